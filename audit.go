@@ -0,0 +1,91 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// AuditSeqKey holds the sequence number of Audit entries
+const AuditSeqKey = "auditSeq"
+
+// auditMarker tells audit entries from the others
+type auditMarker struct{}
+
+// Audit logs a message with k-v pairs at INFO regardless of the level, and
+// writes it to audit_output as well. Each entry is numbered by AuditSeqKey
+// without gaps, so that missing entries can be detected
+//go:noinline
+func Audit(msg string, kv ...interface{}) {
+	klogger.sugar.Desugar().Info(msg, klogger.auditFields(kv)...)
+}
+
+// Audit logs a message with k-v pairs and writes it to audit_output as well
+//go:noinline
+func (k *Klogger) Audit(msg string, kv ...interface{}) {
+	k.sugar.Desugar().Info(msg, k.auditFields(kv)...)
+}
+
+// auditFields appends the next sequence number to kv
+func (k *Klogger) auditFields(kv []interface{}) []zap.Field {
+	seq := atomic.AddUint64(&k.config.stats.auditSeq, 1)
+	return append(k.sweetenFields(kv), zap.Field{
+		Key:       AuditSeqKey,
+		Type:      zapcore.Uint64Type,
+		Integer:   int64(seq),
+		Interface: auditMarker{},
+	})
+}
+
+// openAudit opens audit_output and returns the core writing audit entries
+func (c *Config) openAudit() (zapcore.Core, error) {
+	sink, err := c.sinks.open(c.auditPaths.get()...)
+	if err != nil {
+		return nil, err
+	}
+	enc := zapcore.NewJSONEncoder(c.zapConfig.EncoderConfig)
+	return &auditCore{zapcore.NewCore(enc, sink, zapcore.DebugLevel)}, nil
+}
+
+// auditCore only writes audit entries
+type auditCore struct {
+	zapcore.Core
+}
+
+// With implements zapcore.Core
+func (a *auditCore) With(fields []zapcore.Field) zapcore.Core {
+	return &auditCore{a.Core.With(fields)}
+}
+
+// Check implements zapcore.Core, fields are not known yet
+func (a *auditCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if a.Enabled(ent.Level) {
+		return ce.AddCore(ent, a)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (a *auditCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if _, ok := fields[i].Interface.(auditMarker); ok {
+			return a.Core.Write(ent, fields)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestAudit(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	auditPath := filepath.Join(filepath.Dir(path), "audit.log")
+	k.config.auditPaths.set([]string{auditPath})
+	rebuild(t, k)
+	defer swapLogger(k)()
+
+	Audit("login", "user", "alice")
+	Info("normal")
+	k.WithFields("req", 1).Audit("config changed")
+	k.Audit("logout")
+	if err := Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	normal := readLines(t, path)
+	audit := readLines(t, auditPath)
+	if len(normal) != 4 || len(audit) != 3 {
+		t.Fatalf("unexpected outputs:\n%v\n%v", normal, audit)
+	}
+	for i, msg := range []string{"login", "config changed", "logout"} {
+		entry := audit[i]
+		if entry["msg"] != msg || entry[AuditSeqKey] != float64(i+1) {
+			t.Errorf("unexpected audit entry %v", entry)
+		}
+		if caller, _ := entry["caller"].(string); !strings.Contains(caller, "audit_test.go") {
+			t.Errorf("unexpected caller %s", caller)
+		}
+	}
+	if audit[1]["req"] != float64(1) || audit[0]["user"] != "alice" {
+		t.Errorf("fields are lost: %v", audit)
+	}
+	if normal[2]["msg"] != "config changed" || normal[2][AuditSeqKey] != float64(2) {
+		t.Errorf("audit entries should be in the normal output: %v", normal[2])
+	}
+}
+
+// readLines decodes the JSON lines of a file
+func readLines(t *testing.T, path string) []map[string]interface{} {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return decodeLines(t, bytes.NewBuffer(b))
+}
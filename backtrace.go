@@ -0,0 +1,153 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// traceLocation is a file:line of log_backtrace_at
+type traceLocation struct {
+	file string
+	line int
+}
+
+// traceLocations implements pflag.Value for log_backtrace_at
+type traceLocations []traceLocation
+
+// String implements pflag.Value
+func (t *traceLocations) String() string {
+	locs := make([]string, 0, len(*t))
+	for _, loc := range *t {
+		locs = append(locs, loc.file+":"+strconv.Itoa(loc.line))
+	}
+	return strings.Join(locs, ",")
+}
+
+// Set implements pflag.Value, accepting comma separated file:line
+func (t *traceLocations) Set(s string) error {
+	var locs traceLocations
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		i := strings.LastIndex(part, ":")
+		if i <= 0 {
+			return fmt.Errorf("invalid backtrace location %q: expect file:line", part)
+		}
+		line, err := strconv.Atoi(part[i+1:])
+		if err != nil || line <= 0 {
+			return fmt.Errorf("invalid backtrace location %q: expect file:line", part)
+		}
+		locs = append(locs, traceLocation{file: filepath.Base(part[:i]), line: line})
+	}
+	*t = locs
+	return nil
+}
+
+// Type implements pflag.Value
+func (t *traceLocations) Type() string {
+	return "traceLocations"
+}
+
+// traceValue is an atomic traceLocations implementing pflag.Value
+type traceValue struct {
+	v atomic.Value
+}
+
+// get returns the locations
+func (t *traceValue) get() traceLocations {
+	locs, _ := t.v.Load().(traceLocations)
+	return locs
+}
+
+// String implements pflag.Value
+func (t *traceValue) String() string {
+	locs := t.get()
+	return locs.String()
+}
+
+// Set implements pflag.Value
+func (t *traceValue) Set(s string) error {
+	var locs traceLocations
+	if err := locs.Set(s); err != nil {
+		return err
+	}
+	t.v.Store(locs)
+	return nil
+}
+
+// Type implements pflag.Value
+func (t *traceValue) Type() string {
+	return "traceLocations"
+}
+
+// match reports whether the caller is one of t
+func (t traceLocations) match(caller zapcore.EntryCaller) bool {
+	if !caller.Defined {
+		return false
+	}
+	for _, loc := range t {
+		if loc.line == caller.Line && loc.file == filepath.Base(caller.File) {
+			return true
+		}
+	}
+	return false
+}
+
+// backtraceCore attaches the stack to entries logged at log_backtrace_at
+// It wraps the innermost core, where the caller of the entry is known
+type backtraceCore struct {
+	zapcore.Core
+	locs traceLocations
+}
+
+// newBacktraceCore returns core itself if there is no location
+func newBacktraceCore(core zapcore.Core, locs traceLocations) zapcore.Core {
+	if len(locs) == 0 {
+		return core
+	}
+	return &backtraceCore{Core: core, locs: append(traceLocations(nil), locs...)}
+}
+
+// With implements zapcore.Core
+func (b *backtraceCore) With(fields []zapcore.Field) zapcore.Core {
+	return &backtraceCore{Core: b.Core.With(fields), locs: b.locs}
+}
+
+// Check implements zapcore.Core
+func (b *backtraceCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if b.Enabled(ent.Level) {
+		return ce.AddCore(ent, b)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (b *backtraceCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if ent.Stack == "" && b.locs.match(ent.Caller) {
+		buf := make([]byte, 64<<10)
+		ent.Stack = string(buf[:runtime.Stack(buf, false)])
+	}
+	return b.Core.Write(ent, fields)
+}
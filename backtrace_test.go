@@ -0,0 +1,73 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestBacktraceAt(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	_, file, line, _ := runtime.Caller(0)
+	var locs traceLocations
+	if err := locs.Set(fmt.Sprintf("other.go:1, %s:%d", file, line+10)); err != nil {
+		t.Fatal(err)
+	}
+	k.sugar = k.sugar.Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return newBacktraceCore(core, locs)
+	})).Sugar()
+
+	Infof("before")
+	Infof("traced") // line+10
+	k.WithFields("A", 1).Info("after")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 3 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	for _, e := range entries {
+		stack, _ := e["stacktrace"].(string)
+		if traced := e["msg"] == "traced"; traced != strings.Contains(stack, "TestBacktraceAt") {
+			t.Errorf("stack should be attached only to the traced entry: %v", e)
+		}
+	}
+}
+
+func TestTraceLocationsSet(t *testing.T) {
+	var locs traceLocations
+	if err := locs.Set("a/b.go:12,c.go:3"); err != nil {
+		t.Fatal(err)
+	}
+	if s := locs.String(); s != "b.go:12,c.go:3" {
+		t.Errorf("unexpected locations %s", s)
+	}
+	for _, s := range []string{"b.go", "b.go:x", ":1", "b.go:0"} {
+		if err := locs.Set(s); err == nil {
+			t.Errorf("expect error for %q", s)
+		}
+	}
+	core := zapcore.NewNopCore()
+	if newBacktraceCore(core, nil) != core {
+		t.Error("core should not be wrapped without locations")
+	}
+}
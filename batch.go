@@ -0,0 +1,164 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sync"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultBatchSize is the number of entries a Batch holds before it's
+// flushed automatically
+const DefaultBatchSize = 1024
+
+// Batch collects entries and writes them at once on Flush, which saves a
+// write per entry for file and network outputs
+// Entries are checked when added, so that their time and caller are kept,
+// and disabled ones cost nothing. A Batch is not safe for concurrent use
+type Batch struct {
+	logger  *Klogger
+	size    int
+	entries []batchEntry
+	err     error
+}
+
+// batchEntry is a checked entry waiting for Flush
+type batchEntry struct {
+	ce     *zapcore.CheckedEntry
+	fields []zap.Field
+}
+
+// Batch returns an empty batch writing to k
+func (k *Klogger) Batch() *Batch {
+	return &Batch{logger: k, size: DefaultBatchSize}
+}
+
+// Add appends an entry logged like InfoS if level is 0, or like
+// V(level).InfoS otherwise. The batch is flushed once it holds
+// DefaultBatchSize entries, whose error is returned by the next Flush
+func (b *Batch) Add(level Level, msg string, fields ...zap.Field) {
+	lvl := zapcore.InfoLevel
+	if level > 0 {
+		v := b.logger.V(level)
+		if !v.enabled {
+			return
+		}
+		lvl, fields = v.entry(fields)
+	}
+	ce := b.logger.sugar.Desugar().Check(lvl, msg)
+	if ce == nil {
+		return
+	}
+	b.entries = append(b.entries, batchEntry{ce: ce, fields: fields})
+	if len(b.entries) >= b.size {
+		b.err = multierr.Append(b.err, b.write())
+	}
+}
+
+// Len returns the number of entries not flushed yet
+func (b *Batch) Len() int {
+	return len(b.entries)
+}
+
+// Flush writes the pending entries with a write per output, and returns the
+// errors of writing, including those of automatic flushes
+func (b *Batch) Flush() error {
+	err := multierr.Append(b.err, b.write())
+	b.err = nil
+	return err
+}
+
+// write encodes the entries into the buffers of the outputs and writes them
+func (b *Batch) write() error {
+	if len(b.entries) == 0 {
+		return nil
+	}
+	batch := &b.logger.config.batch
+	batch.begin()
+	for i, e := range b.entries {
+		e.ce.Write(e.fields...)
+		b.entries[i] = batchEntry{}
+	}
+	b.entries = b.entries[:0]
+	return batch.end()
+}
+
+// batchState buffers the writes of the outputs while a Batch is flushed
+// Entries logged by other goroutines meanwhile are buffered as well, so that
+// the order of writes is kept
+type batchState struct {
+	mu      sync.Mutex
+	depth   int
+	pending []*batchSink
+}
+
+// wrap returns a sink buffering writes to ws while a Batch is flushed
+func (s *batchState) wrap(ws zapcore.WriteSyncer) zapcore.WriteSyncer {
+	return &batchSink{state: s, ws: ws}
+}
+
+// begin starts buffering
+func (s *batchState) begin() {
+	s.mu.Lock()
+	s.depth++
+	s.mu.Unlock()
+}
+
+// end writes the buffers once the last Batch is done
+func (s *batchState) end() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.depth--
+	if s.depth > 0 {
+		return nil
+	}
+	var err error
+	for _, sink := range s.pending {
+		_, werr := sink.ws.Write(sink.buf)
+		err = multierr.Append(err, werr)
+		sink.buf = sink.buf[:0]
+	}
+	s.pending = s.pending[:0]
+	return err
+}
+
+// batchSink is an output whose writes are buffered by its batchState
+type batchSink struct {
+	state *batchState
+	ws    zapcore.WriteSyncer
+	buf   []byte
+}
+
+// Write implements zapcore.WriteSyncer
+func (s *batchSink) Write(p []byte) (int, error) {
+	s.state.mu.Lock()
+	defer s.state.mu.Unlock()
+	if s.state.depth == 0 {
+		return s.ws.Write(p)
+	}
+	if len(s.buf) == 0 {
+		s.state.pending = append(s.state.pending, s)
+	}
+	s.buf = append(s.buf, p...)
+	return len(p), nil
+}
+
+// Sync implements zapcore.WriteSyncer
+func (s *batchSink) Sync() error {
+	return s.ws.Sync()
+}
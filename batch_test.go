@@ -0,0 +1,197 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// countingWriter counts the writes into a buffer
+type countingWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func (w *countingWriter) Sync() error {
+	return nil
+}
+
+// newBatchLogger returns a logger whose output is buffered by batches
+func newBatchLogger() (*Klogger, *countingWriter) {
+	w := &countingWriter{}
+	c := newConfig()
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), c.batch.wrap(w), zapcore.DebugLevel)
+	return &Klogger{
+		sugar:  zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1)).Sugar(),
+		config: c,
+	}, w
+}
+
+func TestBatch(t *testing.T) {
+	k, w := newBatchLogger()
+	k.SetLevel(2)
+	b := k.Batch()
+	for i := 0; i < 3; i++ {
+		b.Add(0, "event", zap.Int("i", i))
+	}
+	b.Add(3, "disabled")
+	b.Add(2, "verbose")
+	if b.Len() != 4 || w.writes != 0 {
+		t.Fatalf("expect 4 pending entries and no writes, get %d and %d", b.Len(), w.writes)
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes != 1 {
+		t.Errorf("expect a write per flush, get %d", w.writes)
+	}
+
+	entries := decodeLines(t, &w.Buffer)
+	if len(entries) != 4 {
+		t.Fatalf("expect 4 entries, get %v", entries)
+	}
+	for i, e := range entries[:3] {
+		if e["msg"] != "event" || e["i"] != float64(i) || e["level"] != "info" {
+			t.Errorf("unexpected entry %d: %v", i, e)
+		}
+		if caller, _ := e["caller"].(string); !strings.Contains(caller, "/batch_test.go:") {
+			t.Errorf("expect the caller of Add, get %q", caller)
+		}
+	}
+	if entries[3]["msg"] != "verbose" || entries[3]["level"] != "debug" {
+		t.Errorf("unexpected entry %v", entries[3])
+	}
+
+	if err := b.Flush(); err != nil || w.writes != 1 {
+		t.Errorf("expect nothing to flush, get %v and %d writes", err, w.writes)
+	}
+}
+
+func TestBatchAutoFlush(t *testing.T) {
+	k, w := newBatchLogger()
+	b := k.Batch()
+	for i := 0; i < DefaultBatchSize+1; i++ {
+		b.Add(0, "event", zap.Int("i", i))
+	}
+	if w.writes != 1 || b.Len() != 1 {
+		t.Errorf("expect a full batch to be flushed, get %d writes and %d pending", w.writes, b.Len())
+	}
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	entries := decodeLines(t, &w.Buffer)
+	if len(entries) != DefaultBatchSize+1 {
+		t.Fatalf("expect %d entries, get %d", DefaultBatchSize+1, len(entries))
+	}
+	for i, e := range entries {
+		if e["i"] != float64(i) {
+			t.Fatalf("expect entry %d in order, get %v", i, e)
+		}
+	}
+}
+
+func TestBatchConcurrentWrites(t *testing.T) {
+	k, w := newBatchLogger()
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			b := k.Batch()
+			for i := 0; i < 100; i++ {
+				b.Add(0, "batch", zap.Int("g", g))
+				k.Infof("single %d", i)
+			}
+			if err := b.Flush(); err != nil {
+				t.Error(err)
+			}
+		}(g)
+	}
+	wg.Wait()
+	if entries := decodeLines(t, &w.Buffer); len(entries) != 800 {
+		t.Errorf("expect 800 entries, get %d", len(entries))
+	}
+}
+
+func TestBatchFile(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	b := k.Batch()
+	b.Add(0, "first")
+	b.Add(0, "second")
+	if err := b.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	lines := readLines(t, path)
+	if len(lines) != 2 || lines[0]["msg"] != "first" || lines[1]["msg"] != "second" {
+		t.Errorf("unexpected lines %v", lines)
+	}
+}
+
+func BenchmarkBatch(b *testing.B) {
+	const n = 10000
+	for _, batch := range []bool{false, true} {
+		b.Run(fmt.Sprintf("batch=%v", batch), func(b *testing.B) {
+			dir, err := ioutil.TempDir("", "klog")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			c := newConfig()
+			c.zapConfig = c.newZapConfig()
+			// every entry is written
+			c.sampling.set(samplingRules{})
+			c.zapConfig.OutputPaths = []string{filepath.Join(dir, "klog.log")}
+			zlogger, err := c.build()
+			if err != nil {
+				b.Fatal(err)
+			}
+			k := &Klogger{sugar: zlogger.Sugar(), config: c}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !batch {
+					for j := 0; j < n; j++ {
+						k.InfoS("event", "j", j)
+					}
+					continue
+				}
+				bt := k.Batch()
+				for j := 0; j < n; j++ {
+					bt.Add(0, "event", zap.Int("j", j))
+				}
+				if err := bt.Flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
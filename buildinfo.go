@@ -0,0 +1,96 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"runtime/debug"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// BuildKey holds the build info attached to every entry, see log_build_info
+const BuildKey = "build"
+
+// buildInfo is the version of the program
+type buildInfo struct {
+	version string
+	commit  string
+	date    string
+}
+
+// String joins the non-empty parts
+func (b *buildInfo) String() string {
+	parts := make([]string, 0, 3)
+	for _, s := range []string{b.version, b.commit, b.date} {
+		if s != "" {
+			parts = append(parts, s)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// SetBuildInfo logs the version of the program, and attaches it to every
+// entry if log_build_info is set. Call it before Singleton, or Reconfigure
+// afterwards to attach it. If it's not called, the module version from
+// runtime/debug is used
+//go:noinline
+func SetBuildInfo(version, commit, date string) {
+	b := &buildInfo{version: version, commit: commit, date: date}
+	c := klogger.config
+	c.mu.Lock()
+	c.buildInfo = b
+	c.mu.Unlock()
+	klogger.logBuildInfo(b)
+}
+
+// logBuildInfo logs the build info as a startup entry
+func (k *Klogger) logBuildInfo(b *buildInfo) {
+	if b == nil {
+		return
+	}
+	k.internal().sugar.Desugar().Info("build info",
+		zap.String("version", b.version),
+		zap.String("commit", b.commit),
+		zap.String("date", b.date),
+	)
+}
+
+// readBuildInfo returns the module version of the program, or nil if it's
+// unknown
+func readBuildInfo() *buildInfo {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return nil
+	}
+	return buildInfoOf(info)
+}
+
+// buildInfoOf returns the module version and the vcs.revision of info, the
+// commit is empty if it's not stamped. It's nil if the version is unknown
+func buildInfoOf(info *debug.BuildInfo) *buildInfo {
+	if info.Main.Version == "" {
+		return nil
+	}
+	return &buildInfo{version: info.Main.Version, commit: vcsRevision(info)}
+}
+
+// buildField returns the option attaching the build info to every entry
+func (c *Config) buildField() []zap.Option {
+	if !c.buildInfoField.get() || c.buildInfo == nil {
+		return nil
+	}
+	return []zap.Option{zap.Fields(zap.String(BuildKey, c.buildInfo.String()))}
+}
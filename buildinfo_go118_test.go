@@ -0,0 +1,44 @@
+//go:build go1.18
+// +build go1.18
+
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"runtime/debug"
+	"testing"
+)
+
+func TestBuildInfoOf(t *testing.T) {
+	info := &debug.BuildInfo{
+		Main: debug.Module{Version: "v1.2.3", Sum: "h1:checksum="},
+		Settings: []debug.BuildSetting{
+			{Key: "vcs", Value: "git"},
+			{Key: "vcs.revision", Value: "0123abcd"},
+		},
+	}
+	if b := buildInfoOf(info); b == nil || b.version != "v1.2.3" || b.commit != "0123abcd" {
+		t.Errorf("expect the version and vcs.revision, get %+v", b)
+	}
+
+	info.Settings = info.Settings[:1]
+	if b := buildInfoOf(info); b == nil || b.version != "v1.2.3" || b.commit != "" {
+		t.Errorf("expect no commit without vcs.revision, get %+v", b)
+	}
+	if b := buildInfoOf(&debug.BuildInfo{}); b != nil {
+		t.Errorf("expect nil for an unknown version, get %+v", b)
+	}
+}
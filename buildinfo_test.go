@@ -0,0 +1,70 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"testing"
+)
+
+func TestSetBuildInfo(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	SetBuildInfo("v1.0.0", "abc123", "2020-01-01")
+	entries := decodeLines(t, buf)
+	if len(entries) != 1 {
+		t.Fatalf("expect a startup entry, get %v", entries)
+	}
+	e := entries[0]
+	if e["msg"] != "build info" || e["version"] != "v1.0.0" || e["commit"] != "abc123" || e["date"] != "2020-01-01" {
+		t.Errorf("unexpected entry %v", e)
+	}
+	if k.config.buildInfo.String() != "v1.0.0 abc123 2020-01-01" {
+		t.Errorf("unexpected build info %q", k.config.buildInfo)
+	}
+}
+
+func TestBuildField(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	k.config.buildInfo = &buildInfo{version: "v1.0.0", commit: "abc123"}
+	k.config.buildInfoField.set(true)
+	rebuild(t, k)
+
+	k.Info("first")
+	k.WithFields("A", 1).Info("second")
+	if err := k.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	entries := readLines(t, path)
+	if len(entries) != 2 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	for _, e := range entries {
+		if e[BuildKey] != "v1.0.0 abc123" {
+			t.Errorf("build field is missing: %v", e)
+		}
+	}
+}
+
+func TestBuildFieldDisabled(t *testing.T) {
+	c := newConfig()
+	c.buildInfo = &buildInfo{version: "v1.0.0"}
+	if opts := c.buildField(); len(opts) != 0 {
+		t.Errorf("build field should be disabled by default")
+	}
+	readBuildInfo() // no panic
+}
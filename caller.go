@@ -0,0 +1,136 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// funcCallerEncoder encodes the caller like package/file.go:42 followed by
+// the function name like package.Func
+func funcCallerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+	if !caller.Defined {
+		enc.AppendString("undefined")
+		return
+	}
+	fn := runtime.FuncForPC(caller.PC)
+	if fn == nil {
+		enc.AppendString(caller.TrimmedPath())
+		return
+	}
+	name := fn.Name()
+	// trim the import path of the package
+	if i := strings.LastIndexByte(name, '/'); i >= 0 {
+		name = name[i+1:]
+	}
+	enc.AppendString(caller.TrimmedPath() + " " + name)
+}
+
+// callerHashes maps the callers encoded by hashCallerEncoder from their
+// hashes, see ResolveCaller
+var callerHashes sync.Map
+
+// CallerHash returns the caller logged by log_caller=hash for a caller like
+// package/file.go:42, which is the FNV-1a hash of it in hex. It's the same
+// across builds of the same source, so that tools can map the hashes in log
+// bundles back by hashing the lines of the source
+func CallerHash(caller string) string {
+	const offset64, prime64 = 14695981039346656037, 1099511628211
+	hash := uint64(offset64)
+	for i := 0; i < len(caller); i++ {
+		hash ^= uint64(caller[i])
+		hash *= prime64
+	}
+	s := strconv.FormatUint(hash, 16)
+	return strings.Repeat("0", 16-len(s)) + s
+}
+
+// ResolveCaller returns the caller like package/file.go:42 of a hash logged
+// by log_caller=hash. Besides the callers logged by this process, it knows
+// every line of the running binary, whose table is built on the first miss,
+// and of the binaries added by BuildCallerTable
+func ResolveCaller(hash string) (string, bool) {
+	caller, ok := callerHashes.Load(hash)
+	if !ok {
+		callerTableOnce.Do(func() {
+			BuildCallerTable("")
+		})
+		if caller, ok = callerHashes.Load(hash); !ok {
+			return "", false
+		}
+	}
+	return caller.(string), true
+}
+
+// hashCallerEncoder encodes the caller as CallerHash does, which hides the
+// layout of the source and is shorter
+func hashCallerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+	if !caller.Defined {
+		enc.AppendString("undefined")
+		return
+	}
+	trimmed := caller.TrimmedPath()
+	hash := CallerHash(trimmed)
+	callerHashes.LoadOrStore(hash, trimmed)
+	enc.AppendString(hash)
+}
+
+// baseCallerEncoder encodes the caller like file.go:42, without directories
+func baseCallerEncoder(caller zapcore.EntryCaller, enc zapcore.PrimitiveArrayEncoder) {
+	if !caller.Defined {
+		enc.AppendString("undefined")
+		return
+	}
+	file := caller.File
+	if i := strings.LastIndexByte(file, '/'); i >= 0 {
+		file = file[i+1:]
+	}
+	enc.AppendString(file + ":" + strconv.Itoa(caller.Line))
+}
+
+// validCallerFormat reports whether format is supported by log_caller
+func validCallerFormat(format string) bool {
+	switch format {
+	case "short", "full", "func", "base", "hash", "none":
+		return true
+	}
+	return false
+}
+
+// setCallerFormat applies log_caller to zapConfig, unknown values are short
+func (c *Config) setCallerFormat(zapConfig *zap.Config) {
+	switch c.callerFormat.get() {
+	case "full":
+		zapConfig.EncoderConfig.EncodeCaller = zapcore.FullCallerEncoder
+	case "func":
+		zapConfig.EncoderConfig.EncodeCaller = funcCallerEncoder
+	case "base":
+		zapConfig.EncoderConfig.EncodeCaller = baseCallerEncoder
+	case "hash":
+		zapConfig.EncoderConfig.EncodeCaller = hashCallerEncoder
+	case "none":
+		// the logger of init adds the caller anyway
+		zapConfig.DisableCaller = true
+		zapConfig.EncoderConfig.CallerKey = ""
+	default:
+		zapConfig.EncoderConfig.EncodeCaller = zapcore.ShortCallerEncoder
+	}
+}
@@ -0,0 +1,251 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestCallerFormat(t *testing.T) {
+	_, file, _, _ := runtime.Caller(0)
+	short := filepath.Base(filepath.Dir(file)) + "/caller_test.go:"
+	for format, expect := range map[string]string{
+		"short": short,
+		"full":  file + ":",
+		"func":  short,
+		"base":  "caller_test.go:",
+		"none":  "",
+	} {
+		k, path := newFileLogger(t)
+		k.config.callerFormat.set(format)
+		k.config.zapConfig = k.config.newZapConfig()
+		k.config.zapConfig.OutputPaths = []string{path}
+		rebuild(t, k)
+
+		_, _, line, _ := runtime.Caller(0)
+		k.Infof("caller")
+		k.sugar.Sync()
+
+		if expect != "" {
+			expect += strconv.Itoa(line + 1)
+		}
+		if format == "func" {
+			expect += " klog.TestCallerFormat"
+		}
+		entries := readLines(t, path)
+		caller, _ := entries[len(entries)-1]["caller"].(string)
+		if caller != expect {
+			t.Errorf("expect %q for %s, get %q", expect, format, caller)
+		}
+		removeDir(path)
+	}
+}
+
+func TestCallerHash(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	k.config.callerFormat.set("hash")
+	k.config.zapConfig = k.config.newZapConfig()
+	k.config.zapConfig.OutputPaths = []string{path}
+	rebuild(t, k)
+
+	_, file, line, _ := runtime.Caller(0)
+	k.Infof("caller")
+	k.sugar.Sync()
+
+	caller := filepath.Base(filepath.Dir(file)) + "/caller_test.go:" + strconv.Itoa(line+1)
+	entries := readLines(t, path)
+	hash, _ := entries[len(entries)-1]["caller"].(string)
+	if hash != CallerHash(caller) || len(hash) != 16 {
+		t.Errorf("expect the hash of %s, get %q", caller, hash)
+	}
+	if resolved, ok := ResolveCaller(hash); !ok || resolved != caller {
+		t.Errorf("expect %s resolved, get %q", caller, resolved)
+	}
+	if _, ok := ResolveCaller("0123456789abcdef"); ok {
+		t.Error("expect unknown hashes unresolved")
+	}
+	// the same across builds
+	if h := CallerHash("klog/klog.go:42"); h != "310d6b47ec69ec14" {
+		t.Errorf("expect a stable hash, get %s", h)
+	}
+}
+
+func TestResolveCallerNeverLogged(t *testing.T) {
+	if err := BuildCallerTable(os.Args[0]); err != nil {
+		t.Fatal(err)
+	}
+	// no entry is logged here
+	_, file, line, _ := runtime.Caller(0)
+	caller := filepath.Base(filepath.Dir(file)) + "/caller_test.go:" + strconv.Itoa(line)
+	if resolved, ok := ResolveCaller(CallerHash(caller)); !ok || resolved != caller {
+		t.Errorf("expect %s resolved from the binary, get %q", caller, resolved)
+	}
+	if err := BuildCallerTable(filepath.Join(os.TempDir(), "nonexistent-binary")); err == nil {
+		t.Error("expect error of a missing binary")
+	}
+}
+
+func TestCallerOfEachPath(t *testing.T) {
+	defer ResetOnce()
+	SetExitFunc(func(int) {})
+	defer SetExitFunc(nil)
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer swapLogger(k)()
+	k.config.level.set(1)
+
+	paths := map[string]func(){
+		"Info":            func() { Info("x") },
+		"Infof":           func() { Infof("x") },
+		"Infoln":          func() { Infoln("x") },
+		"InfoS":           func() { InfoS("x") },
+		"Infow":           func() { Infow("x") },
+		"InfoDepth":       func() { InfoDepth(0, "x") },
+		"Warning":         func() { Warning("x") },
+		"Warningf":        func() { Warningf("x") },
+		"WarningDepth":    func() { WarningDepth(0, "x") },
+		"Errorf":          func() { Errorf("x") },
+		"ErrorS":          func() { ErrorS(nil, "x") },
+		"ErrorDepth":      func() { ErrorDepth(0, "x") },
+		"Exitf":           func() { Exitf("x") },
+		"Fatalf":          func() { Fatalf("x") },
+		"FatalDepth":      func() { FatalDepth(0, "x") },
+		"Panicf":          func() { catchPanic(func() { Panicf("x") }) },
+		"k.Info":          func() { k.Info("x") },
+		"k.Infof":         func() { k.Infof("x") },
+		"k.InfoS":         func() { k.InfoS("x") },
+		"k.InfoDepth":     func() { k.InfoDepth(0, "x") },
+		"k.Warningw":      func() { k.Warningw("x") },
+		"k.Errorw":        func() { k.Errorw("x") },
+		"k.Exitw":         func() { k.Exitw("x") },
+		"k.Fatalw":        func() { k.Fatalw("x") },
+		"k.Print":         func() { k.Print("x") },
+		"Printf":          func() { Printf("x") },
+		"Infos":           func() { Infos("x") },
+		"Event":           func() { Event("x") },
+		"WarnOnce":        func() { WarnOnce("x") },
+		"k.ErrorOnce":     func() { k.ErrorOnce("x") },
+		"V.Info":          func() { V(1).Info("x") },
+		"V.Infof":         func() { V(1).Infof("x") },
+		"V.InfoS":         func() { V(1).InfoS("x") },
+		"V.Infoln":        func() { k.V(1).Infoln("x") },
+		"V.InfoFn":        func() { k.V(1).InfoFn(func() (string, []interface{}) { return "x", nil }) },
+		"V.InfofDepth":    func() { V(1).InfofDepth(0, "x") },
+		"V.Event":         func() { V(1).Event("x") },
+		"Check":           func() { Check(1).Write("x") },
+		"WithFields":      func() { WithFields("a", 1).Info("x") },
+		"With":            func() { With(map[string]int{"a": 1}).Warning("x") },
+		"WithAll":         func() { WithAll(struct{ A int }{1}).Infof("x") },
+		"WithNamespace":   func() { k.WithNamespace("ns").InfoS("x") },
+		"WithZapFields":   func() { k.WithZapFields(Int("a", 1)).Infos("x") },
+		"WithVerbosity":   func() { k.WithVerbosity(3).V(3).Info("x") },
+		"WithMinSeverity": func() { k.WithMinSeverity(zapcore.WarnLevel).Warning("x") },
+		"WithFingerprint": func() { k.WithFingerprint("f").Errorf("x") },
+		"Named":           func() { k.Named("n").Info("x") },
+		"WithFields.V":    func() { k.WithFields("a", 1).V(1).Infof("x") },
+		"WithFields.With": func() { k.WithFields("a", 1).With(map[string]int{"b": 2}).Errorw("x") },
+	}
+	for name, fn := range map[string]func(int){
+		"InfoDepth":      func(depth int) { InfoDepth(depth, "x") },
+		"k.WarningDepth": func(depth int) { k.WarningDepth(depth, "x") },
+		"ErrorDepth":     func(depth int) { ErrorDepth(depth, "x") },
+		"V.InfoSDepth":   func(depth int) { V(1).InfoSDepth(depth, "x") },
+	} {
+		log := fn
+		paths[name+"(2)"] = func() { logAtDepth(log) }
+	}
+	for name, fn := range paths {
+		fn()
+		entries := readLines(t, path)
+		if len(entries) == 0 {
+			t.Errorf("%s: no entries", name)
+			continue
+		}
+		// the last but the summaries of exiting
+		caller := ""
+		for i := len(entries) - 1; i >= 0; i-- {
+			if entries[i]["msg"] == "x" {
+				caller, _ = entries[i]["caller"].(string)
+				break
+			}
+		}
+		if strings.HasSuffix(name, "(2)") {
+			if caller != logAtDepthCaller {
+				t.Errorf("%s: expect the caller %q, get %q", name, logAtDepthCaller, caller)
+			}
+		} else if !strings.HasSuffix(strings.Split(caller, ":")[0], "/caller_test.go") {
+			t.Errorf("%s: expect the caller in caller_test.go, get %q", name, caller)
+		}
+		ResetOnce()
+		os.Truncate(path, 0)
+	}
+
+	// the entries of klog itself have no caller, rather than a file of klog
+	internal := map[string]func(){
+		"shutting down": func() { FlushOnSignal(context.Background(), os.Interrupt) },
+		"repeated entries logged once": func() {
+			WarnOnce("x")
+			WarnOnce("x")
+			k.LogOnceSummary()
+		},
+		"duplicate key in WithFields": func() {
+			k.config.strictFields.set(true)
+			defer k.config.strictFields.set(false)
+			k.WithFields("a", 1, "a", 2)
+		},
+		"level out of range": func() {
+			k.config.development.set(true)
+			defer k.config.development.set(false)
+			catchPanic(func() { SetLevel(-1) })
+		},
+	}
+	for msg, fn := range internal {
+		fn()
+		found := false
+		for _, entry := range readLines(t, path) {
+			if entry["msg"] != msg {
+				continue
+			}
+			found = true
+			if caller, ok := entry["caller"]; ok {
+				t.Errorf("%s: expect no caller, get %v", msg, caller)
+			}
+		}
+		if !found {
+			t.Errorf("%s: no entries", msg)
+		}
+		ResetOnce()
+		os.Truncate(path, 0)
+	}
+}
+
+// logAtDepthCaller is the caller of logAtDepth
+var logAtDepthCaller string
+
+// logAtDepth calls log at depth 2, which skips log and logAtDepth
+func logAtDepth(log func(depth int)) {
+	_, file, line, _ := runtime.Caller(1)
+	logAtDepthCaller = filepath.Base(filepath.Dir(file)) + "/caller_test.go:" + strconv.Itoa(line)
+	log(2)
+}
@@ -0,0 +1,238 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// magics of the pcln tables of Go 1.16, 1.18, and 1.20 and later
+const (
+	pclnMagic116 = 0xfffffffa
+	pclnMagic118 = 0xfffffff0
+	pclnMagic120 = 0xfffffff1
+)
+
+// callerTableOnce builds the table of the running binary on the first miss
+// of ResolveCaller
+var callerTableOnce sync.Once
+
+// BuildCallerTable adds every line of the code of the binary at path to the
+// table of ResolveCaller, so that the hashes logged by other processes of
+// the binary are resolved. An empty path means the running binary, whose
+// table is built on the first hash ResolveCaller misses anyway. The lines
+// are read from the pcln table kept by the runtime, which stripped binaries
+// keep as well, of binaries built by Go 1.16 and later
+func BuildCallerTable(path string) error {
+	if path == "" {
+		exe, err := os.Executable()
+		if err != nil {
+			return err
+		}
+		path = exe
+	}
+	data, err := readPclntab(path)
+	if err != nil {
+		return err
+	}
+	return addPclnCallers(data)
+}
+
+// addPclnCallers decodes the file and line of each instruction in the pcln
+// table, and adds them to the table of ResolveCaller
+func addPclnCallers(data []byte) (err error) {
+	defer func() {
+		// a malformed table is sliced out of range
+		if r := recover(); r != nil {
+			err = fmt.Errorf("klog: malformed pcln table: %v", r)
+		}
+	}()
+	if len(data) < 16 || data[4] != 0 || data[5] != 0 {
+		return errors.New("klog: invalid pcln table")
+	}
+	var order binary.ByteOrder = binary.LittleEndian
+	magic := order.Uint32(data)
+	if magic != pclnMagic116 && magic != pclnMagic118 && magic != pclnMagic120 {
+		order = binary.BigEndian
+		magic = order.Uint32(data)
+	}
+	quantum, ptrSize := uint32(data[6]), int(data[7])
+	word := func(b []byte) int {
+		if ptrSize == 4 {
+			return int(order.Uint32(b))
+		}
+		return int(order.Uint64(b))
+	}
+	header := func(i int) int {
+		return word(data[8+i*ptrSize:])
+	}
+
+	// the offsets in the header, and the size of the fields of functab and
+	// of the entry of _func, which are uintptr before 1.18
+	var nfunc, cutab, filetab, pctab, functab, fieldSize, entrySize int
+	switch magic {
+	case pclnMagic118, pclnMagic120:
+		nfunc, cutab, filetab, pctab, functab = header(0), header(4), header(5), header(6), header(7)
+		fieldSize, entrySize = 4, 4
+	case pclnMagic116:
+		nfunc, cutab, filetab, pctab, functab = header(0), header(3), header(4), header(5), header(6)
+		fieldSize, entrySize = ptrSize, ptrSize
+	default:
+		return fmt.Errorf("klog: unsupported pcln table %#x", magic)
+	}
+
+	field := func(b []byte) int {
+		if fieldSize == 4 {
+			return int(order.Uint32(b))
+		}
+		return word(b)
+	}
+	fileNames := make(map[uint32]string)
+	for i := 0; i < nfunc; i++ {
+		funcOff := field(data[functab+(2*i+1)*fieldSize:])
+		fn := data[functab+funcOff:]
+		// pcsp, pcfile, pcln, npcdata and cuOffset follow entry, nameOff,
+		// args and deferreturn
+		pcfile := order.Uint32(fn[entrySize+16:])
+		pcln := order.Uint32(fn[entrySize+20:])
+		cuOffset := order.Uint32(fn[entrySize+28:])
+		if pcfile == 0 || pcln == 0 {
+			continue
+		}
+		files := decodePcvalue(data[pctab+int(pcfile):], quantum)
+		lines := decodePcvalue(data[pctab+int(pcln):], quantum)
+		for f, l := 0, 0; f < len(files) && l < len(lines); {
+			fileno, line := files[f].value, lines[l].value
+			if fileno >= 0 && line > 0 {
+				off := order.Uint32(data[cutab+4*(int(cuOffset)+int(fileno)):])
+				name, ok := fileNames[off]
+				if !ok && off != ^uint32(0) {
+					b := data[filetab+int(off):]
+					name = string(b[:bytes.IndexByte(b, 0)])
+					fileNames[off] = name
+				}
+				if name != "" {
+					caller := zapcore.EntryCaller{Defined: true, File: name, Line: int(line)}
+					trimmed := caller.TrimmedPath()
+					callerHashes.LoadOrStore(CallerHash(trimmed), trimmed)
+				}
+			}
+			// move on from the run ending first
+			switch {
+			case files[f].end < lines[l].end:
+				f++
+			case files[f].end > lines[l].end:
+				l++
+			default:
+				f++
+				l++
+			}
+		}
+	}
+	return nil
+}
+
+// pcRun is a value of a pcvalue table up to the pc offset end
+type pcRun struct {
+	value int32
+	end   uint32
+}
+
+// decodePcvalue decodes a pcvalue table, whose entries are the zigzag delta
+// of the value and the delta of the pc in quanta, until a zero delta
+func decodePcvalue(b []byte, quantum uint32) []pcRun {
+	var runs []pcRun
+	value, pc := int32(-1), uint32(0)
+	for first := true; ; first = false {
+		uvdelta, n := binary.Uvarint(b)
+		if n <= 0 || uvdelta == 0 && !first {
+			return runs
+		}
+		b = b[n:]
+		if uvdelta&1 != 0 {
+			uvdelta = ^(uvdelta >> 1)
+		} else {
+			uvdelta >>= 1
+		}
+		value += int32(uvdelta)
+		pcdelta, n := binary.Uvarint(b)
+		if n <= 0 {
+			return runs
+		}
+		b = b[n:]
+		pc += uint32(pcdelta) * quantum
+		runs = append(runs, pcRun{value: value, end: pc})
+	}
+}
+
+// readPclntab returns the pcln table of an ELF, Mach-O or PE binary
+func readPclntab(path string) ([]byte, error) {
+	if f, err := elf.Open(path); err == nil {
+		defer f.Close()
+		if s := f.Section(".gopclntab"); s != nil {
+			return s.Data()
+		}
+		if s := f.Section(".data.rel.ro.gopclntab"); s != nil {
+			return s.Data()
+		}
+		return nil, errors.New("klog: no pcln table in " + path)
+	}
+	if f, err := macho.Open(path); err == nil {
+		defer f.Close()
+		if s := f.Section("__gopclntab"); s != nil {
+			return s.Data()
+		}
+		return nil, errors.New("klog: no pcln table in " + path)
+	}
+	if f, err := pe.Open(path); err == nil {
+		defer f.Close()
+		return readPESymbols(f, "runtime.pclntab", "runtime.epclntab")
+	}
+	return nil, errors.New("klog: unknown format of binary " + path)
+}
+
+// readPESymbols returns the data of a PE binary between two symbols
+func readPESymbols(f *pe.File, start, end string) ([]byte, error) {
+	var from, to *pe.Symbol
+	for _, s := range f.Symbols {
+		switch s.Name {
+		case start:
+			from = s
+		case end:
+			to = s
+		}
+	}
+	if from == nil || to == nil || from.SectionNumber != to.SectionNumber || from.SectionNumber < 1 || int(from.SectionNumber) > len(f.Sections) {
+		return nil, errors.New("klog: no pcln table in the binary")
+	}
+	data, err := f.Sections[from.SectionNumber-1].Data()
+	if err != nil {
+		return nil, err
+	}
+	if from.Value > to.Value || int(to.Value) > len(data) {
+		return nil, errors.New("klog: malformed pcln table in the binary")
+	}
+	return data[from.Value:to.Value], nil
+}
@@ -0,0 +1,56 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"go.uber.org/zap"
+)
+
+// Checked is a V() entry which will be written, see Check
+type Checked struct {
+	v Verbose
+}
+
+// Check returns nil if V(level) is disabled, otherwise an entry to write
+// It's the fast path for hot code like zap.Logger.Check, nothing is allocated
+// or evaluated for disabled levels if Write is called inside `if ce != nil`
+// Unlike V(), entries skipped by Check are not kept by recent_entries
+func Check(level Level) *Checked {
+	return klogger.Check(level)
+}
+
+// Check returns nil if V(level) of k is disabled, otherwise an entry to write
+func (k *Klogger) Check(level Level) *Checked {
+	if !k.vEnabled(level) {
+		return nil
+	}
+	return &Checked{v: k.V(level)}
+}
+
+// Enabled reports whether the entry will be written, false for nil
+func (c *Checked) Enabled() bool {
+	return c != nil
+}
+
+// Write logs the entry, and does nothing for nil
+func (c *Checked) Write(msg string, fields ...zap.Field) {
+	if c == nil {
+		return
+	}
+	lvl, fields := c.v.entry(fields)
+	if ce := c.v.logger.sugar.Desugar().Check(lvl, msg); ce != nil {
+		ce.Write(fields...)
+	}
+}
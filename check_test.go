@@ -0,0 +1,85 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestCheck(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	SetLevel(2)
+	k.config.vField.set(true)
+
+	if ce := Check(3); ce != nil || ce.Enabled() {
+		t.Error("V(3) should be disabled")
+	}
+	Check(3).Write("no-op")
+	if ce := Check(2); ce.Enabled() {
+		ce.Write("checked", zap.Int("n", 1))
+	}
+	k.WithVerbosity(3).Check(3).Write("verbosity")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 entries, get %v", entries)
+	}
+	e := entries[0]
+	if e["msg"] != "checked" || e["level"] != "debug" || e["n"] != float64(1) || e["v"] != float64(2) {
+		t.Errorf("unexpected entry %v", e)
+	}
+	if caller, _ := e["caller"].(string); !strings.Contains(caller, "check_test.go") {
+		t.Errorf("unexpected caller %s", caller)
+	}
+	if entries[1]["msg"] != "verbosity" {
+		t.Errorf("unexpected entry %v", entries[1])
+	}
+}
+
+func TestCheckNoAlloc(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+
+	n := testing.AllocsPerRun(100, func() {
+		if ce := Check(5); ce != nil {
+			ce.Write("msg", zap.Int("n", 1))
+		}
+	})
+	if n != 0 {
+		t.Errorf("disabled Check should not allocate, get %v", n)
+	}
+}
+
+func BenchmarkCheckDisabled(b *testing.B) {
+	Singleton()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if ce := Check(MaxLevel); ce != nil {
+			ce.Write("world", zap.Int("i", i))
+		}
+	}
+}
+
+func BenchmarkInfofDisabled(b *testing.B) {
+	Singleton()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		V(MaxLevel).Infof("world %d", i)
+	}
+}
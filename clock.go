@@ -0,0 +1,66 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Clock tells the time of entries, e.g. klogtest.FakeClock
+type Clock interface {
+	Now() time.Time
+}
+
+// clockHolder is stored in atomic.Value, which rejects nil
+type clockHolder struct {
+	clock Clock
+}
+
+// SetClock sets the clock of entries, so that tests can compare the output
+// with golden files. nil restores the system clock
+func SetClock(clock Clock) {
+	klogger.config.clock.Store(clockHolder{clock})
+}
+
+// now returns the time of the clock set by SetClock
+func (c *Config) now() time.Time {
+	if h, ok := c.clock.Load().(clockHolder); ok && h.clock != nil {
+		return h.clock.Now()
+	}
+	return time.Now()
+}
+
+// clockCore sets the time of entries by the clock of the config
+// It wraps the outermost core, so that every output sees the same time
+type clockCore struct {
+	zapcore.Core
+	clock *atomic.Value
+}
+
+// With implements zapcore.Core
+func (c *clockCore) With(fields []zapcore.Field) zapcore.Core {
+	return &clockCore{Core: c.Core.With(fields), clock: c.clock}
+}
+
+// Check implements zapcore.Core
+func (c *clockCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if h, ok := c.clock.Load().(clockHolder); ok && h.clock != nil {
+		ent.Time = h.clock.Now()
+	}
+	return c.Core.Check(ent, ce)
+}
@@ -0,0 +1,53 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/xial-thu/klog/klogtest"
+)
+
+func TestClockGolden(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	k.config.zapConfig.DisableCaller = true
+	k.config.sampling.set(samplingRules{})
+	rebuild(t, k)
+	defer swapLogger(k)()
+
+	clock := klogtest.NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	Infof("first")
+	clock.Add(1500 * time.Millisecond)
+	k.WithFields("n", 1).Warningf("second")
+	Flush()
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile("testdata/clock.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(golden) {
+		t.Errorf("expect\n%s\nget\n%s", golden, got)
+	}
+}
@@ -0,0 +1,232 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"os"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// Color is an ANSI SGR code of the foreground, e.g. 31 for red
+type Color int
+
+// colors of the console format, ColorNone leaves the level uncolored
+const (
+	ColorNone    Color = 0
+	ColorRed     Color = 31
+	ColorGreen   Color = 32
+	ColorYellow  Color = 33
+	ColorBlue    Color = 34
+	ColorMagenta Color = 35
+	ColorCyan    Color = 36
+	ColorWhite   Color = 37
+)
+
+// ColorMode is a value of log_color
+type ColorMode string
+
+const (
+	// ColorAuto colors console entries only when all outputs are terminals
+	ColorAuto ColorMode = "auto"
+	// ColorAlways colors console entries even if they go to files or pipes
+	ColorAlways ColorMode = "always"
+	// ColorNever never colors entries
+	ColorNever ColorMode = "never"
+)
+
+// resetColor ends the color started by the SGR code
+const resetColor = "\x1b[0m"
+
+var colorPool = buffer.NewPool()
+
+// defaultLineColors are the colors unless overridden by WithLineColors
+var defaultLineColors = map[zapcore.Level]Color{
+	zapcore.DebugLevel:  ColorMagenta,
+	zapcore.WarnLevel:   ColorYellow,
+	zapcore.ErrorLevel:  ColorRed,
+	zapcore.DPanicLevel: ColorRed,
+	zapcore.PanicLevel:  ColorRed,
+	zapcore.FatalLevel:  ColorRed,
+}
+
+// colorValue is log_color, one of auto, always and never
+type colorValue struct {
+	stringValue
+}
+
+// Set implements pflag.Value
+func (v *colorValue) Set(mode string) error {
+	switch ColorMode(mode) {
+	case ColorAuto, ColorAlways, ColorNever:
+		v.set(mode)
+		return nil
+	}
+	return fmt.Errorf("invalid log_color %q: expect auto, always or never", mode)
+}
+
+// WithColor sets log_color, whether the console format is colored
+func WithColor(mode ColorMode) Option {
+	return func(c *Config) error {
+		return c.color.Set(string(mode))
+	}
+}
+
+// WithColorWholeLine sets log_color_whole_line, which colors the whole entry
+// including its fields instead of the level only
+func WithColorWholeLine(whole bool) Option {
+	return func(c *Config) error {
+		c.colorWholeLine.set(whole)
+		return nil
+	}
+}
+
+// WithLineColors overrides the colors of the levels, ColorNone leaves the
+// level uncolored. The later one overrides the earlier ones
+func WithLineColors(colors map[zapcore.Level]Color) Option {
+	return func(c *Config) error {
+		merged := make(map[zapcore.Level]Color, len(c.lineColors)+len(colors))
+		for l, color := range c.lineColors {
+			merged[l] = color
+		}
+		for l, color := range colors {
+			merged[l] = color
+		}
+		c.lineColors = merged
+		return nil
+	}
+}
+
+// colorOf returns the color of l, from WithLineColors or the default
+func (c *Config) colorOf(l zapcore.Level) Color {
+	if color, ok := c.lineColors[l]; ok {
+		return color
+	}
+	return defaultLineColors[l]
+}
+
+// colorActive reports whether entries of encoding written to outputs are
+// colored. Only console formats are, and in auto mode only if all the outputs
+// are terminals, so that escape codes never leak into files or pipes
+func (c *Config) colorActive(encoding string, outputs []string) bool {
+	if encoding != "console" && encoding != "dev" {
+		return false
+	}
+	switch ColorMode(c.color.get()) {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if len(outputs) == 0 {
+		return false
+	}
+	for _, path := range outputs {
+		if !isTerminal(path) {
+			return false
+		}
+	}
+	return true
+}
+
+// isTerminal reports whether path is stdout or stderr attached to a terminal
+func isTerminal(path string) bool {
+	var f *os.File
+	switch path {
+	case "stdout":
+		f = os.Stdout
+	case "stderr":
+		f = os.Stderr
+	default:
+		return false
+	}
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// colorEncoderOf returns the encoder of encoding, colored if entries written
+// to outputs are, see colorActive
+func (c *Config) colorEncoderOf(encoding string, outputs []string) zapcore.Encoder {
+	if !c.colorActive(encoding, outputs) {
+		return c.encoderOf(encoding)
+	}
+	if c.colorWholeLine.get() {
+		return &colorEncoder{Encoder: c.encoderOf(encoding), config: c}
+	}
+	encoderConfig := c.zapConfig.EncoderConfig
+	encoderConfig.EncodeLevel = c.colorLevelEncoder(encoderConfig.EncodeLevel)
+	return c.encoderWith(encoding, encoderConfig)
+}
+
+// colorLevelEncoder wraps the level encoded by encode with its color
+func (c *Config) colorLevelEncoder(encode zapcore.LevelEncoder) zapcore.LevelEncoder {
+	if encode == nil {
+		encode = zapcore.LowercaseLevelEncoder
+	}
+	return func(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+		color := c.colorOf(l)
+		if color == ColorNone {
+			encode(l, enc)
+			return
+		}
+		// encode into a slice first, since the console encoder separates
+		// each appended element by tabs
+		m := zapcore.NewMapObjectEncoder()
+		m.AddArray("level", zapcore.ArrayMarshalerFunc(func(arr zapcore.ArrayEncoder) error {
+			encode(l, arr)
+			return nil
+		}))
+		for _, v := range m.Fields["level"].([]interface{}) {
+			enc.AppendString(fmt.Sprintf("\x1b[%dm%v%s", color, v, resetColor))
+		}
+	}
+}
+
+// colorEncoder colors the whole entry encoded by Encoder, fields included
+type colorEncoder struct {
+	zapcore.Encoder
+	config *Config
+}
+
+// Clone implements zapcore.Encoder
+func (e *colorEncoder) Clone() zapcore.Encoder {
+	return &colorEncoder{Encoder: e.Encoder.Clone(), config: e.config}
+}
+
+// EncodeEntry implements zapcore.Encoder, the trailing line ending is kept
+// out of the color
+func (e *colorEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	buf, err := e.Encoder.EncodeEntry(ent, fields)
+	color := e.config.colorOf(ent.Level)
+	if err != nil || color == ColorNone {
+		return buf, err
+	}
+	line := buf.Bytes()
+	n := len(line)
+	for n > 0 && (line[n-1] == '\n' || line[n-1] == '\r') {
+		n--
+	}
+	out := colorPool.Get()
+	out.AppendString("\x1b[")
+	out.AppendInt(int64(color))
+	out.AppendByte('m')
+	out.Write(line[:n])
+	out.AppendString(resetColor)
+	out.Write(line[n:])
+	buf.Free()
+	return out, nil
+}
@@ -0,0 +1,127 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+
+	"github.com/xial-thu/klog/klogtest"
+)
+
+// newColorLogger returns a console file logger without the caller and the
+// stack, set by opts
+func newColorLogger(t *testing.T, opts ...Option) (*Klogger, string) {
+	k, path := newFileLogger(t)
+	if err := k.config.apply(append([]Option{WithFormat(Console)}, opts...)); err != nil {
+		t.Fatal(err)
+	}
+	k.config.sampling.set(samplingRules{})
+	k.config.zapConfig = k.config.newZapConfig()
+	k.config.zapConfig.OutputPaths = []string{path}
+	k.config.zapConfig.DisableCaller = true
+	k.config.zapConfig.DisableStacktrace = true
+	rebuild(t, k)
+	k.config.clock.Store(clockHolder{klogtest.NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))})
+	return k, path
+}
+
+// testColorGolden logs a few entries by k and compares them with the golden
+func testColorGolden(t *testing.T, k *Klogger, path, golden string) {
+	k.Infow("started", "id", 7)
+	k.Warningw("slow", "ms", 120, "path", "/a b")
+	k.Errorw("failed", "err", "boom")
+	k.sugar.Sync()
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("expect\n%q\nget\n%q", want, got)
+	}
+}
+
+func TestColorWholeLineGolden(t *testing.T) {
+	k, path := newColorLogger(t, WithColor(ColorAlways), WithColorWholeLine(true),
+		WithLineColors(map[zapcore.Level]Color{zapcore.InfoLevel: ColorGreen}))
+	defer removeDir(path)
+	testColorGolden(t, k, path, "testdata/color_line.golden")
+}
+
+func TestColorLevelGolden(t *testing.T) {
+	k, path := newColorLogger(t, WithColor(ColorAlways),
+		WithLineColors(map[zapcore.Level]Color{zapcore.WarnLevel: ColorNone}))
+	defer removeDir(path)
+	testColorGolden(t, k, path, "testdata/color_level.golden")
+}
+
+func TestColorAuto(t *testing.T) {
+	// the file output is never a terminal
+	k, path := newColorLogger(t, WithColorWholeLine(true))
+	defer removeDir(path)
+	k.Warning("slow")
+	k.sugar.Sync()
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(got), "\x1b[") {
+		t.Errorf("unexpected escape codes in %q", got)
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	defer w.Close()
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	if k.config.colorActive("console", []string{"stdout"}) {
+		t.Error("expect no color when stdout is a pipe")
+	}
+	if newConfig().colorActive("console", nil) {
+		t.Error("expect no color without outputs")
+	}
+}
+
+func TestColorMode(t *testing.T) {
+	c := newConfig()
+	if err := c.color.Set("sometimes"); err == nil {
+		t.Error("expect error of invalid log_color")
+	}
+	c.color.set(string(ColorAlways))
+	if c.colorActive("json", []string{"stdout"}) {
+		t.Error("expect no color of json")
+	}
+	if !c.colorActive("dev", []string{"/tmp/a.log"}) {
+		t.Error("expect color of dev when always")
+	}
+	c.color.set(string(ColorNever))
+	if c.colorActive("console", []string{"stdout"}) {
+		t.Error("expect no color when never")
+	}
+}
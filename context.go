@@ -0,0 +1,60 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+)
+
+// contextKey is the key of the logger stored in a context
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying k
+func NewContext(ctx context.Context, k *Klogger) context.Context {
+	return context.WithValue(ctx, contextKey{}, k)
+}
+
+// FromContext returns the logger carried by ctx, or the global logger. The
+// global one logs the trace ID carried by ctx if there is
+func FromContext(ctx context.Context) *Klogger {
+	if ctx != nil {
+		if k, ok := ctx.Value(contextKey{}).(*Klogger); ok {
+			return k
+		}
+		if id := TraceIDFromContext(ctx); id != "" {
+			return klogger.WithZapFields(zap.String(TraceIDKey, id))
+		}
+	}
+	return klogger
+}
+
+// WithVerbosity returns a logger whose V() is enabled up to level, even if
+// the global level is lower
+func WithVerbosity(level Level) *Klogger {
+	return klogger.WithVerbosity(level)
+}
+
+// WithVerbosity returns a logger whose V() is enabled up to level, even if
+// the global level is lower
+func (k *Klogger) WithVerbosity(level Level) *Klogger {
+	if max := k.config.maxLevel.get(); level > max {
+		level = max
+	}
+	child := k.derive(k.sugar)
+	child.verbosity = level
+	return child
+}
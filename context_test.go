@@ -0,0 +1,62 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"testing"
+)
+
+func TestWithVerbosity(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	debug := WithVerbosity(4).WithFields("request", "r1")
+	ctx := NewContext(context.Background(), debug)
+
+	V(4).Info("global")
+	k.V(4).Info("global-method")
+	debug.V(4).Info("derived")
+	debug.V(5).Info("too-verbose")
+	FromContext(ctx).V(4).Infof("from-%s", "context")
+	FromContext(context.Background()).V(4).Info("no-context")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 || entries[0]["msg"] != "derived" || entries[1]["msg"] != "from-context" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	if entries[1]["request"] != "r1" {
+		t.Errorf("fields of the derived logger are lost: %v", entries[1])
+	}
+
+	// the override is layered on top of the global level
+	SetLevel(MaxLevel)
+	V(4).Info("global")
+	WithVerbosity(1).V(3).Info("max")
+	if entries = decodeLines(t, buf); len(entries) != 4 {
+		t.Errorf("global level should win when it's greater: %v", entries)
+	}
+}
+
+func TestVerboseEnabled(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+
+	if !V(0).Enabled() || V(1).Enabled() || !k.WithVerbosity(2).V(2).Enabled() {
+		t.Errorf("unexpected Enabled()")
+	}
+	var v Verbose
+	v.Info("zero value should be a no-op")
+}
@@ -0,0 +1,116 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// WithDeferredFields returns a logger calling fn for each entry written,
+// see Klogger.WithDeferredFields
+func WithDeferredFields(fn func() []interface{}) *Klogger {
+	return klogger.WithDeferredFields(fn)
+}
+
+// WithDeferredFields returns a logger adding the k-v pairs returned by fn to
+// each entry, e.g. "queue_depth", which change between entries. fn is called
+// once per entry written, and never for entries suppressed by level or
+// sampling. The pairs are repaired like WithFields
+func (k *Klogger) WithDeferredFields(fn func() []interface{}) *Klogger {
+	child := k.derive(k.sugar)
+	child.sugar = k.sugar.Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &deferredCore{Core: core, fields: func() []zap.Field { return child.sweetenFields(fn()) }}
+	})).Sugar()
+	return child
+}
+
+// deferredCore adds the fields computed on writing
+// It checks the wrapped core by itself, so that sampling still applies, and
+// writes the entry checked by the wrapped core along with the fields
+type deferredCore struct {
+	zapcore.Core
+	fields func() []zap.Field
+}
+
+// deferredEntry is the entry checked by the wrapped core
+type deferredEntry struct {
+	*deferredCore
+	ce *zapcore.CheckedEntry
+}
+
+// With implements zapcore.Core
+func (c *deferredCore) With(fields []zapcore.Field) zapcore.Core {
+	return &deferredCore{Core: c.Core.With(fields), fields: c.fields}
+}
+
+// Check implements zapcore.Core
+func (c *deferredCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	inner := c.Core.Check(ent, nil)
+	if inner == nil {
+		return ce
+	}
+	return ce.AddCore(ent, deferredEntry{deferredCore: c, ce: inner})
+}
+
+// Write implements zapcore.Core
+// zap fills in the caller and the stack after checking, so they're taken
+// from ent
+func (e deferredEntry) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	e.ce.Entry.Caller, e.ce.Entry.Stack = ent.Caller, ent.Stack
+	e.ce.Write(append(fields[:len(fields):len(fields)], e.fields()...)...)
+	return nil
+}
+
+// lazyCore evaluates the Lazy fields of each entry once, before the tee
+// writes it to each output. It checks the wrapped core like deferredCore
+type lazyCore struct {
+	zapcore.Core
+	errOutput zapcore.WriteSyncer
+}
+
+// lazyEntry is the entry checked by the wrapped core
+type lazyEntry struct {
+	*lazyCore
+	ce *zapcore.CheckedEntry
+}
+
+// With implements zapcore.Core
+func (c *lazyCore) With(fields []zapcore.Field) zapcore.Core {
+	return &lazyCore{Core: c.Core.With(fields), errOutput: c.errOutput}
+}
+
+// Check implements zapcore.Core
+func (c *lazyCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	inner := c.Core.Check(ent, nil)
+	if inner == nil {
+		return ce
+	}
+	return ce.AddCore(ent, lazyEntry{lazyCore: c, ce: inner})
+}
+
+// Write implements zapcore.Core
+func (c *lazyCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.Core.Write(ent, resolveLazy(fields))
+}
+
+// Write implements zapcore.Core, the errors of the outputs go to the error
+// output
+func (e lazyEntry) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	e.ce.Entry.Caller, e.ce.Entry.Stack = ent.Caller, ent.Stack
+	e.ce.ErrorOutput = e.errOutput
+	e.ce.Write(resolveLazy(fields)...)
+	return nil
+}
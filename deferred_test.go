@@ -0,0 +1,55 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestWithDeferredFields(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer swapLogger(k)()
+
+	calls := 0
+	logger := WithDeferredFields(func() []interface{} {
+		calls++
+		return []interface{}{"depth", calls}
+	})
+	logger.Infof("first")
+	logger.WithFields("a", 1).Warningf("second")
+	logger.V(1).Infof("disabled")
+	for i := 0; i < 150; i++ {
+		logger.Infof("sampled")
+	}
+	if calls != 102 {
+		t.Errorf("expect 102 calls for the entries written, get %d", calls)
+	}
+
+	entries := readLines(t, path)
+	if len(entries) != 102 {
+		t.Fatalf("expect 102 entries, get %d", len(entries))
+	}
+	if entries[0]["depth"] != float64(1) || entries[1]["depth"] != float64(2) || entries[1]["a"] != float64(1) {
+		t.Errorf("unexpected entries %v, %v", entries[0], entries[1])
+	}
+	for _, e := range entries {
+		if caller, _ := e["caller"].(string); !strings.Contains(caller, "/deferred_test.go:") {
+			t.Errorf("expect the caller in this file, get %q", caller)
+			break
+		}
+	}
+}
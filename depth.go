@@ -0,0 +1,87 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+// maxCachedDepth is the deepest depth whose logger is cached, deeper ones are
+// built on each call
+const maxCachedDepth = 8
+
+// depthLogger is a logger skipping depth more frames, built from sugar
+type depthLogger struct {
+	sugar  *zap.SugaredLogger
+	logger *zap.Logger
+}
+
+// depthLogger returns the logger of k skipping depth more frames
+// The loggers are cached per depth, and rebuilt when the sugar of k changes
+func (k *Klogger) depthLogger(depth int) *zap.Logger {
+	if depth <= 0 {
+		return k.sugar.Desugar()
+	}
+	sugar := k.sugar
+	if depth > maxCachedDepth {
+		return sugar.Desugar().WithOptions(zap.AddCallerSkip(depth))
+	}
+	if d, ok := k.depths[depth-1].Load().(depthLogger); ok && d.sugar == sugar {
+		return d.logger
+	}
+	logger := sugar.Desugar().WithOptions(zap.AddCallerSkip(depth))
+	k.depths[depth-1].Store(depthLogger{sugar: sugar, logger: logger})
+	return logger
+}
+
+// InfoDepth is Info reporting the caller depth frames above, e.g. for
+// helpers logging on behalf of their callers
+func (v Verbose) InfoDepth(depth int, args ...interface{}) {
+	if v.enabled {
+		lvl, fields := v.entry(nil)
+		if ce := v.logger.depthLogger(depth).Check(lvl, fmt.Sprint(args...)); ce != nil {
+			ce.Write(fields...)
+		}
+	} else if v.recent != nil {
+		v.recent.suppressed(fmt.Sprint(args...), nil)
+	}
+}
+
+// InfofDepth is Infof reporting the caller depth frames above
+func (v Verbose) InfofDepth(depth int, format string, args ...interface{}) {
+	if v.enabled {
+		msg, wrapped := v.logger.sprintf(format, args)
+		lvl, fields := v.entry(wrapped)
+		if ce := v.logger.depthLogger(depth).Check(lvl, msg); ce != nil {
+			ce.Write(fields...)
+		}
+	} else if v.recent != nil {
+		v.recent.suppressed(fmt.Sprintf(format, args...), nil)
+	}
+}
+
+// InfoSDepth is InfoS reporting the caller depth frames above
+func (v Verbose) InfoSDepth(depth int, msg string, kv ...interface{}) {
+	if v.enabled {
+		lvl, fields := v.entry(v.logger.sweetenFields(kv))
+		if ce := v.logger.depthLogger(depth).Check(lvl, msg); ce != nil {
+			ce.Write(fields...)
+		}
+	} else if v.recent != nil {
+		v.recent.suppressed(msg, v.logger.sweetenFields(kv))
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// retry logs its attempts on behalf of the caller of its caller
+func retry(k *Klogger, attempt int) {
+	logAttempt(k, attempt)
+}
+
+// logAttempt is the inner helper of retry
+func logAttempt(k *Klogger, attempt int) {
+	k.V(1).InfoDepth(2, "attempt ", attempt)
+	k.V(1).InfofDepth(2, "attempt %d", attempt)
+	k.V(1).InfoSDepth(2, "attempt", "n", attempt)
+	k.V(2).InfoSDepth(2, "disabled")
+}
+
+func TestVerboseDepth(t *testing.T) {
+	k, buf := newTestLogger()
+	k.config.level.set(1)
+
+	_, _, line, _ := runtime.Caller(0)
+	retry(k, 1)
+	retry(k, 2)
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 6 {
+		t.Fatalf("expect 6 entries, get %v", entries)
+	}
+	for i, e := range entries {
+		caller, _ := e["caller"].(string)
+		if !strings.HasSuffix(caller, "/depth_test.go:"+strconv.Itoa(line+1+i/3)) {
+			t.Errorf("entry %d: expect the caller of retry, get %q", i, caller)
+		}
+		if e["level"] != "debug" {
+			t.Errorf("entry %d: expect V() entries at DEBUG, get %v", i, e)
+		}
+	}
+	if entries[0]["msg"] != "attempt 1" || entries[1]["msg"] != "attempt 1" || entries[5]["n"] != float64(2) {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
+
+func TestDepthLoggerCache(t *testing.T) {
+	k, _ := newTestLogger()
+	if k.depthLogger(3) != k.depthLogger(3) {
+		t.Error("expect the logger cached")
+	}
+	if k.depthLogger(maxCachedDepth+1) == k.depthLogger(maxCachedDepth+1) {
+		t.Error("expect deep loggers uncached")
+	}
+	cached := k.depthLogger(3)
+	other, _ := newTestLogger()
+	k.sugar = other.sugar
+	if k.depthLogger(3) == cached {
+		t.Error("expect the cache rebuilt when the sugar changes")
+	}
+}
@@ -0,0 +1,70 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Desugar returns the underlying zap logger, as an escape hatch
+func Desugar() *zap.Logger {
+	return klogger.Desugar()
+}
+
+// Desugar returns the underlying zap logger, as an escape hatch
+// Entries go through the same cores and sinks as k, and the caller is the
+// one calling the zap logger
+func (k *Klogger) Desugar() *zap.Logger {
+	// undo the skip of the shim
+	return k.sugar.Desugar().WithOptions(zap.AddCallerSkip(-1))
+}
+
+// Core returns the underlying zap core, as an escape hatch
+func Core() zapcore.Core {
+	return klogger.Core()
+}
+
+// Core returns the underlying zap core, as an escape hatch
+func (k *Klogger) Core() zapcore.Core {
+	return k.sugar.Desugar().Core()
+}
+
+// WithOptions returns a child logger with zap options applied
+// The child shares the level and other klog config with k
+func WithOptions(opts ...zap.Option) *Klogger {
+	return klogger.WithOptions(opts...)
+}
+
+// WithOptions returns a child logger with zap options applied
+// The child shares the level and other klog config with k
+func (k *Klogger) WithOptions(opts ...zap.Option) *Klogger {
+	return k.derive(k.sugar.Desugar().WithOptions(opts...).Sugar())
+}
+
+// WithCallerSkip returns a child logger reporting the caller n frames above,
+// so that a wrapper package reports its callers instead of itself
+func WithCallerSkip(n int) *Klogger {
+	return klogger.WithCallerSkip(n)
+}
+
+// WithCallerSkip returns a child logger reporting the caller n frames above,
+// so that a wrapper package reports its callers instead of itself
+// The child shares the level and other klog config with k
+func (k *Klogger) WithCallerSkip(n int) *Klogger {
+	child := k.WithOptions(zap.AddCallerSkip(n))
+	child.callerSkip += n
+	return child
+}
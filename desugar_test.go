@@ -0,0 +1,114 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestDesugar(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+
+	k.Desugar().With(zap.String("lib", "x")).Info("from zap")
+	if err := k.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := string(b)
+	if !strings.Contains(s, `"msg":"from zap"`) || !strings.Contains(s, `"lib":"x"`) {
+		t.Errorf("entry does not reach the sink: %s", s)
+	}
+	if !strings.Contains(s, "desugar_test.go") {
+		t.Errorf("caller should be the test: %s", s)
+	}
+}
+
+func TestCore(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	if !Core().Enabled(zapcore.DebugLevel) {
+		t.Error("core should be the one of the global logger")
+	}
+	zap.New(Core()).Info("raw")
+	if entries := decodeLines(t, buf); len(entries) != 1 || entries[0]["msg"] != "raw" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
+
+func TestWithOptions(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	child := WithOptions(zap.Fields(zap.String("component", "c")))
+	SetLevel(2)
+	child.V(2).Info("hi")
+	entries := decodeLines(t, buf)
+	if len(entries) != 1 || entries[0]["component"] != "c" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+	if child.config != k.config {
+		t.Error("child should share the config")
+	}
+}
+
+// tenantLogger mimics a wrapper package adding fields to every entry
+type tenantLogger struct {
+	k *Klogger
+}
+
+func (l tenantLogger) Infof(format string, args ...interface{}) {
+	l.k.WithFields("tenant", "t").Infof(format, args...)
+}
+
+func (l tenantLogger) Fatalf(format string, args ...interface{}) {
+	l.k.WithFields("tenant", "t").Fatalf(format, args...)
+}
+
+func TestWithCallerSkip(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	SetExitFunc(func(int) {})
+	defer SetExitFunc(nil)
+
+	l := tenantLogger{WithCallerSkip(1)}
+	_, file, line, _ := runtime.Caller(0)
+	l.Infof("info")
+	l.Fatalf("fatal")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	for i, e := range entries {
+		expect := filepath.Base(file) + ":" + strconv.Itoa(line+1+i)
+		if caller, _ := e["caller"].(string); !strings.HasSuffix(caller, expect) || e["tenant"] != "t" {
+			t.Errorf("expect the caller %s, get %v", expect, e)
+		}
+	}
+}
@@ -0,0 +1,188 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// maxEarlyEntries bounds the entries kept before Singleton, the newer ones
+// are dropped and counted
+const maxEarlyEntries = 1000
+
+// earlyEntry is an entry logged before Singleton
+type earlyEntry struct {
+	ent zapcore.Entry
+	// added by With, and by the entry
+	with   []zapcore.Field
+	fields []zapcore.Field
+}
+
+// earlyQueue keeps the entries logged before Singleton, which are replayed
+// into the core built by Singleton, or written to stderr if the process is
+// about to die before that, e.g. on Fatal or Flush
+type earlyQueue struct {
+	mu      sync.Mutex
+	entries []earlyEntry
+	dropped int
+	// set by replay, entries go to it afterwards
+	core zapcore.Core
+	enc  zapcore.Encoder
+}
+
+// newEarlyLogger returns the global logger used before Singleton, whose
+// core is swapped by setup
+func newEarlyLogger() *Klogger {
+	c := newConfig()
+	c.early = &earlyQueue{enc: zapcore.NewJSONEncoder(c.newZapConfig().EncoderConfig)}
+	c.core = newSwapCore(&earlyCore{queue: c.early, level: c.severity.level})
+	return &Klogger{
+		sugar: zap.New(c.core,
+			zap.ErrorOutput(zapcore.Lock(os.Stderr)),
+			zap.AddCaller(),
+			zap.AddCallerSkip(1),
+			zap.AddStacktrace(zapcore.ErrorLevel),
+		).Sugar(),
+		config: c,
+	}
+}
+
+// add queues an entry unless the queue is replayed already, in which case
+// it returns the core to write the entry to
+func (q *earlyQueue) add(e earlyEntry) zapcore.Core {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.core != nil {
+		return q.core
+	}
+	if len(q.entries) < maxEarlyEntries || e.ent.Level > zapcore.ErrorLevel {
+		q.entries = append(q.entries, e)
+	} else {
+		q.dropped++
+	}
+	if e.ent.Level > zapcore.ErrorLevel {
+		// the process may die before Singleton
+		q.flush()
+	}
+	return nil
+}
+
+// flush writes the queued entries to stderr
+func (q *earlyQueue) flush() {
+	for _, e := range q.take() {
+		enc := q.enc.Clone()
+		for _, f := range e.with {
+			f.AddTo(enc)
+		}
+		buf, err := enc.EncodeEntry(e.ent, e.fields)
+		if err != nil {
+			continue
+		}
+		os.Stderr.Write(buf.Bytes())
+		buf.Free()
+	}
+}
+
+// take empties the queue, appending a warning of the dropped entries
+func (q *earlyQueue) take() []earlyEntry {
+	entries := q.entries
+	if q.dropped > 0 {
+		entries = append(entries, earlyEntry{
+			ent: zapcore.Entry{
+				Level:   zapcore.WarnLevel,
+				Time:    time.Now(),
+				Message: "dropped entries logged before Singleton",
+			},
+			fields: []zapcore.Field{zap.Int("dropped", q.dropped)},
+		})
+	}
+	q.entries, q.dropped = nil, 0
+	return entries
+}
+
+// replay writes the queued entries to core, which receives the entries
+// written afterwards as well
+func (q *earlyQueue) replay(core zapcore.Core) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, e := range q.take() {
+		writeTo(core, e)
+	}
+	q.core = core
+}
+
+// writeTo writes e to core if core enables it
+func writeTo(core zapcore.Core, e earlyEntry) {
+	if len(e.with) > 0 {
+		core = core.With(e.with)
+	}
+	if ce := core.Check(e.ent, nil); ce != nil {
+		ce.Write(e.fields...)
+	}
+}
+
+// earlyCore queues entries into an earlyQueue
+type earlyCore struct {
+	queue *earlyQueue
+	// log_level, which flags may change before Singleton
+	level zapcore.LevelEnabler
+	with  []zapcore.Field
+}
+
+// Enabled implements zapcore.Core
+func (c *earlyCore) Enabled(l zapcore.Level) bool {
+	return c.level.Enabled(l)
+}
+
+// With implements zapcore.Core
+func (c *earlyCore) With(fields []zapcore.Field) zapcore.Core {
+	with := make([]zapcore.Field, 0, len(c.with)+len(fields))
+	with = append(with, c.with...)
+	return &earlyCore{queue: c.queue, level: c.level, with: append(with, fields...)}
+}
+
+// Check implements zapcore.Core
+func (c *earlyCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (c *earlyCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	e := earlyEntry{ent: ent, with: c.with, fields: fields}
+	if core := c.queue.add(e); core != nil {
+		// checked before Singleton, written after it
+		writeTo(core, e)
+	}
+	return nil
+}
+
+// Sync implements zapcore.Core, the queue is written to stderr since it's
+// likely called before exiting
+func (c *earlyCore) Sync() error {
+	c.queue.mu.Lock()
+	defer c.queue.mu.Unlock()
+	if c.queue.core == nil {
+		c.queue.flush()
+	}
+	return nil
+}
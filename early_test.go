@@ -0,0 +1,116 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newEarlyQueue returns a queue and a logger writing into it
+func newEarlyQueue() (*earlyQueue, *zap.Logger) {
+	q := &earlyQueue{enc: zapcore.NewJSONEncoder(newConfig().newZapConfig().EncoderConfig)}
+	return q, zap.New(&earlyCore{queue: q, level: zapcore.DebugLevel})
+}
+
+func TestEarlyReplay(t *testing.T) {
+	q, logger := newEarlyQueue()
+	child := logger.With(zap.String("k", "v"))
+	for i := 0; i < maxEarlyEntries+5; i++ {
+		child.Info("early", zap.Int("i", i))
+	}
+	if len(q.entries) != maxEarlyEntries || q.dropped != 5 {
+		t.Fatalf("expect %d entries and 5 dropped, get %d and %d", maxEarlyEntries, len(q.entries), q.dropped)
+	}
+
+	buf := &bytes.Buffer{}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = ""
+	q.replay(zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.AddSync(buf), zapcore.InfoLevel))
+	child.Debug("disabled")
+	child.Info("late")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != maxEarlyEntries+2 {
+		t.Fatalf("expect %d entries, get %d", maxEarlyEntries+2, len(entries))
+	}
+	if e := entries[0]; e["msg"] != "early" || e["k"] != "v" || e["i"] != float64(0) {
+		t.Errorf("expect the first entry in order, get %v", e)
+	}
+	if e := entries[maxEarlyEntries]; e["level"] != "warn" || e["dropped"] != float64(5) {
+		t.Errorf("expect a warning of the dropped entries, get %v", e)
+	}
+	if e := entries[maxEarlyEntries+1]; e["msg"] != "late" || e["k"] != "v" {
+		t.Errorf("expect entries after replay to be written through, get %v", e)
+	}
+}
+
+func TestEarlyFlush(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stderr := os.Stderr
+	defer func() { os.Stderr = stderr }()
+	f, err := os.Create(filepath.Join(dir, "stderr.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	os.Stderr = f
+
+	q, logger := newEarlyQueue()
+	logger.Info("queued")
+	logger.Sync()
+	logger.Warn("queued again")
+	logger.DPanic("dying")
+	if len(q.entries) != 0 {
+		t.Errorf("expect the queue written, get %d entries", len(q.entries))
+	}
+
+	b, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], `"msg":"queued"`) || !strings.Contains(lines[2], `"msg":"dying"`) {
+		t.Errorf("expect the queued entries in stderr, get %s", b)
+	}
+}
+
+func TestEarlyLevel(t *testing.T) {
+	c := newConfig()
+	q := &earlyQueue{}
+	logger := zap.New(&earlyCore{queue: q, level: c.severity.level})
+	if err := c.severity.Set("warning"); err != nil {
+		t.Fatal(err)
+	}
+	if ce := logger.Check(zapcore.InfoLevel, "suppressed"); ce != nil {
+		t.Error("expect INFO disabled by log_level before Singleton")
+	}
+	logger.With(zap.String("k", "v")).Info("suppressed")
+	logger.Warn("queued")
+	if len(q.entries) != 1 || q.entries[0].ent.Message != "queued" {
+		t.Errorf("expect only the warning queued, get %v", q.entries)
+	}
+}
@@ -0,0 +1,130 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"path/filepath"
+	"runtime"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// ecsVersion is the version of Elastic Common Schema
+	ecsVersion = "1.6.0"
+	// ecsLabelsPrefix nests user fields if log_ecs_labels is set
+	ecsLabelsPrefix = "labels."
+)
+
+// ecsEncoderConfig returns the encoder config of log_format=ecs
+// The caller and the stack are encoded by ecsEncoder instead
+func ecsEncoderConfig(c zapcore.EncoderConfig) zapcore.EncoderConfig {
+	c.TimeKey = "@timestamp"
+	c.EncodeTime = rfc3339NanoTimeEncoder
+	c.LevelKey = "log.level"
+	c.EncodeLevel = zapcore.LowercaseLevelEncoder
+	c.MessageKey = "message"
+	c.NameKey = "log.logger"
+	c.CallerKey = ""
+	c.StacktraceKey = ""
+	return c
+}
+
+// ecsEncoder is a JSON encoder using the field names of Elastic Common Schema
+type ecsEncoder struct {
+	zapcore.Encoder
+}
+
+// newECSEncoder returns the encoder of log_format=ecs
+func newECSEncoder(c zapcore.EncoderConfig) zapcore.Encoder {
+	return ecsEncoder{zapcore.NewJSONEncoder(ecsEncoderConfig(c))}
+}
+
+// Clone implements zapcore.Encoder
+func (e ecsEncoder) Clone() zapcore.Encoder {
+	return ecsEncoder{e.Encoder.Clone()}
+}
+
+// EncodeEntry implements zapcore.Encoder, errors logged by ErrorS are moved
+// into error.message, and the stack into error.stack_trace
+func (e ecsEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	all := make([]zapcore.Field, 0, len(fields)+6)
+	for _, f := range fields {
+		if err, ok := f.Interface.(error); ok && f.Type == zapcore.ErrorType && f.Key == "error" {
+			f = zap.String("error.message", err.Error())
+		}
+		all = append(all, f)
+	}
+	all = append(all, zap.String("ecs.version", ecsVersion))
+	if ent.Caller.Defined {
+		all = append(all,
+			zap.String("log.origin.file.name", filepath.Base(ent.Caller.File)),
+			zap.Int("log.origin.file.line", ent.Caller.Line),
+		)
+		if fn := runtime.FuncForPC(ent.Caller.PC); fn != nil {
+			all = append(all, zap.String("log.origin.function", fn.Name()))
+		}
+	}
+	if ent.Stack != "" {
+		all = append(all, zap.String("error.stack_trace", ent.Stack))
+	}
+	return e.Encoder.EncodeEntry(ent, all)
+}
+
+// labelsCore nests user fields under labels.*, except error
+// It wraps the innermost core, so that fields of With are nested as well
+type labelsCore struct {
+	zapcore.Core
+}
+
+// newLabelsCore returns core itself unless enabled
+func newLabelsCore(core zapcore.Core, enabled bool) zapcore.Core {
+	if !enabled {
+		return core
+	}
+	return &labelsCore{core}
+}
+
+// labels returns the fields with keys prefixed
+func labels(fields []zapcore.Field) []zapcore.Field {
+	nested := make([]zapcore.Field, len(fields))
+	for i, f := range fields {
+		if f.Key != "error" && f.Type != zapcore.SkipType {
+			f.Key = ecsLabelsPrefix + f.Key
+		}
+		nested[i] = f
+	}
+	return nested
+}
+
+// With implements zapcore.Core
+func (l *labelsCore) With(fields []zapcore.Field) zapcore.Core {
+	return &labelsCore{l.Core.With(labels(fields))}
+}
+
+// Check implements zapcore.Core
+func (l *labelsCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if l.Enabled(ent.Level) {
+		return ce.AddCore(ent, l)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (l *labelsCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return l.Core.Write(ent, labels(fields))
+}
@@ -0,0 +1,79 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestECSEncoder(t *testing.T) {
+	c := newConfig()
+	c.format.set("ecs")
+	enc := newECSEncoder(c.newZapConfig().EncoderConfig)
+	at := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	caller := zapcore.EntryCaller{Defined: true, File: "/src/app/main.go", Line: 42}
+
+	for _, tc := range []struct {
+		ent    zapcore.Entry
+		fields []zapcore.Field
+		golden string
+	}{
+		{
+			zapcore.Entry{Level: zapcore.InfoLevel, Time: at, Message: "hello", Caller: caller},
+			[]zapcore.Field{zap.Int("n", 1)},
+			`{"log.level":"info","@timestamp":"2020-01-02T03:04:05.000000006Z","message":"hello","n":1,"ecs.version":"1.6.0","log.origin.file.name":"main.go","log.origin.file.line":42}`,
+		},
+		{
+			zapcore.Entry{Level: zapcore.ErrorLevel, Time: at, Message: "failed", Stack: "main.main"},
+			[]zapcore.Field{zap.Error(errors.New("boom")), zap.String("pod", "p")},
+			`{"log.level":"error","@timestamp":"2020-01-02T03:04:05.000000006Z","message":"failed","error.message":"boom","pod":"p","ecs.version":"1.6.0","error.stack_trace":"main.main"}`,
+		},
+	} {
+		buf, err := enc.Clone().EncodeEntry(tc.ent, tc.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := buf.String(); s != tc.golden+"\n" {
+			t.Errorf("expect\n%s\nget\n%s", tc.golden, s)
+		}
+	}
+}
+
+func TestECSLabels(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	k.config.format.set("ecs")
+	k.config.ecsLabels.set(true)
+	k.config.zapConfig = k.config.newZapConfig()
+	k.config.zapConfig.OutputPaths = []string{path}
+	rebuild(t, k)
+	defer swapLogger(k)()
+
+	With(struct{ Pod string }{"p"}).ErrorS(errors.New("boom"), "failed", "node", "n")
+	Flush()
+	entries := readLines(t, path)
+	e := entries[len(entries)-1]
+	if e["message"] != "failed" || e["error.message"] != "boom" || e["labels.node"] != "n" || e["labels.Pod"] != "p" {
+		t.Errorf("unexpected entry %v", e)
+	}
+	if e["log.origin.file.name"] != "ecs_test.go" || e["log.origin.function"] != "github.com/xial-thu/klog.TestECSLabels" {
+		t.Errorf("unexpected origin %v", e)
+	}
+}
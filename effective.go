@@ -0,0 +1,205 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+)
+
+// ConfigChangesKey holds the changed fields of a "klog config changed" entry
+const ConfigChangesKey = "changes"
+
+// ConfigPath is where RegisterDebugHandlers serves EffectiveConfig
+const ConfigPath = "/debug/klog/config"
+
+// ConfigSnapshot is the effective config of the logger
+type ConfigSnapshot struct {
+	V           Level    `json:"v"`
+	MaxV        Level    `json:"max_v"`
+	MinSeverity string   `json:"min_severity"`
+	Format      string   `json:"format"`
+	Caller      string   `json:"caller"`
+	Outputs     []string `json:"outputs"`
+	// Sampling is formatted as log_sampling
+	Sampling string         `json:"sampling"`
+	Rotation RotationConfig `json:"rotation"`
+	// Routes are the ones of SetRoutes and log_human_stderr
+	Routes []RouteConfig `json:"routes,omitempty"`
+	// Loggers are the settings of ConfigureLogger by name
+	Loggers map[string]LoggerOverrides `json:"loggers,omitempty"`
+}
+
+// RotationConfig is the rotation of log_file, and the files of log_dir
+type RotationConfig struct {
+	File           string `json:"file,omitempty"`
+	MaxSizeMB      uint64 `json:"max_size_mb"`
+	MaxTotalSizeMB uint64 `json:"max_total_size_mb"`
+	MaxAge         string `json:"max_age"`
+	Compress       bool   `json:"compress"`
+	Daily          bool   `json:"daily"`
+	Dir            string `json:"dir,omitempty"`
+	ErrorFile      string `json:"error_file,omitempty"`
+}
+
+// EffectiveConfig returns the config in effect of the global logger. Outputs,
+// format, sampling and rotation are the ones built by Singleton or the last
+// Reconfigure, flags changed after it are not reported until Reconfigure
+func EffectiveConfig() ConfigSnapshot {
+	return klogger.config.snapshot()
+}
+
+// ConfigHandler serves EffectiveConfig as JSON
+func ConfigHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(EffectiveConfig())
+	})
+}
+
+// RegisterDebugHandlers serves ConfigHandler at ConfigPath, LoggersHandler
+// at /debug/klog/loggers and TopHandler at TopPath of mux, or
+// http.DefaultServeMux if it's nil
+func RegisterDebugHandlers(mux *http.ServeMux) {
+	if mux == nil {
+		mux = http.DefaultServeMux
+	}
+	mux.Handle(ConfigPath, ConfigHandler())
+	mux.Handle("/debug/klog/loggers", LoggersHandler())
+	mux.Handle(TopPath, TopHandler())
+}
+
+// builtSnapshot returns the settings read by build, c.mu is held
+func (c *Config) builtSnapshot() ConfigSnapshot {
+	return ConfigSnapshot{
+		Format:   c.format.get(),
+		Caller:   c.callerFormat.get(),
+		Outputs:  c.openedOutputs(),
+		Sampling: c.sampling.String(),
+		Routes:   c.allRoutes(),
+		Rotation: RotationConfig{
+			File:           c.logFile.get(),
+			MaxSizeMB:      c.logFileMaxSize.get(),
+			MaxTotalSizeMB: c.logFileMaxTotalSize.get(),
+			MaxAge:         c.logFileMaxAge.get().String(),
+			Compress:       c.logFileCompress.get(),
+			Daily:          c.logFileDaily.get(),
+			Dir:            c.logDir.get(),
+			ErrorFile:      c.errorLogFile.get(),
+		},
+	}
+}
+
+// snapshot returns the built settings along with the ones changed at runtime
+func (c *Config) snapshot() ConfigSnapshot {
+	s, _ := c.built.Load().(ConfigSnapshot)
+	s.V = c.level.get()
+	s.MaxV = c.maxLevel.get()
+	s.MinSeverity = c.severity.String()
+	s.Loggers = loggers.overrides()
+	return s
+}
+
+// configChange is the old and new value of a changed field
+type configChange struct {
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+// configChanges holds the config last logged by logConfigChanges
+type configChanges struct {
+	mu   sync.Mutex
+	last *ConfigSnapshot
+}
+
+// init stores s unless a config has been stored
+func (c *configChanges) init(s ConfigSnapshot) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.last == nil {
+		c.last = &s
+	}
+}
+
+// update stores s and returns the fields changed since the last one
+func (c *configChanges) update(s ConfigSnapshot) map[string]configChange {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	last := c.last
+	c.last = &s
+	if last == nil {
+		return nil
+	}
+	return diffConfig(*last, s)
+}
+
+// logConfigChanges logs the fields of the config changed since the last
+// call, or since the logger is built. It does nothing before Singleton
+func (k *Klogger) logConfigChanges() {
+	c := k.config
+	if c.built.Load() == nil {
+		return
+	}
+	changes := c.changes.update(c.snapshot())
+	if len(changes) == 0 {
+		return
+	}
+	k.internal().sugar.Infow("klog config changed", ConfigChangesKey, changes)
+}
+
+// diffConfig returns the changed fields by their JSON names, the ones of
+// nested objects are joined by dots, e.g. "rotation.max_size_mb"
+func diffConfig(old, new ConfigSnapshot) map[string]configChange {
+	a, b := flattenConfig(old), flattenConfig(new)
+	changes := make(map[string]configChange)
+	for key, v := range a {
+		if w, ok := b[key]; !ok || !reflect.DeepEqual(v, w) {
+			changes[key] = configChange{Old: v, New: b[key]}
+		}
+	}
+	for key, w := range b {
+		if _, ok := a[key]; !ok {
+			changes[key] = configChange{New: w}
+		}
+	}
+	return changes
+}
+
+// flattenConfig maps the dotted JSON names of the fields of s to the values
+func flattenConfig(s ConfigSnapshot) map[string]interface{} {
+	b, _ := json.Marshal(s)
+	var m map[string]interface{}
+	json.Unmarshal(b, &m)
+	flat := make(map[string]interface{})
+	flatten(flat, "", m)
+	return flat
+}
+
+// flatten copies the values of m into flat, prefixing the keys
+func flatten(flat map[string]interface{}, prefix string, m map[string]interface{}) {
+	for key, v := range m {
+		if sub, ok := v.(map[string]interface{}); ok {
+			flatten(flat, prefix+key+".", sub)
+			continue
+		}
+		flat[prefix+key] = v
+	}
+}
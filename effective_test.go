@@ -0,0 +1,125 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// changeEntries returns the "changes" of the "klog config changed" entries
+func changeEntries(t *testing.T, path string) []map[string]interface{} {
+	var changes []map[string]interface{}
+	for _, entry := range readLines(t, path) {
+		if entry["msg"] == "klog config changed" {
+			changes = append(changes, entry[ConfigChangesKey].(map[string]interface{}))
+		}
+	}
+	return changes
+}
+
+func TestConfigChanges(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "klog.log")
+
+	c := newConfig()
+	c.alsologtostderr.set(false)
+	c.outputPaths.set([]string{path})
+	zlogger, err := c.newLogger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+	defer k.Close(context.Background())
+
+	k.Info("unchanged")
+	k.logConfigChanges()
+	c.sampling.set(samplingRules{})
+	c.logFileMaxSize.set(100)
+	if _, _, err := c.reconfigure(); err != nil {
+		t.Fatal(err)
+	}
+	k.logConfigChanges()
+	k.SetLevel(2)
+	k.SetLevel(2)
+
+	changes := changeEntries(t, path)
+	if len(changes) != 2 {
+		t.Fatalf("expect 2 entries of changes, get %v", changes)
+	}
+	expect := map[string]interface{}{
+		"sampling":             map[string]interface{}{"old": "debug:100/100,info:100/100,warn:100/100", "new": "none"},
+		"rotation.max_size_mb": map[string]interface{}{"old": 0.0, "new": 100.0},
+	}
+	if !reflect.DeepEqual(changes[0], expect) {
+		t.Errorf("unexpected changes of reconfigure: %v", changes[0])
+	}
+	expect = map[string]interface{}{
+		"v": map[string]interface{}{"old": "0", "new": "2"},
+	}
+	if !reflect.DeepEqual(changes[1], expect) {
+		t.Errorf("unexpected changes of SetLevel: %v", changes[1])
+	}
+}
+
+func TestConfigChangesNotBuilt(t *testing.T) {
+	k, buf := newTestLogger()
+	k.SetLevel(3)
+	if buf.Len() != 0 {
+		t.Errorf("expect no changes logged before Singleton, get %s", buf)
+	}
+}
+
+func TestConfigHandler(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer swapLogger(k)()
+	k.config.level.set(3)
+
+	mux := http.NewServeMux()
+	RegisterDebugHandlers(mux)
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", ConfigPath, nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("unexpected response %d %v", w.Code, w.Header())
+	}
+	var s ConfigSnapshot
+	if err := json.NewDecoder(w.Body).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(s, EffectiveConfig()) {
+		t.Errorf("expect %+v, get %+v", EffectiveConfig(), s)
+	}
+	if s.V != 3 || s.Format != "json" || !reflect.DeepEqual(s.Outputs, []string{path}) {
+		t.Errorf("unexpected config %+v", s)
+	}
+
+	w = httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("PUT", ConfigPath, nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expect 405, get %d", w.Code)
+	}
+}
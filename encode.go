@@ -0,0 +1,240 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// valueKind is how a value filled by With is encoded
+type valueKind int
+
+const (
+	kindAny valueKind = iota
+	kindDynamic
+	kindDuration
+	kindTime
+	kindProto
+	kindObject
+	kindJSON
+	kindText
+	kindStringer
+	kindError
+	kindHex
+)
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	timeType     = reflect.TypeOf(time.Time{})
+
+	// interfaces are checked in order, the first match wins
+	kindInterfaces = []struct {
+		iface reflect.Type
+		kind  valueKind
+	}{
+		{reflect.TypeOf((*ProtoMessage)(nil)).Elem(), kindProto},
+		{reflect.TypeOf((*zapcore.ObjectMarshaler)(nil)).Elem(), kindObject},
+		{reflect.TypeOf((*json.Marshaler)(nil)).Elem(), kindJSON},
+		{reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem(), kindText},
+		{reflect.TypeOf((*fmt.Stringer)(nil)).Elem(), kindStringer},
+		{reflect.TypeOf((*error)(nil)).Elem(), kindError},
+	}
+
+	// plans and fields are cached per type
+	planCache  sync.Map
+	fieldCache sync.Map
+)
+
+// valuePlan is the cached encoding of a type
+type valuePlan struct {
+	kind valueKind
+	// the method is implemented by the pointer type
+	addr bool
+}
+
+// structField is an exported field of a struct
+type structField struct {
+	index int
+	name  string
+}
+
+// planOf returns the encoding of t
+func planOf(t reflect.Type) valuePlan {
+	if p, ok := planCache.Load(t); ok {
+		return p.(valuePlan)
+	}
+	p := newPlan(t)
+	planCache.Store(t, p)
+	return p
+}
+
+// newPlan checks durations, times, then the interfaces of t
+func newPlan(t reflect.Type) valuePlan {
+	switch {
+	case t == durationType:
+		return valuePlan{kind: kindDuration}
+	case t == timeType:
+		return valuePlan{kind: kindTime}
+	case t.Kind() == reflect.Interface:
+		return valuePlan{kind: kindDynamic}
+	}
+	for _, k := range kindInterfaces {
+		if t.Implements(k.iface) {
+			return valuePlan{kind: k.kind}
+		}
+		if t.Kind() != reflect.Ptr && reflect.PtrTo(t).Implements(k.iface) {
+			return valuePlan{kind: k.kind, addr: true}
+		}
+	}
+	// byte arrays like checksums are unreadable in base64 or as numbers
+	if t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8 {
+		return valuePlan{kind: kindHex}
+	}
+	return valuePlan{kind: kindAny}
+}
+
+// structFields returns the exported fields of t
+func structFields(t reflect.Type) []structField {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]structField)
+	}
+	fields := make([]structField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.PkgPath == "" {
+			fields = append(fields, structField{index: i, name: f.Name})
+		}
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// fieldOf encodes v by its natural form, e.g. String() instead of the
+// internals dumped by zap.Any. A value failing to marshal is replaced by a
+// string instead of dropping the entry
+func (c *Config) fieldOf(key string, v reflect.Value) zap.Field {
+	return safeField(c.naturalField(key, v))
+}
+
+// naturalField is fieldOf without recovering failures
+func (c *Config) naturalField(key string, v reflect.Value) zap.Field {
+	p := planOf(v.Type())
+	if p.kind == kindDynamic {
+		if v.IsNil() {
+			return zap.Reflect(key, nil)
+		}
+		v = v.Elem()
+		p = planOf(v.Type())
+	}
+	if p.kind == kindHex {
+		return c.hexField(key, v)
+	}
+	if p.kind > kindTime && isNil(v) {
+		return zap.Reflect(key, nil)
+	}
+	if fn, ok := marshalerOf(v.Type()); ok && !isNil(v) {
+		return zap.Object(key, registeredObject{v: v.Interface(), fn: fn})
+	}
+	if p.addr {
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		v = ptr
+	}
+
+	val := v.Interface()
+	switch p.kind {
+	case kindDuration:
+		return zap.String(key, val.(time.Duration).String())
+	case kindTime:
+		return zap.String(key, val.(time.Time).Format(c.timeLayout.get()))
+	case kindProto:
+		return Proto(key, val.(ProtoMessage))
+	case kindObject:
+		return zap.Object(key, val.(zapcore.ObjectMarshaler))
+	case kindJSON:
+		return zap.Reflect(key, val)
+	case kindText:
+		var b []byte
+		err := safely(func() (err error) {
+			b, err = val.(encoding.TextMarshaler).MarshalText()
+			return err
+		})
+		if err == nil {
+			return zap.ByteString(key, b)
+		}
+	case kindStringer:
+		return zap.Stringer(key, val.(fmt.Stringer))
+	case kindError:
+		if err := safely(func() error { _ = val.(error).Error(); return nil }); err != nil {
+			return zap.String(key, marshalFailed(err))
+		}
+		return zap.NamedError(key, val.(error))
+	}
+	return zap.Any(key, val)
+}
+
+// hexField encodes the byte array v in hex, an array longer than log_hex_max
+// is logged as the hex of its prefix followed by its length
+func (c *Config) hexField(key string, v reflect.Value) zap.Field {
+	b := make([]byte, v.Len())
+	reflect.Copy(reflect.ValueOf(b), v)
+	max := c.hexMaxBytes.get()
+	if max < 0 || len(b) <= max {
+		return zap.String(key, hex.EncodeToString(b))
+	}
+	return zap.String(key, hex.EncodeToString(b[:max])+"...("+strconv.Itoa(len(b))+" bytes)")
+}
+
+// mapKey is a key of a map and its string form
+type mapKey struct {
+	v reflect.Value
+	s string
+}
+
+// mapKeys returns the keys of the map v sorted by their string form
+// Non-string keys are stringified by fmt.Sprint
+func mapKeys(v reflect.Value) []mapKey {
+	keys := make([]mapKey, 0, v.Len())
+	for _, k := range v.MapKeys() {
+		s := k.String()
+		if k.Kind() != reflect.String {
+			s = fmt.Sprint(k.Interface())
+		}
+		keys = append(keys, mapKey{v: k, s: s})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i].s < keys[j].s
+	})
+	return keys
+}
+
+// isNil reports whether v is a nil pointer, interface, map, slice, chan or func
+func isNil(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface, reflect.Map, reflect.Slice, reflect.Chan, reflect.Func:
+		return v.IsNil()
+	}
+	return false
+}
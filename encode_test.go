@@ -0,0 +1,171 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+type userID int
+
+func (id userID) String() string {
+	return fmt.Sprintf("user-%d", id)
+}
+
+type point struct {
+	X, Y int
+}
+
+func (p point) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("x", p.X)
+	enc.AddInt("y", p.Y)
+	return nil
+}
+
+func TestWithNaturalForms(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	u, _ := url.Parse("https://example.com/a?b=c")
+	type S struct {
+		URL    url.URL
+		ID     userID
+		Err    error
+		NilErr error
+		IP     net.IP
+		Point  point
+		Secret Secret
+		Raw    []int
+	}
+	With(S{
+		URL:    *u,
+		ID:     7,
+		Err:    errors.New("boom"),
+		IP:     net.ParseIP("10.0.0.1"),
+		Point:  point{1, 2},
+		Secret: "password",
+		Raw:    []int{1},
+	}).Info("struct")
+	With(map[string]interface{}{"url": u, "id": userID(8)}).Info("map")
+
+	entries := decodeLines(t, buf)
+	expect := map[string]interface{}{
+		"URL":    "https://example.com/a?b=c",
+		"ID":     "user-7",
+		"Err":    "boom",
+		"NilErr": nil,
+		"IP":     "10.0.0.1",
+		"Point":  map[string]interface{}{"x": float64(1), "y": float64(2)},
+		"Secret": Redacted,
+		"Raw":    []interface{}{float64(1)},
+	}
+	for key, val := range expect {
+		if !reflect.DeepEqual(entries[0][key], val) {
+			t.Errorf("expect %s %#v, get %#v", key, val, entries[0][key])
+		}
+	}
+	if entries[1]["url"] != "https://example.com/a?b=c" || entries[1]["id"] != "user-8" {
+		t.Errorf("unexpected entry %v", entries[1])
+	}
+}
+
+func TestPlanCache(t *testing.T) {
+	typ := reflect.TypeOf(url.URL{})
+	if p := planOf(typ); p.kind != kindStringer || !p.addr {
+		t.Errorf("unexpected plan %+v", p)
+	}
+	if _, ok := planCache.Load(typ); !ok {
+		t.Error("plan should be cached")
+	}
+}
+
+func TestWithMapKeys(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	var nilMap map[string]int
+	k.With(map[int]string{2: "b", 10: "c", 1: "a"}, nilMap, nil).Infof("int keys")
+	k.With(map[struct{ A string }]int{{A: "x"}: 1}).Infof("struct keys")
+	SetStringifyMapKeys(false)
+	k.With(map[int]string{1: "a"}, map[string]int{"s": 1}).Infof("skipped")
+	SetStringifyMapKeys(true)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("expect 3 lines, get %v", lines)
+	}
+	if !strings.Contains(lines[0], `"msg":"int keys","1":"a","10":"c","2":"b"}`) {
+		t.Errorf("expect stringified keys in order, get %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"{x}":1`) {
+		t.Errorf("expect a stringified struct key, get %s", lines[1])
+	}
+	if strings.Contains(lines[2], `"1":"a"`) || !strings.Contains(lines[2], `"s":1`) {
+		t.Errorf("expect maps of non-string keys to be skipped, get %s", lines[2])
+	}
+}
+
+// digest is a byte array with its own String
+type digest [2]byte
+
+func (d digest) String() string {
+	return "digest"
+}
+
+func TestWithByteArrays(t *testing.T) {
+	k, buf := newTestLogger()
+	k.config.hexMaxBytes.set(4)
+	k.With(struct {
+		Small  [2]byte
+		Limit  [4]byte
+		Large  [6]byte
+		Empty  [0]byte
+		Digest digest
+	}{
+		Small:  [2]byte{0x01, 0xab},
+		Limit:  [4]byte{0xde, 0xad, 0xbe, 0xef},
+		Large:  [6]byte{1, 2, 3, 4, 5, 6},
+		Digest: digest{1, 2},
+	}).Infof("arrays")
+	k.With(map[string][3]byte{"sum": {0xff, 0, 0x10}}).Infof("map")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 entries, get %d", len(entries))
+	}
+	expect := map[string]interface{}{
+		"Small":  "01ab",
+		"Limit":  "deadbeef",
+		"Large":  "01020304...(6 bytes)",
+		"Empty":  "",
+		"Digest": "digest",
+	}
+	for key, val := range expect {
+		if entries[0][key] != val {
+			t.Errorf("expect %s to be %q, get %v", key, val, entries[0][key])
+		}
+	}
+	if entries[1]["sum"] != "ff0010" {
+		t.Errorf("expect the map value in hex, get %v", entries[1]["sum"])
+	}
+}
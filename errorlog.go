@@ -0,0 +1,59 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// errorLogCore writes ERROR and above to error_log_file, rotated like
+// log_file. It's tee'd inside the cores adding fields like seq, so that an
+// entry written to both files is counted once
+func (c *Config) errorLogCore(enc zapcore.Encoder) (zapcore.Core, error) {
+	file, err := openRotatingFile(c.errorLogFile.get(), c.rotateOptions())
+	if err != nil {
+		return nil, err
+	}
+	enabled := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= zapcore.ErrorLevel && c.zapConfig.Level.Enabled(l)
+	})
+	return newLevelCore(zapcore.NewCore(enc, c.batch.wrap(c.sinks.attachFile(file)), enabled)), nil
+}
+
+// levelCore drops the entries written to it below its level
+// Cores adding fields, like seqCore, write entries to the whole tee they wrap,
+// so a core of the tee can't rely on being checked
+type levelCore struct {
+	zapcore.Core
+}
+
+// newLevelCore returns a levelCore of core
+func newLevelCore(core zapcore.Core) zapcore.Core {
+	return levelCore{core}
+}
+
+// With implements zapcore.Core
+func (l levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return levelCore{l.Core.With(fields)}
+}
+
+// Write implements zapcore.Core
+func (l levelCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if !l.Enabled(ent.Level) {
+		return nil
+	}
+	return l.Core.Write(ent, fields)
+}
@@ -0,0 +1,70 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestErrorLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "klog.log")
+	errors := filepath.Join(dir, "errors.log")
+
+	c := newConfig()
+	c.seqField.set(true)
+	c.errorLogFile.set(errors)
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = []string{main}
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+	SetExitFunc(func(int) {})
+	defer SetExitFunc(nil)
+
+	k.Infof("info")
+	k.Errorf("error %d", 1)
+	k.Fatal("fatal")
+	if err := k.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	all := readLines(t, main)
+	if len(all) != 3 {
+		t.Fatalf("expect 3 entries in the main file, get %v", all)
+	}
+	errs := readLines(t, errors)
+	if len(errs) != 2 || errs[0]["msg"] != "error 1" || errs[1]["msg"] != "fatal" {
+		t.Fatalf("expect the error and the fatal entry in the errors file, get %v", errs)
+	}
+	for i, e := range errs {
+		if e["seq"] != all[i+1]["seq"] {
+			t.Errorf("expect an entry to be numbered once, get %v and %v", e["seq"], all[i+1]["seq"])
+		}
+	}
+	if c.stats.seq != 3 {
+		t.Errorf("expect 3 entries to be counted, get %d", c.stats.seq)
+	}
+}
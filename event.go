@@ -0,0 +1,96 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"regexp"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// EventKey holds the name of Event entries
+const EventKey = "event"
+
+// eventNamePattern is snake_case, e.g. user_signed_up
+var eventNamePattern = regexp.MustCompile(`^[a-z][a-z0-9]*(_[a-z0-9]+)*$`)
+
+var (
+	// set by PublishExpvar, events are counted afterwards
+	eventMetrics boolValue
+	// counters of each event name, *uint64
+	eventCounts sync.Map
+)
+
+// Event logs an entry of the event name at INFO, see Klogger.Event
+func Event(name string, kv ...interface{}) {
+	klogger.sugar.Desugar().Info(name, klogger.eventFields(name, kv)...)
+}
+
+// Event logs an entry of the event name at INFO, e.g. "user_signed_up", with
+// the name as the message and as field "event", and k-v pairs like InfoS
+// Names should be snake_case, which is reported as a misuse otherwise. Once
+// PublishExpvar is called, the events of each name are counted in "events"
+func (k *Klogger) Event(name string, kv ...interface{}) {
+	k.sugar.Desugar().Info(name, k.eventFields(name, kv)...)
+}
+
+// Event logs an entry of the event name like Klogger.Event, at the level of
+// V() entries if it's enabled
+func (v Verbose) Event(name string, kv ...interface{}) {
+	if !v.enabled {
+		return
+	}
+	lvl, fields := v.entry(v.logger.eventFields(name, kv))
+	if ce := v.logger.sugar.Desugar().Check(lvl, name); ce != nil {
+		ce.Write(fields...)
+	}
+}
+
+// eventFields validates and counts the event, and returns its fields
+// The name is added after kv is repaired, so that a dangling arg never takes
+// it as the value, and it wins over an "event" of kv
+func (k *Klogger) eventFields(name string, kv []interface{}) []zap.Field {
+	if !eventNamePattern.MatchString(name) {
+		k.misuse("event name is not snake_case", zap.String(EventKey, name))
+	}
+	if eventMetrics.get() {
+		n, ok := eventCounts.Load(name)
+		if !ok {
+			n, _ = eventCounts.LoadOrStore(name, new(uint64))
+		}
+		atomic.AddUint64(n.(*uint64), 1)
+	}
+	fields := k.sweetenFields(kv)
+	for i, f := range fields {
+		if f.Key == EventKey {
+			k.reportDuplicate(EventKey)
+			fields = append(fields[:i], fields[i+1:]...)
+			break
+		}
+	}
+	return append(fields, zap.String(EventKey, name))
+}
+
+// eventCounters returns the counters of each event name
+func eventCounters() map[string]uint64 {
+	m := map[string]uint64{}
+	eventCounts.Range(func(name, n interface{}) bool {
+		m[name.(string)] = atomic.LoadUint64(n.(*uint64))
+		return true
+	})
+	return m
+}
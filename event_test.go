@@ -0,0 +1,117 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"expvar"
+	"strings"
+	"testing"
+)
+
+func TestEvent(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	k.config.level.set(2)
+
+	Event("user_signed_up", "id", 1)
+	k.Event("order_paid", "id", 2, EventKey, "ignored")
+	k.V(2).Event("cache_missed", "key", "a")
+	k.V(3).Event("cache_hit", "key", "a")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries, get %v", entries)
+	}
+	for i, expect := range []struct {
+		event, level string
+	}{{"user_signed_up", "info"}, {"order_paid", "info"}, {"cache_missed", "debug"}} {
+		e := entries[i]
+		if e[EventKey] != expect.event || e["msg"] != expect.event || e["level"] != expect.level {
+			t.Errorf("entry %d: expect event %s at %s, get %v", i, expect.event, expect.level, e)
+		}
+		if caller, _ := e["caller"].(string); !strings.Contains(caller, "/event_test.go:") {
+			t.Errorf("entry %d: unexpected caller %q", i, caller)
+		}
+	}
+	if entries[0]["id"] != float64(1) || entries[2]["key"] != "a" {
+		t.Errorf("expect the k-v pairs, get %v", entries)
+	}
+}
+
+func TestEventOddArgs(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	k.Event("user_signed_up", "dangling")
+	k.Event("order_paid", "id", 1, "odd")
+	k.Event("cache_missed", 42, "a")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries, get %v", entries)
+	}
+	for i, name := range []string{"user_signed_up", "order_paid", "cache_missed"} {
+		if e := entries[i]; e[EventKey] != name {
+			t.Errorf("entry %d: expect event %s, get %v", i, name, e)
+		}
+	}
+	if e := entries[0]; e[DanglingKey] != "dangling" {
+		t.Errorf("expect the dangling arg, get %v", e)
+	}
+	if e := entries[1]; e["id"] != float64(1) || e[DanglingKey] != "odd" {
+		t.Errorf("expect the pairs and the dangling arg, get %v", e)
+	}
+	if e := entries[2]; e["42"] != "a" {
+		t.Errorf("expect the stringified key, get %v", e)
+	}
+}
+
+func TestEventName(t *testing.T) {
+	for _, name := range []string{"signed_up", "a", "http2_ready"} {
+		if !eventNamePattern.MatchString(name) {
+			t.Errorf("expect %s valid", name)
+		}
+	}
+	for _, name := range []string{"", "SignedUp", "signed-up", "signed__up", "_signed", "signed_", "2fa_sent"} {
+		if eventNamePattern.MatchString(name) {
+			t.Errorf("expect %s invalid", name)
+		}
+	}
+
+	k, _ := newModeLogger(false)
+	if r := catchPanic(func() { k.Event("SignedUp") }); r != nil {
+		t.Errorf("expect invalid names tolerated in production, get %v", r)
+	}
+	k, _ = newModeLogger(true)
+	if r := catchPanic(func() { k.Event("SignedUp") }); r == nil {
+		t.Error("expect invalid names to panic in development")
+	}
+}
+
+func TestEventMetrics(t *testing.T) {
+	k, _ := newTestLogger()
+	PublishExpvar()
+	before := eventCounters()["job_done"]
+	k.Event("job_done")
+	k.V(0).Event("job_done")
+	k.V(1).Event("job_done")
+
+	if n := eventCounters()["job_done"]; n != before+2 {
+		t.Errorf("expect 2 more events, get %d", n-before)
+	}
+	if v := expvar.Get(ExpvarName).(*expvar.Map).Get("events"); !strings.Contains(v.String(), `"job_done":`) {
+		t.Errorf("expect the events published, get %s", v)
+	}
+}
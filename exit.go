@@ -0,0 +1,221 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	// ExitCleanupTimeout limits how long Fatal and Exit wait for cleanups
+	ExitCleanupTimeout = 5 * time.Second
+	// ExitDrainTimeout limits how long Fatal and Exit wait for the outputs to
+	// be synced, e.g. buffered files and queued network entries, before the
+	// last entry is written to stderr instead
+	ExitDrainTimeout = 2 * time.Second
+)
+
+var (
+	exitMu sync.Mutex
+	// exitFunc terminates the process after Fatal and Exit
+	exitFunc = os.Exit
+	// cleanups run before exiting, the last registered runs first
+	cleanups []*cleanup
+)
+
+// cleanup is a func registered by OnExit
+type cleanup struct {
+	fn func()
+}
+
+// SetExitFunc replaces os.Exit called by Fatal and Exit, e.g. in tests
+// nil restores os.Exit
+func SetExitFunc(fn func(code int)) {
+	if fn == nil {
+		fn = os.Exit
+	}
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	exitFunc = fn
+}
+
+// OnExit registers fn to run before Fatal and Exit terminate the process,
+// since defers are skipped by os.Exit. Cleanups run like defers, the last
+// registered first, and are given up after ExitCleanupTimeout
+// Call the returned func to unregister fn
+func OnExit(fn func()) (unregister func()) {
+	c := &cleanup{fn: fn}
+	exitMu.Lock()
+	defer exitMu.Unlock()
+	cleanups = append(cleanups, c)
+	return func() {
+		exitMu.Lock()
+		defer exitMu.Unlock()
+		for i := range cleanups {
+			if cleanups[i] == c {
+				cleanups = append(cleanups[:i:i], cleanups[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// FatalWithCleanup logs like Fatal, and runs fn before the registered cleanups
+//go:noinline
+func FatalWithCleanup(fn func(), args ...interface{}) {
+	klogger.exit(255, klogger.fatal(1, fmt.Sprint(args...)), fn)
+}
+
+// FatalWithCleanup logs like Fatal, and runs fn before the registered cleanups
+//go:noinline
+func (k *Klogger) FatalWithCleanup(fn func(), args ...interface{}) {
+	k.exit(255, k.fatal(1, fmt.Sprint(args...)), fn)
+}
+
+// lastEntry is the entry logged by Fatal or Exit, which is written to stderr
+// if the outputs can't be drained in time
+type lastEntry struct {
+	ent    zapcore.Entry
+	fields []zap.Field
+	// a FATAL entry checked but not written yet, since zap syncs the outputs
+	// right after writing it
+	ce *zapcore.CheckedEntry
+}
+
+// fatal checks msg at FATAL, which is written by exit, depth is the number of
+// frames between the caller and fatal
+// zap always exits after a FATAL entry, so the entry is checked by the core
+// directly, with the caller and the stack filled in like zap does
+func (k *Klogger) fatal(depth int, msg string, fields ...zap.Field) lastEntry {
+	ent := zapcore.Entry{
+		Level:   zapcore.FatalLevel,
+		Time:    time.Now(),
+		Message: msg,
+		Caller:  zapcore.NewEntryCaller(runtime.Caller(depth + 1 + k.callerSkip)),
+		Stack:   zap.Stack("").String,
+	}
+	return lastEntry{
+		ent:    ent,
+		fields: fields,
+		ce:     k.sugar.Desugar().Core().Check(ent, nil),
+	}
+}
+
+// exitError writes msg at ERROR for Exit, depth is the number of frames
+// between the caller and exitError
+func (k *Klogger) exitError(depth int, msg string, fields ...zap.Field) lastEntry {
+	last := lastEntry{ent: zapcore.Entry{Level: zapcore.ErrorLevel, Time: time.Now(), Message: msg}, fields: fields}
+	if ce := k.sugar.Desugar().WithOptions(zap.AddCallerSkip(depth)).Check(zapcore.ErrorLevel, msg); ce != nil {
+		last.ent = ce.Entry
+		ce.Write(fields...)
+	}
+	return last
+}
+
+// exit drains the outputs, dumps recent entries, runs the cleanups and
+// terminates the process
+func (k *Klogger) exit(code int, last lastEntry, fns ...func()) {
+	k.LogOnceSummary()
+	k.drain(last)
+	c := k.config
+	c.dumpRecent()
+
+	exitMu.Lock()
+	exit := exitFunc
+	for i := len(cleanups) - 1; i >= 0; i-- {
+		fns = append(fns, cleanups[i].fn)
+	}
+	exitMu.Unlock()
+
+	runCleanups(fns, ExitCleanupTimeout)
+	exit(code)
+}
+
+// drain writes the FATAL entry and syncs the outputs within ExitDrainTimeout,
+// last is written to stderr if it fails or times out, so that the reason of
+// exiting is never lost
+func (k *Klogger) drain(last lastEntry) {
+	done := make(chan error, 1)
+	go func() {
+		if last.ce != nil {
+			last.ce.Write(last.fields...)
+		}
+		done <- k.Flush()
+	}()
+
+	timer := time.NewTimer(ExitDrainTimeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err == nil {
+			return
+		}
+		fmt.Fprintf(os.Stderr, "klog: failed draining outputs: %v\n", err)
+	case <-timer.C:
+		os.Stderr.WriteString("klog: draining outputs timed out\n")
+	}
+	k.config.writeStderr(last)
+}
+
+// writeStderr encodes an entry as JSON into stderr
+func (c *Config) writeStderr(last lastEntry) {
+	ec := c.zapConfig.EncoderConfig
+	if ec.MessageKey == "" {
+		ec = c.newZapConfig().EncoderConfig
+	}
+	buf, err := zapcore.NewJSONEncoder(ec).EncodeEntry(last.ent, last.fields)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "klog: %s: %s\n", last.ent.Level.CapitalString(), last.ent.Message)
+		return
+	}
+	os.Stderr.Write(buf.Bytes())
+	buf.Free()
+}
+
+// runCleanups calls fns in order until timeout, panics are recovered
+func runCleanups(fns []func(), timeout time.Duration) {
+	if len(fns) == 0 {
+		return
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for _, fn := range fns {
+			func() {
+				defer func() {
+					if r := recover(); r != nil {
+						fmt.Fprintf(os.Stderr, "klog: exit cleanup panicked: %v\n", r)
+					}
+				}()
+				fn()
+			}()
+		}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+	case <-timer.C:
+		os.Stderr.WriteString("klog: exit cleanups timed out\n")
+	}
+}
@@ -0,0 +1,228 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestExitCleanups(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	var codes []int
+	SetExitFunc(func(code int) { codes = append(codes, code) })
+	defer SetExitFunc(nil)
+
+	var ran []string
+	defer OnExit(func() { ran = append(ran, "first") })()
+	defer OnExit(func() { panic("boom") })()
+	unregister := OnExit(func() { ran = append(ran, "unregistered") })
+	defer OnExit(func() { ran = append(ran, "last") })()
+	unregister()
+
+	Exitf("exit %d", 1)
+	k.FatalWithCleanup(func() { ran = append(ran, "fn") }, "fatal")
+
+	if expect := []int{1, 255}; !reflect.DeepEqual(codes, expect) {
+		t.Errorf("expect codes %v, get %v", expect, codes)
+	}
+	expect := []string{"last", "first", "fn", "last", "first"}
+	if !reflect.DeepEqual(ran, expect) {
+		t.Errorf("expect cleanups %v, get %v", expect, ran)
+	}
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 || entries[0]["msg"] != "exit 1" || entries[1]["msg"] != "fatal" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
+
+func TestStructuredExit(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	var codes []int
+	SetExitFunc(func(code int) { codes = append(codes, code) })
+	defer SetExitFunc(nil)
+	var ran int
+	defer OnExit(func() { ran++ })()
+
+	FatalS(errors.New("disk full"), "cannot start", "path", "/data")
+	k.FatalS(nil, "method", "n", 1)
+	Exitw("bad flags", "flag", "v")
+	k.WithFields("svc", "api").Exitw("derived")
+
+	if expect := []int{255, 255, 1, 1}; !reflect.DeepEqual(codes, expect) {
+		t.Errorf("expect codes %v, get %v", expect, codes)
+	}
+	if ran != 4 {
+		t.Errorf("expect cleanups to run 4 times, get %d", ran)
+	}
+	entries := decodeLines(t, buf)
+	if len(entries) != 4 {
+		t.Fatalf("expect 4 entries, get %v", entries)
+	}
+	expects := []map[string]interface{}{
+		{"level": "fatal", "msg": "cannot start", "error": "disk full", "path": "/data"},
+		{"level": "fatal", "msg": "method", "n": float64(1)},
+		{"level": "error", "msg": "bad flags", "flag": "v"},
+		{"level": "error", "msg": "derived", "svc": "api"},
+	}
+	for i, expect := range expects {
+		for key, val := range expect {
+			if entries[i][key] != val {
+				t.Errorf("entry %d: expect %s to be %v, get %v", i, key, val, entries[i])
+			}
+		}
+		if caller, _ := entries[i]["caller"].(string); !strings.Contains(caller, "/exit_test.go:") {
+			t.Errorf("entry %d: expect the caller in this file, get %q", i, caller)
+		}
+	}
+	if _, ok := entries[1]["error"]; ok {
+		t.Errorf("unexpected error in %v", entries[1])
+	}
+}
+
+func TestExitCleanupTimeout(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+	exited := false
+	SetExitFunc(func(int) { exited = true })
+	defer SetExitFunc(nil)
+	timeout := ExitCleanupTimeout
+	ExitCleanupTimeout = 10 * time.Millisecond
+	defer func() { ExitCleanupTimeout = timeout }()
+
+	block := make(chan struct{})
+	defer close(block)
+	defer OnExit(func() { <-block })()
+
+	start := time.Now()
+	Fatal("stuck")
+	if !exited || time.Since(start) > time.Second {
+		t.Errorf("exit should not wait for stuck cleanups")
+	}
+}
+
+// slowSink queues writes, which are written to out by a slow Sync
+type slowSink struct {
+	mu     sync.Mutex
+	queue  [][]byte
+	out    bytes.Buffer
+	delay  time.Duration
+	synced int
+}
+
+func (s *slowSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.queue = append(s.queue, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func (s *slowSink) Sync() error {
+	time.Sleep(s.delay)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.queue {
+		s.out.Write(p)
+	}
+	s.queue = nil
+	s.synced++
+	return nil
+}
+
+// output returns what's synced
+func (s *slowSink) output() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.out.String()
+}
+
+// newSlowLogger returns a logger writing to a slowSink
+func newSlowLogger(delay time.Duration) (*Klogger, *slowSink) {
+	sink := &slowSink{delay: delay}
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), sink, zapcore.DebugLevel)
+	return &Klogger{
+		sugar:  zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1)).Sugar(),
+		config: newConfig(),
+	}, sink
+}
+
+func TestExitDrain(t *testing.T) {
+	k, sink := newSlowLogger(20 * time.Millisecond)
+	var outputs []string
+	SetExitFunc(func(int) { outputs = append(outputs, sink.output()) })
+	defer SetExitFunc(nil)
+
+	k.Infof("queued")
+	k.Fatalf("fatal %d", 1)
+	k.ExitDepth(0, "exit")
+
+	if len(outputs) != 2 {
+		t.Fatalf("expect 2 exits, get %d", len(outputs))
+	}
+	if !strings.Contains(outputs[0], `"msg":"queued"`) || !strings.Contains(outputs[0], `"msg":"fatal 1"`) {
+		t.Errorf("expect the fatal entry to be drained before exiting, get %s", outputs[0])
+	}
+	if !strings.Contains(outputs[1], `"msg":"exit"`) || !strings.Contains(outputs[1], "/exit_test.go:") {
+		t.Errorf("expect the exit entry with its caller drained before exiting, get %s", outputs[1])
+	}
+}
+
+func TestExitDrainTimeout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stderr := os.Stderr
+	defer func() { os.Stderr = stderr }()
+	f, err := os.Create(filepath.Join(dir, "stderr.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	os.Stderr = f
+
+	timeout := ExitDrainTimeout
+	ExitDrainTimeout = 10 * time.Millisecond
+	defer func() { ExitDrainTimeout = timeout }()
+	k, sink := newSlowLogger(200 * time.Millisecond)
+	var lost string
+	SetExitFunc(func(int) {
+		b, _ := ioutil.ReadFile(f.Name())
+		lost = string(b)
+	})
+	defer SetExitFunc(nil)
+
+	k.Fatalw("stuck", "reason", "slow")
+	if !strings.Contains(lost, `"msg":"stuck"`) || !strings.Contains(lost, `"reason":"slow"`) {
+		t.Errorf("expect the fatal entry in stderr, get %s", lost)
+	}
+	if strings.Contains(sink.output(), "stuck") {
+		t.Errorf("expect the sink not to be synced yet")
+	}
+}
@@ -0,0 +1,152 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// ExpvarName is the name of the map published by PublishExpvar
+const ExpvarName = "klog"
+
+// numLevels is the number of zap levels, from DEBUG to FATAL
+const numLevels = int(zapcore.FatalLevel-zapcore.DebugLevel) + 1
+
+// publishOnce guards PublishExpvar, expvar panics on duplicated names
+var publishOnce sync.Once
+
+// PublishExpvar publishes the state of the global logger as the expvar.Map
+// "klog", which is served at /debug/vars. The values are read when the map
+// is visited, so they're always up to date. It can be called more than once
+func PublishExpvar() {
+	publishOnce.Do(func() {
+		eventMetrics.set(true)
+		m := expvar.NewMap(ExpvarName)
+		m.Set("v", expvar.Func(func() interface{} {
+			return int(klogger.config.level.get())
+		}))
+		m.Set("min_severity", expvar.Func(func() interface{} {
+			return klogger.config.severity.String()
+		}))
+		m.Set("sampling", expvar.Func(func() interface{} {
+			return klogger.config.samplingState()
+		}))
+		m.Set("outputs", expvar.Func(func() interface{} {
+			return klogger.config.outputs()
+		}))
+		m.Set("lines", levelCounters(func(s *stats) *[numLevels]uint64 { return &s.lines }))
+		m.Set("bytes", levelCounters(func(s *stats) *[numLevels]uint64 { return &s.bytes }))
+		m.Set("sampled", levelCounters(func(s *stats) *[numLevels]uint64 { return &s.sampled }))
+		m.Set("events", expvar.Func(func() interface{} {
+			return eventCounters()
+		}))
+		m.Set("suppressed", expvar.Func(func() interface{} {
+			return SuppressedEntries()
+		}))
+		m.Set("dropped", expvar.Func(func() interface{} {
+			return map[string]uint64{
+				"sampling":      klogger.config.stats.droppedBySampling(),
+				"forward":       DroppedEntries(),
+				"failed_writes": FailedWrites(),
+			}
+		}))
+	})
+}
+
+// levelCounters returns a func of the counters of each level
+func levelCounters(counters func(*stats) *[numLevels]uint64) expvar.Func {
+	return func() interface{} {
+		c := counters(klogger.config.stats)
+		m := make(map[string]uint64, numLevels)
+		for i := range c {
+			m[(zapcore.DebugLevel + zapcore.Level(i)).String()] = atomic.LoadUint64(&c[i])
+		}
+		return m
+	}
+}
+
+// samplingState returns the sampling rules of each level
+func (c *Config) samplingState() map[string]interface{} {
+	rules := c.sampling.get()
+	levels := make(map[string]*samplingRule, numLevels)
+	for i, rule := range rules {
+		if rule != nil {
+			levels[(zapcore.DebugLevel + zapcore.Level(i)).String()] = rule
+		}
+	}
+	return map[string]interface{}{
+		"enabled": len(levels) > 0,
+		"levels":  levels,
+	}
+}
+
+// outputs returns the paths of the outputs
+func (c *Config) outputs() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.openedOutputs()
+}
+
+// openedOutputs returns the paths of the outputs, c.mu is held
+func (c *Config) openedOutputs() []string {
+	paths := append([]string(nil), c.zapConfig.OutputPaths...)
+	if c.logFile.get() != "" {
+		paths = append(paths, c.logFile.get())
+	}
+	return paths
+}
+
+// droppedBySampling returns how many entries were dropped by sampling
+func (s *stats) droppedBySampling() uint64 {
+	var n uint64
+	for i := range s.sampled {
+		n += atomic.LoadUint64(&s.sampled[i])
+	}
+	return n
+}
+
+// countingEncoder counts the lines and bytes encoded for each level
+type countingEncoder struct {
+	zapcore.Encoder
+	stats *stats
+}
+
+// newCountingEncoder wraps enc
+func newCountingEncoder(enc zapcore.Encoder, s *stats) zapcore.Encoder {
+	return &countingEncoder{Encoder: enc, stats: s}
+}
+
+// Clone implements zapcore.Encoder
+func (e *countingEncoder) Clone() zapcore.Encoder {
+	return &countingEncoder{Encoder: e.Encoder.Clone(), stats: e.stats}
+}
+
+// EncodeEntry implements zapcore.Encoder
+func (e *countingEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	buf, err := e.Encoder.EncodeEntry(ent, fields)
+	if err != nil {
+		return buf, err
+	}
+	if i := int(ent.Level - zapcore.DebugLevel); i >= 0 && i < numLevels {
+		atomic.AddUint64(&e.stats.lines[i], 1)
+		atomic.AddUint64(&e.stats.bytes[i], uint64(buf.Len()))
+	}
+	return buf, nil
+}
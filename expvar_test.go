@@ -0,0 +1,96 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+	"expvar"
+	"reflect"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// readExpvar decodes the published map
+func readExpvar(t *testing.T) map[string]interface{} {
+	v := expvar.Get(ExpvarName)
+	if v == nil {
+		t.Fatalf("%s is not published", ExpvarName)
+	}
+	m := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(v.String()), &m); err != nil {
+		t.Fatalf("invalid expvar %q: %v", v.String(), err)
+	}
+	return m
+}
+
+func TestPublishExpvar(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer swapLogger(k)()
+	k.config.level.set(3)
+
+	PublishExpvar()
+	PublishExpvar()
+	before := readExpvar(t)
+	Info("a")
+	Info("b")
+	Warning("c")
+	after := readExpvar(t)
+
+	if after["v"] != float64(3) || after["min_severity"] != "info" {
+		t.Errorf("unexpected level in %v", after)
+	}
+	if !reflect.DeepEqual(after["outputs"], []interface{}{path}) {
+		t.Errorf("unexpected outputs %v", after["outputs"])
+	}
+	sampling, _ := after["sampling"].(map[string]interface{})
+	if sampling["enabled"] != true {
+		t.Errorf("expect sampling enabled, get %v", after["sampling"])
+	}
+	count := func(m map[string]interface{}, counters, level string) float64 {
+		c, _ := m[counters].(map[string]interface{})
+		n, _ := c[level].(float64)
+		return n
+	}
+	if n := count(after, "lines", "info") - count(before, "lines", "info"); n != 2 {
+		t.Errorf("expect 2 more info lines, get %v", n)
+	}
+	if n := count(after, "lines", "warn") - count(before, "lines", "warn"); n != 1 {
+		t.Errorf("expect 1 more warn line, get %v", n)
+	}
+	if count(after, "bytes", "info") <= count(before, "bytes", "info") {
+		t.Errorf("expect info bytes to grow, get %v", after["bytes"])
+	}
+	if _, ok := after["dropped"].(map[string]interface{})["sampling"]; !ok {
+		t.Errorf("expect dropped by sampling, get %v", after["dropped"])
+	}
+}
+
+func TestDroppedBySampling(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+
+	for i := 0; i < 150; i++ {
+		k.Info("same")
+	}
+	// production sampling keeps the first 100 and every 100th after them
+	if n := k.config.stats.droppedBySampling(); n != 50 {
+		t.Errorf("expect 50 dropped, get %d", n)
+	}
+	if n := k.config.stats.lines[zapcore.InfoLevel-zapcore.DebugLevel]; n != 100 {
+		t.Errorf("expect 100 info lines, get %d", n)
+	}
+}
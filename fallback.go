@@ -0,0 +1,184 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// fallbackReportInterval limits how often a failing output is reported
+const fallbackReportInterval = 10 * time.Second
+
+// stats are the counters of a logger
+// Keep uint64 fields first so that they are aligned for atomic operations
+type stats struct {
+	failedWrites uint64
+	auditSeq     uint64
+	seq          uint64
+	lines        [numLevels]uint64
+	bytes        [numLevels]uint64
+	// sampled away by log_sampling
+	sampled [numLevels]uint64
+	// written to stderr after Close
+	afterClose uint64
+}
+
+// FailedWrites returns how many writes failed on their outputs
+func FailedWrites() uint64 {
+	return atomic.LoadUint64(&klogger.config.stats.failedWrites)
+}
+
+// LoggedAfterClose returns how many entries were written to stderr since
+// they were logged after Close
+func LoggedAfterClose() uint64 {
+	return atomic.LoadUint64(&klogger.config.stats.afterClose)
+}
+
+// openFallback opens the output used when another output fails
+func (c *Config) openFallback() error {
+	c.sinks.stats = c.stats
+	c.sinks.fallback, c.sinks.fallbackIsOutput = nil, false
+	if c.fallbackPath.get() == "" {
+		return nil
+	}
+	fallback, err := c.sinks.open(c.fallbackPath.get())
+	if err != nil {
+		return err
+	}
+	c.sinks.fallback = fallback
+	c.sinks.fallbackIsOutput = c.fallbackIsOutput()
+	return nil
+}
+
+// fallbackIsOutput reports whether fallback_output is stderr, which every
+// entry is written to as an output anyway
+func (c *Config) fallbackIsOutput() bool {
+	if c.fallbackPath.get() != "stderr" {
+		return false
+	}
+	for _, path := range c.zapConfig.OutputPaths {
+		if path == "stderr" {
+			return true
+		}
+	}
+	for _, r := range c.allRoutes() {
+		if r.MinSeverity != "" {
+			continue
+		}
+		for _, path := range r.Outputs {
+			if path == "stderr" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// fallbackSink retries a failed write once, then writes it to the fallback
+// unless it's partly written, so that no part is written twice
+// Every write tries the primary first, so it recovers automatically
+type fallbackSink struct {
+	path     string
+	primary  zapcore.WriteSyncer
+	fallback zapcore.WriteSyncer
+	stats    *stats
+	now      func() time.Time
+	// the fallback is an output as well, only failures are reported to it
+	isOutput bool
+
+	mu         sync.Mutex
+	lastReport time.Time
+	suppressed uint64
+}
+
+// newFallbackSink wraps primary
+func newFallbackSink(path string, primary, fallback zapcore.WriteSyncer, s *stats) *fallbackSink {
+	return &fallbackSink{
+		path:     path,
+		primary:  primary,
+		fallback: fallback,
+		stats:    s,
+		now:      time.Now,
+	}
+}
+
+// Write implements zapcore.WriteSyncer
+func (s *fallbackSink) Write(p []byte) (int, error) {
+	n, err := s.primary.Write(p)
+	if err == nil {
+		return n, nil
+	}
+	m, err := s.primary.Write(p[n:])
+	if err == nil {
+		return n + m, nil
+	}
+
+	atomic.AddUint64(&s.stats.failedWrites, 1)
+	if s.fallback == nil {
+		return n + m, err
+	}
+	s.report(err)
+	if n+m > 0 {
+		return n + m, err
+	}
+	if s.isOutput {
+		return len(p), nil
+	}
+	return s.fallback.Write(p)
+}
+
+// Sync implements zapcore.WriteSyncer
+func (s *fallbackSink) Sync() error {
+	return s.primary.Sync()
+}
+
+// report writes a meta entry about the failure at most once per interval
+func (s *fallbackSink) report(err error) {
+	s.mu.Lock()
+	now := s.now()
+	if !s.lastReport.IsZero() && now.Sub(s.lastReport) < fallbackReportInterval {
+		s.suppressed++
+		s.mu.Unlock()
+		return
+	}
+	suppressed := s.suppressed
+	s.lastReport, s.suppressed = now, 0
+	s.mu.Unlock()
+
+	line, _ := json.Marshal(struct {
+		Level      string `json:"level"`
+		Time       string `json:"time"`
+		Msg        string `json:"msg"`
+		Output     string `json:"output"`
+		Error      string `json:"error"`
+		Failed     uint64 `json:"failed"`
+		Suppressed uint64 `json:"suppressed"`
+	}{
+		Level:      zap.ErrorLevel.String(),
+		Time:       now.Format("2006-01-02T15:04:05.000Z0700"),
+		Msg:        "klog: failed writing to output, falling back",
+		Output:     s.path,
+		Error:      err.Error(),
+		Failed:     atomic.LoadUint64(&s.stats.failedWrites),
+		Suppressed: suppressed,
+	})
+	s.fallback.Write(append(line, '\n'))
+}
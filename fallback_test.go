@@ -0,0 +1,163 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// failingSyncer fails the first n writes
+type failingSyncer struct {
+	bytes.Buffer
+	n int
+}
+
+func (s *failingSyncer) Write(p []byte) (int, error) {
+	if s.n > 0 {
+		s.n--
+		return 0, errors.New("disk full")
+	}
+	return s.Buffer.Write(p)
+}
+
+func (s *failingSyncer) Sync() error {
+	return nil
+}
+
+func TestFallbackSink(t *testing.T) {
+	primary := &failingSyncer{n: 5}
+	fallback := &bytes.Buffer{}
+	st := &stats{}
+	now := time.Unix(0, 0)
+	sink := newFallbackSink("primary.log", primary, zapcore.AddSync(fallback), st)
+	sink.now = func() time.Time { return now }
+
+	// recovered by retry
+	primary.n = 1
+	sink.Write([]byte("retried\n"))
+	if primary.String() != "retried\n" || st.failedWrites != 0 {
+		t.Fatalf("write should succeed on retry")
+	}
+
+	// 2 failed entries, 1 report
+	primary.n = 4
+	sink.Write([]byte("first\n"))
+	sink.Write([]byte("second\n"))
+	if st.failedWrites != 2 {
+		t.Errorf("expect 2 failed writes, get %d", st.failedWrites)
+	}
+	if strings.Count(fallback.String(), "falling back") != 1 {
+		t.Errorf("failure should be reported once: %s", fallback.String())
+	}
+	if !strings.Contains(fallback.String(), "first\n") || !strings.Contains(fallback.String(), "second\n") {
+		t.Errorf("entries should go to fallback: %s", fallback.String())
+	}
+
+	// recovered
+	sink.Write([]byte("recovered\n"))
+	if !strings.HasSuffix(primary.String(), "recovered\n") {
+		t.Errorf("primary should recover: %s", primary.String())
+	}
+
+	// reported again after the interval
+	now = now.Add(fallbackReportInterval)
+	primary.n = 2
+	sink.Write([]byte("third\n"))
+	if strings.Count(fallback.String(), "falling back") != 2 || !strings.Contains(fallback.String(), `"suppressed":1`) {
+		t.Errorf("failure should be reported again: %s", fallback.String())
+	}
+}
+
+func TestFallbackDisabled(t *testing.T) {
+	st := &stats{}
+	sink := newFallbackSink("primary.log", &failingSyncer{n: 2}, nil, st)
+	if _, err := sink.Write([]byte("lost\n")); err == nil || st.failedWrites != 1 {
+		t.Errorf("expect error without fallback, get %v", err)
+	}
+}
+
+// shortSyncer writes at most n bytes, then fails
+type shortSyncer struct {
+	bytes.Buffer
+	n int
+}
+
+func (s *shortSyncer) Write(p []byte) (int, error) {
+	if len(p) <= s.n {
+		s.n -= len(p)
+		return s.Buffer.Write(p)
+	}
+	n, _ := s.Buffer.Write(p[:s.n])
+	s.n = 0
+	return n, errors.New("disk full")
+}
+
+func (s *shortSyncer) Sync() error {
+	return nil
+}
+
+func TestFallbackShortWrite(t *testing.T) {
+	primary := &shortSyncer{n: 3}
+	fallback := &bytes.Buffer{}
+	st := &stats{}
+	sink := newFallbackSink("primary.log", primary, zapcore.AddSync(fallback), st)
+
+	n, err := sink.Write([]byte("partial\n"))
+	if n != 3 || err == nil || st.failedWrites != 1 {
+		t.Errorf("expect 3 bytes written with error, get %d, %v", n, err)
+	}
+	if primary.String() != "par" {
+		t.Errorf("unexpected primary %q", primary.String())
+	}
+	if strings.Contains(fallback.String(), "partial") || strings.Contains(fallback.String(), "tial") {
+		t.Errorf("expect no part written twice, get %q", fallback.String())
+	}
+	if !strings.Contains(fallback.String(), "falling back") {
+		t.Errorf("expect the failure reported, get %q", fallback.String())
+	}
+}
+
+func TestFallbackIsOutput(t *testing.T) {
+	c := newConfig()
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = []string{"stderr", "/var/log/app.log"}
+	if !c.fallbackIsOutput() {
+		t.Error("expect stderr fallback to be an output")
+	}
+	c.zapConfig.OutputPaths = []string{"/var/log/app.log"}
+	if c.fallbackIsOutput() {
+		t.Error("expect stderr fallback not to be an output")
+	}
+	c.humanStderr.set(true)
+	if !c.fallbackIsOutput() {
+		t.Error("expect stderr of log_human_stderr to be an output")
+	}
+
+	fallback := &bytes.Buffer{}
+	sink := newFallbackSink("primary.log", &failingSyncer{n: 2}, zapcore.AddSync(fallback), &stats{})
+	sink.isOutput = true
+	if n, err := sink.Write([]byte("once\n")); n != 5 || err != nil {
+		t.Errorf("expect the entry taken as written, get %d, %v", n, err)
+	}
+	if strings.Contains(fallback.String(), "once") || !strings.Contains(fallback.String(), "falling back") {
+		t.Errorf("expect only the failure in the fallback, get %q", fallback.String())
+	}
+}
@@ -0,0 +1,309 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// DanglingKey holds the trailing arg of WithFields when a value is missing
+	DanglingKey = "dangling"
+	// NonStringKeys lists the keys of WithFields that are not strings
+	NonStringKeys = "nonStringKeys"
+)
+
+// lazyValue is evaluated when the entry is encoded
+type lazyValue func() interface{}
+
+// MarshalJSON calls the function
+func (f lazyValue) MarshalJSON() ([]byte, error) {
+	return json.Marshal(f())
+}
+
+// Lazy returns a field whose value is computed only when the entry is written
+// Pass it to InfoS, InfoFn or WithFields to skip fn for disabled entries.
+// fn runs once per entry written, whose outputs all get the same value, and
+// the field follows the fields of the entry when it's added by WithFields
+func Lazy(key string, fn func() interface{}) zap.Field {
+	return zap.Reflect(key, lazyValue(fn))
+}
+
+// lazyOf returns the function of f if it's returned by Lazy, which
+// safeField may wrap
+func lazyOf(f zap.Field) (lazyValue, bool) {
+	if f.Type != zapcore.ReflectType {
+		return nil, false
+	}
+	v := f.Interface
+	if s, ok := v.(safeJSON); ok {
+		v = s.v
+	}
+	fn, ok := v.(lazyValue)
+	return fn, ok
+}
+
+// isLazy reports whether f is returned by Lazy
+func isLazy(f zap.Field) bool {
+	_, ok := lazyOf(f)
+	return ok
+}
+
+// resolveLazy replaces the Lazy fields with their values, so that the cores
+// of a tee encode the same value of a single call
+func resolveLazy(fields []zap.Field) []zap.Field {
+	var resolved []zap.Field
+	for i, f := range fields {
+		fn, ok := lazyOf(f)
+		if !ok {
+			continue
+		}
+		if resolved == nil {
+			resolved = append(make([]zap.Field, 0, len(fields)), fields...)
+		}
+		var v interface{}
+		if err := safely(func() error { v = fn(); return nil }); err != nil {
+			v = marshalFailed(err)
+		}
+		resolved[i] = safeField(zap.Reflect(f.Key, v))
+	}
+	if resolved == nil {
+		return fields
+	}
+	return resolved
+}
+
+// withFields adds fields to sugar. The core encodes the fields of With at
+// once, so the Lazy ones are added to each entry written by a deferredCore
+func withFields(sugar *zap.SugaredLogger, fields []zap.Field) *zap.SugaredLogger {
+	var eager, lazy []zap.Field
+	for _, f := range fields {
+		if isLazy(f) {
+			lazy = append(lazy, f)
+		} else {
+			eager = append(eager, f)
+		}
+	}
+	logger := sugar.Desugar().With(eager...)
+	if len(lazy) > 0 {
+		logger = logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return &deferredCore{Core: core, fields: func() []zap.Field { return lazy }}
+		}))
+	}
+	return logger.Sugar()
+}
+
+// sweetenFields converts loosely typed k-v pairs into zap fields
+func (k *Klogger) sweetenFields(args []interface{}) []zap.Field {
+	fields := make([]zap.Field, 0, len(args)/2+1)
+	index := make(map[string]int, len(args)/2)
+	var invalid []string
+
+	add := func(f zap.Field) {
+		key, ok := k.reserveKey(f.Key)
+		if !ok {
+			return
+		}
+		f.Key = key
+		if i, ok := index[f.Key]; ok {
+			// the last one wins
+			fields[i] = f
+			k.reportDuplicate(f.Key)
+			return
+		}
+		index[f.Key] = len(fields)
+		fields = append(fields, f)
+	}
+
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i].(type) {
+		case zap.Field:
+			add(safeField(arg))
+			continue
+		case map[string]interface{}:
+			for _, key := range sortedKeys(arg) {
+				add(anyField(key, arg[key]))
+			}
+			continue
+		case Fields:
+			for _, key := range sortedKeys(arg) {
+				add(anyField(key, arg[key]))
+			}
+			continue
+		case map[string]string:
+			keys := make([]string, 0, len(arg))
+			for key := range arg {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				add(zap.String(key, arg[key]))
+			}
+			continue
+		}
+
+		if i == len(args)-1 {
+			k.misuse("odd number of args in fields", zap.Any("arg", args[i]))
+			add(zap.Any(DanglingKey, args[i]))
+			break
+		}
+
+		key, val := args[i], args[i+1]
+		i++
+		s, ok := key.(string)
+		if !ok {
+			s = fmt.Sprint(key)
+			invalid = append(invalid, s)
+		}
+		add(anyField(s, val))
+	}
+
+	if len(invalid) > 0 {
+		k.misuse("non-string keys in fields", zap.Strings("keys", invalid))
+		add(zap.Strings(NonStringKeys, invalid))
+	}
+	return fields
+}
+
+// sortedKeys returns the keys of m in order
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// Fields is a set of fields built incrementally, then passed to WithFields
+// or the w methods in one arg, whose keys are added in order
+type Fields map[string]interface{}
+
+// Set sets the value of key, and returns f
+func (f Fields) Set(key string, val interface{}) Fields {
+	f[key] = val
+	return f
+}
+
+// Delete deletes key, and returns f
+func (f Fields) Delete(key string) Fields {
+	delete(f, key)
+	return f
+}
+
+// Merge sets the fields of other, which override the same keys of f, and
+// returns f
+func (f Fields) Merge(other Fields) Fields {
+	for key, val := range other {
+		f[key] = val
+	}
+	return f
+}
+
+// reportDuplicate logs a DPanic when strict mode is on, or in development
+func (k *Klogger) reportDuplicate(key string) {
+	if !k.config.strictFields.get() {
+		k.misuse("duplicate key in fields", zap.String("key", key))
+		return
+	}
+	k.internal().sugar.Desugar().DPanic("duplicate key in WithFields", zap.String("key", key))
+}
+
+// trackedField is a field added to a logger, the value is kept only when
+// SetFieldValueTracking is on
+type trackedField struct {
+	key      string
+	ns       bool
+	hasValue bool
+	field    zap.Field
+}
+
+// SetFieldValueTracking sets whether loggers keep the values of the fields
+// added by With and so on, which are returned by FieldValues. Default to false
+func SetFieldValueTracking(enabled bool) {
+	klogger.config.fieldValues.set(enabled)
+}
+
+// deriveWith returns a child logger with fields added by sugar
+func (k *Klogger) deriveWith(sugar *zap.SugaredLogger, fields []zap.Field) *Klogger {
+	child := k.derive(sugar)
+	values := k.config.fieldValues.get()
+	// the capacity is cut, so that siblings never share the appended ones
+	tracked := k.fields[:len(k.fields):len(k.fields)]
+	for _, f := range fields {
+		t := trackedField{key: f.Key, ns: f.Type == zapcore.NamespaceType}
+		if values {
+			t.hasValue, t.field = true, f
+		}
+		tracked = append(tracked, t)
+	}
+	child.fields = tracked
+	return child
+}
+
+// Fields returns the keys of the fields added to k by With, WithFields and
+// so on, in the order they were added. Keys inside namespaces are prefixed
+// with the namespaces joined by dots, e.g. "request.id"
+func (k *Klogger) Fields() []string {
+	keys := make([]string, 0, len(k.fields))
+	seen := make(map[string]bool, len(k.fields))
+	prefix := ""
+	for _, f := range k.fields {
+		if f.ns {
+			prefix += f.key + "."
+			continue
+		}
+		if key := prefix + f.key; !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// HasField returns whether the key is added to k, see Fields
+func (k *Klogger) HasField(key string) bool {
+	for _, f := range k.Fields() {
+		if f == key {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldValues returns the fields added to k as they are encoded, namespaces
+// are nested maps. Only the fields added while SetFieldValueTracking is on
+// are kept, it's nil if there's none
+func (k *Klogger) FieldValues() map[string]interface{} {
+	var enc *zapcore.MapObjectEncoder
+	for _, f := range k.fields {
+		if !f.hasValue {
+			continue
+		}
+		if enc == nil {
+			enc = zapcore.NewMapObjectEncoder()
+		}
+		f.field.AddTo(enc)
+	}
+	if enc == nil {
+		return nil
+	}
+	return enc.Fields
+}
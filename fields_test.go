@@ -0,0 +1,342 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestWithFieldsMaps(t *testing.T) {
+	k, buf := newTestLogger()
+
+	f := Fields{"user": "u1", "tmp": 1}
+	f.Set("status", "ok").Delete("tmp").Merge(Fields{"b": 2, "user": "u2"})
+	k.WithFields(
+		"z", 0, "a", 1,
+		map[string]interface{}{"m2": 2, "m1": 1, "a": "map"},
+		map[string]string{"s": "x", "z": "str"},
+		f,
+		"status", "overridden",
+	).Info("merged")
+	k.Infow("inline", f)
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines, got %q", buf.String())
+	}
+	// keys keep the position of their first occurrence, values the last
+	want := `"z":"str","a":"map","m1":1,"m2":2,"s":"x","b":2,"status":"overridden","user":"u2"}`
+	if !strings.HasSuffix(lines[0], want) {
+		t.Errorf("expect %s, got %s", want, lines[0])
+	}
+	if want := `"b":2,"status":"ok","user":"u2"}`; !strings.HasSuffix(lines[1], want) {
+		t.Errorf("expect %s, got %s", want, lines[1])
+	}
+}
+
+func TestWithFieldsMalformed(t *testing.T) {
+	k, buf := newTestLogger()
+
+	k.WithFields("A", 1, "B").Info("odd")
+	k.WithFields(1, "a", true, "b").Info("non-string")
+	k.WithFields("A", 1, "A", 2).Info("duplicate")
+	k.WithFields(zap.Int("A", 1), "B", 2).Info("field")
+	k.WithFields(map[string]interface{}{"B": 2, "A": 1}, "C", 3).Info("map")
+
+	if strings.Contains(buf.String(), "Ignored key") {
+		t.Fatalf("zap should not report malformed pairs: %s", buf.String())
+	}
+	entries := decodeLines(t, buf)
+	if len(entries) != 5 {
+		t.Fatalf("expect 5 entries, get %d", len(entries))
+	}
+
+	if e := entries[0]; e["A"] != float64(1) || e[DanglingKey] != "B" {
+		t.Errorf("odd args: %v", e)
+	}
+	if e := entries[1]; e["1"] != "a" || e["true"] != "b" {
+		t.Errorf("non-string keys: %v", e)
+	} else if keys, _ := e[NonStringKeys].([]interface{}); len(keys) != 2 || keys[0] != "1" || keys[1] != "true" {
+		t.Errorf("non-string keys warning: %v", e[NonStringKeys])
+	}
+	if e := entries[2]; e["A"] != float64(2) {
+		t.Errorf("duplicate keys: %v", e)
+	}
+	if strings.Count(buf.String(), `"A":2`) != 1 {
+		t.Errorf("duplicate key should be written once")
+	}
+	if e := entries[3]; e["A"] != float64(1) || e["B"] != float64(2) {
+		t.Errorf("zap field: %v", e)
+	}
+	if e := entries[4]; e["A"] != float64(1) || e["B"] != float64(2) || e["C"] != float64(3) {
+		t.Errorf("map: %v", e)
+	}
+	if !strings.Contains(buf.String(), `"A":1,"B":2,"C":3`) {
+		t.Errorf("map keys should be sorted: %s", buf.String())
+	}
+}
+
+func TestWithFieldsStrict(t *testing.T) {
+	k, buf := newTestLogger()
+	k.config.strictFields.set(true)
+
+	k.WithFields("A", 1, "A", 2).Info("duplicate")
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 || entries[0]["level"] != "dpanic" || entries[0]["key"] != "A" {
+		t.Fatalf("expect a dpanic entry for the duplicate key, get %v", entries)
+	}
+}
+
+func TestLazy(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	calls := 0
+	lazy := Lazy("big", func() interface{} {
+		calls++
+		return map[string]int{"a": 1}
+	})
+
+	V(1).InfoS("disabled", lazy)
+	V(1).InfoFn(func() (string, []interface{}) {
+		calls++
+		return "disabled", nil
+	})
+	if calls != 0 || buf.Len() != 0 {
+		t.Fatalf("disabled entries should not evaluate fields, calls: %d", calls)
+	}
+
+	InfoS("enabled", lazy)
+	V(0).InfoFn(func() (string, []interface{}) {
+		return "enabled-fn", []interface{}{"k", "v", lazy}
+	})
+	if calls != 2 {
+		t.Fatalf("expect 2 evaluations, get %d", calls)
+	}
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 || entries[1]["msg"] != "enabled-fn" || entries[1]["k"] != "v" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	for _, e := range entries {
+		if big, _ := e["big"].(map[string]interface{}); big["a"] != float64(1) {
+			t.Errorf("lazy field not encoded: %v", e)
+		}
+	}
+}
+
+func TestLazyWithFields(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	calls := 0
+	lazy := Lazy("big", func() interface{} {
+		calls++
+		return calls
+	})
+
+	l := WithFields("k", "v", lazy)
+	l.V(1).Info("disabled")
+	l.WithFields("child", 1).V(2).InfoS("disabled")
+	WithZapFields(lazy).V(1).Info("disabled")
+	if calls != 0 || buf.Len() != 0 {
+		t.Fatalf("disabled entries should not evaluate fields of WithFields, calls: %d", calls)
+	}
+
+	l.Info("first")
+	l.WithFields("child", 1).Warning("second")
+	if calls != 2 {
+		t.Fatalf("expect an evaluation per entry, get %d", calls)
+	}
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 || entries[0]["k"] != "v" || entries[0]["big"] != float64(1) {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+	if e := entries[1]; e["child"] != float64(1) || e["big"] != float64(2) || e["caller"] == nil {
+		t.Errorf("expect the lazy field on entries of children, get %v", e)
+	}
+}
+
+func TestLazyOncePerEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	main := filepath.Join(dir, "klog.log")
+	errors := filepath.Join(dir, "errors.log")
+
+	c := newConfig()
+	c.errorLogFile.set(errors)
+	c.recentEntries.set(10)
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = []string{main}
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+
+	calls := 0
+	lazy := Lazy("n", func() interface{} {
+		calls++
+		return calls
+	})
+	k.ErrorS(fmt.Errorf("failed"), "entry", lazy)
+	k.WithFields(lazy).Error("with")
+	if err := k.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Fatalf("expect an evaluation per entry, get %d", calls)
+	}
+
+	all, errs, recent := readLines(t, main), readLines(t, errors), c.recent().recent()
+	if len(all) != 2 || len(errs) != 2 || len(recent) != 2 {
+		t.Fatalf("expect 2 entries in each output, get %d, %d and %d", len(all), len(errs), len(recent))
+	}
+	for i, want := range []float64{1, 2} {
+		if all[i]["n"] != want || errs[i]["n"] != want || !strings.Contains(recent[i].Line, fmt.Sprintf(`"n":%v`, want)) {
+			t.Errorf("expect n=%v in every output, get %v, %v and %s", want, all[i]["n"], errs[i]["n"], recent[i].Line)
+		}
+	}
+}
+
+func TestInfoFnRecent(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	k.config.recentEntries.set(10)
+	rebuild(t, k)
+
+	k.V(3).InfoFn(func() (string, []interface{}) {
+		return "suppressed", []interface{}{"k", "v"}
+	})
+	recent := k.config.recent().recent()
+	if len(recent) != 1 || recent[0].Message != "suppressed" || !strings.Contains(recent[0].Line, `"k":"v"`) {
+		t.Errorf("expect the suppressed entry in the recent entries, get %v", recent)
+	}
+}
+
+func BenchmarkLazyDisabled(b *testing.B) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		V(2).InfoFn(func() (string, []interface{}) {
+			return "never", []interface{}{"big", make([]byte, 1024)}
+		})
+	}
+}
+
+func BenchmarkLazyEnabled(b *testing.B) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		V(0).InfoFn(func() (string, []interface{}) {
+			return "always", []interface{}{"big", make([]byte, 1024)}
+		})
+	}
+}
+
+func TestSugaredW(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	var code int
+	exitFunc = func(c int) { code = c }
+	defer func() { exitFunc = os.Exit }()
+	SetLevel(1)
+
+	Infow("info", "A", 1, "B")
+	k.Warningw("warn", 2, "x")
+	Errorw("error", "A", 1, "A", 2)
+	V(1).Infow("verbose", "A", 1)
+	V(2).Infow("disabled", "A", 1)
+	Fatalw("fatal", "A", 1)
+
+	entries := decodeLines(t, buf)
+	expects := []struct {
+		level, msg, key string
+		val             interface{}
+	}{
+		{"info", "info", DanglingKey, "B"},
+		{"warn", "warn", "2", "x"},
+		{"error", "error", "A", float64(2)},
+		{"debug", "verbose", "A", float64(1)},
+		{"fatal", "fatal", "A", float64(1)},
+	}
+	if len(entries) != len(expects) {
+		t.Fatalf("expect %d entries, get %v", len(expects), entries)
+	}
+	for i, e := range expects {
+		entry := entries[i]
+		if entry["level"] != e.level || entry["msg"] != e.msg || entry[e.key] != e.val {
+			t.Errorf("entry %d: expect %v, get %v", i, e, entry)
+		}
+		if caller, _ := entry["caller"].(string); !strings.Contains(caller, "fields_test.go") {
+			t.Errorf("unexpected caller %s", caller)
+		}
+	}
+	if code != 255 {
+		t.Errorf("Fatalw should exit with 255, get %d", code)
+	}
+}
+
+func TestFieldsAccumulated(t *testing.T) {
+	k, _ := newTestLogger()
+	type user struct {
+		ID   int
+		Name string
+	}
+	l := k.WithFields("request", "r1", "path", "/a").
+		With(user{ID: 1, Name: "u"}).
+		WithNamespace("db").WithFields("table", "t", "request", "r2")
+	expect := []string{"request", "path", "ID", "Name", "db.table", "db.request"}
+	if keys := l.Fields(); !reflect.DeepEqual(keys, expect) {
+		t.Errorf("expect %v, get %v", expect, keys)
+	}
+	if !l.HasField("db.table") || l.HasField("table") || l.FieldValues() != nil {
+		t.Errorf("unexpected fields of %v", l.Fields())
+	}
+
+	// siblings don't share the fields
+	a, b := l.WithFields("a", 1), l.WithFields("b", 2)
+	if a.HasField("db.b") || b.HasField("db.a") || len(k.Fields()) != 0 {
+		t.Errorf("unexpected fields %v %v", a.Fields(), b.Fields())
+	}
+}
+
+func TestFieldValues(t *testing.T) {
+	k, _ := newTestLogger()
+	k.config.fieldValues.set(true)
+	l := k.WithFields("request", "r1").WithNamespace("db").WithZapFields(zap.Int("rows", 3))
+	expect := map[string]interface{}{
+		"request": "r1",
+		"db":      map[string]interface{}{"rows": int64(3)},
+	}
+	if values := l.FieldValues(); !reflect.DeepEqual(values, expect) {
+		t.Errorf("expect %v, get %v", expect, values)
+	}
+}
@@ -0,0 +1,65 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"go.uber.org/zap"
+)
+
+// FingerprintKey holds the fingerprint of an error entry
+const FingerprintKey = "fingerprint"
+
+// WithFingerprint returns a child logger whose Errorf, Errorw and ErrorS
+// entries use fingerprint, even if error_fingerprint is not set
+func WithFingerprint(fingerprint string) *Klogger {
+	return klogger.WithFingerprint(fingerprint)
+}
+
+// WithFingerprint returns a child logger whose Errorf, Errorw and ErrorS
+// entries use fingerprint, even if error_fingerprint is not set
+func (k *Klogger) WithFingerprint(fingerprint string) *Klogger {
+	child := k.derive(k.sugar)
+	child.fingerprint = fingerprint
+	return child
+}
+
+// fingerprintField returns the fingerprint of template, which is the format
+// or the message before any arg is filled in
+func (k *Klogger) fingerprintField(template string) (zap.Field, bool) {
+	if k.fingerprint != "" {
+		return zap.String(FingerprintKey, k.fingerprint), true
+	}
+	if !k.config.fingerprint.get() {
+		return zap.Field{}, false
+	}
+	h := fnv.New64a()
+	h.Write([]byte(template))
+	return zap.String(FingerprintKey, fmt.Sprintf("%016x", h.Sum64())), true
+}
+
+// errorFields returns the fields of Errorw and ErrorS
+func (k *Klogger) errorFields(err error, msg string, kv []interface{}) []zap.Field {
+	fields := k.sweetenFields(kv)
+	if err != nil {
+		fields = append(fields, zap.Error(err))
+	}
+	if f, ok := k.fingerprintField(msg); ok {
+		fields = append(fields, f)
+	}
+	return fields
+}
@@ -0,0 +1,77 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestErrorFingerprint(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	k.config.fingerprint.set(true)
+
+	Errorf("request %d failed", 1)
+	k.Errorf("request %d failed", 2)
+	Errorf("user %s not found", "alice")
+	Errorw("request failed", "id", 1)
+	ErrorS(errors.New("timeout"), "request failed", "id", 2)
+	WithFingerprint("db").Errorf("query %d failed", 3)
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 6 {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	fp := func(i int) string {
+		s, _ := entries[i][FingerprintKey].(string)
+		return s
+	}
+	if fp(0) == "" || fp(0) != fp(1) || len(fp(0)) != 16 {
+		t.Errorf("same format should share a fingerprint: %v", entries[:2])
+	}
+	if fp(2) == fp(0) {
+		t.Errorf("different formats should not share a fingerprint")
+	}
+	if fp(3) == "" || fp(3) != fp(4) {
+		t.Errorf("same message should share a fingerprint: %v", entries[3:5])
+	}
+	if entries[1]["msg"] != "request 2 failed" || entries[4]["error"] != "timeout" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+	if fp(5) != "db" {
+		t.Errorf("expect fingerprint db, get %q", fp(5))
+	}
+	for _, e := range entries {
+		if caller, _ := e["caller"].(string); !strings.Contains(caller, "fingerprint_test.go") {
+			t.Errorf("unexpected caller %s", caller)
+		}
+	}
+}
+
+func TestErrorFingerprintDisabled(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	Errorf("request %d failed", 1)
+	Errorw("request failed")
+	for _, e := range decodeLines(t, buf) {
+		if _, ok := e[FingerprintKey]; ok {
+			t.Errorf("fingerprint should be disabled: %v", e)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestInitGoFlags(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	InitGoFlags(fs)
+	InitGoFlags(fs) // no panic
+	err := fs.Parse([]string{"-v=2", "-alsologtostderr=false", "-sanitize_messages", "-max_message_bytes", "64"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := k.config
+	if c.level.get() != 2 || c.alsologtostderr.get() || !c.sanitize.get() || c.maxMessageBytes.get() != 64 {
+		t.Errorf("flags not applied: %+v", c)
+	}
+	if paths := c.newZapConfig().OutputPaths; len(paths) != 1 || paths[0] != "stdout" {
+		t.Errorf("Singleton should honor alsologtostderr, get %v", paths)
+	}
+}
+
+func TestInitBothFlags(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+
+	gofs := flag.NewFlagSet("test", flag.ContinueOnError)
+	pfs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	InitGoFlags(gofs)
+	InitFlags(pfs)
+	pfs.AddGoFlagSet(gofs) // no panic
+	if err := pfs.Parse([]string{"--v=3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := gofs.Parse([]string{"-recent_entries=5"}); err != nil {
+		t.Fatal(err)
+	}
+	if k.config.level.get() != 3 || k.config.recentEntries.get() != 5 {
+		t.Errorf("both flag sets should write into the same config")
+	}
+}
+
+func TestInitFlagsTwice(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	InitFlags(fs)
+	InitFlags(fs) // no panic
+	if err := fs.Parse([]string{"--v=2", "--log_format=console"}); err != nil {
+		t.Fatal(err)
+	}
+	if k.config.level.get() != 2 || k.config.format.get() != "console" {
+		t.Errorf("flags not applied")
+	}
+}
+
+func TestInitFlagsWithPrefix(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+
+	// e.g. upstream klog registered its -v already
+	gofs := flag.NewFlagSet("test", flag.ContinueOnError)
+	upstream := gofs.Int("v", 0, "upstream verbosity")
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.AddGoFlagSet(gofs)
+	InitFlagsWithPrefix(fs, "klog-")
+	InitFlagsWithPrefix(fs, "klog-") // no panic
+	if err := fs.Parse([]string{"--v=1", "--klog-v=3", "--klog-v_field"}); err != nil {
+		t.Fatal(err)
+	}
+	if *upstream != 1 || k.config.level.get() != 3 || !k.config.vField.get() {
+		t.Errorf("expect prefixed flags to write into the config, get upstream %d and v %d", *upstream, k.config.level.get())
+	}
+	if fs.Lookup("log_format") != nil {
+		t.Errorf("expect no unprefixed flags")
+	}
+}
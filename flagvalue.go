@@ -0,0 +1,251 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Flags read while logging are accessed atomically, so that parsing flags
+// races with no goroutine logging before Singleton
+
+// boolValue is an atomic bool implementing pflag.Value
+type boolValue int32
+
+// get returns the value
+func (b *boolValue) get() bool {
+	return atomic.LoadInt32((*int32)(b)) != 0
+}
+
+// set stores v
+func (b *boolValue) set(v bool) {
+	var n int32
+	if v {
+		n = 1
+	}
+	atomic.StoreInt32((*int32)(b), n)
+}
+
+// String implements pflag.Value
+func (b *boolValue) String() string {
+	return strconv.FormatBool(b.get())
+}
+
+// Set implements pflag.Value
+func (b *boolValue) Set(s string) error {
+	v, err := strconv.ParseBool(s)
+	if err != nil {
+		return err
+	}
+	b.set(v)
+	return nil
+}
+
+// Type implements pflag.Value
+func (b *boolValue) Type() string {
+	return "bool"
+}
+
+// IsBoolFlag allows -flag without a value for the standard flag package
+func (b *boolValue) IsBoolFlag() bool {
+	return true
+}
+
+// intValue is an atomic int implementing pflag.Value
+type intValue int64
+
+// get returns the value
+func (i *intValue) get() int {
+	return int(atomic.LoadInt64((*int64)(i)))
+}
+
+// set stores v
+func (i *intValue) set(v int) {
+	atomic.StoreInt64((*int64)(i), int64(v))
+}
+
+// String implements pflag.Value
+func (i *intValue) String() string {
+	return strconv.Itoa(i.get())
+}
+
+// Set implements pflag.Value
+func (i *intValue) Set(s string) error {
+	v, err := strconv.ParseInt(s, 0, 64)
+	if err != nil {
+		return err
+	}
+	i.set(int(v))
+	return nil
+}
+
+// Type implements pflag.Value
+func (i *intValue) Type() string {
+	return "int"
+}
+
+// stringValue is an atomic string implementing pflag.Value
+type stringValue struct {
+	v atomic.Value
+}
+
+// get returns the value
+func (s *stringValue) get() string {
+	v, _ := s.v.Load().(string)
+	return v
+}
+
+// set stores v
+func (s *stringValue) set(v string) {
+	s.v.Store(v)
+}
+
+// String implements pflag.Value
+func (s *stringValue) String() string {
+	return s.get()
+}
+
+// Set implements pflag.Value
+func (s *stringValue) Set(v string) error {
+	s.set(v)
+	return nil
+}
+
+// Type implements pflag.Value
+func (s *stringValue) Type() string {
+	return "string"
+}
+
+// uint64Value is an atomic uint64 implementing pflag.Value
+type uint64Value uint64
+
+// get returns the value
+func (u *uint64Value) get() uint64 {
+	return atomic.LoadUint64((*uint64)(u))
+}
+
+// set stores v
+func (u *uint64Value) set(v uint64) {
+	atomic.StoreUint64((*uint64)(u), v)
+}
+
+// String implements pflag.Value
+func (u *uint64Value) String() string {
+	return strconv.FormatUint(u.get(), 10)
+}
+
+// Set implements pflag.Value
+func (u *uint64Value) Set(s string) error {
+	v, err := strconv.ParseUint(s, 0, 64)
+	if err != nil {
+		return err
+	}
+	u.set(v)
+	return nil
+}
+
+// Type implements pflag.Value
+func (u *uint64Value) Type() string {
+	return "uint64"
+}
+
+// durationFlag is an atomic time.Duration implementing pflag.Value
+type durationFlag int64
+
+// get returns the value
+func (d *durationFlag) get() time.Duration {
+	return time.Duration(atomic.LoadInt64((*int64)(d)))
+}
+
+// set stores v
+func (d *durationFlag) set(v time.Duration) {
+	atomic.StoreInt64((*int64)(d), int64(v))
+}
+
+// String implements pflag.Value
+func (d *durationFlag) String() string {
+	return d.get().String()
+}
+
+// Set implements pflag.Value
+func (d *durationFlag) Set(s string) error {
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.set(v)
+	return nil
+}
+
+// Type implements pflag.Value
+func (d *durationFlag) Type() string {
+	return "duration"
+}
+
+// stringsValue is an atomic []string implementing pflag.Value, which takes
+// comma separated values like pflag.StringSlice. The first Set replaces the
+// default, the later ones append to it
+type stringsValue struct {
+	v       atomic.Value
+	changed int32
+}
+
+// get returns the value, which must not be modified
+func (s *stringsValue) get() []string {
+	v, _ := s.v.Load().([]string)
+	return v
+}
+
+// set stores a copy of v
+func (s *stringsValue) set(v []string) {
+	s.v.Store(append([]string(nil), v...))
+}
+
+// String implements pflag.Value
+func (s *stringsValue) String() string {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.Write(s.get())
+	w.Flush()
+	return "[" + strings.TrimSuffix(b.String(), "\n") + "]"
+}
+
+// Set implements pflag.Value
+func (s *stringsValue) Set(v string) error {
+	var values []string
+	if v != "" {
+		var err error
+		values, err = csv.NewReader(strings.NewReader(v)).Read()
+		if err != nil {
+			return err
+		}
+	}
+	if atomic.SwapInt32(&s.changed, 1) != 0 {
+		old := s.get()
+		values = append(old[:len(old):len(old)], values...)
+	}
+	s.set(values)
+	return nil
+}
+
+// Type implements pflag.Value
+func (s *stringsValue) Type() string {
+	return "stringSlice"
+}
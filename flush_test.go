@@ -0,0 +1,151 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+)
+
+// countingScheme opens countingSinks named by the host of the URL
+const countingScheme = "klogcount"
+
+var (
+	countingSinks   sync.Map
+	registerCounter sync.Once
+)
+
+// countingSink counts the calls of Sync, which fails with err and blocks
+// until release is closed if it's not nil
+type countingSink struct {
+	syncs   uint64
+	err     error
+	release chan struct{}
+}
+
+func (s *countingSink) Write(p []byte) (int, error) { return len(p), nil }
+func (s *countingSink) Close() error                { return nil }
+
+func (s *countingSink) Sync() error {
+	atomic.AddUint64(&s.syncs, 1)
+	if s.release != nil {
+		<-s.release
+	}
+	return s.err
+}
+
+// newCountingSink registers a sink, and returns it with its path
+func newCountingSink(t *testing.T, name string) (*countingSink, string) {
+	registerCounter.Do(func() {
+		err := zap.RegisterSink(countingScheme, func(u *url.URL) (zap.Sink, error) {
+			s, _ := countingSinks.Load(u.Host)
+			return s.(*countingSink), nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	s := &countingSink{}
+	countingSinks.Store(name, s)
+	return s, countingScheme + "://" + name
+}
+
+func TestFlushEverySink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	main, mainPath := newCountingSink(t, "main")
+	errOut, errPath := newCountingSink(t, "errors")
+	audit, auditPath := newCountingSink(t, "audit")
+	route, routePath := newCountingSink(t, "route")
+	named, namedPath := newCountingSink(t, "named")
+
+	c := newConfig()
+	c.errorLogFile.set(filepath.Join(dir, "error.log"))
+	c.auditPaths.set([]string{auditPath})
+	c.routes = []RouteConfig{{Format: "console", Outputs: []string{routePath}}}
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = []string{mainPath}
+	c.zapConfig.ErrorOutputPaths = []string{errPath}
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+	defer k.Close(context.Background())
+	defer swapLogger(k)()
+	if err := ConfigureLogger("flushed", LoggerOverrides{OutputPaths: []string{namedPath}}); err != nil {
+		t.Fatal(err)
+	}
+	defer ConfigureLogger("flushed", LoggerOverrides{})
+
+	if err := Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+	for name, s := range map[string]*countingSink{"main": main, "errors": errOut, "audit": audit, "route": route, "named": named} {
+		if n := atomic.LoadUint64(&s.syncs); n != 1 {
+			t.Errorf("expect %s synced once, got %d", name, n)
+		}
+	}
+
+	errA, errB := errors.New("a"), errors.New("b")
+	main.err, audit.err = errA, errB
+	err = Flush()
+	if errs := multierr.Errors(err); len(errs) != 2 || errs[0] != errA && errs[1] != errA {
+		t.Errorf("expect both errors, got %v", err)
+	}
+	if n := atomic.LoadUint64(&route.syncs); n != 2 {
+		t.Errorf("expect every sink synced despite errors, got %d", n)
+	}
+}
+
+func TestFlushWithTimeout(t *testing.T) {
+	blocked, path := newCountingSink(t, "blocked")
+	blocked.release = make(chan struct{})
+	c := newConfig()
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = []string{path}
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer swapLogger(&Klogger{sugar: zlogger.Sugar(), config: c})()
+
+	start := time.Now()
+	if err := FlushWithTimeout(20 * time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("expect deadline exceeded, got %v", err)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("expect flush given up, took %v", d)
+	}
+	close(blocked.release)
+	if err := FlushWithTimeout(time.Second); err != nil {
+		t.Errorf("flush: %v", err)
+	}
+}
@@ -0,0 +1,382 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// forwardScheme is the scheme of Fluent Forward outputs,
+	// e.g. forward://127.0.0.1:24224?tag=app
+	forwardScheme = "forward"
+
+	defaultForwardTag      = "klog"
+	defaultForwardBatch    = 100
+	defaultForwardInterval = time.Second
+	defaultForwardQueue    = 1024
+
+	forwardMinBackoff   = 100 * time.Millisecond
+	forwardMaxBackoff   = 10 * time.Second
+	forwardWriteTimeout = 5 * time.Second
+)
+
+// errForwardDisconnected is returned by Sync while waiting to reconnect
+var errForwardDisconnected = errors.New("klog: forward output is disconnected")
+
+// droppedEntries counts entries dropped by full queues
+var droppedEntries uint64
+
+func init() {
+	if err := zap.RegisterSink(forwardScheme, newForwardSink); err != nil {
+		panic(err)
+	}
+}
+
+// DroppedEntries returns how many entries were dropped because the queue of
+// a network output was full, or because it was closed while disconnected
+func DroppedEntries() uint64 {
+	return atomic.LoadUint64(&droppedEntries)
+}
+
+// forwardEntry is an entry waiting to be sent
+type forwardEntry struct {
+	time int64
+	line []byte
+}
+
+// forwardSink sends entries to a Fluent Forward server, e.g. fluent-bit
+// Writes never block: entries are queued, and the newest ones are dropped
+// when the queue is full. A goroutine sends them in batches of up to batch
+// entries or every interval, and reconnects with exponential backoff
+type forwardSink struct {
+	addr     string
+	tag      string
+	batch    int
+	interval time.Duration
+	dial     func(addr string) (net.Conn, error)
+
+	queue chan forwardEntry
+	sync  chan chan error
+	stop  chan struct{}
+	done  chan struct{}
+	once  sync.Once
+
+	// owned by loop
+	conn      net.Conn
+	pending   []forwardEntry
+	backoff   time.Duration
+	retryAt   time.Time
+	lastError error
+}
+
+// newForwardSink is registered to zap for forward:// paths
+// Query parameters are tag, batch, interval and queue
+func newForwardSink(u *url.URL) (zap.Sink, error) {
+	if u.Host == "" {
+		return nil, fmt.Errorf("klog: no address in forward output %q", u)
+	}
+	q := u.Query()
+	s := &forwardSink{
+		addr:     u.Host,
+		tag:      defaultForwardTag,
+		batch:    defaultForwardBatch,
+		interval: defaultForwardInterval,
+		dial: func(addr string) (net.Conn, error) {
+			return net.DialTimeout("tcp", addr, forwardWriteTimeout)
+		},
+	}
+	if tag := q.Get("tag"); tag != "" {
+		s.tag = tag
+	}
+	queue := defaultForwardQueue
+	for _, p := range []struct {
+		key string
+		n   *int
+	}{{"batch", &s.batch}, {"queue", &queue}} {
+		if v := q.Get(p.key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("klog: invalid %s %q in forward output", p.key, v)
+			}
+			*p.n = n
+		}
+	}
+	if v := q.Get("interval"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			return nil, fmt.Errorf("klog: invalid interval %q in forward output", v)
+		}
+		s.interval = d
+	}
+	s.start(queue)
+	return s, nil
+}
+
+// start runs the sending goroutine
+func (s *forwardSink) start(queue int) {
+	s.queue = make(chan forwardEntry, queue)
+	s.sync = make(chan chan error)
+	s.stop = make(chan struct{})
+	s.done = make(chan struct{})
+	go s.loop()
+}
+
+// Write implements zap.Sink, p is one encoded entry
+func (s *forwardSink) Write(p []byte) (int, error) {
+	e := forwardEntry{
+		time: time.Now().Unix(),
+		line: append([]byte(nil), p...),
+	}
+	select {
+	case s.queue <- e:
+	default:
+		atomic.AddUint64(&droppedEntries, 1)
+	}
+	return len(p), nil
+}
+
+// Sync implements zap.Sink, it sends the queued entries once
+func (s *forwardSink) Sync() error {
+	reply := make(chan error, 1)
+	select {
+	case s.sync <- reply:
+		return <-reply
+	case <-s.done:
+		return nil
+	}
+}
+
+// Close implements zap.Sink, it sends the queued entries once then
+// disconnects. The entries it fails to send are dropped
+func (s *forwardSink) Close() error {
+	s.once.Do(func() { close(s.stop) })
+	<-s.done
+	return nil
+}
+
+// loop owns the connection and the pending batch
+func (s *forwardSink) loop() {
+	defer close(s.done)
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case e := <-s.queue:
+			s.add(e)
+			if len(s.pending) >= s.batch {
+				s.flush()
+			}
+		case <-ticker.C:
+			s.flush()
+		case reply := <-s.sync:
+			s.drain()
+			reply <- s.flush()
+		case <-s.stop:
+			s.drain()
+			if s.flush() != nil {
+				// no further attempt, the unsent entries are lost
+				atomic.AddUint64(&droppedEntries, uint64(len(s.pending)))
+				s.pending = nil
+			}
+			if s.conn != nil {
+				s.conn.Close()
+			}
+			return
+		}
+	}
+}
+
+// add appends e to the pending batch, which is bounded by the queue size
+// while disconnected
+func (s *forwardSink) add(e forwardEntry) {
+	if len(s.pending) >= cap(s.queue) {
+		atomic.AddUint64(&droppedEntries, 1)
+		return
+	}
+	s.pending = append(s.pending, e)
+}
+
+// drain moves queued entries into the pending batch
+func (s *forwardSink) drain() {
+	for {
+		select {
+		case e := <-s.queue:
+			s.add(e)
+		default:
+			return
+		}
+	}
+}
+
+// flush sends the pending batch, a failure keeps it for the next attempt
+func (s *forwardSink) flush() error {
+	if len(s.pending) == 0 {
+		return nil
+	}
+	if s.conn == nil {
+		if time.Now().Before(s.retryAt) {
+			return errForwardDisconnected
+		}
+		conn, err := s.dial(s.addr)
+		if err != nil {
+			return s.fail(err)
+		}
+		s.conn = conn
+	}
+
+	for start := 0; start < len(s.pending); start += s.batch {
+		end := start + s.batch
+		if end > len(s.pending) {
+			end = len(s.pending)
+		}
+		s.conn.SetWriteDeadline(time.Now().Add(forwardWriteTimeout))
+		if _, err := s.conn.Write(s.encode(s.pending[start:end])); err != nil {
+			s.pending = s.pending[start:]
+			s.conn.Close()
+			s.conn = nil
+			return s.fail(err)
+		}
+	}
+	s.pending = s.pending[:0]
+	s.backoff = 0
+	return nil
+}
+
+// fail schedules the next connection attempt
+func (s *forwardSink) fail(err error) error {
+	if s.backoff == 0 {
+		s.backoff = forwardMinBackoff
+	} else if s.backoff *= 2; s.backoff > forwardMaxBackoff {
+		s.backoff = forwardMaxBackoff
+	}
+	s.retryAt = time.Now().Add(s.backoff)
+	return err
+}
+
+// encode frames entries as a Forward mode message: [tag, [[time, record]...]]
+// A JSON entry becomes the record, other encodings are put under "log"
+func (s *forwardSink) encode(entries []forwardEntry) []byte {
+	var b bytes.Buffer
+	appendMsgpackArrayHeader(&b, 2)
+	appendMsgpack(&b, s.tag)
+	appendMsgpackArrayHeader(&b, len(entries))
+	for _, e := range entries {
+		appendMsgpackArrayHeader(&b, 2)
+		appendMsgpack(&b, e.time)
+		line := bytes.TrimRight(e.line, "\n")
+		var record map[string]interface{}
+		dec := json.NewDecoder(bytes.NewReader(line))
+		dec.UseNumber()
+		if err := dec.Decode(&record); err != nil || record == nil {
+			record = map[string]interface{}{"log": string(line)}
+		}
+		appendMsgpack(&b, record)
+	}
+	return b.Bytes()
+}
+
+// appendMsgpack encodes the values decoded from JSON into msgpack
+func appendMsgpack(b *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case nil:
+		b.WriteByte(0xc0)
+	case bool:
+		if v {
+			b.WriteByte(0xc3)
+		} else {
+			b.WriteByte(0xc2)
+		}
+	case int64:
+		appendMsgpackInt(b, v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			appendMsgpackInt(b, n)
+			return
+		}
+		f, _ := v.Float64()
+		b.WriteByte(0xcb)
+		binary.Write(b, binary.BigEndian, math.Float64bits(f))
+	case string:
+		appendMsgpackHeader(b, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		b.WriteString(v)
+	case []interface{}:
+		appendMsgpackArrayHeader(b, len(v))
+		for _, e := range v {
+			appendMsgpack(b, e)
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		appendMsgpackHeader(b, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, k := range keys {
+			appendMsgpack(b, k)
+			appendMsgpack(b, v[k])
+		}
+	default:
+		appendMsgpack(b, fmt.Sprint(v))
+	}
+}
+
+// appendMsgpackInt writes a fixint or an int64
+func appendMsgpackInt(b *bytes.Buffer, n int64) {
+	if n >= -32 && n < 128 {
+		b.WriteByte(byte(n))
+		return
+	}
+	b.WriteByte(0xd3)
+	binary.Write(b, binary.BigEndian, n)
+}
+
+// appendMsgpackArrayHeader writes the header of an array of n elements
+func appendMsgpackArrayHeader(b *bytes.Buffer, n int) {
+	appendMsgpackHeader(b, n, 0x90, 16, 0, 0xdc, 0xdd)
+}
+
+// appendMsgpackHeader writes the smallest header of length n: the fix form
+// below fixMax, then 8 bits if code8 is not 0, 16 bits and 32 bits
+func appendMsgpackHeader(b *bytes.Buffer, n int, fix byte, fixMax int, code8, code16, code32 byte) {
+	switch {
+	case n < fixMax:
+		b.WriteByte(fix | byte(n))
+	case code8 != 0 && n <= math.MaxUint8:
+		b.WriteByte(code8)
+		b.WriteByte(byte(n))
+	case n <= math.MaxUint16:
+		b.WriteByte(code16)
+		binary.Write(b, binary.BigEndian, uint16(n))
+	default:
+		b.WriteByte(code32)
+		binary.Write(b, binary.BigEndian, uint32(n))
+	}
+}
@@ -0,0 +1,306 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// decodeMsgpack reads one value of the types written by appendMsgpack
+func decodeMsgpack(r *bufio.Reader) (interface{}, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length := func(n int) (int, error) {
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, err
+		}
+		var l uint64
+		for _, b := range buf {
+			l = l<<8 | uint64(b)
+		}
+		return int(l), nil
+	}
+	str := func(n int, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, n)
+		_, err = io.ReadFull(r, buf)
+		return string(buf), err
+	}
+	array := func(n int, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		a := make([]interface{}, n)
+		for i := range a {
+			if a[i], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return a, nil
+	}
+	object := func(n int, err error) (interface{}, error) {
+		if err != nil {
+			return nil, err
+		}
+		m := make(map[string]interface{}, n)
+		for i := 0; i < n; i++ {
+			k, err := decodeMsgpack(r)
+			if err != nil {
+				return nil, err
+			}
+			if m[k.(string)], err = decodeMsgpack(r); err != nil {
+				return nil, err
+			}
+		}
+		return m, nil
+	}
+
+	switch {
+	case c < 0x80:
+		return int64(c), nil
+	case c >= 0xe0:
+		return int64(int8(c)), nil
+	case c&0xf0 == 0x80:
+		return object(int(c&0x0f), nil)
+	case c&0xf0 == 0x90:
+		return array(int(c&0x0f), nil)
+	case c&0xe0 == 0xa0:
+		return str(int(c&0x1f), nil)
+	}
+	switch c {
+	case 0xc0:
+		return nil, nil
+	case 0xc2, 0xc3:
+		return c == 0xc3, nil
+	case 0xcb:
+		var bits uint64
+		err := binary.Read(r, binary.BigEndian, &bits)
+		return math.Float64frombits(bits), err
+	case 0xd3:
+		var n int64
+		err := binary.Read(r, binary.BigEndian, &n)
+		return n, err
+	case 0xd9:
+		return str(length(1))
+	case 0xda:
+		return str(length(2))
+	case 0xdb:
+		return str(length(4))
+	case 0xdc:
+		return array(length(2))
+	case 0xdd:
+		return array(length(4))
+	case 0xde:
+		return object(length(2))
+	case 0xdf:
+		return object(length(4))
+	}
+	return nil, fmt.Errorf("unexpected msgpack type %#x", c)
+}
+
+// forwardServer accepts Forward messages and sends each entry with its tag
+type forwardServer struct {
+	net.Listener
+	entries chan [2]interface{}
+}
+
+// newForwardServer listens on a random local port
+func newForwardServer(t *testing.T) *forwardServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &forwardServer{l, make(chan [2]interface{}, 100)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+// serve decodes messages until the connection is closed
+func (s *forwardServer) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	for {
+		v, err := decodeMsgpack(r)
+		if err != nil {
+			return
+		}
+		msg := v.([]interface{})
+		for _, e := range msg[1].([]interface{}) {
+			s.entries <- [2]interface{}{msg[0], e.([]interface{})[1]}
+		}
+	}
+}
+
+// next returns the tag and the record of the next entry
+func (s *forwardServer) next(t *testing.T) (interface{}, map[string]interface{}) {
+	select {
+	case e := <-s.entries:
+		return e[0], e[1].(map[string]interface{})
+	case <-time.After(5 * time.Second):
+		t.Fatal("no entry is received")
+	}
+	return nil, nil
+}
+
+func TestForwardSink(t *testing.T) {
+	server := newForwardServer(t)
+	defer server.Close()
+
+	c := newConfig()
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = []string{"forward://" + server.Addr().String() + "?tag=app&batch=2&interval=10ms"}
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+
+	k.Infof("hello %d", 1)
+	k.WithFields("n", 2, "ok", true).Infof("world")
+	for _, want := range []string{"hello 1", "world"} {
+		tag, record := server.next(t)
+		if tag != "app" || record["msg"] != want {
+			t.Errorf("expect %s tagged app, get %v %v", want, tag, record)
+		}
+		if want == "world" && (record["n"] != int64(2) || record["ok"] != true) {
+			t.Errorf("unexpected fields %v", record)
+		}
+	}
+
+	k.Infof("last")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := k.Close(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, record := server.next(t); record["msg"] != "last" {
+		t.Errorf("unexpected record %v", record)
+	}
+}
+
+func TestForwardReconnect(t *testing.T) {
+	server := newForwardServer(t)
+	defer server.Close()
+
+	var dials int32
+	s := &forwardSink{
+		addr:     server.Addr().String(),
+		tag:      "app",
+		batch:    10,
+		interval: time.Hour,
+		dial: func(addr string) (net.Conn, error) {
+			if atomic.AddInt32(&dials, 1) == 1 {
+				return nil, errors.New("refused")
+			}
+			return net.Dial("tcp", addr)
+		},
+	}
+	s.start(10)
+	defer s.Close()
+
+	s.Write([]byte("not json\n"))
+	if err := s.Sync(); err == nil {
+		t.Fatal("expect the first dial to fail")
+	}
+	if err := s.Sync(); err != errForwardDisconnected {
+		t.Fatalf("expect backoff, get %v", err)
+	}
+	time.Sleep(2 * forwardMinBackoff)
+	if err := s.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if _, record := server.next(t); record["log"] != "not json" {
+		t.Errorf("unexpected record %v", record)
+	}
+}
+
+func TestForwardQueueFull(t *testing.T) {
+	s := &forwardSink{queue: make(chan forwardEntry, 1)}
+	dropped := DroppedEntries()
+	for i := 0; i < 3; i++ {
+		if n, err := s.Write([]byte("{}\n")); n != 3 || err != nil {
+			t.Fatalf("write: %d %v", n, err)
+		}
+	}
+	if d := DroppedEntries() - dropped; d != 2 {
+		t.Errorf("expect 2 dropped entries, get %d", d)
+	}
+}
+
+func TestForwardCloseDisconnected(t *testing.T) {
+	s := &forwardSink{
+		tag:      "app",
+		batch:    10,
+		interval: time.Hour,
+		dial: func(string) (net.Conn, error) {
+			return nil, errors.New("refused")
+		},
+	}
+	s.start(10)
+	dropped := DroppedEntries()
+	for i := 0; i < 3; i++ {
+		s.Write([]byte("{}\n"))
+	}
+	if err := s.Sync(); err == nil {
+		t.Fatal("expect the dial to fail")
+	}
+	s.Write([]byte("{}\n"))
+	s.Close()
+	if d := DroppedEntries() - dropped; d != 4 {
+		t.Errorf("expect 4 dropped entries, get %d", d)
+	}
+}
+
+func TestForwardInvalidURL(t *testing.T) {
+	c := newConfig()
+	c.zapConfig = c.newZapConfig()
+	for _, path := range []string{"forward://", "forward://127.0.0.1:1?batch=0", "forward://127.0.0.1:1?interval=x"} {
+		c.zapConfig.OutputPaths = []string{path}
+		if _, err := c.build(); err == nil {
+			t.Errorf("expect %s to be rejected", path)
+		}
+	}
+}
+
+func TestLogOutput(t *testing.T) {
+	c := newConfig()
+	c.outputPaths.set([]string{"forward://127.0.0.1:24224", "stderr"})
+	if paths := c.newZapConfig().OutputPaths; len(paths) != 2 || paths[0] != c.outputPaths.get()[0] {
+		t.Errorf("log_output should replace the outputs, get %v", paths)
+	}
+}
@@ -0,0 +1,136 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// maxGateSites bounds the call sites counted by First and Every, the least
+// called site is forgotten when there're more
+const maxGateSites = 4096
+
+var (
+	// gates counts the calls of First and Every by call site
+	gates = &gateSites{counters: make(map[uintptr]*uint64)}
+	// closedSugar writes the entries of closed gates
+	closedSugar = zap.NewNop().Sugar()
+)
+
+// gateSites maps the pc of call sites to their counts
+type gateSites struct {
+	mu       sync.RWMutex
+	counters map[uintptr]*uint64
+}
+
+// count increases the count of pc and returns it
+func (g *gateSites) count(pc uintptr) uint64 {
+	g.mu.RLock()
+	c, ok := g.counters[pc]
+	g.mu.RUnlock()
+	if !ok {
+		g.mu.Lock()
+		if c, ok = g.counters[pc]; !ok {
+			if len(g.counters) >= maxGateSites {
+				g.evict()
+			}
+			c = new(uint64)
+			g.counters[pc] = c
+		}
+		g.mu.Unlock()
+	}
+	return atomic.AddUint64(c, 1)
+}
+
+// evict forgets the site of the lowest count, so that the hot sites never
+// log their first entries again. g.mu is held
+func (g *gateSites) evict() {
+	var least uintptr
+	min := ^uint64(0)
+	for pc, c := range g.counters {
+		if n := atomic.LoadUint64(c); n < min {
+			least, min = pc, n
+		}
+	}
+	delete(g.counters, least)
+}
+
+// reset forgets every site
+func (g *gateSites) reset() {
+	g.mu.Lock()
+	g.counters = make(map[uintptr]*uint64)
+	g.mu.Unlock()
+}
+
+// ResetGates forgets the counts of First and Every, e.g. between tests
+func ResetGates() {
+	gates.reset()
+}
+
+// First returns the global logger for the first n calls from the same call
+// site, e.g. klog.First(5).Infof(...), and a logger writing nothing after
+func First(n int) *Klogger {
+	pc, _, _, _ := runtime.Caller(1)
+	return klogger.first(pc, n)
+}
+
+// First returns k for the first n calls from the same call site, and a
+// logger writing nothing after
+func (k *Klogger) First(n int) *Klogger {
+	pc, _, _, _ := runtime.Caller(1)
+	return k.first(pc, n)
+}
+
+// Every returns the global logger for the first call and every n-th after
+// it from the same call site, e.g. klog.Every(1000).Warningf(...). Entries
+// after the first have the calls skipped since the last one as "suppressed"
+func Every(n int) *Klogger {
+	pc, _, _, _ := runtime.Caller(1)
+	return klogger.every(pc, n)
+}
+
+// Every returns k for the first call and every n-th after it from the same
+// call site, see Every
+func (k *Klogger) Every(n int) *Klogger {
+	pc, _, _, _ := runtime.Caller(1)
+	return k.every(pc, n)
+}
+
+// first implements First
+func (k *Klogger) first(pc uintptr, n int) *Klogger {
+	if gates.count(pc) <= uint64(n) {
+		return k
+	}
+	return k.derive(closedSugar)
+}
+
+// every implements Every
+func (k *Klogger) every(pc uintptr, n int) *Klogger {
+	if n <= 1 {
+		return k
+	}
+	c := gates.count(pc)
+	if (c-1)%uint64(n) != 0 {
+		return k.derive(closedSugar)
+	}
+	if c == 1 {
+		return k
+	}
+	return k.WithZapFields(zap.Int(SuppressedKey, n-1))
+}
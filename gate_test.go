@@ -0,0 +1,81 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFirstAndEvery(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	ResetGates()
+	defer ResetGates()
+
+	for i := 0; i < 10000; i++ {
+		First(5).Infof("first %d", i)
+		Every(1000).Warningf("every %d", i)
+		k.Every(1000).Infof("method %d", i)
+	}
+	// another call site counts on its own
+	First(5).Infof("another")
+
+	counts := map[string]int{}
+	for _, e := range decodeLines(t, buf) {
+		msg, _ := e["msg"].(string)
+		kind := strings.Fields(msg)[0]
+		counts[kind]++
+		if caller, _ := e["caller"].(string); !strings.Contains(caller, "/gate_test.go:") {
+			t.Errorf("expect the caller in this file, get %q", caller)
+		}
+		switch {
+		case kind == "first" || kind == "another" || msg == "every 0" || msg == "method 0":
+			if _, ok := e[SuppressedKey]; ok {
+				t.Errorf("unexpected %s in %v", SuppressedKey, e)
+			}
+		default:
+			if e[SuppressedKey] != float64(999) {
+				t.Errorf("expect 999 suppressed, get %v", e)
+			}
+		}
+	}
+	expect := map[string]int{"first": 5, "every": 10, "method": 10, "another": 1}
+	for kind, n := range expect {
+		if counts[kind] != n {
+			t.Errorf("expect %d %s entries, get %d", n, kind, counts[kind])
+		}
+	}
+}
+
+func TestGateSitesBounded(t *testing.T) {
+	g := &gateSites{counters: make(map[uintptr]*uint64)}
+	// a hot site
+	for i := 0; i < 10; i++ {
+		g.count(0)
+	}
+	for pc := uintptr(1); pc < maxGateSites+10; pc++ {
+		g.count(pc)
+	}
+	if len(g.counters) != maxGateSites {
+		t.Errorf("expect %d sites, get %d", maxGateSites, len(g.counters))
+	}
+	if g.count(0) != 11 {
+		t.Error("expect the hot site to be kept")
+	}
+	if g.count(maxGateSites+9) != 2 {
+		t.Error("expect the latest site to be kept")
+	}
+}
@@ -0,0 +1,101 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"runtime"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+// gcpSourceLocationKey is read by Google Cloud Logging
+const gcpSourceLocationKey = "logging.googleapis.com/sourceLocation"
+
+// gcpSeverities maps zap levels to the severities of Google Cloud Logging
+var gcpSeverities = map[zapcore.Level]string{
+	zapcore.DebugLevel:  "DEBUG",
+	zapcore.InfoLevel:   "INFO",
+	zapcore.WarnLevel:   "WARNING",
+	zapcore.ErrorLevel:  "ERROR",
+	zapcore.DPanicLevel: "CRITICAL",
+	zapcore.PanicLevel:  "ALERT",
+	zapcore.FatalLevel:  "CRITICAL",
+}
+
+// gcpLevelEncoder encodes levels as Google Cloud Logging severities
+func gcpLevelEncoder(l zapcore.Level, enc zapcore.PrimitiveArrayEncoder) {
+	if s, ok := gcpSeverities[l]; ok {
+		enc.AppendString(s)
+		return
+	}
+	enc.AppendString("DEFAULT")
+}
+
+// rfc3339NanoTimeEncoder encodes times in RFC3339 with nanoseconds
+func rfc3339NanoTimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+	enc.AppendString(t.Format(time.RFC3339Nano))
+}
+
+// gcpEncoderConfig returns the encoder config of log_format=gcp
+// The caller is encoded as the source location by gcpEncoder instead
+func gcpEncoderConfig(c zapcore.EncoderConfig) zapcore.EncoderConfig {
+	c.TimeKey = "time"
+	c.EncodeTime = rfc3339NanoTimeEncoder
+	c.LevelKey = "severity"
+	c.EncodeLevel = gcpLevelEncoder
+	c.MessageKey = "message"
+	c.CallerKey = ""
+	return c
+}
+
+// sourceLocation is the caller in the form of Google Cloud Logging
+type sourceLocation zapcore.EntryCaller
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (s sourceLocation) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("file", s.File)
+	enc.AddString("line", strconv.Itoa(s.Line))
+	if fn := runtime.FuncForPC(s.PC); fn != nil {
+		enc.AddString("function", fn.Name())
+	}
+	return nil
+}
+
+// gcpEncoder is a JSON encoder adding the source location of entries
+type gcpEncoder struct {
+	zapcore.Encoder
+}
+
+// newGCPEncoder returns the encoder of log_format=gcp
+func newGCPEncoder(c zapcore.EncoderConfig) zapcore.Encoder {
+	return gcpEncoder{zapcore.NewJSONEncoder(gcpEncoderConfig(c))}
+}
+
+// Clone implements zapcore.Encoder
+func (e gcpEncoder) Clone() zapcore.Encoder {
+	return gcpEncoder{e.Encoder.Clone()}
+}
+
+// EncodeEntry implements zapcore.Encoder
+func (e gcpEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	if ent.Caller.Defined {
+		fields = append(fields[:len(fields):len(fields)], zap.Object(gcpSourceLocationKey, sourceLocation(ent.Caller)))
+	}
+	return e.Encoder.EncodeEntry(ent, fields)
+}
@@ -0,0 +1,87 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestGCPEncoder(t *testing.T) {
+	c := newConfig()
+	c.format.set("gcp")
+	enc := newGCPEncoder(c.newZapConfig().EncoderConfig)
+	at := time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC)
+	caller := zapcore.EntryCaller{Defined: true, File: "/src/app/main.go", Line: 42}
+
+	for _, tc := range []struct {
+		ent    zapcore.Entry
+		fields []zapcore.Field
+		golden string
+	}{
+		{
+			zapcore.Entry{Level: zapcore.InfoLevel, Time: at, Message: "hello", Caller: caller},
+			[]zapcore.Field{zap.Int("n", 1)},
+			`{"severity":"INFO","time":"2020-01-02T03:04:05.000000006Z","message":"hello","n":1,"logging.googleapis.com/sourceLocation":{"file":"/src/app/main.go","line":"42"}}`,
+		},
+		{
+			zapcore.Entry{Level: zapcore.DebugLevel, Time: at, Message: "verbose"},
+			nil,
+			`{"severity":"DEBUG","time":"2020-01-02T03:04:05.000000006Z","message":"verbose"}`,
+		},
+		{
+			zapcore.Entry{Level: zapcore.WarnLevel, Time: at, Message: "careful", Caller: caller},
+			nil,
+			`{"severity":"WARNING","time":"2020-01-02T03:04:05.000000006Z","message":"careful","logging.googleapis.com/sourceLocation":{"file":"/src/app/main.go","line":"42"}}`,
+		},
+		{
+			zapcore.Entry{Level: zapcore.FatalLevel, Time: at, Message: "bye", Stack: "main.main"},
+			[]zapcore.Field{zap.String("reason", "oom")},
+			`{"severity":"CRITICAL","time":"2020-01-02T03:04:05.000000006Z","message":"bye","reason":"oom","stacktrace":"main.main"}`,
+		},
+	} {
+		buf, err := enc.Clone().EncodeEntry(tc.ent, tc.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s := buf.String(); s != tc.golden+"\n" {
+			t.Errorf("expect\n%s\nget\n%s", tc.golden, s)
+		}
+	}
+}
+
+func TestGCPFatal(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	k.config.format.set("gcp")
+	k.config.zapConfig = k.config.newZapConfig()
+	k.config.zapConfig.OutputPaths = []string{path}
+	rebuild(t, k)
+	defer swapLogger(k)()
+	SetExitFunc(func(int) {})
+	defer SetExitFunc(nil)
+
+	Fatalf("fatal %d", 1)
+	Flush()
+	entries := readLines(t, path)
+	e := entries[len(entries)-1]
+	loc, _ := e[gcpSourceLocationKey].(map[string]interface{})
+	if e["severity"] != "CRITICAL" || e["message"] != "fatal 1" || loc["function"] != "github.com/xial-thu/klog.TestGCPFatal" {
+		t.Errorf("unexpected entry %v", e)
+	}
+}
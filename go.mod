@@ -4,6 +4,7 @@ go 1.13
 
 require (
 	github.com/spf13/pflag v1.0.5
+	go.uber.org/multierr v1.5.0
 	go.uber.org/zap v1.14.1
 	k8s.io/klog v1.0.0 // indirect
 )
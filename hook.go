@@ -0,0 +1,100 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sync"
+)
+
+// levelHook is a registered callback of level changes
+type levelHook struct {
+	id int
+	fn func(old, new Level)
+}
+
+// levelHooks are called in the order of registration
+type levelHooks struct {
+	mu    sync.Mutex
+	next  int
+	hooks []levelHook
+}
+
+// RegisterLevelChangeHook calls fn whenever the global level is changed at
+// runtime, e.g. by SetLevel. fn is called without holding any lock, and its
+// panic is recovered and logged. Call the returned func to unregister it
+func RegisterLevelChangeHook(fn func(old, new Level)) (unregister func()) {
+	return klogger.RegisterLevelChangeHook(fn)
+}
+
+// RegisterLevelChangeHook calls fn whenever the level shared by k is changed
+func (k *Klogger) RegisterLevelChangeHook(fn func(old, new Level)) (unregister func()) {
+	h := &k.config.hooks
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.next++
+	id := h.next
+	h.hooks = append(h.hooks, levelHook{id: id, fn: fn})
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			h.remove(id)
+		})
+	}
+}
+
+// remove unregisters the hook of id
+func (h *levelHooks) remove(id int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, hook := range h.hooks {
+		if hook.id == id {
+			// copy on write, so that snapshots are not modified
+			hooks := make([]levelHook, 0, len(h.hooks)-1)
+			hooks = append(hooks, h.hooks[:i]...)
+			h.hooks = append(hooks, h.hooks[i+1:]...)
+			return
+		}
+	}
+}
+
+// snapshot returns the registered hooks
+func (h *levelHooks) snapshot() []levelHook {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.hooks
+}
+
+// setLevel stores v and calls the hooks if the level changes
+func (k *Klogger) setLevel(v Level) {
+	old := k.config.level.swap(v)
+	if old == v {
+		return
+	}
+	k.logConfigChanges()
+	for _, hook := range k.config.hooks.snapshot() {
+		k.callHook(hook.fn, old, v)
+	}
+}
+
+// callHook calls fn and logs its panic
+func (k *Klogger) callHook(fn func(old, new Level), old, v Level) {
+	defer func() {
+		if r := recover(); r != nil {
+			k.internal().Errorf("level change hook panicked: %v", r)
+		}
+	}()
+	fn(old, v)
+}
@@ -0,0 +1,63 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestLevelChangeHook(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	var changes [][2]Level
+	unregister := RegisterLevelChangeHook(func(old, new Level) {
+		changes = append(changes, [2]Level{old, new})
+	})
+	k.RegisterLevelChangeHook(func(old, new Level) {
+		panic("boom")
+	})
+	var last Level
+	k.RegisterLevelChangeHook(func(old, new Level) {
+		last = new
+	})
+
+	SetLevel(2)
+	SetLevel(2)  // unchanged
+	SetLevel(-1) // rejected
+	k.SetLevel(4)
+	k.WithFields("A", 1).SetLevel(1) // shared by children
+	unregister()
+	unregister()
+	SetLevel(3)
+
+	expect := [][2]Level{{0, 2}, {2, 4}, {4, 1}}
+	if !reflect.DeepEqual(changes, expect) {
+		t.Errorf("expect %v, get %v", expect, changes)
+	}
+	if last != 3 {
+		t.Errorf("hooks after a panicking one should be called, get %d", last)
+	}
+	panics := 0
+	for _, e := range decodeLines(t, buf) {
+		if e["msg"] == "level change hook panicked: boom" {
+			panics++
+		}
+	}
+	if panics != 4 {
+		t.Errorf("expect 4 panics logged, get %d", panics)
+	}
+}
@@ -0,0 +1,156 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+var (
+	// httpHeaders are the request headers logged by HTTPRequest
+	httpHeaders = []string{"Content-Type", "User-Agent", "X-Request-Id", "X-Forwarded-For", "Authorization", "Cookie"}
+	// sensitiveHeaders are always redacted
+	sensitiveHeaders = map[string]bool{
+		"Authorization":       true,
+		"Proxy-Authorization": true,
+		"Cookie":              true,
+		"Set-Cookie":          true,
+	}
+	// redactedParams are the query parameters redacted by HTTPRequest
+	redactedParams = map[string]bool{
+		"access_token": true,
+		"password":     true,
+		"token":        true,
+	}
+)
+
+// SetHTTPHeaders sets the request headers logged by HTTPRequest
+// Authorization, Cookie and the like are always redacted. Call it before
+// logging
+func SetHTTPHeaders(names ...string) {
+	headers := make([]string, 0, len(names))
+	for _, name := range names {
+		headers = append(headers, http.CanonicalHeaderKey(name))
+	}
+	httpHeaders = headers
+}
+
+// SetHTTPRedactedParams sets the query parameters redacted by HTTPRequest
+// Call it before logging
+func SetHTTPRedactedParams(names ...string) {
+	params := make(map[string]bool, len(names))
+	for _, name := range names {
+		params[name] = true
+	}
+	redactedParams = params
+}
+
+// httpRequest encodes a request without reflection
+type httpRequest struct {
+	r *http.Request
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (h httpRequest) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	r := h.r
+	enc.AddString("method", r.Method)
+	if r.URL != nil {
+		enc.AddString("path", r.URL.Path)
+		if r.URL.RawQuery != "" {
+			enc.AddString("query", redactQuery(r.URL.RawQuery))
+		}
+	}
+	enc.AddString("host", r.Host)
+	enc.AddInt64("contentLength", r.ContentLength)
+	if r.RemoteAddr != "" {
+		enc.AddString("remoteAddr", r.RemoteAddr)
+	}
+	return enc.AddObject("headers", zapcore.ObjectMarshalerFunc(func(enc zapcore.ObjectEncoder) error {
+		for _, name := range httpHeaders {
+			if v := r.Header.Get(name); v != "" {
+				if sensitiveHeaders[name] {
+					v = Redacted
+				}
+				enc.AddString(name, v)
+			}
+		}
+		return nil
+	}))
+}
+
+// redactQuery masks the values of redactedParams, and sorts the params
+func redactQuery(raw string) string {
+	query, err := url.ParseQuery(raw)
+	if err != nil {
+		return Redacted
+	}
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		for _, v := range query[key] {
+			if b.Len() > 0 {
+				b.WriteByte('&')
+			}
+			b.WriteString(url.QueryEscape(key))
+			b.WriteByte('=')
+			if redactedParams[key] {
+				b.WriteString(Redacted)
+			} else {
+				b.WriteString(url.QueryEscape(v))
+			}
+		}
+	}
+	return b.String()
+}
+
+// HTTPRequest returns a field of the method, path, query, host, content
+// length and selected headers of r, see SetHTTPHeaders
+func HTTPRequest(key string, r *http.Request) zap.Field {
+	if r == nil {
+		return zap.Skip()
+	}
+	return zap.Object(key, httpRequest{r})
+}
+
+// httpResponse encodes a response without reflection
+type httpResponse struct {
+	status int
+	size   int64
+	d      time.Duration
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (h httpResponse) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt("status", h.status)
+	enc.AddInt64("size", h.size)
+	enc.AddFloat64("seconds", h.d.Seconds())
+	return nil
+}
+
+// HTTPResponse returns a field of the status, size and latency of a response
+func HTTPResponse(key string, status int, size int64, d time.Duration) zap.Field {
+	return zap.Object(key, httpResponse{status: status, size: size, d: d})
+}
@@ -0,0 +1,87 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestHTTPRequest(t *testing.T) {
+	r := httptest.NewRequest("POST", "http://example.com/api/v1?token=abc&page=2", strings.NewReader("hello"))
+	r.Header.Set("Content-Type", "text/plain")
+	r.Header.Set("Authorization", "Bearer abc")
+	r.Header.Set("X-Unlisted", "x")
+
+	enc := zapcore.NewMapObjectEncoder()
+	HTTPRequest("req", r).AddTo(enc)
+	expect := map[string]interface{}{
+		"method":        "POST",
+		"path":          "/api/v1",
+		"query":         "page=2&token=[REDACTED]",
+		"host":          "example.com",
+		"contentLength": int64(5),
+		"remoteAddr":    "192.0.2.1:1234",
+		"headers": map[string]interface{}{
+			"Content-Type":  "text/plain",
+			"Authorization": Redacted,
+		},
+	}
+	if !reflect.DeepEqual(enc.Fields["req"], expect) {
+		t.Errorf("expect %v, get %v", expect, enc.Fields["req"])
+	}
+}
+
+func TestHTTPRequestOptions(t *testing.T) {
+	defer SetHTTPHeaders(httpHeaders...)
+	defer func(params map[string]bool) { redactedParams = params }(redactedParams)
+	SetHTTPHeaders("x-unlisted", "cookie")
+	SetHTTPRedactedParams("page")
+
+	r := httptest.NewRequest("GET", "/?token=abc&page=2", nil)
+	r.Header.Set("X-Unlisted", "x")
+	r.Header.Set("Cookie", "a=b")
+	r.Header.Set("User-Agent", "test")
+
+	enc := zapcore.NewMapObjectEncoder()
+	HTTPRequest("req", r).AddTo(enc)
+	req := enc.Fields["req"].(map[string]interface{})
+	if req["query"] != "page=[REDACTED]&token=abc" {
+		t.Errorf("unexpected query %v", req["query"])
+	}
+	expect := map[string]interface{}{"X-Unlisted": "x", "Cookie": Redacted}
+	if !reflect.DeepEqual(req["headers"], expect) {
+		t.Errorf("expect %v, get %v", expect, req["headers"])
+	}
+
+	HTTPRequest("nil", nil).AddTo(enc)
+	if _, ok := enc.Fields["nil"]; ok {
+		t.Error("nil request should be skipped")
+	}
+}
+
+func TestHTTPResponse(t *testing.T) {
+	enc := zapcore.NewMapObjectEncoder()
+	HTTPResponse("resp", 404, 12, 1500*time.Millisecond).AddTo(enc)
+	expect := map[string]interface{}{"status": 404, "size": int64(12), "seconds": 1.5}
+	if !reflect.DeepEqual(enc.Fields["resp"], expect) {
+		t.Errorf("expect %v, get %v", expect, enc.Fields["resp"])
+	}
+}
@@ -0,0 +1,68 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"net/http"
+)
+
+const (
+	// IncidentIDKey holds the ID of a panic recovered by the middleware
+	IncidentIDKey = "incident_id"
+	// IncidentIDHeaderName is the default response header of the incident ID
+	IncidentIDHeaderName = "X-Incident-Id"
+)
+
+// RecoverPanics makes the middleware recover the panics of handlers, which
+// are logged at ERROR with the request, an incident ID and the stack from the
+// frame that panicked. The response is 500 with the incident ID in the
+// header of IncidentIDHeader, unless the handler wrote its header already
+// If repanic is true, it panics again for the recovery of outer middleware
+// http.ErrAbortHandler is never recovered
+func RecoverPanics(repanic bool) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.recoverPanics, c.repanic = true, repanic
+	}
+}
+
+// IncidentIDHeader sets the response header of the incident ID of
+// RecoverPanics, default to IncidentIDHeaderName
+func IncidentIDHeader(name string) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.incidentHeader = http.CanonicalHeaderKey(name)
+	}
+}
+
+// recoverPanic logs the panic of a handler and responds 500, defer it
+// directly
+func (c *middlewareConfig) recoverPanic(k *Klogger, w *statusWriter, r *http.Request) {
+	p := recover()
+	if p == nil {
+		return
+	}
+	if p == http.ErrAbortHandler {
+		panic(p)
+	}
+	incident := newTraceID()
+	kv := []interface{}{IncidentIDKey, incident, HTTPRequest("request", r)}
+	k.logPanic(p, kv, panicStack())
+	if w.status == 0 {
+		w.Header().Set(c.incidentHeader, incident)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+	if c.repanic {
+		panic(p)
+	}
+}
@@ -0,0 +1,114 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// panickingHandler panics with "boom" unless the path is /written, which
+// writes the header first
+func panickingHandler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/abort" {
+		panic(http.ErrAbortHandler)
+	}
+	if r.URL.Path == "/written" {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	panic("boom")
+}
+
+func TestRecoverPanics(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	handler := NewTraceMiddleware(RecoverPanics(false), IncidentIDHeader("x-support-id"))(http.HandlerFunc(panickingHandler))
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/items?id=1", nil))
+
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("expect 500, got %d", w.Code)
+	}
+	incident := w.Header().Get("X-Support-Id")
+	if !traceIDPattern.MatchString(incident) {
+		t.Errorf("expect an incident id in the header, got %q", incident)
+	}
+	lines := decodeLines(t, buf)
+	if len(lines) != 1 {
+		t.Fatalf("expect 1 entry, got %v", lines)
+	}
+	e := lines[0]
+	if e["level"] != "error" || e["msg"] != recoveredMsg || e[PanicKey] != "boom" || e[IncidentIDKey] != incident || e[TraceIDKey] == nil {
+		t.Errorf("unexpected entry %v", e)
+	}
+	if req, _ := e["request"].(map[string]interface{}); req["path"] != "/items" || req["method"] != "GET" {
+		t.Errorf("expect the request fields, got %v", e["request"])
+	}
+	if caller, _ := e["caller"].(string); !strings.Contains(caller, "httprecover_test.go:") {
+		t.Errorf("expect the caller where it panicked, got %v", caller)
+	}
+	stack, _ := e["stacktrace"].(string)
+	if !strings.HasPrefix(stack, "github.com/xial-thu/klog.panickingHandler\n") || strings.Contains(stack, "recoverPanic") {
+		t.Errorf("expect the stack from the handler, got %s", stack)
+	}
+	if !strings.Contains(stack, "NewTraceMiddleware") {
+		t.Errorf("expect the middleware in the stack, got %s", stack)
+	}
+
+	// the header written by the handler is kept
+	buf.Reset()
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/written", nil))
+	if w.Code != http.StatusAccepted || w.Header().Get("X-Support-Id") != "" {
+		t.Errorf("expect the status of the handler, got %d %v", w.Code, w.Header())
+	}
+	if lines := decodeLines(t, buf); len(lines) != 1 {
+		t.Errorf("expect the panic logged, got %v", lines)
+	}
+}
+
+func TestRecoverPanicsRepanic(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	handler := NewTraceMiddleware(RecoverPanics(true))(http.HandlerFunc(panickingHandler))
+	serve := func(path string) (w *httptest.ResponseRecorder, p interface{}) {
+		defer func() { p = recover() }()
+		w = httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w, nil
+	}
+	w, p := serve("/")
+	if p != "boom" {
+		t.Errorf("expect panicking again, got %v", p)
+	}
+	if w.Code != http.StatusInternalServerError || w.Header().Get(IncidentIDHeaderName) == "" {
+		t.Errorf("expect 500 with the incident id, got %d %v", w.Code, w.Header())
+	}
+	if lines := decodeLines(t, buf); len(lines) != 1 {
+		t.Errorf("expect the panic logged once, got %v", lines)
+	}
+
+	buf.Reset()
+	if _, p := serve("/abort"); p != http.ErrAbortHandler {
+		t.Errorf("expect ErrAbortHandler not recovered, got %v", p)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("expect ErrAbortHandler not logged, got %s", buf)
+	}
+}
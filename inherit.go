@@ -0,0 +1,109 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// fileHolder holds the rotatingFile of log_file, which is nil without it
+type fileHolder struct {
+	file *rotatingFile
+}
+
+// WithLogFileFD sets log_file_fd, see Klogger.ExtraFiles
+func WithLogFileFD(fd int) Option {
+	return func(c *Config) error {
+		if fd < 0 {
+			return fmt.Errorf("invalid log_file_fd %d", fd)
+		}
+		c.logFileFD.set(fd)
+		return nil
+	}
+}
+
+// openLogFile opens log_file, or adopts log_file_fd inherited from the parent
+// process if it's set. The fd is adopted once, later builds open the path
+func (c *Config) openLogFile() (*rotatingFile, error) {
+	fd := c.logFileFD.get()
+	if fd == 0 {
+		return openRotatingFile(c.logFile.get(), c.rotateOptions())
+	}
+	c.logFileFD.set(0)
+	return openInheritedFile(uintptr(fd), c.logFile.get(), c.rotateOptions())
+}
+
+// openInheritedFile writes to the file of fd, which is path opened by the
+// parent process, and rotates it as usual. Its size is read from fd, so that
+// it's rotated at the same size as in the parent. If path is no longer the
+// file of fd, e.g. it's rotated since, path is opened instead
+func openInheritedFile(fd uintptr, path string, opts rotateOptions) (*rotatingFile, error) {
+	if path == "" {
+		return nil, errors.New("klog: log_file_fd needs log_file")
+	}
+	f := os.NewFile(fd, path)
+	if f == nil {
+		return nil, fmt.Errorf("klog: invalid log_file_fd %d", fd)
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("klog: invalid log_file_fd %d: %v", fd, err)
+	}
+	if current, err := os.Stat(path); err != nil || !os.SameFile(info, current) {
+		f.Close()
+		return openRotatingFile(path, opts)
+	}
+	r := rotatingFileOf(path, opts)
+	r.opened = r.now()
+	r.attach(f, info.Size())
+	return r, nil
+}
+
+// current writes the buffered entries, and returns the file being written,
+// or nil once closed
+func (r *rotatingFile) current() *os.File {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.closed:
+		return nil
+	default:
+	}
+	r.flush()
+	return r.file
+}
+
+// ExtraFiles returns the open files of the global logger, see
+// Klogger.ExtraFiles
+func ExtraFiles() []*os.File {
+	return klogger.ExtraFiles()
+}
+
+// ExtraFiles returns the open log_file, if any, for exec.Cmd.ExtraFiles of a
+// re-exec, whose buffered entries are written first. The child started with
+// the same log_file and log_file_fd=3, the fd of the first extra file, keeps
+// appending to it, and rotates it at the size reached by the parent
+func (k *Klogger) ExtraFiles() []*os.File {
+	h, _ := k.config.logFileHandle.Load().(fileHolder)
+	if h.file == nil {
+		return nil
+	}
+	if f := h.file.current(); f != nil {
+		return []*os.File{f}
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// inheritedLogFileEnv passes log_file to TestInheritedLogFileChild
+const inheritedLogFileEnv = "KLOG_TEST_INHERITED_LOG_FILE"
+
+// TestInheritedLogFileChild is run by TestInheritedLogFile as the child
+func TestInheritedLogFileChild(t *testing.T) {
+	path := os.Getenv(inheritedLogFileEnv)
+	if path == "" {
+		t.Skip("run by TestInheritedLogFile")
+	}
+	var size int64
+	if info, err := os.Stat(path); err == nil {
+		size = info.Size()
+	}
+	k, err := New(WithOutputPaths(path+".out"), WithLogFile(path, 1), WithLogFileFD(3))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := k.config.logFileHandle.Load().(fileHolder)
+	if h.file.size != size {
+		t.Errorf("expect size %d, get %d", size, h.file.size)
+	}
+	k.Infow("child")
+	if err := k.Close(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+// reexec runs TestInheritedLogFileChild with the files of k
+func reexec(t *testing.T, k *Klogger, path string) {
+	cmd := exec.Command(os.Args[0], "-test.run=^TestInheritedLogFileChild$")
+	cmd.Env = append(os.Environ(), inheritedLogFileEnv+"="+path)
+	cmd.ExtraFiles = k.ExtraFiles()
+	if len(cmd.ExtraFiles) != 1 {
+		t.Fatalf("expect the log file, get %v", cmd.ExtraFiles)
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("child failed: %v\n%s", err, out)
+	}
+}
+
+func TestInheritedLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	k, err := New(WithOutputPaths(filepath.Join(dir, "out.log")), WithLogFile(path, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close(context.Background())
+
+	k.Infow("parent")
+	reexec(t, k, path)
+	k.Infow("parent again")
+	k.Flush()
+
+	got := messages(readLines(t, path))
+	if len(got) != 3 || got[0] != "parent" || got[1] != "child" || got[2] != "parent again" {
+		t.Errorf("unexpected entries %v", got)
+	}
+}
+
+func TestInheritedLogFileRotated(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "app.log")
+	k, err := New(WithOutputPaths(filepath.Join(dir, "out.log")), WithLogFile(path, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close(context.Background())
+
+	k.Infow("parent")
+	// the child opens path again, since it's not the inherited file any more
+	if err := os.Rename(path, path+".old"); err != nil {
+		t.Fatal(err)
+	}
+	reexec(t, k, path)
+
+	if got := messages(readLines(t, path)); len(got) != 1 || got[0] != "child" {
+		t.Errorf("unexpected entries %v", got)
+	}
+	if b, _ := ioutil.ReadFile(path + ".old"); strings.Contains(string(b), "child") {
+		t.Errorf("unexpected child entry in the inherited file %s", b)
+	}
+}
+
+func TestInheritedLogFileInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := New(WithOutputPaths(filepath.Join(dir, "out.log")), WithLogFileFD(3)); err == nil {
+		t.Error("expect error without log_file")
+	}
+	if _, err := New(WithOutputPaths(filepath.Join(dir, "out.log")), WithLogFile(filepath.Join(dir, "app.log"), 0), WithLogFileFD(1<<20)); err == nil {
+		t.Error("expect error of a closed fd")
+	}
+	k, err := New(WithOutputPaths(filepath.Join(dir, "out.log")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close(context.Background())
+	if files := k.ExtraFiles(); files != nil {
+		t.Errorf("expect no files without log_file, get %v", files)
+	}
+}
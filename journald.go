@@ -0,0 +1,283 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// journaldScheme is the scheme of journal outputs, journald:// writes
+	// to defaultJournalSocket and journald:///path to another socket
+	journaldScheme       = "journald"
+	defaultJournalSocket = "/run/systemd/journal/socket"
+)
+
+// journaldPriorities maps zap levels to syslog priorities
+var journaldPriorities = map[zapcore.Level]string{
+	zapcore.DebugLevel:  "7",
+	zapcore.InfoLevel:   "6",
+	zapcore.WarnLevel:   "4",
+	zapcore.ErrorLevel:  "3",
+	zapcore.DPanicLevel: "2",
+	zapcore.PanicLevel:  "1",
+	zapcore.FatalLevel:  "2",
+}
+
+func init() {
+	if err := zap.RegisterSink(journaldScheme, newJournaldSink); err != nil {
+		panic(err)
+	}
+}
+
+// journalPool holds the buffers of journal messages
+var journalPool = buffer.NewPool()
+
+// stderrSink is used when the journal is absent
+type stderrSink struct {
+	zapcore.WriteSyncer
+}
+
+// Close implements zap.Sink
+func (stderrSink) Close() error {
+	return nil
+}
+
+// journalField converts a key into a journal field name, which consists of
+// uppercase letters, digits and underscores, and starts with a letter
+func journalField(key string) string {
+	name := []byte(strings.ToUpper(key))
+	for i, c := range name {
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') {
+			name[i] = '_'
+		}
+	}
+	return strings.TrimLeft(string(name), "_0123456789")
+}
+
+// journalFieldPrefix renames fields named like the ones set by journalCore,
+// like the prefix of log_reserved_keys
+const journalFieldPrefix = "FIELDS_"
+
+// journalEntryFields are set by journalCore from the entry
+var journalEntryFields = map[string]bool{
+	"SYSLOG_IDENTIFIER": true,
+	"PRIORITY":          true,
+	"MESSAGE":           true,
+	"CODE_FILE":         true,
+	"CODE_LINE":         true,
+	"CODE_FUNC":         true,
+	"LOGGER":            true,
+	"STACKTRACE":        true,
+}
+
+// appendJournalField writes a field in the native journal protocol
+func appendJournalField(b *buffer.Buffer, name, value string) {
+	if name == "" {
+		return
+	}
+	b.AppendString(name)
+	if !strings.Contains(value, "\n") {
+		b.AppendByte('=')
+		b.AppendString(value)
+		b.AppendByte('\n')
+		return
+	}
+	// a value with newlines is prefixed by its length
+	b.AppendByte('\n')
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.AppendString(value)
+	b.AppendByte('\n')
+}
+
+// journalValue formats a value of zapcore.MapObjectEncoder, strings as they
+// are and others in JSON
+func journalValue(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
+
+// encodeJournal converts an entry into a journal message. The level becomes
+// PRIORITY, the message MESSAGE, the caller CODE_FILE, CODE_LINE and
+// CODE_FUNC, and the fields are uppercased
+func encodeJournal(ent zapcore.Entry, fields map[string]interface{}, identifier string) *buffer.Buffer {
+	b := journalPool.Get()
+	appendJournalField(b, "SYSLOG_IDENTIFIER", identifier)
+	appendJournalField(b, "PRIORITY", journaldPriorities[ent.Level])
+	appendJournalField(b, "MESSAGE", ent.Message)
+	if ent.Caller.Defined {
+		appendJournalField(b, "CODE_FILE", ent.Caller.File)
+		appendJournalField(b, "CODE_LINE", strconv.Itoa(ent.Caller.Line))
+		if fn := runtime.FuncForPC(ent.Caller.PC); fn != nil {
+			appendJournalField(b, "CODE_FUNC", fn.Name())
+		}
+	}
+	if ent.LoggerName != "" {
+		appendJournalField(b, "LOGGER", ent.LoggerName)
+	}
+	if ent.Stack != "" {
+		appendJournalField(b, "STACKTRACE", ent.Stack)
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		name := journalField(key)
+		if journalEntryFields[name] {
+			name = journalFieldPrefix + name
+		}
+		appendJournalField(b, name, journalValue(fields[key]))
+	}
+	return b
+}
+
+// encodeJournalLine converts a line written by other than journalCore, e.g.
+// by fallback_output, into a journal message with the line as MESSAGE
+func encodeJournalLine(p []byte, identifier string) *buffer.Buffer {
+	b := journalPool.Get()
+	appendJournalField(b, "SYSLOG_IDENTIFIER", identifier)
+	appendJournalField(b, "PRIORITY", journaldPriorities[zapcore.InfoLevel])
+	appendJournalField(b, "MESSAGE", string(bytes.TrimRight(p, "\n")))
+	return b
+}
+
+// journalCore writes entries to a journal socket. The fields of With are
+// kept, since the entries are encoded from the fields rather than by an
+// encoder
+type journalCore struct {
+	zapcore.LevelEnabler
+	out        zapcore.WriteSyncer
+	identifier string
+	with       []zapcore.Field
+}
+
+// With implements zapcore.Core
+func (c *journalCore) With(fields []zapcore.Field) zapcore.Core {
+	with := make([]zapcore.Field, 0, len(c.with)+len(fields))
+	with = append(with, c.with...)
+	return &journalCore{
+		LevelEnabler: c.LevelEnabler,
+		out:          c.out,
+		identifier:   c.identifier,
+		with:         append(with, fields...),
+	}
+}
+
+// Check implements zapcore.Core
+func (c *journalCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (c *journalCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	enc := zapcore.NewMapObjectEncoder()
+	for _, f := range c.with {
+		f.AddTo(enc)
+	}
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	b := encodeJournal(ent, enc.Fields, c.identifier)
+	_, err := c.out.Write(b.Bytes())
+	b.Free()
+	return err
+}
+
+// Sync implements zapcore.Core
+func (c *journalCore) Sync() error {
+	return c.out.Sync()
+}
+
+// splitJournalPaths separates the journald:// outputs of paths
+func splitJournalPaths(paths []string) (journal, others []string) {
+	for _, path := range paths {
+		if strings.HasPrefix(path, journaldScheme+"://") {
+			journal = append(journal, path)
+		} else {
+			others = append(others, path)
+		}
+	}
+	return journal, others
+}
+
+// journalSocket returns the socket of a journald:// URL
+func journalSocket(u *url.URL) string {
+	if u.Path != "" {
+		return u.Path
+	}
+	return defaultJournalSocket
+}
+
+// journalCore opens the journald:// outputs of paths. Outputs whose socket
+// is absent write enc to stderr instead
+func (c *Config) journalCore(paths []string, enc zapcore.Encoder, enabled zapcore.LevelEnabler) (zapcore.Core, error) {
+	cores := make([]zapcore.Core, 0, len(paths))
+	for _, path := range paths {
+		u, err := url.Parse(path)
+		if err != nil {
+			return nil, err
+		}
+		conn, err := dialJournal(journalSocket(u))
+		if err != nil {
+			return nil, err
+		}
+		if conn == nil {
+			stderr, err := c.sinks.open("stderr")
+			if err != nil {
+				return nil, err
+			}
+			cores = append(cores, zapcore.NewCore(enc, c.batch.wrap(stderr), enabled))
+			continue
+		}
+		out := c.sinks.adopt(path, conn, func() { conn.Close() })
+		cores = append(cores, &journalCore{
+			LevelEnabler: enabled,
+			out:          c.batch.wrap(out),
+			identifier:   journalIdentifier(),
+		})
+	}
+	return zapcore.NewTee(cores...), nil
+}
+
+// journalIdentifier is the SYSLOG_IDENTIFIER of entries
+func journalIdentifier() string {
+	return filepath.Base(os.Args[0])
+}
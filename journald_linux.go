@@ -0,0 +1,174 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"syscall"
+	"unsafe"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// flags of memfd_create and seals of fcntl, absent from package syscall
+	fAddSeals       = 1033
+	fSealSeal       = 0x1
+	fSealShrink     = 0x2
+	fSealGrow       = 0x4
+	fSealWrite      = 0x8
+	mfdCloexec      = 0x1
+	mfdAllowSealing = 0x2
+)
+
+// memfdCreateTrap is the syscall number of memfd_create, 0 if unknown
+var memfdCreateTrap = map[string]uintptr{
+	"386":      356,
+	"amd64":    319,
+	"arm":      385,
+	"arm64":    279,
+	"loong64":  279,
+	"riscv64":  279,
+	"mips":     4354,
+	"mipsle":   4354,
+	"mips64":   5314,
+	"mips64le": 5314,
+	"ppc64":    360,
+	"ppc64le":  360,
+	"s390x":    350,
+}[runtime.GOARCH]
+
+// journalConn sends each message as a datagram to the journal socket
+// Messages beyond the datagram limit, e.g. with stacks, are written to a
+// sealed memfd whose fd is sent instead, as the native protocol specifies
+type journalConn struct {
+	conn *net.UnixConn
+}
+
+// dialJournal connects to the journal socket, it returns nil if the socket
+// is absent
+func dialJournal(socket string) (zap.Sink, error) {
+	if _, err := os.Stat(socket); err != nil {
+		return nil, nil
+	}
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	return &journalConn{conn: conn}, nil
+}
+
+// Write implements zap.Sink, msg is a message of the native protocol
+func (s *journalConn) Write(msg []byte) (int, error) {
+	_, err := s.conn.Write(msg)
+	if err != nil && errors.Is(err, syscall.EMSGSIZE) {
+		err = s.writeMemfd(msg)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return len(msg), nil
+}
+
+// writeMemfd sends msg in a sealed memfd
+func (s *journalConn) writeMemfd(msg []byte) error {
+	f, err := newSealedMemfd(msg)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	// WriteMsgUnix refuses connected sockets, so sendmsg is called directly
+	rc, err := s.conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+	rights := syscall.UnixRights(int(f.Fd()))
+	var serr error
+	if err := rc.Write(func(fd uintptr) bool {
+		serr = syscall.Sendmsg(int(fd), nil, rights, nil, 0)
+		return serr != syscall.EAGAIN
+	}); err != nil {
+		return err
+	}
+	return serr
+}
+
+// newSealedMemfd returns a memfd holding msg, sealed against any change
+func newSealedMemfd(msg []byte) (*os.File, error) {
+	if memfdCreateTrap == 0 {
+		return nil, errors.New("klog: memfd_create is unknown on " + runtime.GOARCH)
+	}
+	name := []byte("journal-entry\x00")
+	fd, _, errno := syscall.Syscall(memfdCreateTrap, uintptr(unsafe.Pointer(&name[0])), mfdCloexec|mfdAllowSealing, 0)
+	if errno != 0 {
+		return nil, os.NewSyscallError("memfd_create", errno)
+	}
+	f := os.NewFile(fd, "journal-entry")
+	if _, err := f.Write(msg); err != nil {
+		f.Close()
+		return nil, err
+	}
+	seals := uintptr(fSealSeal | fSealShrink | fSealGrow | fSealWrite)
+	if _, _, errno := syscall.Syscall(syscall.SYS_FCNTL, fd, fAddSeals, seals); errno != 0 {
+		f.Close()
+		return nil, os.NewSyscallError("fcntl", errno)
+	}
+	return f, nil
+}
+
+// Sync implements zap.Sink, datagrams are not buffered
+func (s *journalConn) Sync() error {
+	return nil
+}
+
+// Close implements zap.Sink
+func (s *journalConn) Close() error {
+	return s.conn.Close()
+}
+
+// journaldSink sends the lines written to journald:// by other than
+// journalCore, e.g. by fallback_output, as MESSAGE
+type journaldSink struct {
+	zap.Sink
+	identifier string
+}
+
+// newJournaldSink is registered to zap for journald:// paths, it falls back
+// to stderr if the socket is absent
+func newJournaldSink(u *url.URL) (zap.Sink, error) {
+	conn, err := dialJournal(journalSocket(u))
+	if err != nil {
+		return nil, err
+	}
+	if conn == nil {
+		return stderrSink{zapcore.Lock(os.Stderr)}, nil
+	}
+	return &journaldSink{Sink: conn, identifier: journalIdentifier()}, nil
+}
+
+// Write implements zap.Sink
+func (s *journaldSink) Write(p []byte) (int, error) {
+	b := encodeJournalLine(p, s.identifier)
+	defer b.Free()
+	if _, err := s.Sink.Write(b.Bytes()); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,219 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// decodeJournal parses a message of the native journal protocol
+func decodeJournal(t *testing.T, p []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(p) > 0 {
+		i := bytes.IndexAny(p, "=\n")
+		if i < 0 {
+			t.Fatalf("invalid journal message %q", p)
+		}
+		name := string(p[:i])
+		if p[i] == '=' {
+			end := bytes.IndexByte(p, '\n')
+			fields[name] = string(p[i+1 : end])
+			p = p[end+1:]
+			continue
+		}
+		n := int(binary.LittleEndian.Uint64(p[i+1 : i+9]))
+		fields[name] = string(p[i+9 : i+9+n])
+		p = p[i+10+n:]
+	}
+	return fields
+}
+
+func TestJournaldSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := newConfig()
+	c.outputPaths.set([]string{"journald://" + socket})
+	c.zapConfig = c.newZapConfig()
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+
+	k.WithFields("http.status", 500, "stack", "a\nb").Warningf("careful")
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := decodeJournal(t, buf[:n])
+	for name, want := range map[string]string{
+		"MESSAGE":           "careful",
+		"PRIORITY":          "4",
+		"HTTP_STATUS":       "500",
+		"STACK":             "a\nb",
+		"SYSLOG_IDENTIFIER": filepath.Base(os.Args[0]),
+	} {
+		if fields[name] != want {
+			t.Errorf("expect %s=%q, get %q", name, want, fields[name])
+		}
+	}
+	if !strings.HasSuffix(fields["CODE_FILE"], "/journald_linux_test.go") || fields["CODE_LINE"] == "" {
+		t.Errorf("unexpected caller %v", fields)
+	}
+}
+
+func TestJournaldMemfd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	c := newConfig()
+	c.outputPaths.set([]string{"journald://" + socket})
+	c.fallbackPath.set("")
+	c.zapConfig = c.newZapConfig()
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+
+	// beyond the limit of datagrams, which is a few hundred KB
+	stack := strings.Repeat("main.handle\n\t/app/main.go:42\n", 1<<16)
+	k.WithFields("stack", stack).Errorf("oversized")
+	oob := make([]byte, syscall.CmsgSpace(4))
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, oobn, _, _, err := conn.ReadMsgUnix(nil, oob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("expect an empty datagram with the fd, get %d bytes", n)
+	}
+	msgs, err := syscall.ParseSocketControlMessage(oob[:oobn])
+	if err != nil || len(msgs) != 1 {
+		t.Fatalf("expect a control message, get %v, %v", msgs, err)
+	}
+	fds, err := syscall.ParseUnixRights(&msgs[0])
+	if err != nil || len(fds) != 1 {
+		t.Fatalf("expect an fd, get %v, %v", fds, err)
+	}
+	f := os.NewFile(uintptr(fds[0]), "memfd")
+	defer f.Close()
+	seals, _, errno := syscall.Syscall(syscall.SYS_FCNTL, f.Fd(), fAddSeals+1, 0)
+	if errno != 0 || seals != fSealSeal|fSealShrink|fSealGrow|fSealWrite {
+		t.Errorf("expect all seals, get %#x, %v", seals, errno)
+	}
+	b, err := ioutil.ReadAll(io.NewSectionReader(f, 0, 1<<30))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := decodeJournal(t, b)
+	if fields["MESSAGE"] != "oversized" || fields["STACK"] != stack || fields["PRIORITY"] != "3" {
+		t.Errorf("unexpected fields of %d bytes", len(b))
+	}
+	if n := atomic.LoadUint64(&c.stats.failedWrites); n != 0 {
+		t.Errorf("expect no failed writes, get %d", n)
+	}
+}
+
+func TestJournaldAbsent(t *testing.T) {
+	c := newConfig()
+	c.outputPaths.set([]string{"journald:///nonexistent/journal.sock"})
+	c.zapConfig = c.newZapConfig()
+	if _, err := c.build(); err != nil {
+		t.Errorf("expect falling back to stderr, get %v", err)
+	}
+}
+
+func TestJournaldFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "journal.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for _, format := range []string{"json", "gcp", "ecs", "console"} {
+		c := newConfig()
+		c.format.set(format)
+		c.outputPaths.set([]string{"journald://" + socket})
+		c.zapConfig = c.newZapConfig()
+		zlogger, err := c.build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		k := &Klogger{sugar: zlogger.Sugar(), config: c}
+
+		k.WithFields("Message", "of user").Warningw("careful", "Priority", "high")
+		buf := make([]byte, 65536)
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fields := decodeJournal(t, buf[:n])
+		for name, want := range map[string]string{
+			"MESSAGE":         "careful",
+			"PRIORITY":        "4",
+			"FIELDS_MESSAGE":  "of user",
+			"FIELDS_PRIORITY": "high",
+		} {
+			if fields[name] != want {
+				t.Errorf("%s: expect %s=%q, get %q", format, name, want, fields[name])
+			}
+		}
+		if !strings.HasSuffix(fields["CODE_FILE"], "/journald_linux_test.go") {
+			t.Errorf("%s: unexpected caller %v", format, fields)
+		}
+		k.Close(context.Background())
+	}
+}
@@ -0,0 +1,36 @@
+//go:build !linux
+// +build !linux
+
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"net/url"
+	"os"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newJournaldSink falls back to stderr, there is no journal but on linux
+func newJournaldSink(*url.URL) (zap.Sink, error) {
+	return stderrSink{zapcore.Lock(os.Stderr)}, nil
+}
+
+// dialJournal returns nil, there is no journal but on linux
+func dialJournal(string) (zap.Sink, error) {
+	return nil, nil
+}
@@ -15,13 +15,16 @@ limitations under the License.
 package klog
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"os"
 	"reflect"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/spf13/pflag"
+	"go.uber.org/multierr"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
 )
@@ -29,8 +32,14 @@ import (
 // Level is a shim
 type Level int32
 
-// Verbose is a shim
-type Verbose bool
+// Verbose is a shim, which logs through the logger it comes from
+type Verbose struct {
+	enabled bool
+	level   Level
+	logger  *Klogger
+	// keeps the entries if it's disabled, see recent_entries
+	recent *ring
+}
 
 // Config is the mixture of zap config and klog config
 type Config struct {
@@ -39,24 +48,131 @@ type Config struct {
 	level     Level
 
 	// klog config
-	v               int32
-	alsologtostderr bool
+	maxLevel        Level
+	vField          boolValue
+	infoMaxV        intValue
+	alsologtostderr boolValue
+	format          stringValue
+	callerFormat    stringValue
+	seqField        boolValue
+	monotonicField  boolValue
+	severityChar    boolValue
+	sortFields      boolValue
+	buildInfoField  boolValue
+	fingerprint     boolValue
+	timeLayout      stringValue
+	severity        severity
+	backtraceAt     traceValue
+	ecsLabels       boolValue
+	buildInfo       *buildInfo
+	strictFields    boolValue
+	development     boolValue
+	reservedPolicy  stringValue
+	stringifyKeys   boolValue
+	secretHash      boolValue
+	fieldValues     boolValue
+	wrapFields      boolValue
+	sanitize        boolValue
+	maxMessageBytes intValue
+	maxFieldBytes   intValue
+	hexMaxBytes     intValue
+	fallbackPath    stringValue
+	recentEntries   intValue
+	recentDumpPath  stringValue
+	auditPaths      stringsValue
+	outputPaths     stringsValue
+	routes          []RouteConfig
+	// set by WithEncoderConfig
+	encoderConfigFns []func(*zapcore.EncoderConfig)
+	humanStderr      boolValue
+	sampling         samplingValue
+	color            colorValue
+	colorWholeLine   boolValue
+	// set by WithLineColors
+	lineColors map[zapcore.Level]Color
+
+	// rotated file output
+	logFile             stringValue
+	logFileFD           intValue
+	logFileMaxSize      uint64Value
+	logFileCompress     boolValue
+	logFileMaxAge       durationFlag
+	logFileMaxTotalSize uint64Value
+	logFileDaily        boolValue
+	logFileBufferSize   intValue
+	logFlushFrequency   durationFlag
+	logFsyncInterval    durationFlag
+	logDir              stringValue
+	errorLogFile        stringValue
+	logNameTemplate     stringValue
+
+	// callbacks of level changes
+	hooks levelHooks
+
+	// guards rebuilding the core
+	mu   sync.Mutex
+	core *swapCore
+	// entries logged before Singleton by the logger of init
+	early *earlyQueue
+
+	// opened outputs and background goroutines
+	sinks sinks
+	stats *stats
+	// holds the *ring of recent_entries, read by V() entries
+	ring atomic.Value
+	// buffers the outputs while a Batch is flushed
+	batch batchState
+	// keys of the encoder set by build, and the reserved ones warned about
+	reservedKeys atomic.Value
+	warnedKeys   sync.Map
+	// holds a clockHolder set by SetClock
+	clock atomic.Value
+	// holds the *filterRules of SetSuppressRules
+	suppress atomic.Value
+	// holds the thresholdHolder of SetErrorThreshold
+	threshold atomic.Value
+	// holds the trackerHolder of TrackMessages
+	tracker atomic.Value
+	// holds the map[string]zapcore.Core of RegisterNamedSink
+	namedSinks atomic.Value
+	// holds the fileHolder of log_file for ExtraFiles
+	logFileHandle atomic.Value
+	// holds the ConfigSnapshot of the settings read by build
+	built atomic.Value
+	// the config last logged on changes
+	changes configChanges
 }
 
 // Klogger wraps a sugarlogger
 type Klogger struct {
 	sugar  *zap.SugaredLogger
-	config Config
+	config *Config
+
+	// the innermost namespace opened on this logger
+	namespace string
+	// overrides the global level if it's greater
+	verbosity Level
+	// overrides the fingerprint of errors if it's not empty
+	fingerprint string
+	// frames skipped by WithCallerSkip
+	callerSkip int
+	// set by WithMinSeverity, along with log_level
+	minSeverity zapcore.LevelEnabler
+	// the node of GetLogger
+	node *loggerNode
+	// loggers of the Depth methods, see depthLogger
+	depths [maxCachedDepth]atomic.Value
+	// fields added by With and so on, see Fields
+	fields []trackedField
+	// holds the V() entries of NewRequestBuffer
+	buffer *requestBuffer
 }
 
 const (
 	// MinLevel 0: default level, forbids DEBUG log
-	MinLevel Level = iota
-	_
-	_
-	_
-	// MaxLevel 4: max level V(4)
-	MaxLevel
+	MinLevel Level = 0
+	// MaxLevel 10: default ceiling of level, V(n) beyond it is disabled
+	MaxLevel Level = 10
 )
 
 var (
@@ -64,63 +180,522 @@ var (
 	once    sync.Once
 )
 
-// init as the global no-ops logger so that unit test will not crash
+// init as the global logger which queues entries until Singleton, so that
+// entries logged before it, e.g. by init funcs of libraries, are not lost
 func init() {
-	klogger = &Klogger{
-		sugar: zap.S(),
-		config: Config{
-			level:           0,
-			v:               0,
-			alsologtostderr: true,
-		},
+	klogger = newEarlyLogger()
+}
+
+// newConfig returns the default config
+func newConfig() *Config {
+	c := &Config{
+		level:       0,
+		maxLevel:    MaxLevel,
+		infoMaxV:    -1,
+		hexMaxBytes: 64,
+		severity:    severity{level: zap.NewAtomicLevelAt(zapcore.DebugLevel)},
+		stats:       &stats{},
 	}
+	c.alsologtostderr.set(true)
+	c.callerFormat.set("short")
+	c.fallbackPath.set("stderr")
+	c.logFlushFrequency.set(5 * time.Second)
+	c.format.set("json")
+	c.color.set(string(ColorAuto))
+	c.stringifyKeys.set(true)
+	c.reservedPolicy.set("rename")
+	c.timeLayout.set(time.RFC3339Nano)
+	c.sampling.set(defaultSampling())
+	return c
 }
 
 // Singleton inits an unique logger
 func Singleton() *Klogger {
 	once.Do(func() {
-		klogger.config.level.set(Level(klogger.config.v))
-		if l := klogger.config.level; l < MinLevel || l > MaxLevel {
-			panic(fmt.Errorf("FATAL: 'v' must be in the range [0, 4]"))
+		if err := setup(); err != nil {
+			panic(err)
+		}
+	})
+	return klogger
+}
+
+// setup builds the global logger from its config
+func setup() error {
+	return klogger.start()
+}
+
+// start builds the logger of k from its config, for Singleton and New
+func (k *Klogger) start() error {
+	c := k.config
+	l, clamped := c.clampLevel()
+	if c.early != nil {
+		// the sugar of the logger of init may be in use by other goroutines
+		if err := c.replaceEarly(); err != nil {
+			return err
 		}
+	} else {
+		zlogger, err := c.newLogger()
+		if err != nil {
+			return err
+		}
+		k.sugar = zlogger.Sugar()
+	}
+	k.logStartup()
+	k.warnConfig(l, clamped)
+	return nil
+}
+
+// logStartup logs the build info and the effective config at V(1), so that
+// it's silent by default, e.g. for command line tools
+func (k *Klogger) logStartup() {
+	c := k.config
+	var build string
+	if c.buildInfo != nil {
+		build = c.buildInfo.String()
+	}
+	k.internal().V(1).InfoS("klog initialized",
+		"format", c.format.get(),
+		"v", int(c.level.get()),
+		"log_level", c.severity.String(),
+		"outputs", c.zapConfig.OutputPaths,
+		BuildKey, build,
+	)
+}
 
-		klogger.config.zapConfig = zap.NewProductionConfig()
+// warnConfig warns about the config values which are corrected
+func (k *Klogger) warnConfig(l Level, clamped bool) {
+	if clamped {
+		k.internal().Warningf("'v' must be in the range [%d, %d], clamped to %d", MinLevel, k.config.maxLevel.get(), l)
+	}
+	if format := k.config.format.get(); !validFormat(format) {
+		k.internal().Warningf("unknown log_format %q, use json instead", format)
+	}
+	if !validCallerFormat(k.config.callerFormat.get()) {
+		k.internal().Warningf("unknown log_caller %q, use short instead", k.config.callerFormat.get())
+	}
+	if policy := k.config.reservedPolicy.get(); !validReservedKeyPolicy(policy) {
+		k.internal().Warningf("unknown log_reserved_keys %q, use rename instead", policy)
+	}
+}
+
+// clampLevel limits the level in [MinLevel, maxLevel]
+func (c *Config) clampLevel() (Level, bool) {
+	if c.maxLevel.get() < MinLevel {
+		c.maxLevel.set(MaxLevel)
+	}
+	l, max := c.level.get(), c.maxLevel.get()
+	switch {
+	case l < MinLevel:
+		c.level.set(MinLevel)
+	case l > max:
+		c.level.set(max)
+	default:
+		return l, false
+	}
+	return c.level.get(), true
+}
 
-		// change time from ns to formatted
-		klogger.config.zapConfig.EncoderConfig.TimeKey = "time"
-		klogger.config.zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+// newZapConfig returns the zap config used by Singleton
+func (c *Config) newZapConfig() zap.Config {
+	zapConfig := zap.NewProductionConfig()
+
+	// change time from ns to formatted
+	zapConfig.EncoderConfig.TimeKey = "time"
+	zapConfig.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+
+	// debug level unless log_level suppresses it, since V() entries are DEBUG
+	zapConfig.Level = c.severity.level
+	// sampled per level by log_sampling instead
+	zapConfig.Sampling = nil
+	c.setCallerFormat(&zapConfig)
+
+	switch c.format.get() {
+	case "console":
+		zapConfig.Encoding = "console"
+	case "dev":
+		// DPanic panics in development
+		zapConfig.Encoding = "console"
+		zapConfig.Development = true
+	case "gcp":
+		zapConfig.Encoding = "gcp"
+	case "ecs":
+		zapConfig.Encoding = "ecs"
+	}
 
-		// always set to debug level
-		klogger.config.zapConfig.Level = zap.NewAtomicLevelAt(zapcore.DebugLevel)
+	if c.development.get() {
+		zapConfig.Development = true
+	}
 
-		// due to gaps between zap and klog
-		if !klogger.config.alsologtostderr {
-			klogger.config.zapConfig.OutputPaths = []string{"stdout"}
+	// due to gaps between zap and klog
+	if !c.alsologtostderr.get() {
+		zapConfig.OutputPaths = []string{"stdout"}
+	}
+	if len(c.outputPaths.get()) > 0 {
+		zapConfig.OutputPaths = c.outputPaths.get()
+	}
+	if c.humanStderr.get() {
+		zapConfig.OutputPaths = withoutStderr(zapConfig.OutputPaths)
+	}
+	for _, fn := range c.encoderConfigFns {
+		fn(&zapConfig.EncoderConfig)
+	}
+	return zapConfig
+}
+
+// newEncoder returns the encoder of the outputs
+func (c *Config) newEncoder() zapcore.Encoder {
+	return c.encoderOf(c.encoding())
+}
+
+// encoding returns the encoding of the outputs, dev is told apart from console
+func (c *Config) encoding() string {
+	if c.format.get() == "dev" {
+		return "dev"
+	}
+	return c.zapConfig.Encoding
+}
+
+// newOutputEncoder returns the encoder of the outputs and log_file, colored
+// if they are terminals, see colorActive. log_dir and the error log are never
+func (c *Config) newOutputEncoder() zapcore.Encoder {
+	paths := c.zapConfig.OutputPaths
+	if c.logFile.get() != "" {
+		paths = append(paths[:len(paths):len(paths)], c.logFile.get())
+	}
+	return c.colorEncoderOf(c.encoding(), paths)
+}
+
+// encoderOf returns the encoder of encoding, e.g. of a route
+func (c *Config) encoderOf(encoding string) zapcore.Encoder {
+	return c.encoderWith(encoding, c.zapConfig.EncoderConfig)
+}
+
+// encoderWith returns the encoder of encoding with encoderConfig
+func (c *Config) encoderWith(encoding string, encoderConfig zapcore.EncoderConfig) zapcore.Encoder {
+	switch encoding {
+	case "console":
+		return zapcore.NewConsoleEncoder(encoderConfig)
+	case "dev":
+		return newMultilineEncoder(zapcore.NewConsoleEncoder(encoderConfig))
+	case "gcp":
+		return newGCPEncoder(encoderConfig)
+	case "ecs":
+		return newECSEncoder(encoderConfig)
+	}
+	return zapcore.NewJSONEncoder(encoderConfig)
+}
+
+// build is the same as zap.Config.Build, except that sinks are managed by c
+// On errors, the sinks opened so far are closed, and nothing is published
+func (c *Config) build() (*zap.Logger, error) {
+	encoder := c.newEncoder()
+	fallback, fallbackIsOutput, opened := c.sinks.fallback, c.sinks.fallbackIsOutput, c.sinks.count()
+	errorOutput := c.sinks.errorOutput
+	built := false
+	defer func() {
+		if !built {
+			closeSinks(context.Background(), c.sinks.detachFrom(opened), func() {})
+			c.sinks.fallback, c.sinks.fallbackIsOutput = fallback, fallbackIsOutput
+			c.sinks.errorOutput = errorOutput
 		}
+	}()
 
-		// trace the real source caller due to munual inline is not supported
-		zlogger, err := klogger.config.zapConfig.Build(zap.AddCallerSkip(1))
+	if err := c.openFallback(); err != nil {
+		return nil, err
+	}
+	errSink, err := c.sinks.open(c.zapConfig.ErrorOutputPaths...)
+	if err != nil {
+		return nil, err
+	}
+	c.sinks.errorOutput = errSink
+	journal, paths := splitJournalPaths(c.zapConfig.OutputPaths)
+	sink, err := c.sinks.open(paths...)
+	if err != nil {
+		return nil, err
+	}
+	var logFile *rotatingFile
+	if c.logFile.get() != "" || c.logFileFD.get() != 0 {
+		logFile, err = c.openLogFile()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
-		klogger.sugar = zlogger.Sugar()
-		Infof("init zap logger...")
-	})
-	return klogger
+		sink = zap.CombineWriteSyncers(sink, c.sinks.attachFile(logFile))
+	}
+	sink = c.batch.wrap(sink)
+
+	opts := []zap.Option{zap.ErrorOutput(errSink)}
+	if !c.zapConfig.DisableCaller {
+		opts = append(opts, zap.AddCaller())
+	}
+	if !c.zapConfig.DisableStacktrace {
+		opts = append(opts, zap.AddStacktrace(zapcore.ErrorLevel))
+	}
+	if rules := c.sampling.get(); rules.enabled() {
+		opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return newSamplerCore(core, rules, c.stats)
+		}))
+	}
+	// outside sampling, so that suppressed entries don't count
+	opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &suppressCore{Core: core, config: c}
+	}))
+	// after sampling, so that audit entries are never dropped
+	if len(c.auditPaths.get()) > 0 {
+		audit, err := c.openAudit()
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, audit)
+		}))
+	}
+	opts = append(opts, c.options()...)
+	opts = append(opts, c.buildField()...)
+	// outside sampling, so that entries to named sinks are never dropped
+	opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &sinkCore{Core: core, config: c, errOutput: errSink}
+	}))
+	// inside clockCore, so that errors and messages are counted by its time
+	opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &trackerCore{Core: &thresholdCore{Core: core, config: c}, config: c}
+	}))
+	opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &clockCore{Core: core, clock: &c.clock}
+	}))
+	// outside the tees, so that Lazy fields are evaluated once per entry
+	opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &lazyCore{Core: core, errOutput: errSink}
+	}))
+	if c.zapConfig.Development {
+		// rather than zap.Development, so that it's swapped along with the core
+		opts = append(opts, zap.WrapCore(newDevelopmentCore))
+	}
+	var seq *uint64
+	if c.seqField.get() {
+		seq = &c.stats.seq
+	}
+	core := zapcore.NewCore(newCountingEncoder(c.newOutputEncoder(), c.stats), sink, c.zapConfig.Level)
+	if len(journal) > 0 {
+		journalCore, err := c.journalCore(journal, c.newOutputEncoder(), c.zapConfig.Level)
+		if err != nil {
+			return nil, err
+		}
+		core = zapcore.NewTee(core, journalCore)
+	}
+	if c.logDir.get() != "" {
+		dir, err := c.logDirCore(encoder)
+		if err != nil {
+			return nil, err
+		}
+		core = zapcore.NewTee(core, dir)
+	}
+	if c.errorLogFile.get() != "" {
+		errLog, err := c.errorLogCore(encoder)
+		if err != nil {
+			return nil, err
+		}
+		core = zapcore.NewTee(core, errLog)
+	}
+	core = newRawJSONCore(core, c.zapConfig.Encoding == "console", c.maxFieldBytes.get())
+	if routes := c.allRoutes(); len(routes) > 0 {
+		cores := []zapcore.Core{core}
+		for _, r := range routes {
+			route, err := c.routeCore(r)
+			if err != nil {
+				return nil, err
+			}
+			cores = append(cores, route)
+		}
+		// inside the cores adding fields, so that the routes get the same ones
+		core = zapcore.NewTee(cores...)
+	}
+	core = newSortCore(core, c.sortFields.get())
+	core = newSeqCore(core, seq, c.monotonicField.get())
+	core = newSevCore(core, c.severityChar.get())
+	core = newBacktraceCore(core, c.backtraceAt.get())
+	core = newLabelsCore(core, c.format.get() == "ecs" && c.ecsLabels.get())
+	built = true
+	c.reservedKeys.Store(c.encoderKeys())
+	c.logFileHandle.Store(fileHolder{logFile})
+	c.built.Store(c.builtSnapshot())
+	c.changes.init(c.snapshot())
+	return zap.New(core, opts...), nil
+}
+
+// options returns the zap options derived from klog config
+func (c *Config) options() []zap.Option {
+	opts := []zap.Option{
+		// trace the real source caller due to munual inline is not supported
+		zap.AddCallerSkip(1),
+	}
+	if c.recentEntries.get() > 0 {
+		r := c.recent()
+		if r == nil || len(r.entries) != c.recentEntries.get() {
+			r = newRing(c.recentEntries.get(), zapcore.NewJSONEncoder(c.zapConfig.EncoderConfig))
+			c.ring.Store(r)
+		}
+		opts = append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return zapcore.NewTee(core, &ringCore{enc: r.enc.Clone(), ring: r})
+		}))
+	}
+	return append(opts, zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return newSanitizeCore(core, c.sanitize.get(), c.maxMessageBytes.get(), c.maxFieldBytes.get())
+	}))
+}
+
+// validFormat reports whether format is supported by log_format
+func validFormat(format string) bool {
+	switch format {
+	case "json", "console", "dev", "gcp", "ecs":
+		return true
+	}
+	return false
 }
 
 // InitFlags is a shim, only accepts
+// Flags already defined in flagset are skipped, so it's safe to call it twice
 func InitFlags(flagset *pflag.FlagSet) {
+	InitFlagsWithPrefix(flagset, "")
+}
+
+// InitFlagsWithPrefix is the same as InitFlags, but prepends prefix to the
+// names of the flags, e.g. "klog-" for --klog-v, so that they don't clash
+// with the flags of another logger, e.g. upstream klog
+func InitFlagsWithPrefix(flagset *pflag.FlagSet, prefix string) {
 	if flagset == nil {
 		flagset = pflag.CommandLine
 	}
-	flagset.Int32Var(&klogger.config.v, "v", klogger.config.v, "verbosity of info log")
-	flagset.BoolVar(&klogger.config.alsologtostderr, "alsologtostderr", klogger.config.alsologtostderr, "also write logs to stderr, default to true")
+	newFlagSet().VisitAll(func(f *pflag.Flag) {
+		f.Name = prefix + f.Name
+		if flagset.Lookup(f.Name) == nil {
+			flagset.AddFlag(f)
+		}
+	})
+}
+
+// newFlagSet returns the flags writing into the config of the global logger
+func newFlagSet() *pflag.FlagSet {
+	flagset := pflag.NewFlagSet("klog", pflag.ContinueOnError)
+	flagset.Var(&klogger.config.level, "v", "verbosity of info log, a number or one of info, debug and trace")
+	flagset.Var(&klogger.config.maxLevel, "max_v", "ceiling of v, V(n) beyond it is disabled")
+	flagset.VarPF(&klogger.config.vField, "v_field", "", "add the verbosity as field \"v\" to V() entries").NoOptDefVal = "true"
+	flagset.Var(&klogger.config.infoMaxV, "v_info_max", "V(n) entries are logged as INFO instead of DEBUG if n is no greater than this, -1 means none")
+	flagset.Var(&klogger.config.severity, "log_level", "suppress entries below it, one of info, warning and error")
+	flagset.Var(&klogger.config.callerFormat, "log_caller", "short for package/file.go:42, full for the full path, func to append the function name, base for file.go:42, hash for a hash of package/file.go:42 which ResolveCaller maps back, or none to skip the caller")
+	flagset.VarPF(&klogger.config.ecsLabels, "log_ecs_labels", "", "nest fields under labels.* for log_format=ecs").NoOptDefVal = "true"
+	flagset.VarPF(&klogger.config.alsologtostderr, "alsologtostderr", "", "also write logs to stderr, default to true").NoOptDefVal = "true"
+	flagset.Var(&klogger.config.format, "log_format", "json, console, dev which is console and makes DPanic panic, gcp for Google Cloud Logging, or ecs for Elastic Common Schema")
+	flagset.VarPF(&klogger.config.development, "log_development", "", "DPanic on misuses like odd args of WithFields, which panics, as log_format=dev does").NoOptDefVal = "true"
+	flagset.Var(&klogger.config.reservedPolicy, "log_reserved_keys", "rename fields named like the keys of the encoder, e.g. msg, with prefix \"fields.\", or drop them")
+	flagset.VarPF(&klogger.config.seqField, "log_seq", "", "add an increasing sequence number to every entry as field \"seq\"").NoOptDefVal = "true"
+	flagset.VarPF(&klogger.config.monotonicField, "log_monotonic", "", "add the nanoseconds of the monotonic clock since start to every entry as field \"monotonic\"").NoOptDefVal = "true"
+	flagset.VarPF(&klogger.config.severityChar, "log_severity_char", "", "add the glog severity letter I, W, E or F to each entry as sev").NoOptDefVal = "true"
+	flagset.VarPF(&klogger.config.sortFields, "log_sort_fields", "", "write fields in lexical order of keys, which costs encoding the fields of With on each entry").NoOptDefVal = "true"
+	flagset.VarPF(&klogger.config.buildInfoField, "log_build_info", "", "attach the build info to every entry as field \"build\", see SetBuildInfo").NoOptDefVal = "true"
+	flagset.VarPF(&klogger.config.fingerprint, "error_fingerprint", "", "attach a hash of the format or message to Errorf, Errorw and ErrorS entries as field \"fingerprint\"").NoOptDefVal = "true"
+	flagset.Var(&klogger.config.backtraceAt, "log_backtrace_at", "comma separated file:line, entries logged there carry the stack")
+	flagset.VarPF(&klogger.config.sanitize, "sanitize_messages", "", "escape CR/LF and strip control characters of messages and string fields").NoOptDefVal = "true"
+	flagset.Var(&klogger.config.maxMessageBytes, "max_message_bytes", "truncate messages longer than this, 0 means unlimited")
+	flagset.Var(&klogger.config.hexMaxBytes, "log_hex_max", "byte arrays passed to With are logged in hex up to this length, beyond which the prefix and the length are logged, -1 means unlimited")
+	flagset.Var(&klogger.config.maxFieldBytes, "max_field_bytes", "truncate string and bytes fields longer than this, 0 means unlimited")
+	flagset.Var(&klogger.config.fallbackPath, "fallback_output", "where entries go when an output fails, empty means dropping them")
+	flagset.Var(&klogger.config.recentEntries, "recent_entries", "keep this many recent entries of any level in memory and dump them on Fatal and Exit")
+	flagset.Var(&klogger.config.outputPaths, "log_output", "outputs replacing stdout or stderr, e.g. forward://127.0.0.1:24224?tag=app")
+	flagset.VarPF(&klogger.config.humanStderr, "log_human_stderr", "", "write console format to stderr instead of log_format, which goes to the other outputs").NoOptDefVal = "true"
+	flagset.Var(&klogger.config.color, "log_color", "color console entries by level: auto only when the outputs are terminals, always or never")
+	flagset.VarPF(&klogger.config.colorWholeLine, "log_color_whole_line", "", "color the whole console entry including its fields instead of the level only").NoOptDefVal = "true"
+	flagset.Var(&klogger.config.logFile, "log_file", "file to write entries to besides the outputs")
+	flagset.Var(&klogger.config.logFileFD, "log_file_fd", "fd of log_file inherited from the parent process, e.g. 3 for the first of ExtraFiles, 0 means opening log_file")
+	flagset.Var(&klogger.config.logFileMaxSize, "log_file_max_size", "rotates log_file beyond this size in MB, 0 means unlimited")
+	flagset.VarPF(&klogger.config.logFileCompress, "log_file_compress", "", "gzip rotated log files").NoOptDefVal = "true"
+	flagset.Var(&klogger.config.logFileMaxAge, "log_file_max_age", "delete rotated log files older than this, 0 means keeping them")
+	flagset.Var(&klogger.config.logFileMaxTotalSize, "log_file_max_total_size", "delete the oldest rotated log files beyond this total size in MB, 0 means unlimited")
+	flagset.VarPF(&klogger.config.logFileDaily, "log_file_daily", "", "rotate log files at midnight as well").NoOptDefVal = "true"
+	flagset.Var(&klogger.config.logFileBufferSize, "log_file_buffer_size", "bytes of entries buffered before writing to log files, 0 means unbuffered")
+	flagset.Var(&klogger.config.logFlushFrequency, "log_flush_frequency", "maximum time between writing buffered entries to log files")
+	flagset.Var(&klogger.config.logFsyncInterval, "log_file_fsync_interval", "fsync log files periodically besides Flush, 0 means never")
+	flagset.Var(&klogger.config.errorLogFile, "error_log_file", "file to duplicate ERROR and FATAL entries to, rotated like log_file")
+	flagset.Var(&klogger.config.logDir, "log_dir", "directory to write INFO, WARNING and ERROR files to, besides the outputs")
+	flagset.Var(&klogger.config.logNameTemplate, "log_name_template", "names of files in log_dir, with {program}, {host}, {user}, {severity}, {date} and {pid}")
+	flagset.Var(&klogger.config.sampling, "log_sampling", "comma separated level:initial/thereafter, the first initial entries of a message per second and every thereafter-th one after them are logged, none to log all")
+	flagset.Var(suppressFile{klogger.config}, "log_suppress_rules", "JSON file of the rules dropping or demoting entries, e.g. [{\"level\":\"info\",\"fields\":{\"path\":\"/healthz\"}}]")
+	flagset.Var(&klogger.config.auditPaths, "audit_output", "outputs of Audit entries besides the normal ones, never sampled")
+	flagset.Var(&klogger.config.recentDumpPath, "recent_entries_dump", "where recent entries are dumped, default to stderr")
+	return flagset
+}
+
+// InitGoFlags is the same as InitFlags, but for the standard flag package
+// Flags already defined in flagset are skipped
+func InitGoFlags(flagset *flag.FlagSet) {
+	if flagset == nil {
+		flagset = flag.CommandLine
+	}
+	// pflag values write into the same config and satisfy flag.Value
+	newFlagSet().VisitAll(func(f *pflag.Flag) {
+		if flagset.Lookup(f.Name) == nil {
+			flagset.Var(f.Value, f.Name, f.Usage)
+		}
+	})
+}
+
+// Flush syncs all the buffered entries
+func Flush() error {
+	return klogger.Flush()
+}
+
+// Flush syncs every output opened by the config of k, including the error
+// file, audit_output, routes, named sinks and the outputs of GetLogger, so
+// that buffered entries are written and files are fsynced. The errors of all
+// the outputs are returned together. Loggers without outputs, e.g. before
+// Singleton, sync their cores
+func (k *Klogger) Flush() error {
+	if ok, err := k.config.sinks.sync(); ok {
+		return multierr.Append(err, k.config.syncNamedSinks())
+	}
+	return k.sugar.Sync()
 }
 
-// Flush is a shim
-func Flush() {
-	klogger.sugar.Sync()
+// FlushWithTimeout is Flush giving up after d, when it returns
+// context.DeadlineExceeded
+func FlushWithTimeout(d time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), d)
+	defer cancel()
+	return klogger.flushContext(ctx)
+}
+
+// flushContext is Flush giving up when ctx is done
+func (k *Klogger) flushContext(ctx context.Context) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- k.Flush()
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close flushes and closes all the outputs before ctx is done
+// Entries logged after Close are written to stderr
+func Close(ctx context.Context) error {
+	return klogger.Close(ctx)
+}
+
+// Close flushes and closes all the outputs before ctx is done
+// Entries logged after Close are written to stderr. Loggers built by
+// Singleton or New switch to JSON on stderr at once, so that concurrent
+// entries never wait for the outputs being closed, see LoggedAfterClose
+func (k *Klogger) Close(ctx context.Context) error {
+	k.LogOnceSummary()
+	c := k.config
+	c.mu.Lock()
+	if c.core != nil {
+		c.core.swap(c.newClosedCore())
+	}
+	c.mu.Unlock()
+	return c.sinks.close(ctx)
 }
 
 // SetLevel updates level on the fly
@@ -130,13 +705,24 @@ func SetLevel(v Level) {
 
 // SetLevel updates level on the fly
 func (k *Klogger) SetLevel(v Level) {
-	if v < MinLevel || v > MaxLevel {
-		k.Warningf("failed setting level: expect [0, 4], get %d", v)
+	if max := k.config.maxLevel.get(); v < MinLevel || v > max {
+		if !k.misuse("level out of range", zap.Int32("v", int32(v)), zap.Int32("max_v", int32(max))) {
+			k.internal().Warningf("failed setting level: expect [%d, %d], get %d", MinLevel, max, v)
+		}
 		return
 	}
-	if k.config.level.get() != v {
-		k.config.level.set(v)
-	}
+	k.setLevel(v)
+}
+
+// SetStrictFields reports duplicate keys of WithFields as DPanic
+func SetStrictFields(strict bool) {
+	klogger.config.strictFields.set(strict)
+}
+
+// SetStringifyMapKeys sets whether With stringifies non-string map keys, or
+// skips such maps. Default to true
+func SetStringifyMapKeys(stringify bool) {
+	klogger.config.stringifyKeys.set(stringify)
 }
 
 // Set sets the value of the Level.
@@ -144,6 +730,11 @@ func (l *Level) set(val Level) {
 	atomic.StoreInt32((*int32)(l), int32(val))
 }
 
+// swap sets the value of the Level and returns the old one.
+func (l *Level) swap(val Level) Level {
+	return Level(atomic.SwapInt32((*int32)(l), int32(val)))
+}
+
 // get returns the value of the Level.
 func (l *Level) get() Level {
 	return Level(atomic.LoadInt32((*int32)(l)))
@@ -151,43 +742,132 @@ func (l *Level) get() Level {
 
 // V is a shim
 func V(level Level) Verbose {
-	return Verbose(level <= klogger.config.level.get())
+	return klogger.V(level)
 }
 
-// V is a shim
+// V is a shim, and respects the verbosity of k
+// The common case of a level above both the global level and the verbosity
+// of k is checked first, so that a disabled V() costs a few atomic loads
 func (k *Klogger) V(level Level) Verbose {
-	return Verbose(level <= k.config.level.get())
+	if level > k.config.level.get() && level > k.verbosity && k.node == nil && k.config.recent() == nil {
+		return Verbose{level: level, logger: k}
+	}
+	return k.v(level)
 }
 
-// Info is a shim
-//go:noinline
+// v is V out of the fast path
+func (k *Klogger) v(level Level) Verbose {
+	v := Verbose{
+		enabled: k.vEnabled(level),
+		level:   level,
+		logger:  k,
+	}
+	if !v.enabled {
+		v.recent = k.config.recent()
+	}
+	return v
+}
+
+// level returns the greater of the global level, or the one set by
+// ConfigureLogger, and the verbosity of k
+func (k *Klogger) level() Level {
+	l := k.config.level.get()
+	if k.node != nil {
+		if v, ok := k.node.v(); ok {
+			l = v
+		}
+	}
+	if l > k.verbosity {
+		return l
+	}
+	return k.verbosity
+}
+
+// Enabled reports whether the verbose entries will be logged
+func (v Verbose) Enabled() bool {
+	return v.enabled
+}
+
+// entry returns the zap level and the extra fields of verbose entries
+func (v Verbose) entry(fields []zap.Field) (zapcore.Level, []zap.Field) {
+	c := v.logger.config
+	lvl := zapcore.DebugLevel
+	if int(v.level) <= c.infoMaxV.get() {
+		lvl = zapcore.InfoLevel
+	}
+	if c.vField.get() {
+		fields = append(fields, verboseField(v.level))
+	}
+	return lvl, fields
+}
+
+// Info is a shim. The Verbose methods are small enough to be inlined, and
+// return before touching args if v is disabled
 func (v Verbose) Info(args ...interface{}) {
-	if v {
-		klogger.sugar.Debug(args...)
+	if v.enabled || v.recent != nil {
+		v.InfoDepth(1, args...)
 	}
 }
 
 // Infoln is a shim
-//go:noinline
 func (v Verbose) Infoln(args ...interface{}) {
-	if v {
-		s := fmt.Sprint(args...)
-		klogger.sugar.Debug(s, "\n")
+	if v.enabled || v.recent != nil {
+		v.infoln(args)
+	}
+}
+
+// infoln is Infoln, which is one frame deeper
+func (v Verbose) infoln(args []interface{}) {
+	if v.enabled {
+		lvl, fields := v.entry(nil)
+		if ce := v.logger.depthLogger(1).Check(lvl, sprintln(args)); ce != nil {
+			ce.Write(fields...)
+		}
+	} else if v.recent != nil {
+		v.recent.suppressed(sprintln(args), nil)
 	}
 }
 
 // Infof is a shim
-//go:noinline
 func (v Verbose) Infof(format string, args ...interface{}) {
-	if v {
-		klogger.sugar.Debugf(format, args...)
+	if v.enabled || v.recent != nil {
+		v.InfofDepth(1, format, args...)
+	}
+}
+
+// InfoS logs a message with k-v pairs
+func (v Verbose) InfoS(msg string, kv ...interface{}) {
+	if v.enabled || v.recent != nil {
+		v.InfoSDepth(1, msg, kv...)
+	}
+}
+
+// Infow is the same as InfoS, named after zap
+func (v Verbose) Infow(msg string, kv ...interface{}) {
+	if v.enabled || v.recent != nil {
+		v.InfoSDepth(1, msg, kv...)
+	}
+}
+
+// InfoFn builds the message and k-v pairs only when v is enabled, or when
+// recent_entries keeps the suppressed entries
+func (v Verbose) InfoFn(fn func() (msg string, kv []interface{})) {
+	if v.enabled {
+		msg, kv := fn()
+		lvl, fields := v.entry(v.logger.sweetenFields(kv))
+		if ce := v.logger.sugar.Desugar().Check(lvl, msg); ce != nil {
+			ce.Write(fields...)
+		}
+	} else if v.recent != nil {
+		msg, kv := fn()
+		v.recent.suppressed(msg, v.logger.sweetenFields(kv))
 	}
 }
 
 // Info is a shim
 //go:noinline
 func Info(args ...interface{}) {
-	klogger.sugar.Info(args)
+	klogger.sugar.Info(args...)
 }
 
 // Info is a shim
@@ -196,44 +876,74 @@ func (k *Klogger) Info(args ...interface{}) {
 	k.sugar.Info(args...)
 }
 
-// InfoDepth is a shim
+// InfoDepth is a shim, reporting the caller depth frames above
 //go:noinline
 func InfoDepth(depth int, args ...interface{}) {
-	klogger.sugar.Info(args...)
+	klogger.depthLogger(depth).Info(fmt.Sprint(args...))
 }
 
-// InfoDepth is a shim
+// InfoDepth is a shim, reporting the caller depth frames above
 //go:noinline
 func (k *Klogger) InfoDepth(depth int, args ...interface{}) {
-	k.sugar.Info(args...)
+	k.depthLogger(depth).Info(fmt.Sprint(args...))
 }
 
 // Infoln is a shim
 //go:noinline
 func Infoln(args ...interface{}) {
-	s := fmt.Sprint(args...)
-	klogger.sugar.Info(s, "\n")
+	klogger.sugar.Desugar().Info(sprintln(args))
 }
 
 // Infoln is a shim
 //go:noinline
 func (k *Klogger) Infoln(args ...interface{}) {
-	s := fmt.Sprint(args...)
-	k.sugar.Info(s, "\n")
+	k.sugar.Desugar().Info(sprintln(args))
 }
 
 // Infof is a shim
 //go:noinline
 func Infof(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		klogger.wrapf(zapcore.InfoLevel, format, args)
+		return
+	}
 	klogger.sugar.Infof(format, args...)
 }
 
 // Infof is a shim
 //go:noinline
 func (k *Klogger) Infof(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		k.wrapf(zapcore.InfoLevel, format, args)
+		return
+	}
 	k.sugar.Infof(format, args...)
 }
 
+// InfoS logs a message with k-v pairs
+//go:noinline
+func InfoS(msg string, kv ...interface{}) {
+	klogger.sugar.Desugar().Info(msg, klogger.sweetenFields(kv)...)
+}
+
+// InfoS logs a message with k-v pairs
+//go:noinline
+func (k *Klogger) InfoS(msg string, kv ...interface{}) {
+	k.sugar.Desugar().Info(msg, k.sweetenFields(kv)...)
+}
+
+// Infow is the same as InfoS, named after zap
+//go:noinline
+func Infow(msg string, kv ...interface{}) {
+	klogger.sugar.Desugar().Info(msg, klogger.sweetenFields(kv)...)
+}
+
+// Infow is the same as InfoS, named after zap
+//go:noinline
+func (k *Klogger) Infow(msg string, kv ...interface{}) {
+	k.sugar.Desugar().Info(msg, k.sweetenFields(kv)...)
+}
+
 // Warning is a shim
 //go:noinline
 func Warning(args ...interface{}) {
@@ -246,44 +956,62 @@ func (k *Klogger) Warning(args ...interface{}) {
 	k.sugar.Warn(args...)
 }
 
-// WarningDepth is a shim
+// WarningDepth is a shim, reporting the caller depth frames above
 //go:noinline
 func WarningDepth(depth int, args ...interface{}) {
-	klogger.sugar.Warn(args...)
+	klogger.depthLogger(depth).Warn(fmt.Sprint(args...))
 }
 
-// WarningDepth is a shim
+// WarningDepth is a shim, reporting the caller depth frames above
 //go:noinline
 func (k *Klogger) WarningDepth(depth int, args ...interface{}) {
-	k.sugar.Warn(args...)
+	k.depthLogger(depth).Warn(fmt.Sprint(args...))
 }
 
 // Warningln is a shim
 //go:noinline
 func Warningln(args ...interface{}) {
-	s := fmt.Sprint(args...)
-	klogger.sugar.Warn(s, "\n")
+	klogger.sugar.Desugar().Warn(sprintln(args))
 }
 
 // Warningln is a shim
 //go:noinline
 func (k *Klogger) Warningln(args ...interface{}) {
-	s := fmt.Sprint(args...)
-	k.sugar.Warn(s, "\n")
+	k.sugar.Desugar().Warn(sprintln(args))
 }
 
 // Warningf is a shim
 //go:noinline
 func Warningf(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		klogger.wrapf(zapcore.WarnLevel, format, args)
+		return
+	}
 	klogger.sugar.Warnf(format, args...)
 }
 
 // Warningf is a shim
 //go:noinline
 func (k *Klogger) Warningf(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		k.wrapf(zapcore.WarnLevel, format, args)
+		return
+	}
 	k.sugar.Warnf(format, args...)
 }
 
+// Warningw logs a message with k-v pairs
+//go:noinline
+func Warningw(msg string, kv ...interface{}) {
+	klogger.sugar.Desugar().Warn(msg, klogger.sweetenFields(kv)...)
+}
+
+// Warningw logs a message with k-v pairs
+//go:noinline
+func (k *Klogger) Warningw(msg string, kv ...interface{}) {
+	k.sugar.Desugar().Warn(msg, k.sweetenFields(kv)...)
+}
+
 // Error is a shim
 //go:noinline
 func Error(args ...interface{}) {
@@ -296,158 +1024,292 @@ func (k *Klogger) Error(args ...interface{}) {
 	k.sugar.Error(args...)
 }
 
-// ErrorDepth is a shim
+// ErrorDepth is a shim, reporting the caller depth frames above
 //go:noinline
 func ErrorDepth(depth int, args ...interface{}) {
-	klogger.sugar.Error(args...)
+	klogger.depthLogger(depth).Error(fmt.Sprint(args...))
 }
 
-// ErrorDepth is a shim
+// ErrorDepth is a shim, reporting the caller depth frames above
 //go:noinline
 func (k *Klogger) ErrorDepth(depth int, args ...interface{}) {
-	k.sugar.Error(args...)
+	k.depthLogger(depth).Error(fmt.Sprint(args...))
 }
 
 // Errorln is a shim
 //go:noinline
 func Errorln(args ...interface{}) {
-	s := fmt.Sprint(args...)
-	klogger.sugar.Error(s, "\n")
+	klogger.sugar.Desugar().Error(sprintln(args))
 }
 
 // Errorln is a shim
 //go:noinline
 func (k *Klogger) Errorln(args ...interface{}) {
-	s := fmt.Sprint(args...)
-	k.sugar.Error(s, "\n")
+	k.sugar.Desugar().Error(sprintln(args))
 }
 
 // Errorf is a shim
 //go:noinline
 func Errorf(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		klogger.wrapf(zapcore.ErrorLevel, format, args)
+		return
+	}
+	if f, ok := klogger.fingerprintField(format); ok {
+		klogger.sugar.Desugar().Error(fmt.Sprintf(format, args...), f)
+		return
+	}
 	klogger.sugar.Errorf(format, args...)
 }
 
 // Errorf is a shim
 //go:noinline
 func (k *Klogger) Errorf(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		k.wrapf(zapcore.ErrorLevel, format, args)
+		return
+	}
+	if f, ok := k.fingerprintField(format); ok {
+		k.sugar.Desugar().Error(fmt.Sprintf(format, args...), f)
+		return
+	}
 	k.sugar.Errorf(format, args...)
 }
 
+// Errorw logs a message with k-v pairs
+//go:noinline
+func Errorw(msg string, kv ...interface{}) {
+	klogger.sugar.Desugar().Error(msg, klogger.errorFields(nil, msg, kv)...)
+}
+
+// Errorw logs a message with k-v pairs
+//go:noinline
+func (k *Klogger) Errorw(msg string, kv ...interface{}) {
+	k.sugar.Desugar().Error(msg, k.errorFields(nil, msg, kv)...)
+}
+
+// ErrorS logs a message with err and k-v pairs
+//go:noinline
+func ErrorS(err error, msg string, kv ...interface{}) {
+	klogger.sugar.Desugar().Error(msg, klogger.errorFields(err, msg, kv)...)
+}
+
+// ErrorS logs a message with err and k-v pairs
+//go:noinline
+func (k *Klogger) ErrorS(err error, msg string, kv ...interface{}) {
+	k.sugar.Desugar().Error(msg, k.errorFields(err, msg, kv)...)
+}
+
 // Fatal is a shim
 //go:noinline
 func Fatal(args ...interface{}) {
-	klogger.sugar.Error(args...)
-	os.Exit(255)
+	klogger.exit(255, klogger.fatal(1, fmt.Sprint(args...)))
 }
 
 // Fatal is a shim
 //go:noinline
 func (k *Klogger) Fatal(args ...interface{}) {
-	k.sugar.Error(args...)
-	os.Exit(255)
+	k.exit(255, k.fatal(1, fmt.Sprint(args...)))
 }
 
 // FatalDepth is a shim
 //go:noinline
 func FatalDepth(depth int, args ...interface{}) {
-	klogger.sugar.Error(args...)
-	os.Exit(255)
+	klogger.exit(255, klogger.fatal(1+depth, fmt.Sprint(args...)))
 }
 
 // FatalDepth is a shim
 //go:noinline
 func (k *Klogger) FatalDepth(depth int, args ...interface{}) {
-	k.sugar.Error(args...)
-	os.Exit(255)
+	k.exit(255, k.fatal(1+depth, fmt.Sprint(args...)))
 }
 
 // Fatalln is a shim
 //go:noinline
 func Fatalln(args ...interface{}) {
-	s := fmt.Sprint(args...)
-	klogger.sugar.Error(s, "\n")
-	os.Exit(255)
+	klogger.exit(255, klogger.fatal(1, sprintln(args)))
 }
 
 // Fatalln is a shim
 //go:noinline
 func (k *Klogger) Fatalln(args ...interface{}) {
-	s := fmt.Sprint(args...)
-	k.sugar.Error(s, "\n")
-	os.Exit(255)
+	k.exit(255, k.fatal(1, sprintln(args)))
 }
 
 // Fatalf is a shim
 //go:noinline
 func Fatalf(format string, args ...interface{}) {
-	klogger.sugar.Errorf(format, args...)
-	os.Exit(255)
+	msg, fields := klogger.sprintf(format, args)
+	klogger.exit(255, klogger.fatal(1, msg, fields...))
 }
 
 // Fatalf is a shim
 //go:noinline
 func (k *Klogger) Fatalf(format string, args ...interface{}) {
-	k.sugar.Errorf(format, args...)
-	os.Exit(255)
+	msg, fields := k.sprintf(format, args)
+	k.exit(255, k.fatal(1, msg, fields...))
+}
+
+// Fatalw logs a message with k-v pairs and exits
+//go:noinline
+func Fatalw(msg string, kv ...interface{}) {
+	klogger.exit(255, klogger.fatal(1, msg, klogger.sweetenFields(kv)...))
+}
+
+// Fatalw logs a message with k-v pairs and exits
+//go:noinline
+func (k *Klogger) Fatalw(msg string, kv ...interface{}) {
+	k.exit(255, k.fatal(1, msg, k.sweetenFields(kv)...))
+}
+
+// FatalS logs a message with err and k-v pairs like ErrorS, and exits
+//go:noinline
+func FatalS(err error, msg string, kv ...interface{}) {
+	klogger.exit(255, klogger.fatal(1, msg, klogger.errorFields(err, msg, kv)...))
+}
+
+// FatalS logs a message with err and k-v pairs like ErrorS, and exits
+//go:noinline
+func (k *Klogger) FatalS(err error, msg string, kv ...interface{}) {
+	k.exit(255, k.fatal(1, msg, k.errorFields(err, msg, kv)...))
 }
 
 // Exit is a shim
 //go:noinline
 func Exit(args ...interface{}) {
-	klogger.sugar.Error(args...)
-	os.Exit(1)
+	klogger.exit(1, klogger.exitError(1, fmt.Sprint(args...)))
 }
 
 // Exit is a shim
 //go:noinline
 func (k *Klogger) Exit(args ...interface{}) {
-	k.sugar.Error(args...)
-	os.Exit(1)
+	k.exit(1, k.exitError(1, fmt.Sprint(args...)))
 }
 
 // ExitDepth is a shim
 //go:noinline
 func ExitDepth(depth int, args ...interface{}) {
-	klogger.sugar.Error(args...)
-	os.Exit(1)
+	klogger.exit(1, klogger.exitError(1+depth, fmt.Sprint(args...)))
 }
 
 // ExitDepth is a shim
 //go:noinline
 func (k *Klogger) ExitDepth(depth int, args ...interface{}) {
-	k.sugar.Error(args...)
-	os.Exit(1)
+	k.exit(1, k.exitError(1+depth, fmt.Sprint(args...)))
 }
 
 // Exitln is a shim
 //go:noinline
 func Exitln(args ...interface{}) {
-	s := fmt.Sprint(args...)
-	klogger.sugar.Error(s, "\n")
-	os.Exit(1)
+	klogger.exit(1, klogger.exitError(1, sprintln(args)))
 }
 
 // Exitln is a shim
 //go:noinline
 func (k *Klogger) Exitln(args ...interface{}) {
-	s := fmt.Sprint(args...)
-	k.sugar.Error(s, "\n")
-	os.Exit(1)
+	k.exit(1, k.exitError(1, sprintln(args)))
 }
 
 // Exitf is a shim
 //go:noinline
 func Exitf(format string, args ...interface{}) {
-	klogger.sugar.Errorf(format, args...)
-	os.Exit(1)
+	msg, fields := klogger.sprintf(format, args)
+	klogger.exit(1, klogger.exitError(1, msg, fields...))
 }
 
 // Exitf is a shim
 //go:noinline
 func (k *Klogger) Exitf(format string, args ...interface{}) {
-	k.sugar.Errorf(format, args...)
-	os.Exit(1)
+	msg, fields := k.sprintf(format, args)
+	k.exit(1, k.exitError(1, msg, fields...))
+}
+
+// Exitw logs a message with k-v pairs like Errorw, and exits with 1
+//go:noinline
+func Exitw(msg string, kv ...interface{}) {
+	klogger.exit(1, klogger.exitError(1, msg, klogger.errorFields(nil, msg, kv)...))
+}
+
+// Exitw logs a message with k-v pairs like Errorw, and exits with 1
+//go:noinline
+func (k *Klogger) Exitw(msg string, kv ...interface{}) {
+	k.exit(1, k.exitError(1, msg, k.errorFields(nil, msg, kv)...))
+}
+
+// Panic logs and panics
+//go:noinline
+func Panic(args ...interface{}) {
+	klogger.sugar.Panic(args...)
+}
+
+// Panic logs and panics
+//go:noinline
+func (k *Klogger) Panic(args ...interface{}) {
+	k.sugar.Panic(args...)
+}
+
+// Panicln logs and panics
+//go:noinline
+func Panicln(args ...interface{}) {
+	klogger.sugar.Desugar().Panic(sprintln(args))
+}
+
+// Panicln logs and panics
+//go:noinline
+func (k *Klogger) Panicln(args ...interface{}) {
+	k.sugar.Desugar().Panic(sprintln(args))
+}
+
+// Panicf logs and panics
+//go:noinline
+func Panicf(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		klogger.wrapf(zapcore.PanicLevel, format, args)
+		return
+	}
+	klogger.sugar.Panicf(format, args...)
+}
+
+// Panicf logs and panics
+//go:noinline
+func (k *Klogger) Panicf(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		k.wrapf(zapcore.PanicLevel, format, args)
+		return
+	}
+	k.sugar.Panicf(format, args...)
+}
+
+// DPanic logs, and panics only in development, see log_format
+//go:noinline
+func DPanic(args ...interface{}) {
+	klogger.sugar.DPanic(args...)
+}
+
+// DPanic logs, and panics only in development, see log_format
+//go:noinline
+func (k *Klogger) DPanic(args ...interface{}) {
+	k.sugar.DPanic(args...)
+}
+
+// DPanicf logs, and panics only in development, see log_format
+//go:noinline
+func DPanicf(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		klogger.wrapf(zapcore.DPanicLevel, format, args)
+		return
+	}
+	klogger.sugar.DPanicf(format, args...)
+}
+
+// DPanicf logs, and panics only in development, see log_format
+//go:noinline
+func (k *Klogger) DPanicf(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		k.wrapf(zapcore.DPanicLevel, format, args)
+		return
+	}
+	k.sugar.DPanicf(format, args...)
 }
 
 // WithAll fills each arg directly without parsing fields and values
@@ -460,13 +1322,14 @@ func WithAll(args ...interface{}) *Klogger {
 // Only valid for exported fields
 func (k *Klogger) WithAll(args ...interface{}) *Klogger {
 	newSugar := k.sugar
+	added := make([]zap.Field, 0, len(args))
 	for _, arg := range args {
 		t := reflect.TypeOf(arg)
-		newSugar = newSugar.With(t.Name(), arg)
-	}
-	return &Klogger{
-		sugar: newSugar,
+		f := anyField(t.Name(), arg)
+		added = append(added, f)
+		newSugar = newSugar.Desugar().With(f).Sugar()
 	}
+	return k.deriveWith(newSugar, added)
 }
 
 // With fills k-v of a struct into a logger, however it's relatively slow
@@ -477,35 +1340,48 @@ func With(args ...interface{}) *Klogger {
 // With fills k-v of a struct into a logger, however it's relatively slow
 // Only struct and map will be accepted:
 //   * struct: only exported field will be added
-//   * map: only accept string type as key
+//   * map: keys are sorted, non-string keys are stringified by fmt.Sprint
+//     unless SetStringifyMapKeys(false) is called
 func (k *Klogger) With(args ...interface{}) *Klogger {
 	newSugar := k.sugar
+	c := k.config
+	var added []zap.Field
 	for i := 0; i < len(args); i++ {
 		arg := args[i]
+		if arg == nil {
+			continue
+		}
 		t := reflect.TypeOf(arg)
 		v := reflect.ValueOf(arg)
 		switch t.Kind() {
 		case reflect.Struct:
-			for i := 0; i < t.NumField(); i++ {
-				k := t.Field(i).Name
-				if f := v.Field(i); f.CanInterface() {
-					newSugar = newSugar.Desugar().With(zap.Any(k, f.Interface())).Sugar()
+			for _, f := range structFields(t) {
+				if name, ok := k.reserveKey(f.name); ok {
+					field := c.fieldOf(name, v.Field(f.index))
+					added = append(added, field)
+					newSugar = newSugar.Desugar().With(field).Sugar()
 				}
 			}
 		case reflect.Map:
-			iter := v.MapRange()
-			for iter.Next() {
-				if key, val := iter.Key(), iter.Value(); key.Kind() == reflect.String && val.CanInterface() {
-					newSugar = newSugar.Desugar().With(zap.Any(key.String(), val.Interface())).Sugar()
+			if t.Key().Kind() != reflect.String {
+				k.misuse("non-string map keys in With", zap.Stringer("type", t))
+				if !c.stringifyKeys.get() {
+					continue
+				}
+			}
+			for _, key := range mapKeys(v) {
+				name, ok := k.reserveKey(key.s)
+				if val := v.MapIndex(key.v); ok && val.CanInterface() {
+					field := c.fieldOf(name, val)
+					added = append(added, field)
+					newSugar = newSugar.Desugar().With(field).Sugar()
 				}
 			}
 		default:
 			// other types are not supported yet
 		}
 	}
-	return &Klogger{
-		sugar: newSugar,
-	}
+	return k.deriveWith(newSugar, added)
 }
 
 // WithFields requires user to fill in k-v pairs
@@ -514,9 +1390,29 @@ func WithFields(args ...interface{}) *Klogger {
 }
 
 // WithFields requires user to fill in k-v pairs
+// Malformed pairs are repaired instead of being dropped by zap:
+//   * odd trailing arg: logged under DanglingKey
+//   * non-string key: stringified and reported under NonStringKeys
+//   * duplicate key: the last one wins
+// zap.Field, Fields, map[string]interface{} and map[string]string are
+// accepted as well, maps are added in the order of their keys
 func (k *Klogger) WithFields(args ...interface{}) *Klogger {
-	newSugar := k.sugar.With(args...)
+	fields := k.sweetenFields(args)
+	return k.deriveWith(withFields(k.sugar, fields), fields)
+}
+
+// derive returns a child logger sharing the config of k
+func (k *Klogger) derive(sugar *zap.SugaredLogger) *Klogger {
 	return &Klogger{
-		sugar: newSugar,
+		sugar:       sugar,
+		config:      k.config,
+		namespace:   k.namespace,
+		verbosity:   k.verbosity,
+		fingerprint: k.fingerprint,
+		callerSkip:  k.callerSkip,
+		minSeverity: k.minSeverity,
+		node:        k.node,
+		fields:      k.fields,
+		buffer:      k.buffer,
 	}
 }
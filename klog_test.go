@@ -15,13 +15,64 @@ limitations under the License.
 package klog
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
+// newTestLogger returns a logger writing JSON lines into a buffer
+func newTestLogger() (*Klogger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.AddSync(buf), zapcore.DebugLevel)
+	return &Klogger{
+		sugar:  zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1)).Sugar(),
+		config: newConfig(),
+	}, buf
+}
+
+// swapLogger installs k as the global logger and returns a restore func
+func swapLogger(k *Klogger) func() {
+	old := klogger
+	klogger = k
+	return func() {
+		klogger = old
+	}
+}
+
+// decodeLines parses each JSON line written by a test logger
+func decodeLines(t *testing.T, buf *bytes.Buffer) []map[string]interface{} {
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := map[string]interface{}{}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("invalid json line %q: %v", line, err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
 func TestProduction(t *testing.T) {
 	InitFlags(nil)
-	klogger.config.v = 1 // enable DEBUG level
+	klogger.config.level.set(1) // enable DEBUG level
 	Singleton()
 
 	arg := fmt.Errorf("hello")
@@ -46,6 +97,136 @@ func TestProduction(t *testing.T) {
 	V(2).Infof("%s", arg)
 }
 
+func TestStartupEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+
+	for _, v := range []Level{0, 1} {
+		c := newConfig()
+		c.alsologtostderr.set(false)
+		c.level.set(v)
+		path := redirectStdout(t, dir, fmt.Sprintf("v%d.log", v))
+		k := &Klogger{sugar: zap.S(), config: c}
+		restore := swapLogger(k)
+		// a fresh Singleton, which is done already by TestProduction
+		once = sync.Once{}
+		Singleton()
+		k.Close(context.Background())
+		restore()
+
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s := string(b)
+		if v == 0 && s != "" {
+			t.Errorf("expect silence by default, get %s", s)
+		}
+		if v == 1 && (!strings.Contains(s, `"msg":"klog initialized","format":"json","v":1`) || !strings.Contains(s, `"outputs":["stdout"]`)) {
+			t.Errorf("expect the startup entry, get %s", s)
+		}
+	}
+}
+
+func TestLogBeforeSingleton(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "early.log")
+
+	restore := swapLogger(newEarlyLogger())
+	defer restore()
+	Infof("before flags")
+
+	var loops int32
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; ; i++ {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			Infof("logging %d", i)
+			InfoS("logging", "i", i, "odd")
+			V(1).InfoS("verbose", "i", i)
+			WithFields("i", i).Warning("logging")
+			atomic.AddInt32(&loops, 1)
+		}
+	}()
+	// wait for the goroutine to log
+	for atomic.LoadInt32(&loops) == 0 {
+		runtime.Gosched()
+	}
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	InitFlags(fs)
+	if err := fs.Parse([]string{"--v=1", "--v_field", "--log_reserved_keys=drop", "--log_output=" + path}); err != nil {
+		t.Fatal(err)
+	}
+	// a fresh Singleton, which is done already by TestProduction
+	once = sync.Once{}
+	Singleton()
+	Infof("after Singleton")
+	for n := atomic.LoadInt32(&loops); atomic.LoadInt32(&loops) < n+2; {
+		runtime.Gosched()
+	}
+
+	// flags read by build, parsed while rebuilding
+	parsed := make(chan error)
+	go func() {
+		parsed <- fs.Parse([]string{
+			"--alsologtostderr=false", "--log_caller=full", "--log_seq", "--log_monotonic",
+			"--log_severity_char", "--log_sort_fields", "--log_build_info", "--log_ecs_labels",
+			"--sanitize_messages", "--max_message_bytes=4096", "--max_field_bytes=1024",
+			"--fallback_output=stderr", "--recent_entries=10", "--recent_entries_dump=stderr",
+			"--log_human_stderr", "--log_color_whole_line", "--log_backtrace_at=nowhere.go:1",
+			"--log_file_max_size=1", "--log_file_compress", "--log_file_max_age=1h",
+			"--log_file_max_total_size=10", "--log_file_daily", "--log_file_buffer_size=4096",
+			"--log_flush_frequency=1s", "--log_file_fsync_interval=1s",
+		})
+	}()
+	for i := 0; i < 3; i++ {
+		if err := Reconfigure(); err != nil {
+			t.Fatal(err)
+		}
+		EffectiveConfig()
+	}
+	if err := <-parsed; err != nil {
+		t.Fatal(err)
+	}
+	if err := Reconfigure(); err != nil {
+		t.Fatal(err)
+	}
+	Infof("after flags")
+	close(stop)
+	<-done
+	klogger.Close(context.Background())
+
+	entries := readLines(t, path)
+	if len(entries) == 0 || entries[0]["msg"] != "before flags" {
+		t.Fatalf("expect entries before Singleton to be replayed first, get %v", entries)
+	}
+	var verbose, after, seq bool
+	for _, e := range entries {
+		verbose = verbose || e["msg"] == "verbose" && e["v"] == float64(1)
+		after = after || e["msg"] == "after Singleton"
+		seq = seq || e["msg"] == "after flags" && e["seq"] != nil
+	}
+	if !verbose || !after || !seq {
+		t.Errorf("expect entries logged with the parsed flags, get %d entries", len(entries))
+	}
+}
+
 func TestWith(t *testing.T) {
 	Singleton()
 
@@ -136,6 +317,125 @@ func TestUpdateLevel(t *testing.T) {
 	V(1).Infof("should-print")
 }
 
+// catchPanic returns the value recovered from fn
+func catchPanic(fn func()) (r interface{}) {
+	defer func() {
+		r = recover()
+	}()
+	fn()
+	return nil
+}
+
+func TestPanic(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	for _, fn := range []func(){
+		func() { Panic("boom") },
+		func() { Panicf("%s", "boom") },
+		func() { k.Panicln("boom") },
+	} {
+		buf.Reset()
+		if r := catchPanic(fn); r == nil || !strings.HasPrefix(fmt.Sprint(r), "boom") {
+			t.Errorf("expect panic boom, get %v", r)
+		}
+		entries := decodeLines(t, buf)
+		if len(entries) != 1 || entries[0]["level"] != "panic" {
+			t.Fatalf("entry should be written before panicking: %v", entries)
+		}
+		if caller, _ := entries[0]["caller"].(string); !strings.Contains(caller, "klog_test.go") {
+			t.Errorf("unexpected caller %s", caller)
+		}
+	}
+}
+
+func TestDPanic(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	// production only logs
+	if r := catchPanic(func() { DPanicf("%s", "boom") }); r != nil {
+		t.Errorf("unexpected panic %v", r)
+	}
+	if entries := decodeLines(t, buf); len(entries) != 1 || entries[0]["level"] != "dpanic" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+
+	// development panics
+	buf.Reset()
+	k.sugar = k.sugar.Desugar().WithOptions(zap.Development()).Sugar()
+	if r := catchPanic(func() { DPanic("boom") }); r != "boom" {
+		t.Errorf("expect panic boom, get %v", r)
+	}
+	if entries := decodeLines(t, buf); len(entries) != 1 || entries[0]["msg"] != "boom" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
+
+func TestLogFormat(t *testing.T) {
+	c := newConfig()
+	if zc := c.newZapConfig(); zc.Encoding != "json" || zc.Development {
+		t.Errorf("unexpected default config %+v", zc)
+	}
+	c.format.set("console")
+	if zc := c.newZapConfig(); zc.Encoding != "console" || zc.Development {
+		t.Errorf("unexpected console config %+v", zc)
+	}
+	c.format.set("dev")
+	if zc := c.newZapConfig(); zc.Encoding != "console" || !zc.Development {
+		t.Errorf("unexpected dev config %+v", zc)
+	}
+}
+
+// state is a big struct logged by %+v
+type state struct {
+	ID    string
+	Names [16]string
+	Count [16]int
+}
+
+func TestDisabledVNoAlloc(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+	st := &state{ID: "0001"}
+
+	n := testing.AllocsPerRun(100, func() {
+		V(5).Infof("state: %+v", st)
+		V(5).InfoS("state", "state", st, "n", 1000)
+		k.V(5).Info("state", st)
+	})
+	if n != 0 {
+		t.Errorf("disabled V() should not allocate, get %v", n)
+	}
+}
+
+func TestVerboseCaller(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	V(0).Infof("infof")
+	V(0).InfoS("infos")
+	k.V(0).Info("info")
+	k.V(0).Infoln("infoln")
+	k.V(0).Infow("infow")
+	for _, e := range decodeLines(t, buf) {
+		if caller, _ := e["caller"].(string); !strings.Contains(caller, "klog_test.go") {
+			t.Errorf("unexpected caller of %v: %s", e["msg"], caller)
+		}
+	}
+}
+
+// BenchmarkDisabledV is the cost of a disabled V(), which returns before
+// formatting or boxing args. Values passed by pointer are not copied either
+func BenchmarkDisabledV(b *testing.B) {
+	Singleton()
+	st := &state{ID: "0001"}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		V(MaxLevel).Infof("state: %+v", st)
+	}
+}
+
 func BenchmarkWith(b *testing.B) {
 	Singleton()
 	b.ResetTimer()
@@ -155,6 +455,14 @@ func BenchmarkWithFields(b *testing.B) {
 	}
 }
 
+func BenchmarkInfow(b *testing.B) {
+	Singleton()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Infow("world", "ID", "0001", "Name", "hello")
+	}
+}
+
 func BenchmarkWithAll(b *testing.B) {
 	Singleton()
 	type s struct {
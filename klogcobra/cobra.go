@@ -0,0 +1,90 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package klogcobra wires klog into cobra commands and viper configs
+// *cobra.Command and *viper.Viper satisfy the interfaces below, so that this
+// package doesn't depend on them
+package klogcobra
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/spf13/pflag"
+	"github.com/xial-thu/klog"
+)
+
+// Command is satisfied by *cobra.Command
+type Command interface {
+	PersistentFlags() *pflag.FlagSet
+	Flags() *pflag.FlagSet
+}
+
+// Viper is satisfied by *viper.Viper
+type Viper interface {
+	IsSet(key string) bool
+	GetString(key string) string
+}
+
+var (
+	mu     sync.Mutex
+	viper  Viper
+	prefix string
+)
+
+// AddFlags registers klog flags into the persistent flags of cmd
+func AddFlags(cmd Command) {
+	klog.InitFlags(cmd.PersistentFlags())
+}
+
+// BindViper makes klog flags read from v under prefix, e.g. "log." for
+// "log.v", when they are not set on the command line
+func BindViper(v Viper, keyPrefix string) {
+	mu.Lock()
+	defer mu.Unlock()
+	viper, prefix = v, keyPrefix
+}
+
+// SetupFromCommand applies viper values and inits the singleton
+// Call it in PersistentPreRunE, which runs after flags are parsed
+func SetupFromCommand(cmd Command) error {
+	mu.Lock()
+	v, p := viper, prefix
+	mu.Unlock()
+
+	if v != nil {
+		var err error
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			key := p + f.Name
+			if err != nil || f.Changed || !isKlogFlag(f.Name) || !v.IsSet(key) {
+				return
+			}
+			if e := f.Value.Set(v.GetString(key)); e != nil {
+				err = fmt.Errorf("invalid %s from config: %v", key, e)
+			}
+		})
+		if err != nil {
+			return err
+		}
+	}
+	klog.Singleton()
+	return nil
+}
+
+// isKlogFlag reports whether name is registered by klog.InitFlags
+func isKlogFlag(name string) bool {
+	fs := pflag.NewFlagSet("klog", pflag.ContinueOnError)
+	klog.InitFlags(fs)
+	return fs.Lookup(name) != nil
+}
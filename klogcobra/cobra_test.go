@@ -0,0 +1,82 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klogcobra
+
+import (
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/xial-thu/klog"
+)
+
+// command mimics how cobra merges persistent flags into Flags()
+type command struct {
+	persistent *pflag.FlagSet
+	flags      *pflag.FlagSet
+	preRun     func(cmd Command) error
+}
+
+// newPreparedCommand is how a root command is wired with klog
+func newPreparedCommand() *command {
+	cmd := &command{
+		persistent: pflag.NewFlagSet("persistent", pflag.ContinueOnError),
+		flags:      pflag.NewFlagSet("flags", pflag.ContinueOnError),
+		preRun:     SetupFromCommand,
+	}
+	AddFlags(cmd)
+	return cmd
+}
+
+func (c *command) PersistentFlags() *pflag.FlagSet { return c.persistent }
+func (c *command) Flags() *pflag.FlagSet           { return c.flags }
+
+func (c *command) Execute(args []string) error {
+	c.flags.AddFlagSet(c.persistent)
+	if err := c.flags.Parse(args); err != nil {
+		return err
+	}
+	return c.preRun(c)
+}
+
+// fakeViper is a config file in memory
+type fakeViper map[string]string
+
+func (v fakeViper) IsSet(key string) bool       { _, ok := v[key]; return ok }
+func (v fakeViper) GetString(key string) string { return v[key] }
+
+func TestSetupFromCommand(t *testing.T) {
+	cmd := newPreparedCommand()
+	BindViper(fakeViper{
+		"log.v":                 "3",
+		"log.max_message_bytes": "128",
+		"log.unknown":           "ignored",
+	}, "log.")
+
+	// command line wins over config
+	if err := cmd.Execute([]string{"--max_message_bytes=64"}); err != nil {
+		t.Fatal(err)
+	}
+	if klog.GetLevel() != 3 {
+		t.Errorf("v should come from config, get %d", klog.GetLevel())
+	}
+	if f := cmd.Flags().Lookup("max_message_bytes"); f.Value.String() != "64" {
+		t.Errorf("command line should win, get %s", f.Value.String())
+	}
+
+	BindViper(fakeViper{"log.v": "invalid"}, "log.")
+	if err := newPreparedCommand().Execute(nil); err == nil {
+		t.Errorf("invalid config value should fail")
+	}
+}
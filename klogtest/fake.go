@@ -0,0 +1,82 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klogtest
+
+import (
+	"fmt"
+	"sync"
+)
+
+// FakeEntry is a call recorded by Fake
+type FakeEntry struct {
+	// Level is one of info, warning and error
+	Level string
+	Msg   string
+	Err   error
+	KV    []interface{}
+}
+
+// Fake is a klog.Logger recording the calls, e.g. for asserting what a unit
+// under test logs. It's safe for concurrent use
+type Fake struct {
+	mu      sync.Mutex
+	entries []FakeEntry
+}
+
+// record appends an entry
+func (f *Fake) record(e FakeEntry) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = append(f.entries, e)
+}
+
+// Entries returns the calls recorded so far
+func (f *Fake) Entries() []FakeEntry {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]FakeEntry(nil), f.entries...)
+}
+
+// Reset drops the calls recorded
+func (f *Fake) Reset() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.entries = nil
+}
+
+// Infof implements klog.Logger
+func (f *Fake) Infof(format string, args ...interface{}) {
+	f.record(FakeEntry{Level: "info", Msg: fmt.Sprintf(format, args...)})
+}
+
+// Warningf implements klog.Logger
+func (f *Fake) Warningf(format string, args ...interface{}) {
+	f.record(FakeEntry{Level: "warning", Msg: fmt.Sprintf(format, args...)})
+}
+
+// Errorf implements klog.Logger
+func (f *Fake) Errorf(format string, args ...interface{}) {
+	f.record(FakeEntry{Level: "error", Msg: fmt.Sprintf(format, args...)})
+}
+
+// InfoS implements klog.Logger
+func (f *Fake) InfoS(msg string, kv ...interface{}) {
+	f.record(FakeEntry{Level: "info", Msg: msg, KV: append([]interface{}(nil), kv...)})
+}
+
+// ErrorS implements klog.Logger
+func (f *Fake) ErrorS(err error, msg string, kv ...interface{}) {
+	f.record(FakeEntry{Level: "error", Msg: msg, Err: err, KV: append([]interface{}(nil), kv...)})
+}
@@ -0,0 +1,63 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klogtest
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/xial-thu/klog"
+)
+
+var _ klog.Logger = (*Fake)(nil)
+
+// syncJob is a unit depending on klog.Logger
+func syncJob(log klog.Logger, items int, err error) {
+	log.InfoS("syncing", "items", items)
+	if err != nil {
+		log.ErrorS(err, "sync failed", "items", items)
+		return
+	}
+	log.Infof("synced %d items", items)
+}
+
+func TestFake(t *testing.T) {
+	fake := &Fake{}
+	failed := errors.New("timeout")
+	syncJob(fake, 3, nil)
+	syncJob(fake, 1, failed)
+	fake.Warningf("retry in %ds", 5)
+	fake.Errorf("giving up")
+
+	expect := []FakeEntry{
+		{Level: "info", Msg: "syncing", KV: []interface{}{"items", 3}},
+		{Level: "info", Msg: "synced 3 items"},
+		{Level: "info", Msg: "syncing", KV: []interface{}{"items", 1}},
+		{Level: "error", Msg: "sync failed", Err: failed, KV: []interface{}{"items", 1}},
+		{Level: "warning", Msg: "retry in 5s"},
+		{Level: "error", Msg: "giving up"},
+	}
+	if got := fake.Entries(); !reflect.DeepEqual(got, expect) {
+		t.Errorf("expect %+v, get %+v", expect, got)
+	}
+	fake.Reset()
+	if len(fake.Entries()) != 0 {
+		t.Errorf("expect no entries after Reset")
+	}
+
+	// *klog.Klogger is accepted as well
+	syncJob(klog.NewNop(), 1, failed)
+}
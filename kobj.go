@@ -0,0 +1,74 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"reflect"
+)
+
+// KMetadata is implemented by Kubernetes objects, so that klog does not
+// depend on Kubernetes
+type KMetadata interface {
+	GetName() string
+	GetNamespace() string
+}
+
+// ObjectRef references a Kubernetes object
+type ObjectRef struct {
+	Name      string `json:"name"`
+	Namespace string `json:"namespace,omitempty"`
+}
+
+// String returns "namespace/name", or "name" if it's cluster scoped
+func (ref ObjectRef) String() string {
+	if ref.Namespace != "" {
+		return ref.Namespace + "/" + ref.Name
+	}
+	return ref.Name
+}
+
+// MarshalText implements encoding.TextMarshaler, so that it's encoded as a
+// single string in JSON
+func (ref ObjectRef) MarshalText() ([]byte, error) {
+	return []byte(ref.String()), nil
+}
+
+// MarshalLog returns the structured form for logr
+func (ref ObjectRef) MarshalLog() interface{} {
+	type plain ObjectRef
+	return plain(ref)
+}
+
+// KObj returns the reference of obj, which is empty for nil
+func KObj(obj KMetadata) ObjectRef {
+	if obj == nil {
+		return ObjectRef{}
+	}
+	if v := reflect.ValueOf(obj); v.Kind() == reflect.Ptr && v.IsNil() {
+		return ObjectRef{}
+	}
+	return ObjectRef{
+		Name:      obj.GetName(),
+		Namespace: obj.GetNamespace(),
+	}
+}
+
+// KRef returns the reference of an object by its namespace and name
+func KRef(namespace, name string) ObjectRef {
+	return ObjectRef{
+		Name:      name,
+		Namespace: namespace,
+	}
+}
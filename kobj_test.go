@@ -0,0 +1,57 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"testing"
+)
+
+type fakeObject struct {
+	name, namespace string
+}
+
+func (o *fakeObject) GetName() string      { return o.name }
+func (o *fakeObject) GetNamespace() string { return o.namespace }
+
+func TestKObj(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	pod := &fakeObject{name: "web-0", namespace: "default"}
+	node := &fakeObject{name: "node-1"}
+	var missing *fakeObject
+	InfoS("pod", "pod", KObj(pod), "node", KObj(node))
+	WithFields("ref", KRef("kube-system", "dns")).Info("fields")
+	With(struct{ Pod ObjectRef }{KObj(pod)}).Info("with")
+	InfoS("nil", "pod", KObj(missing))
+
+	entries := decodeLines(t, buf)
+	expects := []map[string]string{
+		{"pod": "default/web-0", "node": "node-1"},
+		{"ref": "kube-system/dns"},
+		{"Pod": "default/web-0"},
+		{"pod": ""},
+	}
+	for i, expect := range expects {
+		for key, val := range expect {
+			if entries[i][key] != val {
+				t.Errorf("expect %s %q, get %v", key, val, entries[i][key])
+			}
+		}
+	}
+	if s := KObj(pod).String(); s != "default/web-0" {
+		t.Errorf("unexpected string %s", s)
+	}
+}
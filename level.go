@@ -0,0 +1,139 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+)
+
+// levelNames maps readable names to levels. Severities above info disable
+// V() entries, log_level suppresses INFO and WARNING entries instead
+var levelNames = map[string]Level{
+	"info":    MinLevel,
+	"warn":    MinLevel,
+	"warning": MinLevel,
+	"error":   MinLevel,
+	"debug":   2,
+	"trace":   4,
+}
+
+// validLevels lists the names of levelNames for errors
+var validLevels = func() string {
+	names := make([]string, 0, len(levelNames))
+	for name := range levelNames {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}()
+
+// verboseFields are the precomputed "v" fields of V() entries
+var verboseFields = func() []zap.Field {
+	fields := make([]zap.Field, MaxLevel+1)
+	for i := range fields {
+		fields[i] = zap.Int32("v", int32(i))
+	}
+	return fields
+}()
+
+// verboseField returns the "v" field of level
+func verboseField(level Level) zap.Field {
+	if level >= 0 && int(level) < len(verboseFields) {
+		return verboseFields[level]
+	}
+	return zap.Int32("v", int32(level))
+}
+
+// GetLevel returns the global level
+func GetLevel() Level {
+	return klogger.config.level.get()
+}
+
+// GetLevel returns the level of k, which is the greater of the global level
+// and the verbosity of k
+func (k *Klogger) GetLevel() Level {
+	return k.level()
+}
+
+// ParseLevel accepts a number, or one of info, debug and trace in any case,
+// which are 0, 2 and 4. warn, warning and error are 0 as well
+func ParseLevel(s string) (Level, error) {
+	s = strings.TrimSpace(s)
+	if l, ok := levelNames[strings.ToLower(s)]; ok {
+		return l, nil
+	}
+	n, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid level %q: expect a number or one of %s", s, validLevels)
+	}
+	if l := Level(n); l < MinLevel {
+		return 0, fmt.Errorf("invalid level %q: expect no less than %d", s, MinLevel)
+	}
+	return Level(n), nil
+}
+
+// SetLevelFromString updates the global level from s, see ParseLevel
+func SetLevelFromString(s string) error {
+	return klogger.SetLevelFromString(s)
+}
+
+// SetLevelFromString updates level from s, see ParseLevel. Unlike SetLevel,
+// a level out of range is returned as an error
+func (k *Klogger) SetLevelFromString(s string) error {
+	v, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	if max := k.config.maxLevel.get(); v > max {
+		return fmt.Errorf("invalid level %q: expect no more than %d", s, max)
+	}
+	k.setLevel(v)
+	return nil
+}
+
+// String implements pflag.Value and fmt.Stringer
+func (l *Level) String() string {
+	return strconv.Itoa(int(l.get()))
+}
+
+// Set implements pflag.Value
+func (l *Level) Set(s string) error {
+	v, err := ParseLevel(s)
+	if err != nil {
+		return err
+	}
+	l.set(v)
+	return nil
+}
+
+// Type implements pflag.Value
+func (l *Level) Type() string {
+	return "Level"
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (l Level) MarshalText() ([]byte, error) {
+	return []byte(strconv.Itoa(int(l))), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+func (l *Level) UnmarshalText(text []byte) error {
+	return l.Set(string(text))
+}
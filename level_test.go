@@ -0,0 +1,223 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestLevelText(t *testing.T) {
+	cases := map[string]Level{
+		"0":       0,
+		"3":       3,
+		" 4 ":     4,
+		"info":    MinLevel,
+		"DEBUG":   2,
+		"Trace":   4,
+		"12":      12,
+		"invalid": -1,
+		"-1":      -1,
+	}
+	for s, expect := range cases {
+		var l Level
+		err := l.UnmarshalText([]byte(s))
+		if expect < 0 {
+			if err == nil {
+				t.Errorf("%q should be invalid", s)
+			}
+			continue
+		}
+		if err != nil || l != expect {
+			t.Errorf("parse %q: expect %d, get %d, %v", s, expect, l, err)
+		}
+	}
+
+	type config struct {
+		V Level `json:"v"`
+	}
+	data, err := json.Marshal(config{V: 3})
+	if err != nil || string(data) != `{"v":"3"}` {
+		t.Fatalf("marshal: %s, %v", data, err)
+	}
+	var c config
+	if err := json.Unmarshal([]byte(`{"v":"debug"}`), &c); err != nil || c.V != 2 {
+		t.Errorf("unmarshal: %d, %v", c.V, err)
+	}
+}
+
+func TestParseLevel(t *testing.T) {
+	cases := []struct {
+		in     string
+		expect Level
+		ok     bool
+	}{
+		{"0", 0, true},
+		{"3", 3, true},
+		{" 7\n", 7, true},
+		{"info", 0, true},
+		{"INFO", 0, true},
+		{"debug", 2, true},
+		{"Debug", 2, true},
+		{"trace", 4, true},
+		{"TRACE", 4, true},
+		{"warn", 0, true},
+		{"Warning", 0, true},
+		{"error", 0, true},
+		{"", 0, false},
+		{"verbose", 0, false},
+		{"-1", 0, false},
+		{"2.5", 0, false},
+	}
+	for _, c := range cases {
+		l, err := ParseLevel(c.in)
+		if (err == nil) != c.ok || l != c.expect {
+			t.Errorf("parse %q: expect %d, %v, get %d, %v", c.in, c.expect, c.ok, l, err)
+		}
+	}
+	_, err := ParseLevel("verbose")
+	if err == nil || !strings.Contains(err.Error(), "debug, error, info, trace, warn, warning") {
+		t.Errorf("expect the valid values in the error, get %v", err)
+	}
+}
+
+func TestSetLevelFromString(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+	k.config.maxLevel.set(5)
+
+	if err := SetLevelFromString("Trace"); err != nil || GetLevel() != 4 {
+		t.Errorf("expect level 4, get %d, %v", GetLevel(), err)
+	}
+	if err := k.SetLevelFromString("3"); err != nil || GetLevel() != 3 {
+		t.Errorf("expect level 3, get %d, %v", GetLevel(), err)
+	}
+	for _, s := range []string{"6", "loud"} {
+		if err := SetLevelFromString(s); err == nil {
+			t.Errorf("%q should be invalid", s)
+		}
+	}
+	if GetLevel() != 3 {
+		t.Errorf("level should be kept on errors, get %d", GetLevel())
+	}
+}
+
+func TestLevelFlag(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	InitFlags(fs)
+	if f := fs.Lookup("v"); f == nil || f.DefValue != "0" || f.Value.Type() != "Level" {
+		t.Fatalf("unexpected flag: %+v", f)
+	}
+	if err := fs.Parse([]string{"--v=3"}); err != nil {
+		t.Fatal(err)
+	}
+	if GetLevel() != 3 || !V(3).Enabled() {
+		t.Errorf("expect level 3, get %d", GetLevel())
+	}
+	if err := fs.Parse([]string{"--v=trace"}); err != nil || GetLevel() != 4 {
+		t.Errorf("expect level 4, get %d, %v", GetLevel(), err)
+	}
+	if err := fs.Parse([]string{"--v=-1"}); err == nil {
+		t.Errorf("negative level should be rejected")
+	}
+	if k.WithVerbosity(MaxLevel).GetLevel() != MaxLevel {
+		t.Errorf("GetLevel should respect the verbosity of the logger")
+	}
+}
+
+func TestMaxLevel(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	SetLevel(6)
+	V(7).Info("v6")
+	SetLevel(8)
+	V(7).Info("v8")
+	V(11).Info("beyond-max")
+	entries := decodeLines(t, buf)
+	if len(entries) != 1 || entries[0]["msg"] != "v8" {
+		t.Fatalf("unexpected entries: %v", entries)
+	}
+
+	// a lower ceiling
+	k.config.maxLevel.set(6)
+	SetLevel(7)
+	if GetLevel() != 8 {
+		t.Errorf("level out of range should be rejected")
+	}
+	if k.WithVerbosity(9).GetLevel() != 8 {
+		t.Errorf("verbosity should be clamped")
+	}
+
+	// Singleton clamps instead of panicking
+	k.config.level.set(9)
+	if l, clamped := k.config.clampLevel(); !clamped || l != 6 || GetLevel() != 6 {
+		t.Errorf("expect clamped to 6, get %d", l)
+	}
+	if _, clamped := k.config.clampLevel(); clamped {
+		t.Errorf("level in range should not be clamped")
+	}
+}
+
+func TestVerboseEntry(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	SetLevel(10)
+	k.config.vField.set(true)
+	k.config.infoMaxV.set(1)
+
+	V(1).Info("v1")
+	V(2).Infof("v%d", 2)
+	V(3).InfoS("v3", "A", 1)
+	V(4).Infoln("v4")
+	V(10).InfoFn(func() (string, []interface{}) { return "v10", nil })
+
+	entries := decodeLines(t, buf)
+	expects := []struct {
+		level string
+		v     float64
+	}{
+		{"info", 1}, {"debug", 2}, {"debug", 3}, {"debug", 4}, {"debug", 10},
+	}
+	if len(entries) != len(expects) {
+		t.Fatalf("expect %d entries, get %d", len(expects), len(entries))
+	}
+	for i, e := range expects {
+		if entries[i]["level"] != e.level || entries[i]["v"] != e.v {
+			t.Errorf("entry %d: expect %v, get %v", i, e, entries[i])
+		}
+		if caller, _ := entries[i]["caller"].(string); !strings.Contains(caller, "level_test.go") {
+			t.Errorf("unexpected caller %s", caller)
+		}
+	}
+	if entries[2]["A"] != float64(1) {
+		t.Errorf("fields are lost: %v", entries[2])
+	}
+
+	// disabled by default
+	buf.Reset()
+	k.config.vField.set(false)
+	k.config.infoMaxV.set(-1)
+	V(1).Info("v1")
+	if e := decodeLines(t, buf)[0]; e["level"] != "debug" || e["v"] != nil {
+		t.Errorf("unexpected entry: %v", e)
+	}
+}
@@ -0,0 +1,122 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// DefaultLogNameTemplate names files in log_dir like klog does
+const DefaultLogNameTemplate = "{program}.{host}.{user}.log.{severity}.{date}.{pid}"
+
+// logDirSeverities are the files created in log_dir, each has the entries
+// at or above its level
+var logDirSeverities = []struct {
+	name  string
+	level zapcore.Level
+}{
+	{"INFO", zapcore.DebugLevel},
+	{"WARNING", zapcore.WarnLevel},
+	{"ERROR", zapcore.ErrorLevel},
+}
+
+// program, host and user fill the file names
+var (
+	program  = filepath.Base(os.Args[0])
+	host     = "unknownhost"
+	userName = "unknownuser"
+)
+
+func init() {
+	if h, err := os.Hostname(); err == nil {
+		// the short name, like klog
+		host = strings.SplitN(h, ".", 2)[0]
+	}
+	if u, err := user.Current(); err == nil {
+		// domain\user on windows
+		userName = strings.Replace(u.Username, `\`, "_", -1)
+	}
+}
+
+// logFileName fills the placeholders of template, which are {program},
+// {host}, {user}, {severity}, {date} and {pid}
+func logFileName(template, severity string, t time.Time) string {
+	return strings.NewReplacer(
+		"{program}", program,
+		"{host}", host,
+		"{user}", userName,
+		"{severity}", severity,
+		"{date}", t.Format("20060102-150405"),
+		"{pid}", strconv.Itoa(os.Getpid()),
+	).Replace(template)
+}
+
+// openLogDir opens a file for each of logDirSeverities in log_dir, named
+// by log_name_template. A new file is created on each rotation, and
+// {program}.{severity} links to the newest
+func (c *Config) openLogDir() ([]*rotatingFile, error) {
+	template := c.logNameTemplate.get()
+	if template == "" {
+		template = DefaultLogNameTemplate
+	}
+	var files []*rotatingFile
+	for _, s := range logDirSeverities {
+		severity := s.name
+		r := &rotatingFile{
+			path: filepath.Join(c.logDir.get(), severity),
+			opts: c.rotateOptions(),
+			now:  time.Now,
+			name: func(t time.Time) string {
+				return logFileName(template, severity, t)
+			},
+			link:    filepath.Join(c.logDir.get(), program+"."+severity),
+			rotated: make(chan struct{}, 1),
+			closed:  make(chan struct{}),
+		}
+		if err := r.open(r.now()); err != nil {
+			for _, f := range files {
+				f.Close()
+			}
+			return nil, err
+		}
+		files = append(files, r)
+	}
+	return files, nil
+}
+
+// logDirCore writes entries into the files of openLogDir by their levels
+func (c *Config) logDirCore(enc zapcore.Encoder) (zapcore.Core, error) {
+	files, err := c.openLogDir()
+	if err != nil {
+		return nil, err
+	}
+	cores := make([]zapcore.Core, len(files))
+	for i, f := range files {
+		min := logDirSeverities[i].level
+		enabled := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return l >= min && c.zapConfig.Level.Enabled(l)
+		})
+		cores[i] = newLevelCore(zapcore.NewCore(enc, c.batch.wrap(c.sinks.attachFile(f)), enabled))
+	}
+	return zapcore.NewTee(cores...), nil
+}
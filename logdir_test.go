@@ -0,0 +1,141 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestLogFileName(t *testing.T) {
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	name := logFileName(DefaultLogNameTemplate, "INFO", at)
+	expect := program + "." + host + "." + userName + ".log.INFO.20200102-030405." + strconv.Itoa(os.Getpid())
+	if name != expect {
+		t.Errorf("expect %s, get %s", expect, name)
+	}
+	if name := logFileName("{program}-{severity}.log", "ERROR", at); name != program+"-ERROR.log" {
+		t.Errorf("unexpected name %s", name)
+	}
+}
+
+func TestLogDir(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newConfig()
+	c.logDir.set(dir)
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = nil
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+	k.Infof("info")
+	k.Warningf("warning")
+	k.Errorf("error")
+	if err := k.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for severity, n := range map[string]int{"INFO": 3, "WARNING": 2, "ERROR": 1} {
+		link := filepath.Join(dir, program+"."+severity)
+		target, err := os.Readlink(link)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if filepath.Dir(target) != "." || filepath.Ext(target) != "."+strconv.Itoa(os.Getpid()) {
+			t.Errorf("unexpected target %s", target)
+		}
+		if entries := readLines(t, link); len(entries) != n {
+			t.Errorf("expect %d entries in %s, get %v", n, severity, entries)
+		}
+	}
+}
+
+// newNamedFile opens a file in log_dir whose clock ticks an hour on each call
+func newNamedFile(t *testing.T, opts rotateOptions) *rotatingFile {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 2, 21, 0, 0, 0, time.Local)
+	r := &rotatingFile{
+		path: filepath.Join(dir, "INFO"),
+		opts: opts,
+		now: func() time.Time {
+			now = now.Add(time.Hour)
+			return now
+		},
+		name: func(t time.Time) string {
+			return logFileName("app.log.{date}", "INFO", t)
+		},
+		link:    filepath.Join(dir, "app.INFO"),
+		rotated: make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+	if err := r.open(r.now()); err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestLogDirRotate(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks need privileges on windows")
+	}
+	for _, tc := range []struct {
+		opts  rotateOptions
+		files []string
+	}{
+		// 22:00, 23:00
+		{rotateOptions{maxSize: 1}, []string{"app.INFO", "app.log.20200102-220000", "app.log.20200102-230000"}},
+		// 22:00, rotates at 00:00 on the second write
+		{rotateOptions{daily: true}, []string{"app.INFO", "app.log.20200102-220000", "app.log.20200103-000000"}},
+	} {
+		r := newNamedFile(t, tc.opts)
+		r.Write([]byte("a\n"))
+		r.Write([]byte("b\n"))
+		r.Close()
+
+		dir := filepath.Dir(r.path)
+		names := listDir(t, dir)
+		if len(names) != len(tc.files) {
+			t.Fatalf("expect %v, get %v", tc.files, names)
+		}
+		for i := range names {
+			if names[i] != tc.files[i] {
+				t.Errorf("expect %v, get %v", tc.files, names)
+			}
+		}
+		if target, _ := os.Readlink(filepath.Join(dir, "app.INFO")); target != tc.files[2] {
+			t.Errorf("expect the link to %s, get %s", tc.files[2], target)
+		}
+		os.RemoveAll(dir)
+	}
+}
@@ -0,0 +1,33 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+// Logger is the part of *Klogger that code can depend on instead, so that
+// tests can pass a fake, e.g. klogtest.Fake. It's kept small enough to be
+// implemented by hand, so it leaves out:
+//   - V, WithFields, WithVerbosity and the like, which return Verbose or
+//     *Klogger, and a fake can't return those. Pass k-v pairs to InfoS
+//     instead, or depend on *Klogger
+//   - Fatal and Exit, which don't return
+//   - the variants of the same levels, e.g. Info, Infoln and Infow
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+	InfoS(msg string, kv ...interface{})
+	ErrorS(err error, msg string, kv ...interface{})
+}
+
+var _ Logger = (*Klogger)(nil)
@@ -0,0 +1,92 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"reflect"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// MarshalerFunc encodes v, whose type is the registered one, like
+// zapcore.ObjectMarshaler
+type MarshalerFunc func(v interface{}, enc zapcore.ObjectEncoder) error
+
+var (
+	// marshalers maps reflect.Type to MarshalerFunc
+	marshalers sync.Map
+	// the number of registered types, which skips the lookup if zero
+	marshalerCount int32
+	// guards registering
+	marshalerMu sync.Mutex
+)
+
+// RegisterMarshalerFor encodes values of type t by fn instead of reflection,
+// e.g. for hot types whose fields are partly unwanted. It's consulted by With,
+// WithAll and WithFields, and by the k-v pairs of InfoS and so on
+// t is matched exactly, register T and *T both if both are logged. A nil fn
+// unregisters t. It's safe to call concurrently with logging
+func RegisterMarshalerFor(t reflect.Type, fn MarshalerFunc) {
+	marshalerMu.Lock()
+	defer marshalerMu.Unlock()
+	if fn == nil {
+		if _, ok := marshalers.Load(t); ok {
+			marshalers.Delete(t)
+			atomic.AddInt32(&marshalerCount, -1)
+		}
+		return
+	}
+	if _, loaded := marshalers.LoadOrStore(t, fn); loaded {
+		marshalers.Store(t, fn)
+		return
+	}
+	atomic.AddInt32(&marshalerCount, 1)
+}
+
+// registeredObject encodes v by a registered MarshalerFunc
+type registeredObject struct {
+	v  interface{}
+	fn MarshalerFunc
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (r registeredObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	return r.fn(r.v, enc)
+}
+
+// marshalerOf returns the MarshalerFunc registered for t
+func marshalerOf(t reflect.Type) (MarshalerFunc, bool) {
+	if atomic.LoadInt32(&marshalerCount) == 0 {
+		return nil, false
+	}
+	fn, ok := marshalers.Load(t)
+	if !ok {
+		return nil, false
+	}
+	return fn.(MarshalerFunc), true
+}
+
+// registeredField returns the field of val if its type is registered
+// nil pointers are left to the caller
+func registeredField(key string, val interface{}) (zap.Field, bool) {
+	fn, ok := marshalerOf(reflect.TypeOf(val))
+	if !ok || isNil(reflect.ValueOf(val)) {
+		return zap.Field{}, false
+	}
+	return zap.Object(key, registeredObject{v: val, fn: fn}), true
+}
@@ -0,0 +1,147 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"io/ioutil"
+	"reflect"
+	"sync"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// order is encoded by a registered marshaler in tests
+type order struct {
+	ID     string
+	Amount int
+	Note   string
+	Items  []string
+}
+
+// marshalOrder skips the note and the items
+func marshalOrder(v interface{}, enc zapcore.ObjectEncoder) error {
+	o := v.(order)
+	enc.AddString("id", o.ID)
+	enc.AddInt("amount", o.Amount)
+	return nil
+}
+
+// registerOrder registers marshalOrder and returns the unregister func
+func registerOrder() func() {
+	t := reflect.TypeOf(order{})
+	RegisterMarshalerFor(t, marshalOrder)
+	return func() { RegisterMarshalerFor(t, nil) }
+}
+
+func TestRegisterMarshaler(t *testing.T) {
+	k, buf := newTestLogger()
+	o := order{ID: "o-1", Amount: 3, Note: "secret", Items: []string{"a"}}
+
+	unregister := registerOrder()
+	k.WithAll(o).Infof("with all")
+	k.With(struct{ Order order }{o}).Infof("with")
+	k.With(map[string]interface{}{"Order": o}).Infof("with map")
+	k.WithFields("Order", o).Infof("with fields")
+	k.InfoS("kv", "Order", o)
+	k.InfoS("pointer", "Order", &o)
+	unregister()
+	k.WithFields("Order", o).Infof("unregistered")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 7 {
+		t.Fatalf("expect 7 entries, get %d", len(entries))
+	}
+	expect := map[string]interface{}{"id": "o-1", "amount": float64(3)}
+	for _, e := range entries[:5] {
+		key := "Order"
+		if e["msg"] == "with all" {
+			key = "order"
+		}
+		if !reflect.DeepEqual(e[key], expect) {
+			t.Errorf("expect %v by the registered marshaler for %q, get %v", expect, e["msg"], e[key])
+		}
+	}
+	for _, e := range entries[5:] {
+		if obj, _ := e["Order"].(map[string]interface{}); obj["Note"] != "secret" {
+			t.Errorf("expect reflection for %q, get %v", e["msg"], e["Order"])
+		}
+	}
+}
+
+func TestRegisterMarshalerFailure(t *testing.T) {
+	k, buf := newTestLogger()
+	type broken struct{}
+	typ := reflect.TypeOf(broken{})
+	RegisterMarshalerFor(typ, func(interface{}, zapcore.ObjectEncoder) error {
+		panic("boom")
+	})
+	defer RegisterMarshalerFor(typ, nil)
+	k.InfoS("broken", "b", broken{}, "next", 1)
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 1 || entries[0]["next"] != float64(1) {
+		t.Errorf("expect the entry to be written, get %v", entries)
+	}
+	if _, ok := entries[0]["bError"]; !ok {
+		t.Errorf("expect the failure to be reported, get %v", entries[0])
+	}
+}
+
+func TestRegisterMarshalerConcurrently(t *testing.T) {
+	k := NewNop()
+	o := order{ID: "o-1"}
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				registerOrder()()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				k.WithFields("order", o).Infof("concurrent")
+			}
+		}()
+	}
+	wg.Wait()
+	if _, ok := marshalerOf(reflect.TypeOf(o)); ok {
+		t.Errorf("expect order to be unregistered")
+	}
+}
+
+func BenchmarkRegisterMarshaler(b *testing.B) {
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(ioutil.Discard), zapcore.DebugLevel)
+	k := &Klogger{sugar: zap.New(core).Sugar(), config: newConfig()}
+	o := order{ID: "o-1", Amount: 3, Note: "note", Items: []string{"a", "b"}}
+
+	b.Run("reflect", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			k.InfoS("order", "order", o)
+		}
+	})
+	b.Run("registered", func(b *testing.B) {
+		defer registerOrder()()
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			k.InfoS("order", "order", o)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// inDevelopment reports whether misuses are reported as DPanic, which panics,
+// see log_development and log_format=dev
+func (c *Config) inDevelopment() bool {
+	return c.development.get() || c.format.get() == "dev"
+}
+
+// misuse reports a misuse of the API as DPanic in development, and returns
+// false otherwise, so that the caller tolerates it as usual
+func (k *Klogger) misuse(msg string, fields ...zap.Field) bool {
+	if !k.config.inDevelopment() {
+		return false
+	}
+	k.internal().sugar.Desugar().DPanic(msg, fields...)
+	return true
+}
+
+// internal returns a logger for the entries of klog itself, e.g. misuses and
+// "shutting down", which have no caller since they aren't logged where the
+// user calls klog
+func (k *Klogger) internal() *Klogger {
+	return k.derive(k.sugar.Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &noCallerCore{Core: core}
+	})).Sugar())
+}
+
+// noCallerCore drops the caller of the entries. It checks the wrapped core
+// like deferredCore, before zap fills in the caller
+type noCallerCore struct {
+	zapcore.Core
+}
+
+// noCallerEntry is the entry checked by the wrapped core
+type noCallerEntry struct {
+	*noCallerCore
+	ce *zapcore.CheckedEntry
+}
+
+// With implements zapcore.Core
+func (c *noCallerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &noCallerCore{Core: c.Core.With(fields)}
+}
+
+// Check implements zapcore.Core
+func (c *noCallerCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	inner := c.Core.Check(ent, nil)
+	if inner == nil {
+		return ce
+	}
+	return ce.AddCore(ent, noCallerEntry{noCallerCore: c, ce: inner})
+}
+
+// Write implements zapcore.Core
+// Only the stack is taken from ent
+func (e noCallerEntry) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	e.ce.Entry.Stack = ent.Stack
+	e.ce.Write(fields...)
+	return nil
+}
+
+// developmentCore makes DPanic panic as zap.Development does
+type developmentCore struct {
+	zapcore.Core
+}
+
+// newDevelopmentCore wraps core in a developmentCore
+func newDevelopmentCore(core zapcore.Core) zapcore.Core {
+	return &developmentCore{Core: core}
+}
+
+// With implements zapcore.Core
+func (c *developmentCore) With(fields []zapcore.Field) zapcore.Core {
+	return &developmentCore{Core: c.Core.With(fields)}
+}
+
+// Check implements zapcore.Core
+func (c *developmentCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	ce = c.Core.Check(ent, ce)
+	if ent.Level == zapcore.DPanicLevel {
+		ce = ce.Should(ent, zapcore.WriteThenPanic)
+	}
+	return ce
+}
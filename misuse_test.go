@@ -0,0 +1,88 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newModeLogger returns a test logger in development or production
+func newModeLogger(development bool) (*Klogger, *bytes.Buffer) {
+	buf := &bytes.Buffer{}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.AddSync(buf), zapcore.DebugLevel)
+	opts := []zap.Option{zap.AddCaller(), zap.AddCallerSkip(1)}
+	if development {
+		opts = append(opts, zap.Development())
+	}
+	c := newConfig()
+	c.development.set(development)
+	return &Klogger{sugar: zap.New(core, opts...).Sugar(), config: c}, buf
+}
+
+func TestMisuse(t *testing.T) {
+	misuses := map[string]func(k *Klogger){
+		"odd args":             func(k *Klogger) { k.WithFields("a", 1, "b") },
+		"non-string key":       func(k *Klogger) { k.InfoS("m", 1, "a") },
+		"duplicate key":        func(k *Klogger) { k.InfoS("m", "a", 1, "a", 2) },
+		"reserved key":         func(k *Klogger) { k.InfoS("m", "msg", "x") },
+		"reserved map key":     func(k *Klogger) { k.With(map[string]int{"level": 1}) },
+		"non-string map key":   func(k *Klogger) { k.With(map[int]int{1: 1}) },
+		"level out of range":   func(k *Klogger) { k.SetLevel(MaxLevel + 1) },
+		"level below the min":  func(k *Klogger) { k.SetLevel(-1) },
+		"reserved caller key":  func(k *Klogger) { k.WithFields("caller", "x") },
+		"reserved message key": func(k *Klogger) { k.Infow("m", "msg", "x") },
+	}
+	for name, misuse := range misuses {
+		k, _ := newModeLogger(false)
+		if r := catchPanic(func() { misuse(k) }); r != nil {
+			t.Errorf("expect %s to be tolerated in production, get %v", name, r)
+		}
+		k, buf := newModeLogger(true)
+		if r := catchPanic(func() { misuse(k) }); r == nil {
+			t.Errorf("expect %s to panic in development", name)
+		}
+		if entries := decodeLines(t, buf); len(entries) == 0 || entries[0]["level"] != "dpanic" {
+			t.Errorf("expect %s to be logged as dpanic, get %v", name, entries)
+		}
+	}
+}
+
+func TestMisuseDevFormat(t *testing.T) {
+	c := newConfig()
+	c.format.set("dev")
+	if !c.inDevelopment() || !c.newZapConfig().Development {
+		t.Errorf("expect log_format=dev to imply development")
+	}
+	c = newConfig()
+	c.development.set(true)
+	if !c.newZapConfig().Development {
+		t.Errorf("expect log_development to build a development logger")
+	}
+}
+
+func TestNoMisuse(t *testing.T) {
+	k, buf := newModeLogger(true)
+	k.With(map[string]int{"a": 1}).WithFields("b", 2).InfoS("fine", "c", 3)
+	k.SetLevel(MaxLevel)
+	if entries := decodeLines(t, buf); len(entries) != 1 || entries[0]["level"] != "info" {
+		t.Errorf("expect only the info entry, get %v", entries)
+	}
+}
@@ -0,0 +1,163 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/buffer"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// multilineKeyIndent indents the keys printed after the line of an entry
+	multilineKeyIndent = "  "
+	// multilineIndent indents the values printed after the line of an entry
+	multilineIndent = "    "
+	// multilineSeparator ends the values printed after the line of an entry
+	multilineSeparator = "  ---"
+)
+
+// multiline is a value printed on lines of its own by log_format=dev
+type multiline string
+
+// MarshalText keeps it a string in JSON
+func (m multiline) MarshalText() ([]byte, error) {
+	return []byte(m), nil
+}
+
+// Multiline returns a field which log_format=dev prints after the line of
+// the entry, indented, e.g. a pretty-printed config. Other formats log it as
+// a string. Fields named stacktrace or stack, or ending in _yaml or _dump,
+// are printed so as well
+func Multiline(key, val string) Field {
+	return zap.Reflect(key, multiline(val))
+}
+
+// multilineKey reports whether the field of key is printed on its own lines
+// A prefix like "fields." of reserved keys is ignored
+func multilineKey(key string) bool {
+	if i := strings.LastIndexByte(key, '.'); i >= 0 {
+		key = key[i+1:]
+	}
+	return key == "stacktrace" || key == "stack" || strings.HasSuffix(key, "_yaml") || strings.HasSuffix(key, "_dump")
+}
+
+// multilineField is a field printed after the line of an entry
+type multilineField struct {
+	key string
+	val string
+}
+
+// multilineEncoder prints the multiline fields after the line encoded by
+// the console encoder, like zap prints the stack of an entry
+type multilineEncoder struct {
+	zapcore.Encoder
+	// multiline fields added by With
+	context []multilineField
+}
+
+// newMultilineEncoder wraps a console encoder
+func newMultilineEncoder(enc zapcore.Encoder) zapcore.Encoder {
+	return &multilineEncoder{Encoder: enc}
+}
+
+// Clone implements zapcore.Encoder
+func (e *multilineEncoder) Clone() zapcore.Encoder {
+	return &multilineEncoder{
+		Encoder: e.Encoder.Clone(),
+		context: e.context[:len(e.context):len(e.context)],
+	}
+}
+
+// AddString implements zapcore.ObjectEncoder, for the fields of With
+func (e *multilineEncoder) AddString(key, val string) {
+	if multilineKey(key) {
+		e.context = append(e.context, multilineField{key: key, val: val})
+		return
+	}
+	e.Encoder.AddString(key, val)
+}
+
+// AddReflected implements zapcore.ObjectEncoder, for the fields of With
+func (e *multilineEncoder) AddReflected(key string, val interface{}) error {
+	if m, ok := asMultiline(val); ok {
+		e.context = append(e.context, multilineField{key: key, val: string(m)})
+		return nil
+	}
+	return e.Encoder.AddReflected(key, val)
+}
+
+// EncodeEntry implements zapcore.Encoder
+func (e *multilineEncoder) EncodeEntry(ent zapcore.Entry, fields []zapcore.Field) (*buffer.Buffer, error) {
+	groups := e.context
+	var rest []zapcore.Field
+	for i, f := range fields {
+		val, ok := multilineValue(f)
+		if !ok {
+			if rest != nil {
+				rest = append(rest, f)
+			}
+			continue
+		}
+		if rest == nil {
+			rest = append(make([]zapcore.Field, 0, len(fields)), fields[:i]...)
+			groups = groups[:len(groups):len(groups)]
+		}
+		groups = append(groups, multilineField{key: f.Key, val: val})
+	}
+	if rest == nil {
+		rest = fields
+	}
+	buf, err := e.Encoder.EncodeEntry(ent, rest)
+	if err != nil || len(groups) == 0 {
+		return buf, err
+	}
+	for _, g := range groups {
+		buf.AppendString(multilineKeyIndent)
+		buf.AppendString(g.key)
+		buf.AppendString(":\n")
+		for _, line := range strings.Split(strings.TrimRight(g.val, "\n"), "\n") {
+			buf.AppendString(multilineIndent)
+			buf.AppendString(line)
+			buf.AppendByte('\n')
+		}
+	}
+	buf.AppendString(multilineSeparator)
+	buf.AppendByte('\n')
+	return buf, nil
+}
+
+// multilineValue returns the value of f if it's printed on its own lines
+func multilineValue(f zapcore.Field) (string, bool) {
+	switch f.Type {
+	case zapcore.ReflectType:
+		m, ok := asMultiline(f.Interface)
+		return string(m), ok
+	case zapcore.StringType:
+		return f.String, multilineKey(f.Key)
+	}
+	return "", false
+}
+
+// asMultiline returns v as a multiline, which may be wrapped by safeField
+func asMultiline(v interface{}) (multiline, bool) {
+	if safe, ok := v.(safeJSON); ok {
+		v = safe.v
+	}
+	m, ok := v.(multiline)
+	return m, ok
+}
@@ -0,0 +1,89 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/xial-thu/klog/klogtest"
+)
+
+// newFormatLogger returns a file logger of format without the caller
+func newFormatLogger(t *testing.T, format string) (*Klogger, string) {
+	k, path := newFileLogger(t)
+	k.config.format.set(format)
+	k.config.sampling.set(samplingRules{})
+	k.config.zapConfig = k.config.newZapConfig()
+	k.config.zapConfig.OutputPaths = []string{path}
+	k.config.zapConfig.DisableCaller = true
+	rebuild(t, k)
+	return k, path
+}
+
+func TestMultilineGolden(t *testing.T) {
+	k, path := newFormatLogger(t, "dev")
+	defer removeDir(path)
+	clock := klogtest.NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	k.config.clock.Store(clockHolder{clock})
+
+	stack := "main.handle\n\t/app/main.go:42\nmain.main\n\t/app/main.go:10\n"
+	k.Warningw("recovered", "stack", stack, "id", 7)
+	k.WithFields("config_yaml", "a: 1\nb:\n  - c\n").Infos("loaded", Multiline("notes", "one\ntwo"), Int("n", 2))
+	k.Infow("plain", "id", 8)
+	k.sugar.Sync()
+
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	golden, err := ioutil.ReadFile("testdata/multiline.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(golden) {
+		t.Errorf("expect\n%s\nget\n%s", golden, got)
+	}
+}
+
+func TestMultilineJSON(t *testing.T) {
+	k, path := newFormatLogger(t, "json")
+	defer removeDir(path)
+	k.Infos("loaded", Multiline("notes", "one\ntwo"))
+	k.Infow("recovered", "stack", "a\nb")
+	k.sugar.Sync()
+
+	entries := readLines(t, path)
+	if len(entries) != 2 || entries[0]["notes"] != "one\ntwo" || entries[1]["stack"] != "a\nb" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
+
+func TestMultilineKey(t *testing.T) {
+	for key, expect := range map[string]bool{
+		"stacktrace":        true,
+		"fields.stacktrace": true,
+		"stack":             true,
+		"config_yaml":       true,
+		"heap_dump":         true,
+		"stacks":            false,
+		"yaml":              false,
+	} {
+		if multilineKey(key) != expect {
+			t.Errorf("expect %v for %s", expect, key)
+		}
+	}
+}
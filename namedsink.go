@@ -0,0 +1,276 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// SinkKey is the field naming the sink an entry goes to, see ToSink
+	SinkKey = "_sink"
+	// ExclusiveSinkKey is the bool field keeping the entry of SinkKey out of
+	// the other outputs
+	ExclusiveSinkKey = "_sink_exclusive"
+)
+
+// SinkOption sets how ToSink routes entries
+type SinkOption func(*sinkTarget)
+
+// ExclusiveSink writes the entries to the named sink only, rather than to
+// the outputs as well
+func ExclusiveSink() SinkOption {
+	return func(t *sinkTarget) {
+		t.exclusive = true
+	}
+}
+
+// sinkTarget is the named sink of an entry
+type sinkTarget struct {
+	name      string
+	exclusive bool
+}
+
+// RegisterNamedSink registers a sink of the global logger, see
+// Klogger.RegisterNamedSink
+func RegisterNamedSink(name string, ws zapcore.WriteSyncer, enc zapcore.Encoder) error {
+	return klogger.RegisterNamedSink(name, ws, enc)
+}
+
+// RegisterNamedSink registers ws encoded by enc as name, which entries of
+// ToSink or with field SinkKey go to, besides the outputs. It takes effect
+// at once for the loggers sharing the config of k, and the entries follow
+// log_level but are never sampled nor suppressed. Registering a name twice
+// is an error
+func (k *Klogger) RegisterNamedSink(name string, ws zapcore.WriteSyncer, enc zapcore.Encoder) error {
+	if name == "" {
+		return errors.New("klog: empty sink name")
+	}
+	if ws == nil || enc == nil {
+		return fmt.Errorf("klog: nil writer or encoder of sink %q", name)
+	}
+	c := k.config
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	old := c.namedSinkCores()
+	if _, ok := old[name]; ok {
+		return fmt.Errorf("klog: sink %q already registered", name)
+	}
+	sinks := make(map[string]zapcore.Core, len(old)+1)
+	for n, core := range old {
+		sinks[n] = core
+	}
+	sinks[name] = zapcore.NewCore(enc, ws, c.severity.level)
+	c.namedSinks.Store(sinks)
+	return nil
+}
+
+// namedSinkCores returns the cores of RegisterNamedSink
+func (c *Config) namedSinkCores() map[string]zapcore.Core {
+	sinks, _ := c.namedSinks.Load().(map[string]zapcore.Core)
+	return sinks
+}
+
+// syncNamedSinks syncs the sinks of RegisterNamedSink
+func (c *Config) syncNamedSinks() error {
+	var err error
+	for _, core := range c.namedSinkCores() {
+		err = multierr.Append(err, core.Sync())
+	}
+	return err
+}
+
+// namedSink returns the core of the sink name
+func (c *Config) namedSink(name string) (zapcore.Core, bool) {
+	core, ok := c.namedSinkCores()[name]
+	return core, ok
+}
+
+// ToSink returns a child of the global logger, see Klogger.ToSink
+func ToSink(name string, opts ...SinkOption) *Klogger {
+	return klogger.ToSink(name, opts...)
+}
+
+// ToSink returns a child logger whose entries go to the sink registered as
+// name as well, or only with ExclusiveSink. The same goes for the entries
+// with field SinkKey, e.g. Infow("charged", klog.SinkKey, "billing"). An
+// unknown name is a misuse, which panics in development, and otherwise
+// the entries follow the usual outputs
+func (k *Klogger) ToSink(name string, opts ...SinkOption) *Klogger {
+	t := sinkTarget{name: name}
+	for _, opt := range opts {
+		opt(&t)
+	}
+	if _, ok := k.config.namedSink(name); !ok {
+		k.misuse("unknown sink", zap.String("sink", name))
+	}
+	fields := []zap.Field{zap.String(SinkKey, t.name)}
+	if t.exclusive {
+		fields = append(fields, zap.Bool(ExclusiveSinkKey, true))
+	}
+	return k.derive(k.sugar.Desugar().With(fields...).Sugar())
+}
+
+// sinkFields removes SinkKey and ExclusiveSinkKey from fields, and returns
+// the target they set, if any. fields is copied only if they're found
+func sinkFields(fields []zapcore.Field) ([]zapcore.Field, sinkTarget, bool) {
+	var t sinkTarget
+	found := false
+	rest := fields
+	for i, f := range fields {
+		switch {
+		case f.Key == SinkKey && f.Type == zapcore.StringType:
+			t.name = f.String
+		case f.Key == ExclusiveSinkKey && f.Type == zapcore.BoolType:
+			t.exclusive = f.Integer == 1
+		default:
+			if found {
+				rest = append(rest, f)
+			}
+			continue
+		}
+		if !found {
+			found = true
+			rest = append(make([]zapcore.Field, 0, len(fields)), fields[:i]...)
+		}
+	}
+	return rest, t, found
+}
+
+// sinkCore routes entries to the sinks of RegisterNamedSink. The target set
+// by With is known at Check, while the one of the fields of an entry is only
+// known at Write, so the entry is checked by Core first and written later
+type sinkCore struct {
+	zapcore.Core
+	config *Config
+	// the outputs of the errors of delayed writes
+	errOutput zapcore.WriteSyncer
+	// the fields of With, which the named sinks get as well
+	context []zapcore.Field
+	target  sinkTarget
+}
+
+// With implements zapcore.Core
+func (s *sinkCore) With(fields []zapcore.Field) zapcore.Core {
+	rest, t, found := sinkFields(fields)
+	clone := *s
+	clone.Core = s.Core.With(rest)
+	clone.context = append(s.context[:len(s.context):len(s.context)], rest...)
+	if found {
+		clone.target = t
+	}
+	return &clone
+}
+
+// Check implements zapcore.Core
+func (s *sinkCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if s.target.name != "" {
+		return s.checkTarget(ent, ce)
+	}
+	if len(s.config.namedSinkCores()) == 0 {
+		return s.Core.Check(ent, ce)
+	}
+	inner := s.Core.Check(ent, nil)
+	if inner == nil && !s.config.severity.level.Enabled(ent.Level) {
+		return ce
+	}
+	return ce.AddCore(ent, &fieldSinkWriter{Core: s.Core, sink: s, inner: inner})
+}
+
+// checkTarget checks ent of the target set by With
+func (s *sinkCore) checkTarget(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	named, ok := s.config.namedSink(s.target.name)
+	if !ok {
+		ce = s.Core.Check(ent, ce)
+		if s.config.inDevelopment() {
+			ce = ce.Should(ent, zapcore.WriteThenPanic)
+		}
+		return ce
+	}
+	if !s.target.exclusive {
+		ce = s.Core.Check(ent, ce)
+	}
+	if !named.Enabled(ent.Level) {
+		return ce
+	}
+	return ce.AddCore(ent, &namedSinkWriter{Core: named, context: s.context})
+}
+
+// Sync implements zapcore.Core, the named sinks are synced as well
+func (s *sinkCore) Sync() error {
+	return multierr.Append(s.Core.Sync(), s.config.syncNamedSinks())
+}
+
+// namedSinkWriter writes entries to a named sink with the fields of With
+type namedSinkWriter struct {
+	zapcore.Core
+	context []zapcore.Field
+}
+
+// Write implements zapcore.Core
+func (w *namedSinkWriter) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if len(w.context) > 0 {
+		fields = append(w.context[:len(w.context):len(w.context)], fields...)
+	}
+	return w.Core.Write(ent, fields)
+}
+
+// fieldSinkWriter writes entries to the sink named by their fields, and to
+// the cores of inner unless it's exclusive
+type fieldSinkWriter struct {
+	zapcore.Core
+	sink  *sinkCore
+	inner *zapcore.CheckedEntry
+}
+
+// Write implements zapcore.Core
+func (w *fieldSinkWriter) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	rest, t, found := sinkFields(fields)
+	if !found {
+		w.writeInner(fields)
+		return nil
+	}
+	named, ok := w.sink.config.namedSink(t.name)
+	if !ok {
+		w.writeInner(fields)
+		if w.sink.config.inDevelopment() {
+			panic(fmt.Sprintf("klog: unknown sink %q", t.name))
+		}
+		return nil
+	}
+	if !t.exclusive {
+		w.writeInner(rest)
+	}
+	if !named.Enabled(ent.Level) {
+		return nil
+	}
+	return (&namedSinkWriter{Core: named, context: w.sink.context}).Write(ent, rest)
+}
+
+// writeInner writes the entry checked by the outputs, whose errors go to
+// the error output
+func (w *fieldSinkWriter) writeInner(fields []zapcore.Field) {
+	if w.inner == nil {
+		return
+	}
+	w.inner.ErrorOutput = w.sink.errOutput
+	w.inner.Write(fields...)
+	w.inner = nil
+}
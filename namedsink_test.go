@@ -0,0 +1,141 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newSinkLogger returns a file logger with a buffer registered as sink
+// "billing"
+func newSinkLogger(t *testing.T, development bool) (*Klogger, string, *bytes.Buffer) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "klog.log")
+	c := newConfig()
+	c.development.set(development)
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = []string{path}
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+	buf := &bytes.Buffer{}
+	if err := k.RegisterNamedSink("billing", zapcore.AddSync(buf), zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())); err != nil {
+		t.Fatal(err)
+	}
+	return k, path, buf
+}
+
+// messages returns the messages of entries
+func messages(entries []map[string]interface{}) []interface{} {
+	msgs := make([]interface{}, 0, len(entries))
+	for _, e := range entries {
+		msgs = append(msgs, e["msg"])
+	}
+	return msgs
+}
+
+func TestToSink(t *testing.T) {
+	k, path, buf := newSinkLogger(t, false)
+	defer removeDir(path)
+
+	k.Infow("plain")
+	k.ToSink("billing").With(map[string]interface{}{"user": "u1"}).Infow("charged", "amount", 42)
+	k.ToSink("billing", ExclusiveSink()).Infow("invoice", "id", 7)
+	k.Infow("field", SinkKey, "billing")
+	k.WithFields(SinkKey, "billing", ExclusiveSinkKey, true).Warningw("refund")
+	k.Flush()
+
+	outputs := readLines(t, path)
+	sink := decodeLines(t, buf)
+	if got := messages(outputs); len(got) != 3 || got[0] != "plain" || got[1] != "charged" || got[2] != "field" {
+		t.Errorf("unexpected outputs %v", got)
+	}
+	if got := messages(sink); len(got) != 4 || got[0] != "charged" || got[1] != "invoice" || got[2] != "field" || got[3] != "refund" {
+		t.Errorf("unexpected sink %v", got)
+	}
+	for _, e := range append(outputs, sink...) {
+		if _, ok := e[SinkKey]; ok {
+			t.Errorf("unexpected %s in %v", SinkKey, e)
+		}
+		if _, ok := e[ExclusiveSinkKey]; ok {
+			t.Errorf("unexpected %s in %v", ExclusiveSinkKey, e)
+		}
+	}
+	if sink[0]["user"] != "u1" || sink[0]["amount"] != float64(42) || outputs[1]["user"] != "u1" {
+		t.Errorf("expect the fields in both, get %v and %v", sink[0], outputs[1])
+	}
+}
+
+func TestToSinkLevel(t *testing.T) {
+	k, path, buf := newSinkLogger(t, false)
+	defer removeDir(path)
+	k.config.severity.Set("error")
+	k.ToSink("billing", ExclusiveSink()).Infow("suppressed")
+	k.Infow("suppressed", SinkKey, "billing")
+	if buf.Len() != 0 {
+		t.Errorf("expect entries below log_level dropped, get %s", buf)
+	}
+}
+
+func TestToSinkUnknown(t *testing.T) {
+	k, path, buf := newSinkLogger(t, false)
+	defer removeDir(path)
+	if r := catchPanic(func() {
+		k.ToSink("nope", ExclusiveSink()).Infow("charged")
+		k.Infow("field", SinkKey, "nope")
+	}); r != nil {
+		t.Fatalf("unexpected panic %v", r)
+	}
+	k.Flush()
+	if got := messages(readLines(t, path)); len(got) != 2 || got[0] != "charged" || got[1] != "field" {
+		t.Errorf("expect default routing, get %v", got)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("unexpected sink %s", buf)
+	}
+
+	dev, devPath, _ := newSinkLogger(t, true)
+	defer removeDir(devPath)
+	if r := catchPanic(func() { dev.ToSink("nope") }); r == nil {
+		t.Error("expect panic of ToSink in development")
+	}
+	if r := catchPanic(func() { dev.Infow("field", SinkKey, "nope") }); r == nil {
+		t.Error("expect panic of the field in development")
+	}
+}
+
+func TestRegisterNamedSink(t *testing.T) {
+	k, path, _ := newSinkLogger(t, false)
+	defer removeDir(path)
+	enc := zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig())
+	if err := k.RegisterNamedSink("billing", zapcore.AddSync(os.Stderr), enc); err == nil {
+		t.Error("expect error of duplicate sink")
+	}
+	if err := k.RegisterNamedSink("", zapcore.AddSync(os.Stderr), enc); err == nil {
+		t.Error("expect error of empty name")
+	}
+}
@@ -0,0 +1,51 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"go.uber.org/zap"
+)
+
+// WithNamespace groups all the following fields under name
+func WithNamespace(name string) *Klogger {
+	return klogger.WithNamespace(name)
+}
+
+// WithNamespace groups all the following fields under name
+// Due to zap, a namespace can't be closed. Opening another one nests it
+// inside the current one, so derive from a logger without namespace if
+// sibling groups are needed
+func (k *Klogger) WithNamespace(name string) *Klogger {
+	ns := zap.Namespace(name)
+	child := k.deriveWith(k.sugar.Desugar().With(ns).Sugar(), []zap.Field{ns})
+	child.namespace = name
+	return child
+}
+
+// WithFieldsNS opens ns and fills k-v pairs into it
+func WithFieldsNS(ns string, kv ...interface{}) *Klogger {
+	return klogger.WithFieldsNS(ns, kv...)
+}
+
+// WithFieldsNS opens ns and fills k-v pairs into it
+// Subsequent WithFields calls stay inside ns. If ns is already the current
+// namespace, it is not opened again
+func (k *Klogger) WithFieldsNS(ns string, kv ...interface{}) *Klogger {
+	l := k
+	if k.namespace != ns {
+		l = k.WithNamespace(ns)
+	}
+	return l.WithFields(kv...)
+}
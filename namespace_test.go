@@ -0,0 +1,46 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNamespace(t *testing.T) {
+	k, buf := newTestLogger()
+
+	k.WithFields("id", 1).WithNamespace("req").WithFields("path", "/").Info("ns")
+	k.WithFieldsNS("req", "path", "/").WithFields("method", "GET").Info("ns-fields")
+	k.WithFieldsNS("req", "path", "/").WithFieldsNS("req", "method", "GET").Info("same-ns")
+	k.WithFieldsNS("req", "path", "/").WithFieldsNS("resp", "code", 200).Info("nested")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	expects := []string{
+		`"id":1,"req":{"path":"/"}`,
+		`"req":{"path":"/","method":"GET"}`,
+		`"req":{"path":"/","method":"GET"}`,
+		`"req":{"path":"/","resp":{"code":200}}`,
+	}
+	if len(lines) != len(expects) {
+		t.Fatalf("expect %d lines, get %d", len(expects), len(lines))
+	}
+	for i, expect := range expects {
+		if !strings.Contains(lines[i], expect) {
+			t.Errorf("expect %s in %s", expect, lines[i])
+		}
+	}
+	decodeLines(t, buf)
+}
@@ -0,0 +1,38 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import "go.uber.org/zap"
+
+// NewNop returns a logger that writes nothing, e.g. for benchmarks and tests
+// of libraries accepting a *Klogger. V, SetLevel and With* work as usual.
+// Fatal and Exit still call the exit func set by SetExitFunc, and Panic still
+// panics, since callers don't expect them to return
+func NewNop() *Klogger {
+	return &Klogger{
+		sugar:  zap.NewNop().Sugar(),
+		config: newConfig(),
+	}
+}
+
+// DisableForTesting installs a no-op logger as the global one
+// Call the returned func to restore the previous logger
+func DisableForTesting() (restore func()) {
+	old := klogger
+	klogger = NewNop()
+	return func() {
+		klogger = old
+	}
+}
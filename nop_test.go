@@ -0,0 +1,86 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestNop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	out := redirectStdout(t, dir, "stdout.log")
+	os.Stderr = os.Stdout
+
+	var codes []int
+	SetExitFunc(func(code int) { codes = append(codes, code) })
+	defer SetExitFunc(nil)
+
+	k := NewNop()
+	k.SetLevel(MaxLevel)
+	k.SetLevel(MaxLevel + 1)
+	k.V(5).Infof("v %d", 5)
+	k.V(5).InfoS("v", "n", 5)
+	child := k.With("a", 1).WithFields("b", 2).WithAll("c").WithCallerSkip(1)
+	child.Infof("info")
+	child.Warningw("warning", "k", "v")
+	child.ErrorS(errors.New("failed"), "error")
+	child.DPanic("dpanic")
+	child.Fatalf("fatal")
+	child.Exitf("exit")
+	if err := k.Close(context.Background()); err != nil {
+		t.Errorf("close: %v", err)
+	}
+
+	if expect := []int{255, 1}; !reflect.DeepEqual(codes, expect) {
+		t.Errorf("expect exit codes %v, get %v", expect, codes)
+	}
+	os.Stdout.Sync()
+	if b, err := ioutil.ReadFile(out); err != nil || len(b) != 0 {
+		t.Errorf("expect no output, get %q, %v", b, err)
+	}
+}
+
+func TestDisableForTesting(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	restore := DisableForTesting()
+	Infof("disabled")
+	restore()
+	Infof("restored")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 1 || entries[0]["msg"] != "restored" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
+
+func BenchmarkNop(b *testing.B) {
+	k := NewNop()
+	for i := 0; i < b.N; i++ {
+		k.InfoS("nop", "i", i)
+	}
+}
@@ -0,0 +1,140 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+)
+
+// onceKeys holds a *uint64 of each key logged by WarnOnce and so on, which
+// counts the calls suppressed afterwards
+var onceKeys sync.Map
+
+// WarnOnce logs a message with k-v pairs at WARN once per process, keyed by
+// msg, e.g. a deprecation warning. See WarnOnceKey
+func WarnOnce(msg string, kv ...interface{}) {
+	if takeOnce(msg) {
+		klogger.sugar.Desugar().Warn(msg, klogger.sweetenFields(kv)...)
+	}
+}
+
+// WarnOnce logs a message with k-v pairs at WARN once per process, keyed by
+// msg, e.g. a deprecation warning. See WarnOnceKey
+func (k *Klogger) WarnOnce(msg string, kv ...interface{}) {
+	if takeOnce(msg) {
+		k.sugar.Desugar().Warn(msg, k.sweetenFields(kv)...)
+	}
+}
+
+// WarnOnceKey logs a message with k-v pairs at WARN once per process for key
+func WarnOnceKey(key, msg string, kv ...interface{}) {
+	if takeOnce(key) {
+		klogger.sugar.Desugar().Warn(msg, klogger.sweetenFields(kv)...)
+	}
+}
+
+// WarnOnceKey logs a message with k-v pairs at WARN once per process for key,
+// e.g. the name of a deprecated option when msg varies. Keys are shared by
+// all the loggers and levels, the later calls are counted, see
+// LogOnceSummary
+func (k *Klogger) WarnOnceKey(key, msg string, kv ...interface{}) {
+	if takeOnce(key) {
+		k.sugar.Desugar().Warn(msg, k.sweetenFields(kv)...)
+	}
+}
+
+// ErrorOnce logs a message with k-v pairs at ERROR once per process, keyed by
+// msg, like Errorw
+func ErrorOnce(msg string, kv ...interface{}) {
+	if takeOnce(msg) {
+		klogger.sugar.Desugar().Error(msg, klogger.errorFields(nil, msg, kv)...)
+	}
+}
+
+// ErrorOnce logs a message with k-v pairs at ERROR once per process, keyed by
+// msg, like Errorw
+func (k *Klogger) ErrorOnce(msg string, kv ...interface{}) {
+	if takeOnce(msg) {
+		k.sugar.Desugar().Error(msg, k.errorFields(nil, msg, kv)...)
+	}
+}
+
+// ErrorOnceKey logs a message with k-v pairs at ERROR once per process for key
+func ErrorOnceKey(key, msg string, kv ...interface{}) {
+	if takeOnce(key) {
+		klogger.sugar.Desugar().Error(msg, klogger.errorFields(nil, msg, kv)...)
+	}
+}
+
+// ErrorOnceKey logs a message with k-v pairs at ERROR once per process for key
+func (k *Klogger) ErrorOnceKey(key, msg string, kv ...interface{}) {
+	if takeOnce(key) {
+		k.sugar.Desugar().Error(msg, k.errorFields(nil, msg, kv)...)
+	}
+}
+
+// takeOnce returns true for the first call of key, and counts the others
+// Disabled levels don't matter, the key is taken anyway
+func takeOnce(key string) bool {
+	n := new(uint64)
+	if v, loaded := onceKeys.LoadOrStore(key, n); loaded {
+		atomic.AddUint64(v.(*uint64), 1)
+		return false
+	}
+	return true
+}
+
+// OnceSuppressed returns how many calls of WarnOnce and so on are suppressed
+// for each key
+func OnceSuppressed() map[string]uint64 {
+	m := make(map[string]uint64)
+	onceKeys.Range(func(key, v interface{}) bool {
+		m[key.(string)] = atomic.LoadUint64(v.(*uint64))
+		return true
+	})
+	return m
+}
+
+// LogOnceSummary logs the keys of WarnOnce and so on whose calls have been
+// suppressed, with the counts as "suppressed". It's called on exiting by
+// Fatal, Exit, FlushOnSignal and Close
+func LogOnceSummary() {
+	klogger.LogOnceSummary()
+}
+
+// LogOnceSummary logs the keys of WarnOnce and so on whose calls have been
+// suppressed, with the counts as "suppressed"
+func (k *Klogger) LogOnceSummary() {
+	counts := OnceSuppressed()
+	for key, n := range counts {
+		if n == 0 {
+			delete(counts, key)
+		}
+	}
+	if len(counts) > 0 {
+		k.internal().sugar.Desugar().Info("repeated entries logged once", zap.Any(SuppressedKey, counts))
+	}
+}
+
+// ResetOnce forgets the keys of WarnOnce and so on, e.g. between tests
+func ResetOnce() {
+	onceKeys.Range(func(key, _ interface{}) bool {
+		onceKeys.Delete(key)
+		return true
+	})
+}
@@ -0,0 +1,87 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestWarnOnce(t *testing.T) {
+	defer ResetOnce()
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			WarnOnce("option foo is deprecated", "i", i)
+			k.WarnOnceKey("foo", "option foo is deprecated, use bar", "i", i)
+		}(i)
+	}
+	wg.Wait()
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 entries, get %v", entries)
+	}
+	for _, entry := range entries {
+		if entry["level"] != "warn" {
+			t.Errorf("expect warn, get %v", entry)
+		}
+	}
+	counts := OnceSuppressed()
+	if counts["option foo is deprecated"] != 49 || counts["foo"] != 49 {
+		t.Errorf("unexpected suppressed counts %v", counts)
+	}
+
+	buf.Reset()
+	LogOnceSummary()
+	entries = decodeLines(t, buf)
+	if len(entries) != 1 || entries[0]["msg"] != "repeated entries logged once" {
+		t.Fatalf("unexpected summary %v", entries)
+	}
+	summary := entries[0][SuppressedKey].(map[string]interface{})
+	if summary["foo"] != 49.0 || summary["option foo is deprecated"] != 49.0 {
+		t.Errorf("unexpected summary %v", summary)
+	}
+}
+
+func TestErrorOnce(t *testing.T) {
+	defer ResetOnce()
+	k, buf := newTestLogger()
+	for i := 0; i < 3; i++ {
+		k.ErrorOnce("bad config", "i", i)
+	}
+	k.ErrorOnceKey("other", "bad config")
+	ResetOnce()
+	k.ErrorOnce("bad config", "i", 3)
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries, get %v", entries)
+	}
+	if entries[0]["level"] != "error" || entries[0]["i"] != 0.0 || entries[2]["i"] != 3.0 {
+		t.Errorf("unexpected entries %v", entries)
+	}
+
+	buf.Reset()
+	k.LogOnceSummary()
+	if buf.Len() != 0 {
+		t.Errorf("expect no summary without suppressed calls, get %s", buf)
+	}
+}
@@ -0,0 +1,167 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// Format is a value of log_format
+type Format string
+
+const (
+	// JSON is the default format
+	JSON Format = "json"
+	// Console is the format of zap's console encoder
+	Console Format = "console"
+	// Dev is Console, and makes DPanic panic
+	Dev Format = "dev"
+	// GCP is the format of Google Cloud Logging
+	GCP Format = "gcp"
+	// ECS is the format of Elastic Common Schema
+	ECS Format = "ecs"
+)
+
+// Option sets the config of New or Configure, like the flags of InitFlags
+type Option func(c *Config) error
+
+// New returns a logger built from the default config and opts, which doesn't
+// read flags nor affect the global logger. Close it to release the outputs
+func New(opts ...Option) (*Klogger, error) {
+	c := newConfig()
+	if err := c.apply(opts); err != nil {
+		return nil, err
+	}
+	k := &Klogger{config: c}
+	if err := k.start(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// Configure sets the config of the global logger like flags do, which takes
+// effect on Singleton or Reconfigure
+func Configure(opts ...Option) error {
+	c := klogger.config
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.apply(opts)
+}
+
+// apply calls opts in order, stopping at the first error
+func (c *Config) apply(opts []Option) error {
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WithLevel sets v, the verbosity of V()
+func WithLevel(v Level) Option {
+	return func(c *Config) error {
+		if v < MinLevel {
+			return fmt.Errorf("invalid level %d: expect no less than %d", v, MinLevel)
+		}
+		c.level.set(v)
+		return nil
+	}
+}
+
+// WithLogLevel sets log_level, one of info, warning and error
+func WithLogLevel(severity string) Option {
+	return func(c *Config) error {
+		return c.severity.Set(severity)
+	}
+}
+
+// WithFormat sets log_format
+func WithFormat(format Format) Option {
+	return func(c *Config) error {
+		if !validFormat(string(format)) {
+			return fmt.Errorf("invalid log_format %q", format)
+		}
+		c.format.set(string(format))
+		return nil
+	}
+}
+
+// WithOutputPaths sets log_output, the outputs replacing stdout or stderr
+func WithOutputPaths(paths ...string) Option {
+	return func(c *Config) error {
+		c.outputPaths.set(append([]string(nil), paths...))
+		return nil
+	}
+}
+
+// WithAlsoLogToStderr sets alsologtostderr, entries go to stdout if it's false
+func WithAlsoLogToStderr(also bool) Option {
+	return func(c *Config) error {
+		c.alsologtostderr.set(also)
+		return nil
+	}
+}
+
+// WithCaller sets log_caller, e.g. full or none
+func WithCaller(format string) Option {
+	return func(c *Config) error {
+		if !validCallerFormat(format) {
+			return fmt.Errorf("invalid log_caller %q", format)
+		}
+		c.callerFormat.set(format)
+		return nil
+	}
+}
+
+// WithLogFile sets log_file, rotated beyond maxSizeMB unless it's 0
+func WithLogFile(path string, maxSizeMB uint64) Option {
+	return func(c *Config) error {
+		c.logFile.set(path)
+		c.logFileMaxSize.set(maxSizeMB)
+		return nil
+	}
+}
+
+// WithSampling sets log_sampling, e.g. info:100/100 or none
+func WithSampling(rules string) Option {
+	return func(c *Config) error {
+		return c.sampling.Set(rules)
+	}
+}
+
+// WithRoutes sets the routes, see SetRoutes
+func WithRoutes(routes ...RouteConfig) Option {
+	return func(c *Config) error {
+		for _, r := range routes {
+			if err := r.validate(); err != nil {
+				return err
+			}
+		}
+		c.routes = append([]RouteConfig(nil), routes...)
+		return nil
+	}
+}
+
+// WithEncoderConfig calls fn with the encoder config derived from the other
+// settings, e.g. to rename the keys. The later one is called later
+func WithEncoderConfig(fn func(*zapcore.EncoderConfig)) Option {
+	return func(c *Config) error {
+		c.encoderConfigFns = append(c.encoderConfigFns, fn)
+		return nil
+	}
+}
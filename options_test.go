@@ -0,0 +1,118 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out.log")
+	file := filepath.Join(dir, "file.log")
+	human := filepath.Join(dir, "human.log")
+
+	k, err := New(
+		WithLevel(2),
+		WithLogLevel("info"),
+		WithFormat(JSON),
+		WithOutputPaths(out),
+		WithAlsoLogToStderr(true),
+		WithCaller("none"),
+		WithLogFile(file, 10),
+		WithSampling("none"),
+		WithRoutes(RouteConfig{Format: string(Console), Outputs: []string{human}}),
+		WithEncoderConfig(func(ec *zapcore.EncoderConfig) {
+			ec.MessageKey = "message"
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 200; i++ {
+		k.V(2).Infof("n %d", i)
+	}
+	k.V(3).Info("disabled")
+	if err := k.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{out, file} {
+		entries := readLines(t, path)
+		// and "klog initialized" at V(1)
+		if len(entries) != 201 {
+			t.Fatalf("expect 201 entries in %s unsampled, get %d", path, len(entries))
+		}
+		if entries[1]["message"] != "n 0" || entries[1]["caller"] != nil {
+			t.Errorf("unexpected entry %v", entries[1])
+		}
+	}
+	b, _ := ioutil.ReadFile(human)
+	if lines := strings.Split(string(b), "\n"); len(lines) < 2 || !strings.HasSuffix(lines[1], "\tn 0") {
+		t.Errorf("unexpected console output %q", b)
+	}
+	if klogger.config == k.config || k.config.level.get() != 2 || k.config.maxLevel.get() != MaxLevel {
+		t.Error("expect a config of its own")
+	}
+}
+
+func TestNewStdout(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+	path := redirectStdout(t, dir, "stdout.log")
+
+	k, err := New(WithAlsoLogToStderr(false), WithLogLevel("warning"), WithFormat(Console))
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.Info("suppressed")
+	k.Warning("written")
+	k.sugar.Sync()
+	b, _ := ioutil.ReadFile(path)
+	if s := string(b); strings.Contains(s, "suppressed") || !strings.Contains(s, "\twarn\t") {
+		t.Errorf("unexpected output %q", s)
+	}
+}
+
+func TestNewInvalid(t *testing.T) {
+	for _, opt := range []Option{
+		WithLevel(-1),
+		WithLogLevel("fatal"),
+		WithFormat("xml"),
+		WithCaller("long"),
+		WithSampling("info:x"),
+		WithRoutes(RouteConfig{}),
+	} {
+		if k, err := New(opt); err == nil || k != nil {
+			t.Errorf("expect error, get %v", k)
+		}
+	}
+}
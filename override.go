@@ -0,0 +1,84 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const (
+	// DebugLogHeader is the default request header of verbosity overrides
+	DebugLogHeader = "X-Debug-Log"
+	// DebugTokenHeader is the default request header of their tokens
+	DebugTokenHeader = "X-Debug-Token"
+)
+
+// VerbosityOverride makes the middleware honor a verbosity set by a request
+// header, e.g. "X-Debug-Log: 4", if valid accepts the token of tokenHeader,
+// see OverrideVerbosity. Empty header names default to DebugLogHeader and
+// DebugTokenHeader. Requests overridden are never buffered by BufferVerbose
+func VerbosityOverride(header, tokenHeader string, valid func(token string) bool) MiddlewareOption {
+	if header == "" {
+		header = DebugLogHeader
+	}
+	if tokenHeader == "" {
+		tokenHeader = DebugTokenHeader
+	}
+	return func(c *middlewareConfig) {
+		c.overrideHeader = http.CanonicalHeaderKey(header)
+		c.tokenHeader = http.CanonicalHeaderKey(tokenHeader)
+		c.validToken = valid
+	}
+}
+
+// AllowTokens returns a validator for VerbosityOverride accepting the tokens
+func AllowTokens(tokens ...string) func(token string) bool {
+	return func(token string) bool {
+		ok := 0
+		for _, t := range tokens {
+			ok |= subtle.ConstantTimeCompare([]byte(t), []byte(token))
+		}
+		return ok == 1
+	}
+}
+
+// OverrideVerbosity returns a copy of ctx whose logger, see FromContext, has
+// the verbosity of value if valid accepts token, e.g. in gRPC interceptors
+// reading them from the metadata. An honored override is audited, and an
+// invalid token logs a warning. It returns false with ctx if value is empty,
+// not a level, or token is invalid
+func OverrideVerbosity(ctx context.Context, value, token string, valid func(token string) bool) (context.Context, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ctx, false
+	}
+	k := FromContext(ctx)
+	level, err := strconv.Atoi(value)
+	if err != nil || level < 0 {
+		k.Warningw("invalid verbosity override", "value", value)
+		return ctx, false
+	}
+	if valid == nil || !valid(token) {
+		k.Warningw("verbosity override rejected", "v", level)
+		return ctx, false
+	}
+	k = k.WithVerbosity(Level(level))
+	k.Audit("verbosity override honored", "v", int(k.verbosity))
+	return NewContext(ctx, k), true
+}
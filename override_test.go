@@ -0,0 +1,98 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestVerbosityOverrideMiddleware(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	handler := NewTraceMiddleware(VerbosityOverride("x-debug", "", AllowTokens("secret", "other")))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		FromContext(r.Context()).V(4).Infof("verbose")
+	}))
+	cases := []struct {
+		name    string
+		headers map[string]string
+		verbose bool
+		msg     string
+	}{
+		{"no header", nil, false, ""},
+		{"valid", map[string]string{"X-Debug": "4", DebugTokenHeader: "secret"}, true, "verbosity override honored"},
+		{"other valid", map[string]string{"X-Debug": "5", DebugTokenHeader: "other"}, true, "verbosity override honored"},
+		{"invalid token", map[string]string{"X-Debug": "4", DebugTokenHeader: "wrong"}, false, "verbosity override rejected"},
+		{"no token", map[string]string{"X-Debug": "4"}, false, "verbosity override rejected"},
+		{"too low", map[string]string{"X-Debug": "3", DebugTokenHeader: "secret"}, false, "verbosity override honored"},
+		{"not a level", map[string]string{"X-Debug": "high", DebugTokenHeader: "secret"}, false, "invalid verbosity override"},
+		{"default header ignored", map[string]string{DebugLogHeader: "4", DebugTokenHeader: "secret"}, false, ""},
+	}
+	for _, c := range cases {
+		buf.Reset()
+		r := httptest.NewRequest("GET", "/", nil)
+		for name, v := range c.headers {
+			r.Header.Set(name, v)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+
+		var verbose bool
+		var msg string
+		for _, line := range decodeLines(t, buf) {
+			if line["msg"] == "verbose" {
+				verbose = true
+			} else {
+				msg, _ = line["msg"].(string)
+			}
+			if line[TraceIDKey] == nil {
+				t.Errorf("%s: expect the trace id in %v", c.name, line)
+			}
+		}
+		if verbose != c.verbose || msg != c.msg {
+			t.Errorf("%s: expect verbose %v and %q, got %v and %q", c.name, c.verbose, c.msg, verbose, msg)
+		}
+	}
+}
+
+func TestOverrideVerbosity(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	ctx := context.Background()
+	if got, ok := OverrideVerbosity(ctx, "", "t", AllowTokens("t")); ok || got != ctx {
+		t.Error("expect an empty value ignored")
+	}
+	if _, ok := OverrideVerbosity(ctx, "4", "t", nil); ok {
+		t.Error("expect no validator rejecting overrides")
+	}
+	if _, ok := OverrideVerbosity(ctx, "-1", "t", AllowTokens("t")); ok {
+		t.Error("expect a negative level rejected")
+	}
+	got, ok := OverrideVerbosity(ctx, " 99 ", "t", AllowTokens("t"))
+	if !ok || FromContext(got).verbosity != MaxLevel {
+		t.Errorf("expect the level clamped to %d", MaxLevel)
+	}
+	lines := decodeLines(t, buf)
+	last := lines[len(lines)-1]
+	if last["msg"] != "verbosity override honored" || last["v"] != float64(MaxLevel) {
+		t.Errorf("expect an audit entry, got %v", last)
+	}
+	if AllowTokens()("") {
+		t.Error("expect no token allowed by an empty allowlist")
+	}
+}
@@ -0,0 +1,78 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+)
+
+// maxProtoBytes caps the encoded JSON of a message
+const maxProtoBytes = 16 << 10
+
+// ProtoMessage is implemented by generated protobuf messages, so that klog
+// does not depend on protobuf
+type ProtoMessage interface {
+	ProtoMessage()
+}
+
+// protoMarshal encodes messages, set by SetProtoMarshaler
+var protoMarshal = func(m ProtoMessage) ([]byte, error) {
+	return json.Marshal(m)
+}
+
+// SetProtoMarshaler sets how messages are encoded, e.g. by wrapping
+// protojson.Marshal. encoding/json is used by default, which skips XXX_ fields
+// of generated code. Call it before logging
+func SetProtoMarshaler(fn func(m ProtoMessage) ([]byte, error)) {
+	protoMarshal = fn
+}
+
+// protoValue encodes a message when the entry is written
+type protoValue struct {
+	m ProtoMessage
+}
+
+// MarshalJSON implements json.Marshaler, huge messages are truncated into
+// a string with the truncated suffix
+func (p protoValue) MarshalJSON() ([]byte, error) {
+	b, err := protoMarshal(p.m)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxProtoBytes {
+		return json.Marshal(truncateString(string(b), maxProtoBytes) + truncatedSuffix)
+	}
+	return b, nil
+}
+
+// Proto returns a field of a message encoded as JSON
+// Messages passed to With, WithAll and WithFields are detected as well
+func Proto(key string, m ProtoMessage) zap.Field {
+	return zap.Reflect(key, protoValue{m})
+}
+
+// anyField is zap.Any aware of registered types and messages, failures to
+// marshal are recovered
+func anyField(key string, val interface{}) zap.Field {
+	if f, ok := registeredField(key, val); ok {
+		return safeField(f)
+	}
+	if m, ok := val.(ProtoMessage); ok {
+		return safeField(Proto(key, m))
+	}
+	return safeField(zap.Any(key, val))
+}
@@ -0,0 +1,88 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeMessage looks like a message generated by protoc-gen-go
+type fakeMessage struct {
+	Name             string   `json:"name,omitempty"`
+	Tags             []string `json:"tags,omitempty"`
+	XXX_unrecognized []byte   `json:"-"`
+	XXX_sizecache    int32    `json:"-"`
+	state            int
+}
+
+func (m *fakeMessage) ProtoMessage()  {}
+func (m *fakeMessage) Reset()         { *m = fakeMessage{} }
+func (m *fakeMessage) String() string { return "name:" + m.Name }
+
+func TestProto(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	m := &fakeMessage{Name: "a", Tags: []string{"x"}, XXX_sizecache: 1, state: 2}
+	expect := map[string]interface{}{"name": "a", "tags": []interface{}{"x"}}
+	Infow("explicit", Proto("m", m))
+	WithFields("m", m).Info("fields")
+	WithFields(map[string]interface{}{"m": m}).Info("map")
+	With(struct{ M *fakeMessage }{m}).Info("with")
+	WithAll(m).Info("all")
+
+	entries := decodeLines(t, buf)
+	keys := []string{"m", "m", "m", "M", ""}
+	if len(entries) != len(keys) {
+		t.Fatalf("unexpected entries %v", entries)
+	}
+	for i, key := range keys {
+		if !reflect.DeepEqual(entries[i][key], expect) {
+			t.Errorf("%s: expect %v, get %v", entries[i]["msg"], expect, entries[i][key])
+		}
+	}
+}
+
+func TestProtoTruncated(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	Infow("huge", Proto("m", &fakeMessage{Name: strings.Repeat("a", maxProtoBytes)}))
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	s, _ := entry["m"].(string)
+	if len(s) != maxProtoBytes+len(truncatedSuffix) || !strings.HasSuffix(s, truncatedSuffix) {
+		t.Errorf("huge message should be truncated, get %d bytes", len(s))
+	}
+}
+
+func TestSetProtoMarshaler(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	defer SetProtoMarshaler(protoMarshal)
+
+	SetProtoMarshaler(func(m ProtoMessage) ([]byte, error) {
+		return []byte(`{"custom":true}`), nil
+	})
+	Infow("custom", Proto("m", &fakeMessage{}))
+	if e := decodeLines(t, buf)[0]; !reflect.DeepEqual(e["m"], map[string]interface{}{"custom": true}) {
+		t.Errorf("unexpected entry %v", e)
+	}
+}
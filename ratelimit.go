@@ -0,0 +1,119 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SuppressedKey holds how many entries were dropped by WithRateLimit
+const SuppressedKey = "suppressed"
+
+// WithRateLimit returns a logger writing one entry per interval on average,
+// see Klogger.WithRateLimit
+func WithRateLimit(interval time.Duration, burst int) *Klogger {
+	return klogger.WithRateLimit(interval, burst)
+}
+
+// WithRateLimit returns a logger writing one entry per interval on average,
+// with bursts of up to burst entries, e.g. WithRateLimit(30*time.Second, 1)
+// in a poll loop. Entries beyond it are dropped, and the next entry written
+// is preceded by one telling how many were dropped. The limit is shared by
+// the loggers derived from the returned one, regardless of the message
+// Entries above ERROR are never dropped. A non-positive interval disables it
+func (k *Klogger) WithRateLimit(interval time.Duration, burst int) *Klogger {
+	if interval <= 0 {
+		return k.derive(k.sugar)
+	}
+	if burst < 1 {
+		burst = 1
+	}
+	limiter := &rateLimiter{interval: interval, burst: float64(burst)}
+	return k.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &rateLimitCore{Core: core, limiter: limiter, now: k.config.now}
+	}))
+}
+
+// rateLimiter is a token bucket
+type rateLimiter struct {
+	interval time.Duration
+	burst    float64
+
+	mu         sync.Mutex
+	tokens     float64
+	last       time.Time
+	suppressed int
+}
+
+// allow takes a token at now. If there's one, it returns the number of
+// entries suppressed since the last one allowed
+func (r *rateLimiter) allow(now time.Time) (bool, int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.last.IsZero() {
+		r.tokens = r.burst
+		r.last = now
+	} else if now.After(r.last) {
+		r.tokens += float64(now.Sub(r.last)) / float64(r.interval)
+		if r.tokens > r.burst {
+			r.tokens = r.burst
+		}
+		r.last = now
+	}
+	if r.tokens < 1 {
+		r.suppressed++
+		return false, 0
+	}
+	r.tokens--
+	n := r.suppressed
+	r.suppressed = 0
+	return true, n
+}
+
+// rateLimitCore drops the entries not allowed by its limiter
+type rateLimitCore struct {
+	zapcore.Core
+	limiter *rateLimiter
+	now     func() time.Time
+}
+
+// With implements zapcore.Core
+func (c *rateLimitCore) With(fields []zapcore.Field) zapcore.Core {
+	return &rateLimitCore{Core: c.Core.With(fields), limiter: c.limiter, now: c.now}
+}
+
+// Check implements zapcore.Core
+func (c *rateLimitCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level > zapcore.ErrorLevel || !c.Enabled(ent.Level) {
+		return c.Core.Check(ent, ce)
+	}
+	ok, n := c.limiter.allow(c.now())
+	if !ok {
+		return ce
+	}
+	if n > 0 {
+		summary := ent
+		summary.Message = "suppressed " + strconv.Itoa(n) + " similar entries"
+		if sce := c.Core.Check(summary, nil); sce != nil {
+			sce.Write(zap.Int(SuppressedKey, n))
+		}
+	}
+	return c.Core.Check(ent, ce)
+}
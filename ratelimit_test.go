@@ -0,0 +1,92 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xial-thu/klog/klogtest"
+)
+
+func TestWithRateLimit(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	k.config.sampling.set(samplingRules{})
+	rebuild(t, k)
+	defer swapLogger(k)()
+
+	clock := klogtest.NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	limited := WithRateLimit(10*time.Second, 2)
+	for i := 0; i < 4; i++ {
+		limited.Infof("poll %d", i)
+	}
+	limited.WithFields("derived", true).Warningf("derived")
+	Infof("unlimited")
+	clock.Add(5 * time.Second)
+	limited.Infof("too early")
+	clock.Add(5 * time.Second)
+	limited.Infof("refilled")
+	clock.Add(time.Hour)
+	limited.Infof("after an hour")
+
+	var msgs []interface{}
+	for _, e := range readLines(t, path) {
+		msgs = append(msgs, e["msg"])
+		if e["msg"] == "suppressed 4 similar entries" && (e["suppressed"] != float64(4) || e["level"] != "info") {
+			t.Errorf("unexpected summary %v", e)
+		}
+	}
+	expect := []interface{}{"poll 0", "poll 1", "unlimited", "suppressed 4 similar entries", "refilled", "after an hour"}
+	if len(msgs) != len(expect) {
+		t.Fatalf("expect %v, get %v", expect, msgs)
+	}
+	for i := range expect {
+		if msgs[i] != expect[i] {
+			t.Errorf("expect %v, get %v", expect, msgs)
+			break
+		}
+	}
+}
+
+func TestRateLimiterConcurrent(t *testing.T) {
+	r := &rateLimiter{interval: time.Minute, burst: 5}
+	now := time.Now()
+	var allowed int32
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if ok, _ := r.allow(now); ok {
+					atomic.AddInt32(&allowed, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if allowed != 5 {
+		t.Errorf("expect 5 allowed, get %d", allowed)
+	}
+	if ok, n := r.allow(now.Add(time.Minute)); !ok || n != 795 {
+		t.Errorf("expect 795 suppressed, get %v, %d", ok, n)
+	}
+}
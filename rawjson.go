@@ -0,0 +1,123 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// InvalidJSONKey is added to entries with a RawJSON field which isn't valid
+const InvalidJSONKey = "invalid_json"
+
+// rawJSON is embedded in JSON outputs as it is
+type rawJSON []byte
+
+// MarshalJSON implements json.Marshaler
+func (r rawJSON) MarshalJSON() ([]byte, error) {
+	return r, nil
+}
+
+// invalidJSON is the data of RawJSON which isn't valid
+type invalidJSON []byte
+
+// RawJSON returns a field embedding data, which is already serialized JSON,
+// as a JSON value instead of an escaped string. Data which isn't valid is
+// logged as a string with InvalidJSONKey set to true. Console outputs and
+// data longer than max_field_bytes get a string as well
+func RawJSON(key string, data []byte) Field {
+	if !json.Valid(data) {
+		return zap.Reflect(key, invalidJSON(data))
+	}
+	return zap.Reflect(key, rawJSON(data))
+}
+
+// rawJSONCore turns RawJSON fields into strings where they can't be embedded
+// The strings are truncated by max_field_bytes here, since the sanitizing
+// core sees RawJSON fields before they're converted
+type rawJSONCore struct {
+	zapcore.Core
+	console       bool
+	maxFieldBytes int
+}
+
+// newRawJSONCore returns a rawJSONCore of core
+func newRawJSONCore(core zapcore.Core, console bool, maxFieldBytes int) zapcore.Core {
+	return &rawJSONCore{Core: core, console: console, maxFieldBytes: maxFieldBytes}
+}
+
+// With implements zapcore.Core
+func (r *rawJSONCore) With(fields []zapcore.Field) zapcore.Core {
+	return &rawJSONCore{
+		Core:          r.Core.With(r.fields(fields)),
+		console:       r.console,
+		maxFieldBytes: r.maxFieldBytes,
+	}
+}
+
+// Check implements zapcore.Core
+func (r *rawJSONCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if r.Enabled(ent.Level) {
+		return ce.AddCore(ent, r)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (r *rawJSONCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return r.Core.Write(ent, r.fields(fields))
+}
+
+// fields converts RawJSON fields, copying the slice only when needed
+func (r *rawJSONCore) fields(fields []zapcore.Field) []zapcore.Field {
+	copied := false
+	invalid := false
+	for i, f := range fields {
+		if f.Type != zapcore.ReflectType {
+			continue
+		}
+		v := f.Interface
+		if safe, ok := v.(safeJSON); ok {
+			v = safe.v
+		}
+		var s string
+		switch v := v.(type) {
+		case rawJSON:
+			if !r.console && (r.maxFieldBytes <= 0 || len(v) <= r.maxFieldBytes) {
+				continue
+			}
+			s = string(v)
+		case invalidJSON:
+			s = string(v)
+			invalid = true
+		default:
+			continue
+		}
+		if !copied {
+			fields = append(make([]zapcore.Field, 0, len(fields)+1), fields...)
+			copied = true
+		}
+		if r.maxFieldBytes > 0 && len(s) > r.maxFieldBytes {
+			s = truncateField(s, r.maxFieldBytes)
+		}
+		fields[i] = zap.String(f.Key, s)
+	}
+	if invalid {
+		fields = append(fields, zap.Bool(InvalidJSONKey, true))
+	}
+	return fields
+}
@@ -0,0 +1,98 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRawJSON(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+
+	k.Infos("object", RawJSON("raw", []byte(`{"a":1,"b":[true,null]}`)))
+	k.WithFields(RawJSON("raw", []byte(`[1, "two"]`))).InfoS("array")
+	k.Infos("invalid", RawJSON("raw", []byte(`{"a":`)))
+
+	entries := readLines(t, path)
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries, get %d", len(entries))
+	}
+	object := map[string]interface{}{"a": float64(1), "b": []interface{}{true, nil}}
+	if !reflect.DeepEqual(entries[0]["raw"], object) {
+		t.Errorf("expect an embedded object, get %v", entries[0]["raw"])
+	}
+	if !reflect.DeepEqual(entries[1]["raw"], []interface{}{float64(1), "two"}) {
+		t.Errorf("expect an embedded array, get %v", entries[1]["raw"])
+	}
+	if entries[2]["raw"] != `{"a":` || entries[2][InvalidJSONKey] != true {
+		t.Errorf("expect invalid json as a string, get %v", entries[2])
+	}
+	for _, e := range entries[:2] {
+		if _, ok := e[InvalidJSONKey]; ok {
+			t.Errorf("unexpected %s in %v", InvalidJSONKey, e)
+		}
+	}
+}
+
+func TestRawJSONMaxFieldBytes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.AddSync(buf), zapcore.DebugLevel)
+	logger := zap.New(newRawJSONCore(core, false, 8))
+
+	logger.Info("short", RawJSON("raw", []byte(`[1,2]`)))
+	logger.Info("long", RawJSON("raw", []byte(`[1,2,3,4,5,6]`)))
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 entries, get %d", len(entries))
+	}
+	if !reflect.DeepEqual(entries[0]["raw"], []interface{}{float64(1), float64(2)}) {
+		t.Errorf("expect an embedded array, get %v", entries[0]["raw"])
+	}
+	if expect := `[1,2,3,4` + truncatedFieldSuffix(5); entries[1]["raw"] != expect {
+		t.Errorf("expect %q, get %v", expect, entries[1]["raw"])
+	}
+}
+
+func TestRawJSONConsole(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoderConfig := zap.NewDevelopmentEncoderConfig()
+	encoderConfig.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), zapcore.AddSync(buf), zapcore.DebugLevel)
+	logger := zap.New(newRawJSONCore(core, true, 0))
+
+	logger.With(RawJSON("raw", []byte(`{"a":1}`))).Info("console")
+	logger.Info("invalid", RawJSON("raw", []byte(`nope`)))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines, get %q", buf.String())
+	}
+	if !strings.Contains(lines[0], `{"raw": "{\"a\":1}"}`) {
+		t.Errorf("expect raw json as a string, get %q", lines[0])
+	}
+	if !strings.Contains(lines[1], `{"raw": "nope", "invalid_json": true}`) {
+		t.Errorf("expect invalid json with %s, get %q", InvalidJSONKey, lines[1])
+	}
+}
@@ -0,0 +1,179 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Reconfigure rebuilds the outputs of the global logger from the current
+// config, so that flags parsed after Singleton take effect. Loggers derived
+// by WithFields and so on are updated as well. It calls Singleton if it has
+// not been called yet. The changed settings are logged, see EffectiveConfig
+func Reconfigure() error {
+	var err error
+	built := true
+	once.Do(func() {
+		built = false
+		err = setup()
+	})
+	if !built {
+		return err
+	}
+	l, clamped, err := klogger.config.reconfigure()
+	if err != nil {
+		return err
+	}
+	klogger.warnConfig(l, clamped)
+	klogger.logConfigChanges()
+	return nil
+}
+
+// newLogger builds a logger whose core can be swapped by reconfigure
+func (c *Config) newLogger() (*zap.Logger, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	zlogger, err := c.buildFirst()
+	if err != nil {
+		return nil, err
+	}
+	c.core = newSwapCore(zlogger.Core())
+	return zlogger.WithOptions(zap.WrapCore(func(zapcore.Core) zapcore.Core {
+		return c.core
+	})), nil
+}
+
+// replaceEarly builds the core of the logger of init, replays the entries
+// logged before Singleton into it and swaps it in
+func (c *Config) replaceEarly() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	zlogger, err := c.buildFirst()
+	if err != nil {
+		return err
+	}
+	c.early.replay(zlogger.Core())
+	c.core.swap(zlogger.Core())
+	return nil
+}
+
+// buildFirst builds the logger for the first time
+func (c *Config) buildFirst() (*zap.Logger, error) {
+	if c.buildInfo == nil {
+		c.buildInfo = readBuildInfo()
+	}
+	c.zapConfig = c.newZapConfig()
+	return c.build()
+}
+
+// reconfigure builds a new core and swaps it in, then closes the old sinks
+// Entries being written to the old sinks when they are closed go to stderr
+func (c *Config) reconfigure() (Level, bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.core == nil {
+		return 0, false, errors.New("klog: the logger is not built by Singleton")
+	}
+
+	l, clamped := c.clampLevel()
+	c.zapConfig = c.newZapConfig()
+	old := c.sinks.detach()
+	zlogger, err := c.build()
+	if err != nil {
+		// build closed the sinks it opened
+		c.sinks.attach(old)
+		return l, clamped, err
+	}
+	c.core.swap(zlogger.Core())
+	return l, clamped, closeSinks(context.Background(), old, func() {})
+}
+
+// coreGen is a core built by reconfigure
+type coreGen struct {
+	core zapcore.Core
+	gen  uint64
+}
+
+// swapCore forwards to the latest core built by reconfigure
+type swapCore struct {
+	root   *atomic.Value
+	fields []zapcore.Field
+	// root core with fields, rebuilt once per generation
+	cache atomic.Value
+}
+
+// newSwapCore returns a swapCore forwarding to core
+func newSwapCore(core zapcore.Core) *swapCore {
+	root := &atomic.Value{}
+	root.Store(&coreGen{core: core})
+	return &swapCore{root: root}
+}
+
+// swap replaces the root core
+func (s *swapCore) swap(core zapcore.Core) {
+	gen := s.root.Load().(*coreGen).gen
+	s.root.Store(&coreGen{core: core, gen: gen + 1})
+}
+
+// current returns the latest core with the fields of s
+func (s *swapCore) current() zapcore.Core {
+	root := s.root.Load().(*coreGen)
+	if len(s.fields) == 0 {
+		return root.core
+	}
+	if c, ok := s.cache.Load().(*coreGen); ok && c.gen == root.gen {
+		return c.core
+	}
+	core := root.core.With(s.fields)
+	s.cache.Store(&coreGen{core: core, gen: root.gen})
+	return core
+}
+
+// Enabled implements zapcore.Core
+func (s *swapCore) Enabled(lvl zapcore.Level) bool {
+	return s.current().Enabled(lvl)
+}
+
+// With implements zapcore.Core
+func (s *swapCore) With(fields []zapcore.Field) zapcore.Core {
+	all := make([]zapcore.Field, 0, len(s.fields)+len(fields))
+	all = append(all, s.fields...)
+	child := &swapCore{
+		root:   s.root,
+		fields: append(all, fields...),
+	}
+	child.current()
+	return child
+}
+
+// Check implements zapcore.Core, the current core adds itself to ce
+func (s *swapCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return s.current().Check(ent, ce)
+}
+
+// Write implements zapcore.Core
+func (s *swapCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return s.current().Write(ent, fields)
+}
+
+// Sync implements zapcore.Core
+func (s *swapCore) Sync() error {
+	return s.current().Sync()
+}
@@ -0,0 +1,100 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// redirectStdout points os.Stdout to a file in dir
+func redirectStdout(t *testing.T, dir, name string) string {
+	f, err := os.Create(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Stdout = f
+	return f.Name()
+}
+
+func TestReconfigure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stdout := os.Stdout
+	defer func() { os.Stdout = stdout }()
+
+	c := newConfig()
+	c.alsologtostderr.set(false)
+	first := redirectStdout(t, dir, "first.log")
+	zlogger, err := c.newLogger()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+	child := k.WithFields("A", 1)
+	k.Info("before")
+	k.V(2).Info("disabled")
+
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+				child.Info("in flight")
+			}
+		}
+	}()
+
+	second := redirectStdout(t, dir, "second.log")
+	c.level.set(2)
+	if _, _, err := c.reconfigure(); err != nil {
+		t.Fatal(err)
+	}
+	close(stop)
+	wg.Wait()
+	k.V(2).Info("after")
+	child.Info("child")
+
+	b, _ := ioutil.ReadFile(first)
+	if s := string(b); !strings.Contains(s, "before") || strings.Contains(s, "disabled") || strings.Contains(s, "after") {
+		t.Errorf("unexpected old output: %s", s)
+	}
+	b, _ = ioutil.ReadFile(second)
+	s := string(b)
+	if strings.Contains(s, "before") || !strings.Contains(s, `"msg":"after"`) || !strings.Contains(s, `"msg":"child","A":1`) {
+		t.Errorf("unexpected new output: %s", s)
+	}
+	if !strings.Contains(s, "reconfigure_test.go") {
+		t.Errorf("caller is lost: %s", s)
+	}
+}
+
+func TestReconfigureNotBuilt(t *testing.T) {
+	if _, _, err := newConfig().reconfigure(); err == nil {
+		t.Error("expect error for a logger not built by Singleton")
+	}
+}
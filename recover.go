@@ -0,0 +1,146 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"runtime"
+	"strconv"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// PanicKey holds the value recovered by Recover
+	PanicKey = "panic"
+	// recoveredMsg is the message of the entries of Recover
+	recoveredMsg = "recovered from panic"
+)
+
+// Recover logs a panic at ERROR with the panic value, the stack and kv, then
+// panics again with the same value. Defer it directly, e.g.
+// defer klog.Recover("job", name)
+func Recover(kv ...interface{}) {
+	if r := recover(); r != nil {
+		klogger.recovered(r, kv)
+		panic(r)
+	}
+}
+
+// Recover logs a panic at ERROR with the panic value, the stack and kv, then
+// panics again with the same value. Defer it directly
+func (k *Klogger) Recover(kv ...interface{}) {
+	if r := recover(); r != nil {
+		k.recovered(r, kv)
+		panic(r)
+	}
+}
+
+// RecoverAndContinue logs a panic like Recover, but lets the function of the
+// deferred call return normally
+func RecoverAndContinue(kv ...interface{}) {
+	if r := recover(); r != nil {
+		klogger.recovered(r, kv)
+	}
+}
+
+// RecoverAndContinue logs a panic like Recover, but lets the function of the
+// deferred call return normally
+func (k *Klogger) RecoverAndContinue(kv ...interface{}) {
+	if r := recover(); r != nil {
+		k.recovered(r, kv)
+	}
+}
+
+// GoSafe runs fn in a goroutine, a panic of which is logged and recovered
+func GoSafe(fn func()) {
+	klogger.GoSafe(fn)
+}
+
+// GoSafe runs fn in a goroutine, a panic of which is logged and recovered
+func (k *Klogger) GoSafe(fn func()) {
+	go func() {
+		defer k.RecoverAndContinue()
+		fn()
+	}()
+}
+
+// recovered writes the entry of a recovered panic r, whose stack is the
+// whole stack of the goroutine
+func (k *Klogger) recovered(r interface{}, kv []interface{}) {
+	buf := make([]byte, 64<<10)
+	k.logPanic(r, kv, string(buf[:runtime.Stack(buf, false)]))
+}
+
+// logPanic writes the entry of a recovered panic r, whose caller is where it
+// panicked
+func (k *Klogger) logPanic(r interface{}, kv []interface{}, stack string) {
+	ce := k.sugar.Desugar().Check(zapcore.ErrorLevel, recoveredMsg)
+	if ce == nil {
+		return
+	}
+	if caller, ok := panicCaller(); ok {
+		ce.Entry.Caller = caller
+	}
+	ce.Entry.Stack = stack
+	fields := k.errorFields(nil, recoveredMsg, kv)
+	ce.Write(append(fields, zap.Any(PanicKey, r))...)
+}
+
+// panicStack formats the stack from the frame calling panic, like the
+// stacktraces of zap
+func panicStack() string {
+	pcs := make([]uintptr, 128)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	var b strings.Builder
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		} else if panicking && (b.Len() > 0 || !strings.HasPrefix(frame.Function, "runtime.")) {
+			if b.Len() > 0 {
+				b.WriteByte('\n')
+			}
+			b.WriteString(frame.Function)
+			b.WriteString("\n\t")
+			b.WriteString(frame.File)
+			b.WriteByte(':')
+			b.WriteString(strconv.Itoa(frame.Line))
+		}
+		if !more {
+			return b.String()
+		}
+	}
+}
+
+// panicCaller returns the frame calling panic, or failing in the runtime
+func panicCaller() (zapcore.EntryCaller, bool) {
+	pcs := make([]uintptr, 64)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	panicking := false
+	for {
+		frame, more := frames.Next()
+		if frame.Function == "runtime.gopanic" {
+			panicking = true
+		} else if panicking && !strings.HasPrefix(frame.Function, "runtime.") {
+			return zapcore.NewEntryCaller(frame.PC, frame.File, frame.Line, true), true
+		}
+		if !more {
+			return zapcore.EntryCaller{}, false
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRecover(t *testing.T) {
+	k, buf := newTestLogger()
+	// GoSafe logs after fn returns, the hook tells when
+	logged := make(chan struct{}, 3)
+	k = k.WithOptions(zap.Hooks(func(zapcore.Entry) error {
+		logged <- struct{}{}
+		return nil
+	}))
+	defer swapLogger(k)()
+
+	r := catchPanic(func() {
+		defer Recover("job", "sync")
+		panic("boom")
+	})
+	if r != "boom" {
+		t.Errorf("expect the panic to be rethrown, get %v", r)
+	}
+
+	continued := false
+	func() {
+		defer func() { continued = true }()
+		defer k.RecoverAndContinue("job", "cleanup")
+		var m map[string]int
+		m["nil"]++
+	}()
+	if !continued {
+		t.Error("expect RecoverAndContinue to return normally")
+	}
+
+	GoSafe(func() {
+		panic("in goroutine")
+	})
+	for i := 0; i < 3; i++ {
+		<-logged
+	}
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries, get %v", entries)
+	}
+	expects := []map[string]interface{}{
+		{"job": "sync", PanicKey: "boom"},
+		{"job": "cleanup", PanicKey: "assignment to entry in nil map"},
+		{PanicKey: "in goroutine"},
+	}
+	for i, expect := range expects {
+		e := entries[i]
+		if e["level"] != "error" || e["msg"] != recoveredMsg {
+			t.Errorf("entry %d: unexpected %v", i, e)
+		}
+		for key, val := range expect {
+			if e[key] != val {
+				t.Errorf("entry %d: expect %s to be %v, get %v", i, key, val, e[key])
+			}
+		}
+		if caller, _ := e["caller"].(string); !strings.Contains(caller, "/recover_test.go:") {
+			t.Errorf("entry %d: expect the panicking line as the caller, get %q", i, caller)
+		}
+		stack, _ := e["stacktrace"].(string)
+		if !strings.Contains(stack, "panic") || !strings.Contains(stack, "recover_test.go") {
+			t.Errorf("entry %d: expect the whole stack, get %q", i, stack)
+		}
+	}
+}
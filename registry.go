@@ -0,0 +1,296 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// LoggerOverrides are the settings of a logger of GetLogger, which can be
+// loaded from config files. Unset ones are inherited from the parent logger,
+// e.g. "a" of "a.b", or the global config
+type LoggerOverrides struct {
+	// V replaces v for V() of the logger
+	V *Level `json:"v,omitempty"`
+	// MinSeverity is one of info, warning and error. It can only raise
+	// log_level, like WithMinSeverity
+	MinSeverity string `json:"min_severity,omitempty"`
+	// OutputPaths receive the entries of the logger besides the outputs
+	OutputPaths []string `json:"outputs,omitempty"`
+}
+
+// loggers is the registry of GetLogger
+var loggers = &loggerRegistry{nodes: make(map[string]*loggerNode)}
+
+// loggerRegistry holds the named loggers, the settings are guarded by mu
+type loggerRegistry struct {
+	mu    sync.Mutex
+	nodes map[string]*loggerNode
+}
+
+// loggerNode is a name of the registry
+type loggerNode struct {
+	name   string
+	parent *loggerNode
+	logger *Klogger
+
+	// set by ConfigureLogger
+	own      LoggerOverrides
+	severity zapcore.Level
+	out      zapcore.Core
+
+	// *loggerState inherited from the parents
+	state atomic.Value
+}
+
+// loggerState is the effective settings of a node
+type loggerState struct {
+	v           Level
+	hasV        bool
+	severity    zapcore.Level
+	hasSeverity bool
+	out         zapcore.Core
+	outputs     []string
+}
+
+// v returns the level set for the node
+func (n *loggerNode) v() (Level, bool) {
+	s := n.state.Load().(*loggerState)
+	return s.v, s.hasV
+}
+
+// node returns the node of name, creating it and its parents if needed
+func (r *loggerRegistry) node(name string) *loggerNode {
+	if n, ok := r.nodes[name]; ok {
+		return n
+	}
+	n := &loggerNode{name: name}
+	if i := strings.LastIndex(name, "."); i > 0 {
+		n.parent = r.node(name[:i])
+	}
+	r.nodes[name] = n
+	n.refresh()
+	return n
+}
+
+// refresh computes the state of n from the nearest settings
+func (n *loggerNode) refresh() {
+	s := &loggerState{}
+	for p := n; p != nil; p = p.parent {
+		if !s.hasV && p.own.V != nil {
+			s.v, s.hasV = *p.own.V, true
+		}
+		if !s.hasSeverity && p.own.MinSeverity != "" {
+			s.severity, s.hasSeverity = p.severity, true
+		}
+		if s.out == nil && p.out != nil {
+			s.out, s.outputs = p.out, p.own.OutputPaths
+		}
+	}
+	n.state.Store(s)
+}
+
+// GetLogger returns the logger of name, which is created on the first call
+// and logged as "logger". Dots make a hierarchy: "a.b" inherits the settings
+// of "a" set by ConfigureLogger. It calls Singleton
+func GetLogger(name string) *Klogger {
+	return loggers.get(Singleton(), name)
+}
+
+// get returns the logger of name derived from k
+func (r *loggerRegistry) get(k *Klogger, name string) *Klogger {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.node(name)
+	if n.logger == nil {
+		child := k.Named(name)
+		child.sugar = child.sugar.Desugar().WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return &namedCore{Core: core, node: n}
+		})).Sugar()
+		child.node = n
+		n.logger = child
+	}
+	return n.logger
+}
+
+// ConfigureLogger sets the settings of the logger of name and its children
+// It takes effect at once, on the loggers already returned by GetLogger too
+func ConfigureLogger(name string, o LoggerOverrides) error {
+	if err := loggers.configure(klogger.config, name, o); err != nil {
+		return err
+	}
+	klogger.logConfigChanges()
+	return nil
+}
+
+// configure implements ConfigureLogger, outputs are opened by c
+func (r *loggerRegistry) configure(c *Config, name string, o LoggerOverrides) error {
+	var severity zapcore.Level
+	if o.MinSeverity != "" {
+		var err error
+		if severity, err = parseSeverity(o.MinSeverity); err != nil {
+			return err
+		}
+	}
+	if o.V != nil && *o.V < MinLevel {
+		return fmt.Errorf("invalid level %d of logger %q: expect no less than %d", *o.V, name, MinLevel)
+	}
+	var out zapcore.Core
+	if len(o.OutputPaths) > 0 {
+		var err error
+		if out, err = c.namedOutput(o.OutputPaths); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	n := r.node(name)
+	n.own, n.severity, n.out = o, severity, out
+	for _, node := range r.nodes {
+		node.refresh()
+	}
+	return nil
+}
+
+// namedOutput opens the outputs of a logger of GetLogger
+func (c *Config) namedOutput(paths []string) (zapcore.Core, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	sink, err := c.sinks.open(paths...)
+	if err != nil {
+		return nil, err
+	}
+	return zapcore.NewCore(c.newEncoder(), sink, c.severity.level), nil
+}
+
+// Named returns a logger whose entries are logged with name as "logger"
+func Named(name string) *Klogger {
+	return klogger.Named(name)
+}
+
+// Named returns a logger whose entries are logged with name as "logger",
+// appended to the name of k after a dot
+func (k *Klogger) Named(name string) *Klogger {
+	return k.derive(k.sugar.Named(name))
+}
+
+// namedCore applies the settings of a node to the entries
+type namedCore struct {
+	zapcore.Core
+	node *loggerNode
+	// added by With, for the outputs of the node
+	fields []zapcore.Field
+}
+
+// Enabled implements zapcore.Core
+func (c *namedCore) Enabled(l zapcore.Level) bool {
+	s := c.node.state.Load().(*loggerState)
+	if s.hasSeverity && l < s.severity {
+		return false
+	}
+	return c.Core.Enabled(l) || (s.out != nil && s.out.Enabled(l))
+}
+
+// With implements zapcore.Core
+func (c *namedCore) With(fields []zapcore.Field) zapcore.Core {
+	all := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	all = append(all, c.fields...)
+	return &namedCore{Core: c.Core.With(fields), node: c.node, fields: append(all, fields...)}
+}
+
+// Check implements zapcore.Core
+func (c *namedCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	s := c.node.state.Load().(*loggerState)
+	if s.hasSeverity && ent.Level < s.severity {
+		return ce
+	}
+	ce = c.Core.Check(ent, ce)
+	if s.out != nil {
+		out := s.out
+		if len(c.fields) > 0 {
+			out = out.With(c.fields)
+		}
+		ce = out.Check(ent, ce)
+	}
+	return ce
+}
+
+// overrides returns the settings of ConfigureLogger by name
+func (r *loggerRegistry) overrides() map[string]LoggerOverrides {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var m map[string]LoggerOverrides
+	for name, n := range r.nodes {
+		if n.own.V == nil && n.own.MinSeverity == "" && len(n.own.OutputPaths) == 0 {
+			continue
+		}
+		if m == nil {
+			m = make(map[string]LoggerOverrides)
+		}
+		m[name] = n.own
+	}
+	return m
+}
+
+// loggerInfo is the effective settings of a logger listed by LoggersHandler
+type loggerInfo struct {
+	Name        string   `json:"name"`
+	V           Level    `json:"v"`
+	MinSeverity string   `json:"min_severity"`
+	Outputs     []string `json:"outputs,omitempty"`
+}
+
+// LoggersHandler serves the loggers of GetLogger, and their parents, with
+// the effective settings as a JSON array sorted by name
+func LoggersHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(loggers.list(klogger.config))
+	})
+}
+
+// list returns the effective settings of the loggers, falling back to global
+func (r *loggerRegistry) list(global *Config) []loggerInfo {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	infos := make([]loggerInfo, 0, len(r.nodes))
+	for name, n := range r.nodes {
+		s := n.state.Load().(*loggerState)
+		info := loggerInfo{Name: name, V: global.level.get(), MinSeverity: global.severity.String(), Outputs: s.outputs}
+		if s.hasV {
+			info.V = s.v
+		}
+		if s.hasSeverity {
+			info.MinSeverity = severityName(s.severity)
+		}
+		infos = append(infos, info)
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name < infos[j].Name })
+	return infos
+}
@@ -0,0 +1,101 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGetLogger(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	r := &loggerRegistry{nodes: make(map[string]*loggerNode)}
+
+	storage := r.get(k, "storage")
+	blob := r.get(k, "storage.blob")
+	if r.get(k, "storage.blob") != blob {
+		t.Error("expect the logger to be memoized")
+	}
+	other := r.get(k, "net")
+
+	v := Level(3)
+	if err := r.configure(k.config, "storage", LoggerOverrides{V: &v}); err != nil {
+		t.Fatal(err)
+	}
+	if !storage.V(3).Enabled() || !blob.WithFields("a", 1).V(3).Enabled() || other.V(1).Enabled() {
+		t.Error("expect V(3) of storage and its children only")
+	}
+
+	blobOutput := filepath.Join(filepath.Dir(path), "blob.log")
+	err := r.configure(k.config, "storage.blob", LoggerOverrides{MinSeverity: "warning", OutputPaths: []string{blobOutput}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob.Infof("dropped")
+	blob.V(3).Infof("dropped too")
+	blob.WithFields("id", 7).Warningf("blob warning")
+	storage.V(3).Infof("storage verbose")
+	other.Infof("net info")
+
+	// reconfiguring the parent at runtime
+	if err := r.configure(k.config, "storage", LoggerOverrides{}); err != nil {
+		t.Fatal(err)
+	}
+	if storage.V(3).Enabled() {
+		t.Error("expect V(3) to be disabled after reconfiguring")
+	}
+
+	var msgs []interface{}
+	for _, e := range readLines(t, path) {
+		msgs = append(msgs, e["msg"])
+	}
+	if expect := []interface{}{"blob warning", "storage verbose", "net info"}; !reflect.DeepEqual(msgs, expect) {
+		t.Errorf("expect %v, get %v", expect, msgs)
+	}
+	entries := readLines(t, blobOutput)
+	if len(entries) != 1 || entries[0]["msg"] != "blob warning" || entries[0]["id"] != float64(7) || entries[0]["logger"] != "storage.blob" {
+		t.Errorf("unexpected entries of the blob output %v", entries)
+	}
+
+	expect := []loggerInfo{
+		{Name: "net", V: 0, MinSeverity: "info"},
+		{Name: "storage", V: 0, MinSeverity: "info"},
+		{Name: "storage.blob", V: 0, MinSeverity: "warning", Outputs: []string{blobOutput}},
+	}
+	if infos := r.list(k.config); !reflect.DeepEqual(infos, expect) {
+		t.Errorf("expect %+v, get %+v", expect, infos)
+	}
+
+	if err := r.configure(k.config, "x", LoggerOverrides{MinSeverity: "loud"}); err == nil {
+		t.Error("expect an error for invalid severity")
+	}
+}
+
+func TestLoggersHandler(t *testing.T) {
+	w := httptest.NewRecorder()
+	LoggersHandler().ServeHTTP(w, httptest.NewRequest("GET", "/loggers", nil))
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("unexpected response %d %v", w.Code, w.Header())
+	}
+	w = httptest.NewRecorder()
+	LoggersHandler().ServeHTTP(w, httptest.NewRequest("PUT", "/loggers", nil))
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expect 405, get %d", w.Code)
+	}
+}
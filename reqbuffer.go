@@ -0,0 +1,182 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// ReplayedKey is true on the entries written by FlushBuffer
+	ReplayedKey = "replayed"
+	// DroppedKey holds the count of buffered entries dropped by the bounds
+	DroppedKey = "dropped"
+	// maxBufferedEntries and maxBufferedBytes bound a request buffer, the
+	// oldest entries are dropped beyond them
+	maxBufferedEntries = 1000
+	maxBufferedBytes   = 1 << 20
+	// fieldOverhead is the rough size of a field besides its key and string
+	fieldOverhead = 16
+)
+
+// bufferedEntry is an entry held by a request buffer, along with the core
+// having the fields of the logger
+type bufferedEntry struct {
+	core   zapcore.Core
+	ent    zapcore.Entry
+	fields []zapcore.Field
+	size   int
+}
+
+// requestBuffer holds the V() entries of a logger of NewRequestBuffer
+type requestBuffer struct {
+	mu         sync.Mutex
+	entries    []bufferedEntry
+	bytes      int
+	dropped    int
+	maxEntries int
+	maxBytes   int
+}
+
+// add holds an entry, dropping the oldest ones beyond the bounds
+func (b *requestBuffer) add(e bufferedEntry) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries = append(b.entries, e)
+	b.bytes += e.size
+	n := 0
+	for len(b.entries)-n > b.maxEntries || (b.bytes > b.maxBytes && len(b.entries)-n > 1) {
+		b.bytes -= b.entries[n].size
+		b.entries[n] = bufferedEntry{}
+		n++
+	}
+	if n > 0 {
+		b.entries = b.entries[n:]
+		b.dropped += n
+	}
+}
+
+// take empties the buffer, returning the entries and the count of dropped
+func (b *requestBuffer) take() ([]bufferedEntry, int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	entries, dropped := b.entries, b.dropped
+	b.entries, b.bytes, b.dropped = nil, 0, 0
+	return entries, dropped
+}
+
+// entrySize approximates the encoded size of an entry
+func entrySize(ent zapcore.Entry, fields []zapcore.Field) int {
+	n := len(ent.Message) + len(ent.Stack)
+	for _, f := range fields {
+		n += len(f.Key) + len(f.String) + fieldOverhead
+	}
+	return n
+}
+
+// bufferCore holds the DEBUG entries in a request buffer, others pass
+type bufferCore struct {
+	zapcore.Core
+	buffer *requestBuffer
+}
+
+// Enabled implements zapcore.Core
+func (c *bufferCore) Enabled(l zapcore.Level) bool {
+	return l == zapcore.DebugLevel || c.Core.Enabled(l)
+}
+
+// With implements zapcore.Core
+func (c *bufferCore) With(fields []zapcore.Field) zapcore.Core {
+	return &bufferCore{Core: c.Core.With(fields), buffer: c.buffer}
+}
+
+// Check implements zapcore.Core
+func (c *bufferCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level == zapcore.DebugLevel {
+		return ce.AddCore(ent, c)
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// Write implements zapcore.Core, it's only called for DEBUG entries
+func (c *bufferCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	c.buffer.add(bufferedEntry{
+		core:   c.Core,
+		ent:    ent,
+		fields: append([]zapcore.Field(nil), fields...),
+		size:   entrySize(ent, fields),
+	})
+	return nil
+}
+
+// NewRequestBuffer returns a logger whose V() entries are enabled, but held
+// in memory until FlushBuffer writes them to parent, or DiscardBuffer drops
+// them, e.g. to log the details of failed requests only. At most 1000
+// entries or about 1MB are held, the oldest ones are dropped beyond it.
+// Other entries are written at once. Loggers derived from it share the buffer
+func NewRequestBuffer(parent *Klogger) *Klogger {
+	b := &requestBuffer{maxEntries: maxBufferedEntries, maxBytes: maxBufferedBytes}
+	child := parent.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &bufferCore{Core: core, buffer: b}
+	}))
+	child.verbosity = parent.config.maxLevel.get()
+	child.minSeverity = zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l == zapcore.DebugLevel || parent.severityEnabled(l)
+	})
+	child.buffer = b
+	return child
+}
+
+// FlushBuffer writes the entries held by the logger of NewRequestBuffer to
+// its parent at level, with their original time and "replayed":true. The
+// count of dropped entries is logged ahead of them. It does nothing if k is
+// not buffered
+// They're written to the cores under the buffer, which would hold them again
+// at DEBUG
+func (k *Klogger) FlushBuffer(level zapcore.Level) {
+	if k.buffer == nil {
+		return
+	}
+	entries, dropped := k.buffer.take()
+	if dropped > 0 && len(entries) > 0 {
+		ent := zapcore.Entry{
+			Level:      level,
+			Time:       time.Now(),
+			LoggerName: entries[0].ent.LoggerName,
+			Message:    "dropped buffered entries",
+		}
+		if ce := entries[0].core.Check(ent, nil); ce != nil {
+			ce.Write(zap.Int(DroppedKey, dropped))
+		}
+	}
+	for _, e := range entries {
+		e.ent.Level = level
+		if ce := e.core.Check(e.ent, nil); ce != nil {
+			ce.Write(append(e.fields, zap.Bool(ReplayedKey, true))...)
+		}
+	}
+}
+
+// DiscardBuffer drops the entries held by the logger of NewRequestBuffer. It
+// does nothing if k is not buffered
+func (k *Klogger) DiscardBuffer() {
+	if k.buffer != nil {
+		k.buffer.take()
+	}
+}
@@ -0,0 +1,174 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestRequestBufferDiscard(t *testing.T) {
+	k, buf := newTestLogger()
+	b := NewRequestBuffer(k.WithFields("req", 1))
+	b.V(3).Infof("detail %d", 1)
+	b.Infof("not buffered")
+	if k.V(3).Enabled() {
+		t.Fatal("expect V(3) of the parent disabled")
+	}
+	lines := decodeLines(t, buf)
+	if len(lines) != 1 || lines[0]["msg"] != "not buffered" {
+		t.Fatalf("expect only the info entry, got %v", lines)
+	}
+	b.DiscardBuffer()
+	b.FlushBuffer(zapcore.InfoLevel)
+	if lines := decodeLines(t, buf); len(lines) != 1 {
+		t.Errorf("expect discarded entries not flushed, got %v", lines)
+	}
+	// no-ops on a logger without a buffer
+	k.FlushBuffer(zapcore.InfoLevel)
+	k.DiscardBuffer()
+}
+
+func TestRequestBufferFlush(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.RFC3339NanoTimeEncoder
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.AddSync(buf), zapcore.InfoLevel)
+	k := &Klogger{
+		sugar:  zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1)).Sugar(),
+		config: newConfig(),
+	}
+
+	b := NewRequestBuffer(k).WithFields("req", 1)
+	b.V(2).Infow("detail", "n", 1)
+	b.WithFields("step", "b").V(5).Info("more")
+	logged := time.Now()
+	time.Sleep(10 * time.Millisecond)
+	if buf.Len() != 0 {
+		t.Fatalf("expect entries buffered, got %s", buf)
+	}
+
+	b.FlushBuffer(zapcore.WarnLevel)
+	lines := decodeLines(t, buf)
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 replayed entries, got %v", lines)
+	}
+	for i, msg := range []string{"detail", "more"} {
+		line := lines[i]
+		if line["msg"] != msg || line["level"] != "warn" || line[ReplayedKey] != true || line["req"] != float64(1) {
+			t.Errorf("unexpected replayed entry %v", line)
+		}
+		ts, err := time.Parse(time.RFC3339Nano, line["ts"].(string))
+		if err != nil || ts.After(logged) {
+			t.Errorf("expect the original time before %v, got %v", logged, line["ts"])
+		}
+	}
+	if lines[0]["n"] != float64(1) || lines[1]["step"] != "b" {
+		t.Errorf("expect fields kept, got %v", lines)
+	}
+
+	buf.Reset()
+	b.FlushBuffer(zapcore.WarnLevel)
+	if buf.Len() != 0 {
+		t.Errorf("expect the buffer emptied by flush, got %s", buf)
+	}
+}
+
+func TestRequestBufferBounds(t *testing.T) {
+	k, buf := newTestLogger()
+	b := NewRequestBuffer(k)
+	b.buffer.maxEntries = 3
+	for i := 0; i < 5; i++ {
+		b.V(1).Infof("entry %d", i)
+	}
+	b.FlushBuffer(zapcore.InfoLevel)
+	lines := decodeLines(t, buf)
+	if len(lines) != 4 || lines[0][DroppedKey] != float64(2) {
+		t.Fatalf("expect the dropped count and 3 entries, got %v", lines)
+	}
+	for i, line := range lines[1:] {
+		if want := "entry " + string(rune('2'+i)); line["msg"] != want {
+			t.Errorf("expect the newest entries kept, got %v", line["msg"])
+		}
+	}
+
+	// flushed at DEBUG, they're not held again
+	buf.Reset()
+	for i := 0; i < 5; i++ {
+		b.V(1).Infof("entry %d", i)
+	}
+	b.FlushBuffer(zapcore.DebugLevel)
+	if lines := decodeLines(t, buf); len(lines) != 4 || lines[0][DroppedKey] != float64(2) || lines[0]["level"] != "debug" {
+		t.Fatalf("expect the dropped count and 3 entries at debug, got %v", lines)
+	}
+	if n := len(b.buffer.entries); n != 0 {
+		t.Errorf("expect the buffer emptied by flush, got %d entries", n)
+	}
+
+	buf.Reset()
+	b.buffer.maxEntries = maxBufferedEntries
+	b.buffer.maxBytes = 100
+	for i := 0; i < 10; i++ {
+		b.V(1).Infow("entry", "payload", "0123456789")
+	}
+	if n := len(b.buffer.entries); n == 0 || b.buffer.bytes > 100 {
+		t.Errorf("expect the bytes bounded, got %d entries of %d bytes", n, b.buffer.bytes)
+	}
+	b.DiscardBuffer()
+	if b.buffer.dropped != 0 || b.buffer.bytes != 0 {
+		t.Error("expect the buffer reset by discard")
+	}
+}
+
+func TestBufferVerboseMiddleware(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	handler := NewTraceMiddleware(BufferVerbose(500))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		l := FromContext(r.Context())
+		l.V(4).Infof("detail of %s", r.URL.Path)
+		switch r.URL.Path {
+		case "/fail":
+			w.WriteHeader(http.StatusInternalServerError)
+		case "/panic":
+			panic("boom")
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	for _, path := range []string{"/ok", "/fail", "/panic"} {
+		func() {
+			defer func() { recover() }()
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		}()
+	}
+
+	lines := decodeLines(t, buf)
+	if len(lines) != 2 {
+		t.Fatalf("expect the entries of failed requests, got %v", lines)
+	}
+	for i, path := range []string{"/fail", "/panic"} {
+		line := lines[i]
+		if line["msg"] != "detail of "+path || line["level"] != "info" || line[ReplayedKey] != true || line[TraceIDKey] == nil {
+			t.Errorf("unexpected entry %v", line)
+		}
+	}
+}
@@ -0,0 +1,88 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import "go.uber.org/zap"
+
+// ReservedKeyPrefix is prepended to fields named like the keys of the
+// encoder, e.g. "msg" is logged as "fields.msg", see log_reserved_keys
+const ReservedKeyPrefix = "fields."
+
+// defaultReservedKeys are the keys of loggers not built from flags
+var defaultReservedKeys = func() []string {
+	c := newConfig()
+	c.zapConfig = c.newZapConfig()
+	return c.encoderKeys()
+}()
+
+// validReservedKeyPolicy reports whether policy is supported by
+// log_reserved_keys
+func validReservedKeyPolicy(policy string) bool {
+	switch policy {
+	case "rename", "drop":
+		return true
+	}
+	return false
+}
+
+// encoderKeys returns the keys written by the encoder of c.zapConfig
+func (c *Config) encoderKeys() []string {
+	ec := c.zapConfig.EncoderConfig
+	switch c.zapConfig.Encoding {
+	case "gcp":
+		ec = gcpEncoderConfig(ec)
+	case "ecs":
+		ec = ecsEncoderConfig(ec)
+	}
+	var keys []string
+	for _, key := range []string{ec.MessageKey, ec.LevelKey, ec.TimeKey, ec.NameKey, ec.CallerKey, ec.StacktraceKey} {
+		if key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// isReserved reports whether key collides with the keys of the encoder
+func (c *Config) isReserved(key string) bool {
+	keys := defaultReservedKeys
+	if v, ok := c.reservedKeys.Load().([]string); ok {
+		keys = v
+	}
+	for _, reserved := range keys {
+		if key == reserved {
+			return true
+		}
+	}
+	return false
+}
+
+// reserveKey applies log_reserved_keys to a field named like the keys of the
+// encoder, false means the field is dropped. A warning is logged once per key
+func (k *Klogger) reserveKey(key string) (string, bool) {
+	c := k.config
+	if !c.isReserved(key) {
+		return key, true
+	}
+	k.misuse("reserved key in fields", zap.String("key", key))
+	if _, warned := c.warnedKeys.LoadOrStore(key, struct{}{}); !warned {
+		k.internal().sugar.Desugar().Warn("field named like a key of the encoder",
+			zap.String("key", key), zap.String("policy", c.reservedPolicy.get()))
+	}
+	if c.reservedPolicy.get() == "drop" {
+		return "", false
+	}
+	return ReservedKeyPrefix + key, true
+}
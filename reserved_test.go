@@ -0,0 +1,90 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReservedKeys(t *testing.T) {
+	for _, key := range []string{"msg", "level", "time", "caller", "logger", "stacktrace"} {
+		k, buf := newTestLogger()
+		k.InfoS("kv", key, "a")
+		k.WithFields(key, "b").Infof("fields")
+		k.With(map[string]string{key: "c"}).Infof("map")
+
+		entries := decodeLines(t, buf)
+		if len(entries) != 4 {
+			t.Fatalf("expect a warning and 3 entries for %s, get %v", key, entries)
+		}
+		if entries[0]["msg"] != "field named like a key of the encoder" || entries[0]["key"] != key {
+			t.Errorf("expect a warning for %s, get %v", key, entries[0])
+		}
+		for i, val := range []string{"a", "b", "c"} {
+			e := entries[i+1]
+			if e[ReservedKeyPrefix+key] != val {
+				t.Errorf("expect %s to be renamed, get %v", key, e)
+			}
+		}
+		if entries[1]["msg"] != "kv" || entries[1]["level"] != "info" {
+			t.Errorf("expect the keys of the encoder to be kept, get %v", entries[1])
+		}
+	}
+}
+
+func TestReservedKeyDrop(t *testing.T) {
+	k, buf := newTestLogger()
+	k.config.reservedPolicy.set("drop")
+	k.InfoS("kv", "msg", "a", "b", 1)
+	k.With(map[string]int{"level": 1}).Infof("map")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 4 {
+		t.Fatalf("expect 2 warnings and 2 entries, get %v", entries)
+	}
+	if e := entries[1]; e["msg"] != "kv" || e["b"] != float64(1) || e["fields.msg"] != nil {
+		t.Errorf("expect msg to be dropped, get %v", e)
+	}
+	if e := entries[3]; e["level"] != "info" || e["fields.level"] != nil {
+		t.Errorf("expect level to be dropped, get %v", e)
+	}
+}
+
+func TestEncoderKeys(t *testing.T) {
+	for format, expect := range map[string][]string{
+		"json": {"msg", "level", "time", "logger", "caller", "stacktrace"},
+		"ecs":  {"message", "log.level", "@timestamp", "log.logger"},
+	} {
+		c := newConfig()
+		c.format.set(format)
+		c.zapConfig = c.newZapConfig()
+		if keys := c.encoderKeys(); !reflect.DeepEqual(keys, expect) {
+			t.Errorf("expect keys %v of %s, get %v", expect, format, keys)
+		}
+	}
+
+	c := newConfig()
+	c.format.set("gcp")
+	c.zapConfig = c.newZapConfig()
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer zlogger.Sync()
+	if !c.isReserved("severity") || c.isReserved("level") {
+		t.Errorf("expect the keys of gcp to be reserved after build, get %v", c.reservedKeys.Load())
+	}
+}
@@ -0,0 +1,175 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// maxRecentEntryBytes caps the size of an entry kept in memory
+const maxRecentEntryBytes = 4096
+
+// Entry is a recent entry kept in memory
+type Entry struct {
+	Time    time.Time
+	Level   zapcore.Level
+	Message string
+	// Line is the encoded entry including fields
+	Line string
+}
+
+// ring is a fixed-size circular buffer of entries
+type ring struct {
+	enc zapcore.Encoder
+
+	mu      sync.Mutex
+	entries []Entry
+	next    int
+	full    bool
+}
+
+// newRing returns a ring keeping the newest size entries
+func newRing(size int, enc zapcore.Encoder) *ring {
+	return &ring{
+		enc:     enc,
+		entries: make([]Entry, size),
+	}
+}
+
+// add encodes and keeps an entry, overwriting the oldest one
+func (r *ring) add(enc zapcore.Encoder, ent zapcore.Entry, fields []zapcore.Field) error {
+	buf, err := enc.EncodeEntry(ent, fields)
+	if err != nil {
+		return err
+	}
+	line := strings.TrimSuffix(truncateString(buf.String(), maxRecentEntryBytes), "\n")
+	buf.Free()
+
+	r.mu.Lock()
+	r.entries[r.next] = Entry{
+		Time:    ent.Time,
+		Level:   ent.Level,
+		Message: truncateString(ent.Message, maxRecentEntryBytes),
+		Line:    line,
+	}
+	r.next++
+	if r.next == len(r.entries) {
+		r.next, r.full = 0, true
+	}
+	r.mu.Unlock()
+	return nil
+}
+
+// suppressed keeps a verbose entry which is not written to outputs
+func (r *ring) suppressed(msg string, fields []zapcore.Field) {
+	r.add(r.enc, zapcore.Entry{
+		Level:   zapcore.DebugLevel,
+		Time:    time.Now(),
+		Message: msg,
+	}, fields)
+}
+
+// recent returns a copy of the entries, from the oldest to the newest
+func (r *ring) recent() []Entry {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !r.full {
+		return append([]Entry(nil), r.entries[:r.next]...)
+	}
+	out := make([]Entry, 0, len(r.entries))
+	out = append(out, r.entries[r.next:]...)
+	return append(out, r.entries[:r.next]...)
+}
+
+// ringCore records every entry into a ring regardless of level
+type ringCore struct {
+	enc  zapcore.Encoder
+	ring *ring
+}
+
+// Enabled implements zapcore.Core
+func (c *ringCore) Enabled(zapcore.Level) bool {
+	return true
+}
+
+// With implements zapcore.Core
+func (c *ringCore) With(fields []zapcore.Field) zapcore.Core {
+	enc := c.enc.Clone()
+	for _, f := range fields {
+		f.AddTo(enc)
+	}
+	return &ringCore{enc: enc, ring: c.ring}
+}
+
+// Check implements zapcore.Core
+func (c *ringCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, c)
+}
+
+// Write implements zapcore.Core
+func (c *ringCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.ring.add(c.enc, ent, fields)
+}
+
+// Sync implements zapcore.Core
+func (c *ringCore) Sync() error {
+	return nil
+}
+
+// DumpRecent returns the recent entries, including suppressed verbose ones
+// It returns nil unless --recent_entries is set
+func DumpRecent() []Entry {
+	if r := klogger.config.recent(); r != nil {
+		return r.recent()
+	}
+	return nil
+}
+
+// recent returns the ring of recent_entries, nil if it's not set
+func (c *Config) recent() *ring {
+	r, _ := c.ring.Load().(*ring)
+	return r
+}
+
+// dumpRecent writes the recent entries to the dump output
+func (c *Config) dumpRecent() {
+	r := c.recent()
+	if r == nil {
+		return
+	}
+	var w io.Writer = os.Stderr
+	if c.recentDumpPath.get() != "" && c.recentDumpPath.get() != "stderr" {
+		f, err := os.OpenFile(c.recentDumpPath.get(), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "klog: failed dumping recent entries: %v\n", err)
+		} else {
+			defer f.Close()
+			w = f
+		}
+	}
+
+	entries := r.recent()
+	fmt.Fprintf(w, "----- klog: %d recent entries -----\n", len(entries))
+	for _, e := range entries {
+		fmt.Fprintln(w, e.Line)
+	}
+}
@@ -0,0 +1,115 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// newRingLogger builds a logger keeping n recent entries without any output
+func newRingLogger(t *testing.T, n int) *Klogger {
+	c := newConfig()
+	c.recentEntries.set(n)
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = nil
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Klogger{sugar: zlogger.Sugar(), config: c}
+}
+
+func TestRecentEntries(t *testing.T) {
+	defer swapLogger(newRingLogger(t, 3))()
+
+	Info("first")
+	WithFields("A", 1).Info("second")
+	V(2).Infof("suppressed %d", 3)
+	Warning("fourth")
+	V(2).InfoS("suppressed-s", "B", 2)
+
+	entries := DumpRecent()
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries, get %d", len(entries))
+	}
+	expects := []struct {
+		msg   string
+		level zapcore.Level
+		line  string
+	}{
+		{"suppressed 3", zapcore.DebugLevel, `"msg":"suppressed 3"`},
+		{"fourth", zapcore.WarnLevel, `ring_test.go:`},
+		{"suppressed-s", zapcore.DebugLevel, `"B":2`},
+	}
+	for i, e := range expects {
+		if entries[i].Message != e.msg || entries[i].Level != e.level || !strings.Contains(entries[i].Line, e.line) {
+			t.Errorf("entry %d: expect %v, get %+v", i, e, entries[i])
+		}
+	}
+}
+
+func TestRecentEntriesCapped(t *testing.T) {
+	defer swapLogger(newRingLogger(t, 2))()
+
+	Info(strings.Repeat("a", 2*maxRecentEntryBytes))
+	if e := DumpRecent()[0]; len(e.Message) != maxRecentEntryBytes || len(e.Line) > maxRecentEntryBytes {
+		t.Errorf("entry should be capped, get %d bytes", len(e.Line))
+	}
+}
+
+func TestRecentEntriesDumpOnFatal(t *testing.T) {
+	k := newRingLogger(t, 10)
+	defer swapLogger(k)()
+	f, err := ioutil.TempFile("", "klog-dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+	k.config.recentDumpPath.set(f.Name())
+
+	code := 0
+	exitFunc = func(c int) { code = c }
+	defer func() { exitFunc = os.Exit }()
+
+	V(3).Info("before-fatal")
+	Fatalf("fatal %s", "error")
+	if code != 255 {
+		t.Errorf("expect exit code 255, get %d", code)
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 3 || !strings.Contains(lines[0], "2 recent entries") ||
+		!strings.Contains(lines[1], "before-fatal") || !strings.Contains(lines[2], "fatal error") {
+		t.Errorf("unexpected dump: %s", data)
+	}
+}
+
+func TestRecentEntriesDisabled(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+	V(3).Info("suppressed")
+	if DumpRecent() != nil {
+		t.Errorf("recent entries should be disabled by default")
+	}
+}
@@ -0,0 +1,449 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// backupTimeLayout suffixes the name of a rotated file
+	backupTimeLayout = "20060102-150405.000000"
+	// partialSuffix marks a backup being compressed
+	partialSuffix = ".gz.partial"
+	megabyte      = 1 << 20
+	// rotateRetryInterval is how long a file is appended to after a failed
+	// rotation before it's retried
+	rotateRetryInterval = 10 * time.Second
+)
+
+// rotateOptions controls rotation of log_file, zero means unlimited
+type rotateOptions struct {
+	// rotates once the file would exceed maxSize bytes
+	maxSize int64
+	// gzips rotated files
+	compress bool
+	// deletes rotated files older than maxAge
+	maxAge time.Duration
+	// deletes the oldest rotated files beyond maxTotalSize bytes
+	maxTotalSize int64
+	// rotates at midnight as well
+	daily bool
+	// buffers writes in bufferSize bytes, which are written to the file
+	// every flushInterval, 0 means unbuffered
+	bufferSize    int
+	flushInterval time.Duration
+	// fsyncs the file periodically besides Sync
+	fsyncInterval time.Duration
+}
+
+// rotateOptions converts the flags in MB into bytes
+func (c *Config) rotateOptions() rotateOptions {
+	return rotateOptions{
+		maxSize:       int64(c.logFileMaxSize.get()) * megabyte,
+		compress:      c.logFileCompress.get(),
+		maxAge:        c.logFileMaxAge.get(),
+		maxTotalSize:  int64(c.logFileMaxTotalSize.get()) * megabyte,
+		daily:         c.logFileDaily.get(),
+		bufferSize:    c.logFileBufferSize.get(),
+		flushInterval: c.logFlushFrequency.get(),
+		fsyncInterval: c.logFsyncInterval.get(),
+	}
+}
+
+// rotatingFile renames the file with a timestamp suffix when it's full
+// Compression and retention of the rotated files run in the background by
+// maintain, which is woken up by each rotation, and writes buffered entries
+// and fsyncs the file periodically as well
+// If name is set, each rotation opens a new file named by it instead, and
+// link is pointed to the newest file
+type rotatingFile struct {
+	path string
+	opts rotateOptions
+	now  func() time.Time
+	name func(time.Time) string
+	link string
+	// where failed rotations are reported, stderr if nil
+	errorOutput io.Writer
+
+	mu   sync.Mutex
+	file *os.File
+	buf  *bufio.Writer
+	size int64
+	// rotation is retried after failing, not before
+	retryAt time.Time
+	opened  time.Time
+	rotated chan struct{}
+	closed  chan struct{}
+}
+
+// openRotatingFile opens path for appending
+func openRotatingFile(path string, opts rotateOptions) (*rotatingFile, error) {
+	r := rotatingFileOf(path, opts)
+	if err := r.open(r.now()); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// rotatingFileOf returns a rotatingFile of path without opening it
+func rotatingFileOf(path string, opts rotateOptions) *rotatingFile {
+	return &rotatingFile{
+		path:    path,
+		opts:    opts,
+		now:     time.Now,
+		rotated: make(chan struct{}, 1),
+		closed:  make(chan struct{}),
+	}
+}
+
+// open opens a new file or appends to the existing one at t
+func (r *rotatingFile) open(t time.Time) error {
+	r.opened = t
+	if r.name != nil {
+		r.path = filepath.Join(filepath.Dir(r.path), r.name(t))
+	}
+	if err := os.MkdirAll(filepath.Dir(r.path), 0755); err != nil {
+		return err
+	}
+	if err := r.reopen(); err != nil {
+		return err
+	}
+	if r.link != "" {
+		relink(r.link, filepath.Base(r.path))
+	}
+	return nil
+}
+
+// reopen appends to the file of the current path
+func (r *rotatingFile) reopen() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.attach(f, info.Size())
+	return nil
+}
+
+// attach writes to f of size from now on
+func (r *rotatingFile) attach(f *os.File, size int64) {
+	r.file, r.size = f, size
+	if r.opts.bufferSize > 0 {
+		if r.buf == nil {
+			r.buf = bufio.NewWriterSize(f, r.opts.bufferSize)
+		} else {
+			r.buf.Reset(f)
+		}
+	}
+}
+
+// relink points link to target atomically, failures are ignored since
+// links are only for convenience
+func relink(link, target string) {
+	tmp := link + ".tmp"
+	os.Remove(tmp)
+	if err := os.Symlink(target, tmp); err != nil {
+		return
+	}
+	if err := os.Rename(tmp, link); err != nil {
+		os.Remove(tmp)
+	}
+}
+
+// Write implements zapcore.WriteSyncer
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	full := r.opts.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.opts.maxSize
+	if full || r.opts.daily {
+		if now := r.now(); (full || !sameDay(r.opened, now)) && !now.Before(r.retryAt) {
+			if err := r.rotate(now); err != nil {
+				// the entry is appended to the current file instead
+				r.retryAt = now.Add(rotateRetryInterval)
+				r.report(err)
+			}
+		}
+	}
+	if r.file == nil {
+		select {
+		case <-r.closed:
+			return 0, os.ErrClosed
+		default:
+		}
+		if err := r.reopen(); err != nil {
+			return 0, err
+		}
+	}
+	var n int
+	var err error
+	if r.buf != nil {
+		n, err = r.buf.Write(p)
+	} else {
+		n, err = r.file.Write(p)
+	}
+	r.size += int64(n)
+	return n, err
+}
+
+// sameDay tells whether a and b are in the same local day
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// rotate renames the current file and opens a new one at now. If it fails,
+// the current path is opened again, so that writes go on there
+func (r *rotatingFile) rotate(now time.Time) error {
+	path, opened := r.path, r.opened
+	err := r.close()
+	if err == nil && r.name == nil {
+		err = os.Rename(r.path, r.path+"."+now.Format(backupTimeLayout))
+	}
+	if err == nil {
+		err = r.open(now)
+	}
+	if err != nil {
+		r.path, r.opened = path, opened
+		// reopened on the next write if it fails again
+		r.reopen()
+		return err
+	}
+	select {
+	case r.rotated <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// report writes a failed rotation to errorOutput
+func (r *rotatingFile) report(err error) {
+	var w io.Writer = os.Stderr
+	if r.errorOutput != nil {
+		w = r.errorOutput
+	}
+	fmt.Fprintf(w, "%v klog: failed rotating %s, appending to it: %v\n", r.now(), r.path, err)
+}
+
+// Sync implements zapcore.WriteSyncer, it writes the buffered entries and
+// fsyncs the file
+func (r *rotatingFile) Sync() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.file == nil {
+		return os.ErrClosed
+	}
+	if err := r.flush(); err != nil {
+		return err
+	}
+	return r.file.Sync()
+}
+
+// flush writes the buffered entries to the file
+func (r *rotatingFile) flush() error {
+	if r.buf == nil {
+		return nil
+	}
+	return r.buf.Flush()
+}
+
+// close flushes, fsyncs and closes the current file
+func (r *rotatingFile) close() error {
+	if r.file == nil {
+		return nil
+	}
+	defer func() { r.file = nil }()
+	err := r.flush()
+	if serr := r.file.Sync(); err == nil {
+		err = serr
+	}
+	if cerr := r.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Close closes the file and stops maintain
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	select {
+	case <-r.closed:
+		return nil
+	default:
+	}
+	close(r.closed)
+	return r.close()
+}
+
+// maintain compresses and deletes rotated files after each rotation, and
+// once at start to redo the work interrupted by a crash
+// Files named by name are kept as they are
+func (r *rotatingFile) maintain(stop <-chan struct{}) {
+	cleanup := r.name == nil && (r.opts.compress || r.opts.maxAge > 0 || r.opts.maxTotalSize > 0)
+	var flush, fsync <-chan time.Time
+	if r.opts.bufferSize > 0 && r.opts.flushInterval > 0 {
+		t := time.NewTicker(r.opts.flushInterval)
+		defer t.Stop()
+		flush = t.C
+	}
+	if r.opts.fsyncInterval > 0 {
+		t := time.NewTicker(r.opts.fsyncInterval)
+		defer t.Stop()
+		fsync = t.C
+	}
+	if !cleanup && flush == nil && fsync == nil {
+		return
+	}
+
+	if cleanup {
+		r.cleanup()
+	}
+	for {
+		select {
+		case <-r.rotated:
+			if cleanup {
+				r.cleanup()
+			}
+		case <-flush:
+			r.mu.Lock()
+			r.flush()
+			r.mu.Unlock()
+		case <-fsync:
+			r.Sync()
+		case <-r.closed:
+			return
+		case <-stop:
+			return
+		}
+	}
+}
+
+// backup is a rotated file
+type backup struct {
+	path string
+	time time.Time
+	size int64
+}
+
+// cleanup compresses the rotated files if enabled, then deletes those
+// beyond maxAge or maxTotalSize, the newest are kept
+func (r *rotatingFile) cleanup() {
+	dir, prefix := filepath.Dir(r.path), filepath.Base(r.path)+"."
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	names := make(map[string]bool, len(infos))
+	for _, info := range infos {
+		names[info.Name()] = true
+	}
+
+	var backups []backup
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		path := filepath.Join(dir, name)
+		if strings.HasSuffix(name, partialSuffix) {
+			// interrupted, the source is still there
+			os.Remove(path)
+			continue
+		}
+		t, err := time.ParseInLocation(backupTimeLayout, strings.TrimSuffix(name[len(prefix):], ".gz"), time.Local)
+		if err != nil {
+			continue
+		}
+		if r.opts.compress && !strings.HasSuffix(name, ".gz") {
+			if names[name+".gz"] {
+				// compressed, but the source was left
+				os.Remove(path)
+				continue
+			}
+			if err := compressFile(path); err != nil {
+				continue
+			}
+			path += ".gz"
+			if info, err = os.Stat(path); err != nil {
+				continue
+			}
+		}
+		backups = append(backups, backup{path: path, time: t, size: info.Size()})
+	}
+
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].time.After(backups[j].time)
+	})
+	var total int64
+	now := r.now()
+	for _, b := range backups {
+		total += b.size
+		if (r.opts.maxAge > 0 && now.Sub(b.time) > r.opts.maxAge) ||
+			(r.opts.maxTotalSize > 0 && total > r.opts.maxTotalSize) {
+			os.Remove(b.path)
+		}
+	}
+}
+
+// compressFile gzips path into path.gz and removes path, the output is
+// written to a partial file first so that a crash never leaves a broken .gz
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	partial := path + partialSuffix
+	dst, err := os.OpenFile(partial, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if err == nil {
+		err = dst.Sync()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(partial, path+".gz")
+	}
+	if err != nil {
+		os.Remove(partial)
+		return err
+	}
+	return os.Remove(path)
+}
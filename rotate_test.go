@@ -0,0 +1,335 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newRotatingFile opens a rotated file in a temp dir, whose clock ticks a
+// second on each call
+func newRotatingFile(t *testing.T, opts rotateOptions) *rotatingFile {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := openRotatingFile(filepath.Join(dir, "app.log"), opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	r.now = func() time.Time {
+		now = now.Add(time.Second)
+		return now
+	}
+	return r
+}
+
+// listDir returns the sorted names in dir
+func listDir(t *testing.T, dir string) []string {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, info := range infos {
+		names = append(names, info.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+// gunzip returns the content of a gzip file
+func gunzip(t *testing.T, path string) string {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotate(t *testing.T) {
+	r := newRotatingFile(t, rotateOptions{maxSize: 20})
+	defer removeDir(r.path)
+	defer r.Close()
+
+	for _, line := range []string{"first line\n", "second line\n", "third\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	names := listDir(t, filepath.Dir(r.path))
+	expect := []string{"app.log", "app.log.20200102-030406.000000"}
+	if strings.Join(names, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expect %v, get %v", expect, names)
+	}
+	if b, _ := ioutil.ReadFile(r.path); string(b) != "second line\nthird\n" {
+		t.Errorf("unexpected content %q", b)
+	}
+}
+
+func TestRotateFailure(t *testing.T) {
+	r := newRotatingFile(t, rotateOptions{maxSize: 20})
+	defer removeDir(r.path)
+	defer r.Close()
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.Local)
+	r.now = func() time.Time { return now }
+	errOut := &bytes.Buffer{}
+	r.errorOutput = errOut
+
+	// a directory in the way of the backup fails the rename
+	backup := r.path + "." + now.Format(backupTimeLayout)
+	if err := os.MkdirAll(filepath.Join(backup, "busy"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{"first line\n", "second line\n", "third\n"} {
+		if _, err := r.Write([]byte(line)); err != nil {
+			t.Fatalf("expect appending after a failed rotation, get %v", err)
+		}
+	}
+	if b, _ := ioutil.ReadFile(r.path); string(b) != "first line\nsecond line\nthird\n" {
+		t.Errorf("unexpected content %q", b)
+	}
+	if strings.Count(errOut.String(), "failed rotating") != 1 {
+		t.Errorf("expect the failure reported once, get %q", errOut.String())
+	}
+
+	// retried after the interval
+	os.RemoveAll(backup)
+	now = now.Add(rotateRetryInterval)
+	if _, err := r.Write([]byte("fourth\n")); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(r.path); string(b) != "fourth\n" {
+		t.Errorf("expect rotated, get %q", b)
+	}
+	rotated := r.path + "." + now.Format(backupTimeLayout)
+	if b, _ := ioutil.ReadFile(rotated); string(b) != "first line\nsecond line\nthird\n" {
+		t.Errorf("unexpected backup %q", b)
+	}
+}
+
+func TestRotateCleanup(t *testing.T) {
+	r := newRotatingFile(t, rotateOptions{maxSize: 8, compress: true, maxTotalSize: 200})
+	defer removeDir(r.path)
+	defer r.Close()
+
+	for i := 0; i < 6; i++ {
+		r.Write([]byte(strings.Repeat("x", 60) + "\n"))
+	}
+	r.cleanup()
+	names := listDir(t, filepath.Dir(r.path))
+	// 2 of 5 backups fit in 200 bytes after compression
+	if len(names) != 3 {
+		t.Fatalf("expect the oldest backups to be deleted, get %v", names)
+	}
+	for _, name := range names[1:] {
+		if !strings.HasSuffix(name, ".gz") {
+			t.Errorf("expect %s to be compressed", name)
+		}
+	}
+	newest := names[len(names)-1]
+	if newest != "app.log.20200102-030410.000000.gz" {
+		t.Fatalf("expect the newest backup kept, get %v", names)
+	}
+	if s := gunzip(t, filepath.Join(filepath.Dir(r.path), newest)); s != strings.Repeat("x", 60)+"\n" {
+		t.Errorf("unexpected content %q", s)
+	}
+}
+
+func TestRotateMaxAge(t *testing.T) {
+	r := newRotatingFile(t, rotateOptions{maxSize: 1, maxAge: 90 * time.Second})
+	defer removeDir(r.path)
+	defer r.Close()
+
+	for i := 0; i < 4; i++ {
+		r.Write([]byte("x\n"))
+	}
+	// backups are 92s, 91s and 90s old
+	r.now = func() time.Time {
+		return time.Date(2020, 1, 2, 3, 5, 38, 0, time.Local)
+	}
+	r.cleanup()
+	names := listDir(t, filepath.Dir(r.path))
+	expect := []string{"app.log", "app.log.20200102-030408.000000"}
+	if strings.Join(names, ",") != strings.Join(expect, ",") {
+		t.Errorf("expect %v, get %v", expect, names)
+	}
+}
+
+func TestRotateRedoPartial(t *testing.T) {
+	r := newRotatingFile(t, rotateOptions{compress: true})
+	defer removeDir(r.path)
+	defer r.Close()
+
+	backup := r.path + ".20200102-030405.000000"
+	ioutil.WriteFile(backup, []byte("old\n"), 0644)
+	ioutil.WriteFile(backup+partialSuffix, []byte("broken"), 0644)
+	// a crash after renaming the .gz, before removing the source
+	done := r.path + ".20200101-030405.000000"
+	ioutil.WriteFile(done, []byte("done\n"), 0644)
+	if err := compressFile(done); err != nil {
+		t.Fatal(err)
+	}
+	ioutil.WriteFile(done, []byte("done\n"), 0644)
+
+	r.cleanup()
+	names := listDir(t, filepath.Dir(r.path))
+	expect := []string{"app.log", "app.log.20200101-030405.000000.gz", "app.log.20200102-030405.000000.gz"}
+	if strings.Join(names, ",") != strings.Join(expect, ",") {
+		t.Fatalf("expect %v, get %v", expect, names)
+	}
+	if s := gunzip(t, backup+".gz"); s != "old\n" {
+		t.Errorf("unexpected content %q", s)
+	}
+}
+
+func TestLogFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newConfig()
+	c.logFile.set(filepath.Join(dir, "app.log"))
+	c.logFileCompress.set(true)
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = nil
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+	k.Infof("hello")
+	// waits for maintain to stop
+	if err := k.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readLines(t, c.logFile.get())
+	if len(entries) == 0 || entries[len(entries)-1]["msg"] != "hello" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+}
+
+func TestRotateBuffer(t *testing.T) {
+	r := newRotatingFile(t, rotateOptions{bufferSize: 4096})
+	defer removeDir(r.path)
+	defer r.Close()
+
+	r.Write([]byte("buffered\n"))
+	// a crash here loses the entry
+	if b, _ := ioutil.ReadFile(r.path); len(b) != 0 {
+		t.Fatalf("expect nothing written, get %q", b)
+	}
+	if err := r.Sync(); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadFile(r.path); string(b) != "buffered\n" {
+		t.Errorf("unexpected content %q", b)
+	}
+}
+
+func TestRotateFlushDaemon(t *testing.T) {
+	for _, opts := range []rotateOptions{
+		{bufferSize: 4096, flushInterval: time.Millisecond},
+		// fsync writes the buffered entries as well
+		{bufferSize: 4096, fsyncInterval: time.Millisecond},
+	} {
+		r := newRotatingFile(t, opts)
+		stop := make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			r.maintain(stop)
+			close(done)
+		}()
+
+		r.Write([]byte("buffered\n"))
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			if b, _ := ioutil.ReadFile(r.path); string(b) == "buffered\n" {
+				break
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("buffered entries are not written with %+v", opts)
+			}
+			time.Sleep(time.Millisecond)
+		}
+		close(stop)
+		<-done
+		r.Close()
+		removeDir(r.path)
+	}
+}
+
+func TestRotateFlushBeforeRotation(t *testing.T) {
+	r := newRotatingFile(t, rotateOptions{maxSize: 20, bufferSize: 4096})
+	defer removeDir(r.path)
+
+	r.Write([]byte("first line\n"))
+	r.Write([]byte("second line\n"))
+	r.Close()
+	backup := r.path + ".20200102-030406.000000"
+	if b, _ := ioutil.ReadFile(backup); string(b) != "first line\n" {
+		t.Errorf("unexpected backup %q", b)
+	}
+	if b, _ := ioutil.ReadFile(r.path); string(b) != "second line\n" {
+		t.Errorf("expect Close to write buffered entries, get %q", b)
+	}
+}
+
+func BenchmarkRotatingFile(b *testing.B) {
+	line := []byte(`{"level":"info","time":"2020-01-02T03:04:05.000Z","msg":"benchmark"}` + "\n")
+	for _, size := range []int{0, 4096, 256 << 10} {
+		b.Run(fmt.Sprintf("buffer=%d", size), func(b *testing.B) {
+			dir, err := ioutil.TempDir("", "klog")
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			r, err := openRotatingFile(filepath.Join(dir, "app.log"), rotateOptions{bufferSize: size})
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer r.Close()
+
+			b.SetBytes(int64(len(line)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				r.Write(line)
+			}
+		})
+	}
+}
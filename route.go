@@ -0,0 +1,110 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RouteConfig is an output with its own format and level, written besides
+// the outputs, e.g. console to stderr for humans and json to a file
+type RouteConfig struct {
+	// Format is one of log_format, default to json
+	Format string `json:"format,omitempty"`
+	// MinSeverity is one of info, warning and error. It can only raise
+	// log_level, like WithMinSeverity
+	MinSeverity string `json:"min_severity,omitempty"`
+	// Outputs are paths like log_output
+	Outputs []string `json:"outputs"`
+}
+
+// SetRoutes replaces the routes, which take effect on Singleton or Reconfigure
+// Entries are sampled, suppressed and sanitized once for all of them
+func SetRoutes(routes ...RouteConfig) error {
+	return Configure(WithRoutes(routes...))
+}
+
+// validate checks the format, severity and outputs of r
+func (r RouteConfig) validate() error {
+	if r.Format != "" && !validFormat(r.Format) {
+		return fmt.Errorf("invalid format %q of route", r.Format)
+	}
+	if r.MinSeverity != "" {
+		if _, err := parseSeverity(r.MinSeverity); err != nil {
+			return err
+		}
+	}
+	if len(r.Outputs) == 0 {
+		return errors.New("klog: no outputs of route")
+	}
+	return nil
+}
+
+// humanStderrRoute is the route of log_human_stderr
+var humanStderrRoute = RouteConfig{Format: "console", Outputs: []string{"stderr"}}
+
+// allRoutes returns the routes set by SetRoutes and log_human_stderr
+func (c *Config) allRoutes() []RouteConfig {
+	if !c.humanStderr.get() {
+		return c.routes
+	}
+	return append(c.routes[:len(c.routes):len(c.routes)], humanStderrRoute)
+}
+
+// withoutStderr removes stderr from paths for log_human_stderr
+func withoutStderr(paths []string) []string {
+	kept := make([]string, 0, len(paths))
+	for _, path := range paths {
+		if path != "stderr" {
+			kept = append(kept, path)
+		}
+	}
+	return kept
+}
+
+// routeCore opens the outputs of r, written by the encoder of its format
+func (c *Config) routeCore(r RouteConfig) (zapcore.Core, error) {
+	journal, paths := splitJournalPaths(r.Outputs)
+	sink, err := c.sinks.open(paths...)
+	if err != nil {
+		return nil, err
+	}
+	encoding := r.Format
+	if encoding == "" {
+		encoding = "json"
+	}
+	enabled := zapcore.LevelEnabler(c.zapConfig.Level)
+	if r.MinSeverity != "" {
+		min, _ := parseSeverity(r.MinSeverity)
+		enabled = zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+			return l >= min && c.zapConfig.Level.Enabled(l)
+		})
+	}
+	enc := c.colorEncoderOf(encoding, r.Outputs)
+	core := zapcore.NewCore(enc, c.batch.wrap(sink), enabled)
+	if len(journal) > 0 {
+		journalCore, err := c.journalCore(journal, enc.Clone(), enabled)
+		if err != nil {
+			return nil, err
+		}
+		core = zapcore.NewTee(core, journalCore)
+	}
+	core = newLevelCore(core)
+	return newRawJSONCore(core, encoding == "console" || encoding == "dev", c.maxFieldBytes.get()), nil
+}
@@ -0,0 +1,106 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRoutes(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	machine := filepath.Join(dir, "machine.log")
+	human := filepath.Join(dir, "human.log")
+	warnings := filepath.Join(dir, "warnings.log")
+
+	c := newConfig()
+	c.seqField.set(true)
+	c.routes = []RouteConfig{
+		{Format: "console", Outputs: []string{human}},
+		{MinSeverity: "warning", Outputs: []string{warnings}},
+	}
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = []string{machine}
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k := &Klogger{sugar: zlogger.Sugar(), config: c}
+	k.InfoS("hello", "user", "u1")
+	k.Warningw("failed", "user", "u2")
+	k.sugar.Sync()
+
+	entries := readLines(t, machine)
+	if len(entries) != 2 || entries[0]["msg"] != "hello" || entries[0]["user"] != "u1" {
+		t.Fatalf("unexpected json entries %v", entries)
+	}
+	b, _ := ioutil.ReadFile(human)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 || strings.HasPrefix(lines[0], "{") {
+		t.Fatalf("expect 2 console lines, get %q", b)
+	}
+	if cols := strings.Split(lines[0], "\t"); len(cols) < 4 || cols[1] != "info" || cols[3] != "hello" || !strings.Contains(lines[0], `{"user": "u1", "seq": 1}`) {
+		t.Errorf("unexpected console line %q", lines[0])
+	}
+	entries = readLines(t, warnings)
+	if len(entries) != 1 || entries[0]["msg"] != "failed" || entries[0]["seq"] != 2.0 {
+		t.Errorf("expect the warning only, get %v", entries)
+	}
+}
+
+func TestHumanStderr(t *testing.T) {
+	c := newConfig()
+	c.humanStderr.set(true)
+	c.outputPaths.set([]string{"stderr", "stdout"})
+	if paths := c.newZapConfig().OutputPaths; !reflect.DeepEqual(paths, []string{"stdout"}) {
+		t.Errorf("expect stderr removed, get %v", paths)
+	}
+	c.routes = []RouteConfig{{Outputs: []string{"stdout"}}}
+	routes := c.allRoutes()
+	if len(routes) != 2 || !reflect.DeepEqual(routes[1], humanStderrRoute) || len(c.routes) != 1 {
+		t.Errorf("unexpected routes %v", routes)
+	}
+}
+
+func TestSetRoutes(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+	for _, r := range []RouteConfig{
+		{Format: "xml", Outputs: []string{"stderr"}},
+		{MinSeverity: "fatal", Outputs: []string{"stderr"}},
+		{Format: "console"},
+	} {
+		if err := SetRoutes(r); err == nil {
+			t.Errorf("expect error of %+v", r)
+		}
+	}
+	r := RouteConfig{Format: "console", MinSeverity: "warning", Outputs: []string{"stderr"}}
+	if err := SetRoutes(r); err != nil {
+		t.Fatal(err)
+	}
+	b, _ := json.Marshal(k.config.routes)
+	if string(b) != `[{"format":"console","min_severity":"warning","outputs":["stderr"]}]` {
+		t.Errorf("unexpected routes %s", b)
+	}
+}
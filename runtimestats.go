@@ -0,0 +1,103 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RuntimeStatsMsg is the message of the entries of StartRuntimeStatsLogger
+const RuntimeStatsMsg = "runtime_stats"
+
+// StartRuntimeStatsLogger logs the runtime stats every interval at
+// V(level), see Klogger.StartRuntimeStatsLogger
+func StartRuntimeStatsLogger(interval time.Duration, level Level) (stop func()) {
+	return klogger.StartRuntimeStatsLogger(interval, level)
+}
+
+// StartRuntimeStatsLogger logs a "runtime_stats" entry every interval at
+// V(level), with the fields:
+//   - goroutines: runtime.NumGoroutine
+//   - heap_alloc_bytes, heap_sys_bytes, heap_objects: the heap in use
+//   - gc_count, gc_pause_total_ns, gc_pause_last_ns: the GC cycles and pauses
+//   - open_fds: the open file descriptors, where /proc/self/fd exists
+//
+// Nothing is read while V(level) is disabled, since reading the memory stats
+// stops the world. It stops on the returned func or Close, a non-positive
+// interval logs nothing
+func (k *Klogger) StartRuntimeStatsLogger(interval time.Duration, level Level) (stop func()) {
+	done := make(chan struct{})
+	if interval <= 0 {
+		return func() {}
+	}
+	k.config.sinks.run(func(stop <-chan struct{}) {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if v := k.V(level); v.Enabled() {
+					v.InfoS(RuntimeStatsMsg, runtimeStats()...)
+				}
+			case <-done:
+				return
+			case <-stop:
+				return
+			}
+		}
+	})
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// runtimeStats returns the fields of a "runtime_stats" entry
+func runtimeStats() []interface{} {
+	var m runtime.MemStats
+	runtime.ReadMemStats(&m)
+	fields := []interface{}{
+		zap.Int("goroutines", runtime.NumGoroutine()),
+		zap.Uint64("heap_alloc_bytes", m.HeapAlloc),
+		zap.Uint64("heap_sys_bytes", m.HeapSys),
+		zap.Uint64("heap_objects", m.HeapObjects),
+		zap.Uint32("gc_count", m.NumGC),
+		zap.Uint64("gc_pause_total_ns", m.PauseTotalNs),
+		zap.Uint64("gc_pause_last_ns", m.PauseNs[(m.NumGC+255)%256]),
+	}
+	if n, ok := openFDs(); ok {
+		fields = append(fields, zap.Int("open_fds", n))
+	}
+	return fields
+}
+
+// openFDs counts the entries of /proc/self/fd, except the one reading it
+func openFDs() (int, bool) {
+	f, err := os.Open("/proc/self/fd")
+	if err != nil {
+		return 0, false
+	}
+	defer f.Close()
+	names, err := f.Readdirnames(-1)
+	if err != nil {
+		return 0, false
+	}
+	return len(names) - 1, true
+}
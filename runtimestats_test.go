@@ -0,0 +1,67 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestRuntimeStatsLogger(t *testing.T) {
+	k, buf := newTestLogger()
+	k.SetLevel(2)
+
+	disabled := k.StartRuntimeStatsLogger(time.Millisecond, 3)
+	time.Sleep(20 * time.Millisecond)
+	disabled()
+	if buf.Len() != 0 {
+		t.Fatalf("expect nothing logged at V(3), got %s", buf)
+	}
+
+	stop := k.StartRuntimeStatsLogger(5*time.Millisecond, 2)
+	defer stop()
+	time.Sleep(50 * time.Millisecond)
+	stop()
+	stop()
+	k.config.sinks.wg.Wait()
+
+	lines := decodeLines(t, buf)
+	if len(lines) == 0 {
+		t.Fatal("expect runtime stats logged")
+	}
+	keys := []string{"goroutines", "heap_alloc_bytes", "heap_sys_bytes", "heap_objects", "gc_count", "gc_pause_total_ns", "gc_pause_last_ns"}
+	if runtime.GOOS == "linux" {
+		keys = append(keys, "open_fds")
+	}
+	for _, line := range lines {
+		if line["msg"] != RuntimeStatsMsg || line["level"] != "debug" {
+			t.Errorf("unexpected entry %v", line)
+		}
+		for _, key := range keys {
+			if _, ok := line[key].(float64); !ok {
+				t.Errorf("expect %s in %v", key, line)
+			}
+		}
+	}
+
+	// stopped
+	buf.Reset()
+	time.Sleep(20 * time.Millisecond)
+	if buf.Len() != 0 {
+		t.Errorf("expect nothing logged after stop, got %s", buf)
+	}
+	k.StartRuntimeStatsLogger(0, 0)()
+}
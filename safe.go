@@ -0,0 +1,125 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// marshalFailedFormat replaces a value which fails to marshal
+const marshalFailedFormat = "!ERROR(marshal failed: %v)"
+
+// marshalFailed returns the replacement of a value failing with err
+func marshalFailed(err error) string {
+	return fmt.Sprintf(marshalFailedFormat, err)
+}
+
+// safely calls fn, a panic is returned as an error
+func safely(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return fn()
+}
+
+// safeJSON encodes v as zap does, a failure is encoded as the replacement
+// string so that the rest of the entry is still written
+type safeJSON struct {
+	v interface{}
+}
+
+// MarshalJSON implements json.Marshaler
+func (s safeJSON) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	err := safely(func() error {
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		return enc.Encode(s.v)
+	})
+	if err != nil {
+		return json.Marshal(marshalFailed(err))
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// safeObject recovers panics of an ObjectMarshaler, zap writes the error as
+// field keyError. The fields added before the failure are kept
+type safeObject struct {
+	m zapcore.ObjectMarshaler
+}
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (s safeObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	if err := safely(func() error { return s.m.MarshalLogObject(enc) }); err != nil {
+		return errors.New(marshalFailed(err))
+	}
+	return nil
+}
+
+// safeArray recovers panics of an ArrayMarshaler like safeObject
+type safeArray struct {
+	m zapcore.ArrayMarshaler
+}
+
+// MarshalLogArray implements zapcore.ArrayMarshaler
+func (s safeArray) MarshalLogArray(enc zapcore.ArrayEncoder) error {
+	if err := safely(func() error { return s.m.MarshalLogArray(enc) }); err != nil {
+		return errors.New(marshalFailed(err))
+	}
+	return nil
+}
+
+// safeStringer replaces a panicking String with the replacement string
+type safeStringer struct {
+	s fmt.Stringer
+}
+
+// String implements fmt.Stringer
+func (s safeStringer) String() (str string) {
+	if err := safely(func() error { str = s.s.String(); return nil }); err != nil {
+		return marshalFailed(err)
+	}
+	return str
+}
+
+// safeField wraps the values of f which run user code when encoded
+func safeField(f zapcore.Field) zapcore.Field {
+	switch f.Type {
+	case zapcore.ReflectType:
+		if _, ok := f.Interface.(safeJSON); !ok {
+			f.Interface = safeJSON{f.Interface}
+		}
+	case zapcore.ObjectMarshalerType:
+		if _, ok := f.Interface.(safeObject); !ok {
+			f.Interface = safeObject{f.Interface.(zapcore.ObjectMarshaler)}
+		}
+	case zapcore.ArrayMarshalerType:
+		if _, ok := f.Interface.(safeArray); !ok {
+			f.Interface = safeArray{f.Interface.(zapcore.ArrayMarshaler)}
+		}
+	case zapcore.StringerType:
+		if _, ok := f.Interface.(safeStringer); !ok {
+			f.Interface = safeStringer{f.Interface.(fmt.Stringer)}
+		}
+	}
+	return f
+}
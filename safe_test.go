@@ -0,0 +1,92 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+type failingJSON struct{}
+
+func (failingJSON) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("no json")
+}
+
+type panickingJSON struct{}
+
+func (panickingJSON) MarshalJSON() ([]byte, error) {
+	panic("boom")
+}
+
+type panickingObject struct{}
+
+func (panickingObject) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddString("before", "kept")
+	panic("boom")
+}
+
+type panickingStringer struct{}
+
+func (panickingStringer) String() string {
+	panic("boom")
+}
+
+func TestMarshalFailure(t *testing.T) {
+	k, buf := newTestLogger()
+
+	k.With(struct {
+		JSON     failingJSON
+		Stringer panickingStringer
+	}{}).InfoS("with", "ok", 1)
+	k.WithAll(struct{ C chan int }{make(chan int)}).InfoS("withAll")
+	k.InfoS("fields", "json", panickingJSON{}, zap.Object("obj", panickingObject{}), zap.Stringer("str", panickingStringer{}))
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 3 {
+		t.Fatalf("expect every entry written, get %v", entries)
+	}
+	for i, expect := range []map[string]string{
+		{"msg": "with", "JSON": "no json", "Stringer": "panic: boom"},
+		{"msg": "withAll", "": "unsupported type"},
+		{"msg": "fields", "json": "panic: boom", "objError": "panic: boom", "str": "panic: boom"},
+	} {
+		e := entries[i]
+		for key, want := range expect {
+			s, _ := e[key].(string)
+			if key != "msg" {
+				if !strings.HasPrefix(s, "!ERROR(marshal failed: ") || !strings.Contains(s, want) {
+					t.Errorf("expect %s replaced, get %v", key, e)
+				}
+			} else if s != want {
+				t.Errorf("expect %s, get %v", want, e)
+			}
+		}
+	}
+	if obj, _ := entries[2]["obj"].(map[string]interface{}); obj["before"] != "kept" {
+		t.Errorf("expect fields before the panic kept, get %v", entries[2])
+	}
+}
+
+func TestSafeJSON(t *testing.T) {
+	b, err := safeJSON{map[string]string{"a": "<b>"}}.MarshalJSON()
+	if err != nil || string(b) != `{"a":"<b>"}` {
+		t.Errorf("unexpected json %s %v", b, err)
+	}
+}
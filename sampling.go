@@ -0,0 +1,225 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// samplingTick is the period the sampling counters are reset
+	samplingTick = time.Second
+	// samplingCounters is the number of counters of a level, messages are
+	// hashed into them
+	samplingCounters = 4096
+)
+
+// samplingRule keeps the first Initial entries of a message per second, and
+// every Thereafter-th one after that, none if Thereafter is 0
+type samplingRule struct {
+	Initial    int `json:"initial"`
+	Thereafter int `json:"thereafter"`
+}
+
+// samplingRules are the rules of each level from DEBUG, nil is not sampled
+type samplingRules [numLevels]*samplingRule
+
+// defaultSampling samples entries below ERROR like zap production does
+func defaultSampling() samplingRules {
+	var rules samplingRules
+	rule := &samplingRule{Initial: 100, Thereafter: 100}
+	for l := zapcore.DebugLevel; l < zapcore.ErrorLevel; l++ {
+		rules[l-zapcore.DebugLevel] = rule
+	}
+	return rules
+}
+
+// parseSampling parses level:initial/thereafter pairs separated by commas,
+// e.g. info:100/100,debug:10/1000. Levels not listed are not sampled, and
+// an empty string or none disables sampling
+func parseSampling(s string) (samplingRules, error) {
+	var rules samplingRules
+	s = strings.TrimSpace(s)
+	if s == "" || s == "none" {
+		return rules, nil
+	}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		i, j := strings.IndexByte(item, ':'), strings.IndexByte(item, '/')
+		if i < 0 || j < i {
+			return rules, fmt.Errorf("invalid sampling %q: expect level:initial/thereafter", item)
+		}
+		var lvl zapcore.Level
+		if err := lvl.UnmarshalText([]byte(item[:i])); err != nil {
+			return rules, fmt.Errorf("invalid sampling %q: %v", item, err)
+		}
+		initial, err := strconv.Atoi(item[i+1 : j])
+		if err != nil || initial < 0 {
+			return rules, fmt.Errorf("invalid sampling %q: expect a non-negative initial", item)
+		}
+		thereafter, err := strconv.Atoi(item[j+1:])
+		if err != nil || thereafter < 0 {
+			return rules, fmt.Errorf("invalid sampling %q: expect a non-negative thereafter", item)
+		}
+		rules[lvl-zapcore.DebugLevel] = &samplingRule{Initial: initial, Thereafter: thereafter}
+	}
+	return rules, nil
+}
+
+// enabled reports whether any level is sampled
+func (r *samplingRules) enabled() bool {
+	for _, rule := range r {
+		if rule != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// String formats the rules as parseSampling accepts
+func (r *samplingRules) String() string {
+	var items []string
+	for i, rule := range r {
+		if rule != nil {
+			items = append(items, fmt.Sprintf("%s:%d/%d", zapcore.DebugLevel+zapcore.Level(i), rule.Initial, rule.Thereafter))
+		}
+	}
+	if len(items) == 0 {
+		return "none"
+	}
+	return strings.Join(items, ",")
+}
+
+// samplingValue holds the samplingRules of log_sampling
+type samplingValue struct {
+	v atomic.Value
+}
+
+// get returns the rules
+func (s *samplingValue) get() samplingRules {
+	r, _ := s.v.Load().(samplingRules)
+	return r
+}
+
+// set stores the rules
+func (s *samplingValue) set(r samplingRules) {
+	s.v.Store(r)
+}
+
+// String implements pflag.Value
+func (s *samplingValue) String() string {
+	r := s.get()
+	return r.String()
+}
+
+// Set implements pflag.Value
+func (s *samplingValue) Set(v string) error {
+	r, err := parseSampling(v)
+	if err != nil {
+		return err
+	}
+	s.set(r)
+	return nil
+}
+
+// Type implements pflag.Value
+func (s *samplingValue) Type() string {
+	return "sampling"
+}
+
+// SetSampling replaces the sampling rules, e.g. info:100/100,debug:10/1000,
+// which take effect on Singleton or Reconfigure
+func SetSampling(rules string) error {
+	return klogger.config.sampling.Set(rules)
+}
+
+// samplingCounter counts the entries of the messages hashed into it within
+// a tick, it's the counter of zap's sampler
+type samplingCounter struct {
+	resetAt int64
+	n       uint64
+}
+
+// inc increases the counter, or resets it if the tick is over
+func (c *samplingCounter) inc(t time.Time) uint64 {
+	now := t.UnixNano()
+	resetAt := atomic.LoadInt64(&c.resetAt)
+	if resetAt > now {
+		return atomic.AddUint64(&c.n, 1)
+	}
+	atomic.StoreUint64(&c.n, 1)
+	if !atomic.CompareAndSwapInt64(&c.resetAt, resetAt, now+samplingTick.Nanoseconds()) {
+		// reset by another goroutine
+		return atomic.AddUint64(&c.n, 1)
+	}
+	return 1
+}
+
+// samplerCore samples entries by the rule of their level, and counts the
+// entries sampled away
+type samplerCore struct {
+	zapcore.Core
+	rules    samplingRules
+	counters *[numLevels][]samplingCounter
+	stats    *stats
+}
+
+// newSamplerCore wraps core with the rules
+func newSamplerCore(core zapcore.Core, rules samplingRules, s *stats) zapcore.Core {
+	counters := &[numLevels][]samplingCounter{}
+	for i, rule := range rules {
+		if rule != nil {
+			counters[i] = make([]samplingCounter, samplingCounters)
+		}
+	}
+	return &samplerCore{Core: core, rules: rules, counters: counters, stats: s}
+}
+
+// With implements zapcore.Core, the counters are shared
+func (c *samplerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &samplerCore{Core: c.Core.With(fields), rules: c.rules, counters: c.counters, stats: c.stats}
+}
+
+// Check implements zapcore.Core
+func (c *samplerCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	i := int(ent.Level - zapcore.DebugLevel)
+	if i < 0 || i >= numLevels || c.rules[i] == nil || !c.Enabled(ent.Level) {
+		return c.Core.Check(ent, ce)
+	}
+	rule := c.rules[i]
+	n := c.counters[i][fnv32a(ent.Message)%samplingCounters].inc(ent.Time)
+	if n > uint64(rule.Initial) && (rule.Thereafter == 0 || (n-uint64(rule.Initial))%uint64(rule.Thereafter) != 0) {
+		atomic.AddUint64(&c.stats.sampled[i], 1)
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// fnv32a hashes s as FNV-1a
+func fnv32a(s string) uint32 {
+	const offset32, prime32 = 2166136261, 16777619
+	hash := uint32(offset32)
+	for i := 0; i < len(s); i++ {
+		hash ^= uint32(s[i])
+		hash *= prime32
+	}
+	return hash
+}
@@ -0,0 +1,95 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xial-thu/klog/klogtest"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestParseSampling(t *testing.T) {
+	for s, expect := range map[string]string{
+		"":                                   "none",
+		"none":                               "none",
+		"info:100/100,debug:10/1000":         "debug:10/1000,info:100/100",
+		" warn:1/0 , error:5/10 , fatal:1/1": "warn:1/0,error:5/10,fatal:1/1",
+	} {
+		rules, err := parseSampling(s)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", s, err)
+			continue
+		}
+		if rules.String() != expect {
+			t.Errorf("%q: expect %s, get %s", s, expect, rules.String())
+		}
+	}
+	for _, s := range []string{"info", "info:100", "info/100:100", "loud:1/1", "info:-1/1", "info:1/x"} {
+		if _, err := parseSampling(s); err == nil {
+			t.Errorf("%q: expect an error", s)
+		}
+	}
+	if s := newConfig().sampling.String(); s != "debug:100/100,info:100/100,warn:100/100" {
+		t.Errorf("expect errors exempt by default, get %s", s)
+	}
+}
+
+func TestSamplingPerLevel(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	if err := k.config.sampling.Set("debug:10/1000,info:100/100"); err != nil {
+		t.Fatal(err)
+	}
+	rebuild(t, k)
+	k.config.level.set(3)
+	defer swapLogger(k)()
+	clock := klogtest.NewFakeClock(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC))
+	SetClock(clock)
+	defer SetClock(nil)
+
+	burst := func() {
+		for i := 0; i < 1000; i++ {
+			k.V(3).Info("chatter")
+			k.Info("request")
+			k.Warning("slow")
+			k.Error("failed")
+		}
+	}
+	burst()
+	// the counters are reset every second
+	clock.Add(2 * time.Second)
+	burst()
+
+	s := k.config.stats
+	for l, expect := range map[zapcore.Level]uint64{
+		zapcore.DebugLevel: 2 * 10,
+		zapcore.InfoLevel:  2 * (100 + 9),
+		zapcore.WarnLevel:  2 * 1000,
+		zapcore.ErrorLevel: 2 * 1000,
+	} {
+		i := l - zapcore.DebugLevel
+		if s.lines[i] != expect {
+			t.Errorf("%s: expect %d lines, get %d", l, expect, s.lines[i])
+		}
+		if s.lines[i]+s.sampled[i] != 2000 {
+			t.Errorf("%s: expect the rest sampled away, get %d", l, s.sampled[i])
+		}
+	}
+	if n := s.droppedBySampling(); n != 2*(990+891) {
+		t.Errorf("expect %d dropped, get %d", 2*(990+891), n)
+	}
+}
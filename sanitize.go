@@ -0,0 +1,224 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// truncatedSuffix is appended to messages exceeding MaxMessageBytes
+const truncatedSuffix = "(truncated)"
+
+// sanitizeCore escapes control characters of messages and string fields
+// before they reach the encoder, so that a single entry is always a single line
+// It truncates messages and string or bytes fields beyond their limits as well
+type sanitizeCore struct {
+	zapcore.Core
+	sanitize        bool
+	maxMessageBytes int
+	maxFieldBytes   int
+}
+
+// newSanitizeCore wraps core, returns core itself if nothing is enabled
+func newSanitizeCore(core zapcore.Core, sanitize bool, maxMessageBytes, maxFieldBytes int) zapcore.Core {
+	if !sanitize && maxMessageBytes <= 0 && maxFieldBytes <= 0 {
+		return core
+	}
+	return &sanitizeCore{
+		Core:            core,
+		sanitize:        sanitize,
+		maxMessageBytes: maxMessageBytes,
+		maxFieldBytes:   maxFieldBytes,
+	}
+}
+
+// With implements zapcore.Core
+func (c *sanitizeCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sanitizeCore{
+		Core:            c.Core.With(c.fields(fields)),
+		sanitize:        c.sanitize,
+		maxMessageBytes: c.maxMessageBytes,
+		maxFieldBytes:   c.maxFieldBytes,
+	}
+}
+
+// Check implements zapcore.Core
+func (c *sanitizeCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (c *sanitizeCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	if c.sanitize {
+		ent.Message = sanitizeString(ent.Message)
+	}
+	if c.maxMessageBytes > 0 && len(ent.Message) > c.maxMessageBytes {
+		ent.Message = truncateString(ent.Message, c.maxMessageBytes) + truncatedSuffix
+	}
+	return c.Core.Write(ent, c.fields(fields))
+}
+
+// fields sanitizes and truncates string and bytes fields, copying the slice
+// only when needed
+func (c *sanitizeCore) fields(fields []zapcore.Field) []zapcore.Field {
+	if !c.sanitize && c.maxFieldBytes <= 0 {
+		return fields
+	}
+	copied := false
+	for i, f := range fields {
+		g, ok := c.field(f)
+		if !ok {
+			continue
+		}
+		if !copied {
+			fields = append([]zapcore.Field(nil), fields...)
+			copied = true
+		}
+		fields[i] = g
+	}
+	return fields
+}
+
+// field returns f sanitized and truncated, false if f is kept as it is
+func (c *sanitizeCore) field(f zapcore.Field) (zapcore.Field, bool) {
+	switch f.Type {
+	case zapcore.StringType:
+		s := f.String
+		if c.sanitize {
+			s = sanitizeString(s)
+		}
+		if c.maxFieldBytes > 0 && len(s) > c.maxFieldBytes {
+			s = truncateField(s, c.maxFieldBytes)
+		}
+		if s == f.String {
+			return f, false
+		}
+		f.String = s
+		return f, true
+	case zapcore.ByteStringType, zapcore.BinaryType:
+		b, ok := f.Interface.([]byte)
+		if !ok || c.maxFieldBytes <= 0 || len(b) <= c.maxFieldBytes {
+			return f, false
+		}
+		if f.Type == zapcore.ByteStringType {
+			f.Interface = []byte(truncateField(string(b), c.maxFieldBytes))
+			return f, true
+		}
+		// binary is base64 encoded, which can't carry the suffix
+		n := c.maxFieldBytes
+		s := base64.StdEncoding.EncodeToString(b[:n]) + truncatedFieldSuffix(len(b)-n)
+		return zapcore.Field{Key: f.Key, Type: zapcore.StringType, String: s}, true
+	}
+	return f, false
+}
+
+// truncateField cuts s to at most n bytes followed by the number of bytes cut
+// The result is a copy, so that huge values are not kept by loggers
+func truncateField(s string, n int) string {
+	t := truncateString(s, n)
+	return t + truncatedFieldSuffix(len(s)-len(t))
+}
+
+// truncatedFieldSuffix tells how many bytes of a field are cut
+func truncatedFieldSuffix(n int) string {
+	return "...(truncated " + strconv.Itoa(n) + " bytes)"
+}
+
+// needSanitize reports whether s contains any control character
+func needSanitize(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if b := s[i]; b < 0x20 || b == 0x7f {
+			return true
+		}
+	}
+	return false
+}
+
+// sanitizeString escapes CR/LF and strips ANSI escape sequences and other
+// control characters except tab
+func sanitizeString(s string) string {
+	if !needSanitize(s) {
+		return s
+	}
+	var b strings.Builder
+	b.Grow(len(s) + 8)
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteByte(c)
+		case c == 0x1b:
+			i = skipEscape(s, i)
+		case c < 0x20 || c == 0x7f:
+			// drop other control characters
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// skipEscape returns the index of the last byte of the escape sequence at i
+func skipEscape(s string, i int) int {
+	if i+1 >= len(s) {
+		return i
+	}
+	switch s[i+1] {
+	case '[':
+		// CSI: parameters and intermediates end with a final byte in [0x40, 0x7e]
+		for j := i + 2; j < len(s); j++ {
+			if s[j] >= 0x40 && s[j] <= 0x7e {
+				return j
+			}
+		}
+		return len(s) - 1
+	case ']':
+		// OSC: ends with BEL or ST
+		for j := i + 2; j < len(s); j++ {
+			if s[j] == 0x07 {
+				return j
+			}
+			if s[j] == 0x1b && j+1 < len(s) && s[j+1] == '\\' {
+				return j + 1
+			}
+		}
+		return len(s) - 1
+	default:
+		// two-byte sequence
+		return i + 1
+	}
+}
+
+// truncateString cuts s to at most n bytes without splitting a rune
+func truncateString(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,111 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSanitizeString(t *testing.T) {
+	cases := map[string]string{
+		"plain":                         "plain",
+		"a\nb\r\nc":                     `a\nb\r\nc`,
+		"\x1b[31mred\x1b[0m":            "red",
+		"\x1b]0;title\x07text":          "text",
+		"tab\tbell\x07del\x7f":          "tab\tbelldel",
+		"dangling\x1b":                  "dangling",
+		"forged\n{\"level\":\"error\"}": `forged\n{"level":"error"}`,
+	}
+	for in, expect := range cases {
+		if out := sanitizeString(in); out != expect {
+			t.Errorf("sanitize %q: expect %q, get %q", in, expect, out)
+		}
+	}
+}
+
+func TestSanitizeCore(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoderConfig := zap.NewDevelopmentEncoderConfig()
+	encoderConfig.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewConsoleEncoder(encoderConfig), zapcore.AddSync(buf), zapcore.DebugLevel)
+	sugar := zap.New(newSanitizeCore(core, true, 64, 0)).Sugar()
+
+	hostile := "user\n2020-01-01T00:00:00Z\tERROR\tforged \x1b[2J\x1b[31mentry\r"
+	sugar.With("field", hostile).Infof("login %s", hostile)
+	sugar.Info(strings.Repeat("é", 40))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expect 2 lines, get %d: %q", len(lines), buf.String())
+	}
+	if strings.ContainsAny(lines[0], "\r\x1b") {
+		t.Errorf("control characters not stripped: %q", lines[0])
+	}
+	if !strings.Contains(lines[0], `login user\n2020-01-01T00:00:00Z`) || !strings.Contains(lines[0], `"field": "user\\n2020`) {
+		t.Errorf("unexpected line: %q", lines[0])
+	}
+	if !strings.HasSuffix(lines[1], strings.Repeat("é", 32)+truncatedSuffix) {
+		t.Errorf("message not truncated: %q", lines[1])
+	}
+}
+
+func TestSanitizeDisabled(t *testing.T) {
+	core := zapcore.NewNopCore()
+	if newSanitizeCore(core, false, 0, 0) != core {
+		t.Errorf("core should not be wrapped when nothing is enabled")
+	}
+}
+
+func TestMaxFieldBytes(t *testing.T) {
+	buf := &bytes.Buffer{}
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.AddSync(buf), zapcore.DebugLevel)
+	k := &Klogger{sugar: zap.New(newSanitizeCore(core, false, 16, 8)).Sugar(), config: newConfig()}
+
+	body := strings.Repeat("x", 40<<20)
+	k.WithFields("body", body).InfoS(strings.Repeat("m", 20),
+		"short", "12345678",
+		"any", []byte("0123456789"),
+		String("typed", "abcdefghij"),
+		zap.ByteString("bytes", []byte("0123456789")),
+	)
+
+	if buf.Len() > 1024 {
+		t.Fatalf("expect the entry to be small, get %d bytes", buf.Len())
+	}
+	entries := decodeLines(t, buf)
+	if len(entries) != 1 {
+		t.Fatalf("expect 1 entry, get %d", len(entries))
+	}
+	expect := map[string]interface{}{
+		"msg":   strings.Repeat("m", 16) + truncatedSuffix,
+		"body":  "xxxxxxxx...(truncated 41943032 bytes)",
+		"short": "12345678",
+		"any":   "MDEyMzQ1Njc=...(truncated 2 bytes)",
+		"typed": "abcdefgh...(truncated 2 bytes)",
+		"bytes": "01234567...(truncated 2 bytes)",
+	}
+	for key, val := range expect {
+		if entries[0][key] != val {
+			t.Errorf("expect %s to be %q, get %q", key, val, entries[0][key])
+		}
+	}
+}
@@ -0,0 +1,84 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+)
+
+// Redacted replaces the value of a secret
+const Redacted = "[REDACTED]"
+
+// Secret is a string which is always masked in logs
+type Secret string
+
+// SecretBytes is a byte slice which is always masked in logs
+type SecretBytes []byte
+
+// SetSecretHash appends a short hash to masked secrets for correlation
+func SetSecretHash(enabled bool) {
+	klogger.config.secretHash.set(enabled)
+}
+
+// redact masks b, with an optional hash suffix
+func redact(b []byte) string {
+	if !klogger.config.secretHash.get() {
+		return Redacted
+	}
+	sum := sha256.Sum256(b)
+	return "[REDACTED:" + hex.EncodeToString(sum[:4]) + "]"
+}
+
+// String implements fmt.Stringer
+func (s Secret) String() string {
+	return redact([]byte(s))
+}
+
+// GoString implements fmt.GoStringer so that %#v is masked as well
+func (s Secret) GoString() string {
+	return s.String()
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s Secret) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (s Secret) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
+
+// String implements fmt.Stringer
+func (s SecretBytes) String() string {
+	return redact(s)
+}
+
+// GoString implements fmt.GoStringer so that %#v is masked as well
+func (s SecretBytes) GoString() string {
+	return s.String()
+}
+
+// MarshalText implements encoding.TextMarshaler
+func (s SecretBytes) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// MarshalJSON implements json.Marshaler
+func (s SecretBytes) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.String())
+}
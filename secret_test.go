@@ -0,0 +1,77 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSecret(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	type Credential struct {
+		User     string
+		Password Secret
+	}
+	type Request struct {
+		Credential Credential
+		Token      SecretBytes
+	}
+	password := Secret("hunter2")
+	token := SecretBytes("t0ken")
+	cred := Credential{User: "admin", Password: password}
+
+	Infof("%v %s %q %#v", password, password, token, token)
+	k.WithFields("value", password, "token", token).Info("fields")
+	k.With(cred).Info("with")
+	k.WithAll(Request{Credential: cred, Token: token}).Info("nested")
+
+	out := buf.String()
+	if strings.Contains(out, "hunter2") || strings.Contains(out, "t0ken") {
+		t.Fatalf("secret leaked: %s", out)
+	}
+	entries := decodeLines(t, buf)
+	if len(entries) != 4 {
+		t.Fatalf("expect 4 entries, get %d", len(entries))
+	}
+	if msg := entries[0]["msg"]; msg != `[REDACTED] [REDACTED] "[REDACTED]" [REDACTED]` {
+		t.Errorf("unexpected message: %v", msg)
+	}
+	if e := entries[1]; e["value"] != Redacted || e["token"] != Redacted {
+		t.Errorf("unexpected fields: %v", e)
+	}
+	if e := entries[2]; e["User"] != "admin" || e["Password"] != Redacted {
+		t.Errorf("unexpected fields: %v", e)
+	}
+	if !strings.Contains(out, `"Request":{"Credential":{"User":"admin","Password":"[REDACTED]"},"Token":"[REDACTED]"}`) {
+		t.Errorf("nested secret not masked: %s", out)
+	}
+}
+
+func TestSecretHash(t *testing.T) {
+	k, _ := newTestLogger()
+	defer swapLogger(k)()
+
+	SetSecretHash(true)
+	a, b := Secret("a").String(), Secret("b").String()
+	if !strings.HasPrefix(a, "[REDACTED:") || len(a) != len("[REDACTED:12345678]") {
+		t.Fatalf("unexpected hashed secret: %s", a)
+	}
+	if a == b || a != Secret("a").String() || a != SecretBytes("a").String() {
+		t.Errorf("hash should be stable and distinct: %s %s", a, b)
+	}
+}
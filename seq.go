@@ -0,0 +1,76 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// SeqKey holds the sequence number of an entry, see log_seq
+	SeqKey = "seq"
+	// MonotonicKey holds the monotonic nanoseconds of an entry, see log_monotonic
+	MonotonicKey = "monotonic"
+)
+
+// processStart is the origin of the monotonic field
+var processStart = time.Now()
+
+// seqCore numbers the entries written to the outputs
+// It wraps the innermost core, so that entries dropped by sampling are not
+// numbered, and the counter is kept by Reconfigure
+type seqCore struct {
+	zapcore.Core
+	seq       *uint64
+	monotonic bool
+}
+
+// newSeqCore returns core itself if neither seq nor monotonic is enabled
+func newSeqCore(core zapcore.Core, seq *uint64, monotonic bool) zapcore.Core {
+	if seq == nil && !monotonic {
+		return core
+	}
+	return &seqCore{Core: core, seq: seq, monotonic: monotonic}
+}
+
+// With implements zapcore.Core
+func (s *seqCore) With(fields []zapcore.Field) zapcore.Core {
+	return &seqCore{Core: s.Core.With(fields), seq: s.seq, monotonic: s.monotonic}
+}
+
+// Check implements zapcore.Core
+func (s *seqCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if s.Enabled(ent.Level) {
+		return ce.AddCore(ent, s)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (s *seqCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := make([]zapcore.Field, len(fields), len(fields)+2)
+	copy(all, fields)
+	if s.seq != nil {
+		all = append(all, zap.Uint64(SeqKey, atomic.AddUint64(s.seq, 1)))
+	}
+	if s.monotonic {
+		all = append(all, zap.Int64(MonotonicKey, int64(time.Since(processStart))))
+	}
+	return s.Core.Write(ent, all)
+}
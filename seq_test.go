@@ -0,0 +1,75 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func TestSeqField(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	k.config.seqField.set(true)
+	k.config.monotonicField.set(true)
+	k.config.sampling.set(samplingRules{})
+	rebuild(t, k)
+
+	const goroutines, n = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			child := k.WithFields("g", i)
+			for j := 0; j < n; j++ {
+				child.Info("hi")
+			}
+		}(i)
+	}
+	wg.Wait()
+	if err := k.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := readLines(t, path)
+	if len(entries) != goroutines*n {
+		t.Fatalf("expect %d entries, get %d", goroutines*n, len(entries))
+	}
+	seqs := make([]int, 0, len(entries))
+	for _, e := range entries {
+		seq, _ := e[SeqKey].(float64)
+		seqs = append(seqs, int(seq))
+		if mono, _ := e[MonotonicKey].(float64); mono <= 0 {
+			t.Errorf("unexpected monotonic field %v", e)
+		}
+	}
+	sort.Ints(seqs)
+	for i, seq := range seqs {
+		if seq != i+1 {
+			t.Fatalf("sequence numbers should be unique and dense, get %d at %d", seq, i)
+		}
+	}
+}
+
+func TestSeqFieldDisabled(t *testing.T) {
+	k, _ := newTestLogger()
+	core := k.sugar.Desugar().Core()
+	if newSeqCore(core, nil, false) != core {
+		t.Error("core should not be wrapped")
+	}
+}
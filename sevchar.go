@@ -0,0 +1,76 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SeverityCharKey holds the glog severity letter of an entry, see
+// log_severity_char
+const SeverityCharKey = "sev"
+
+// severityChars maps zap levels to glog severity letters, V logs are INFO
+var severityChars = map[zapcore.Level]string{
+	zapcore.DebugLevel:  "I",
+	zapcore.InfoLevel:   "I",
+	zapcore.WarnLevel:   "W",
+	zapcore.ErrorLevel:  "E",
+	zapcore.DPanicLevel: "E",
+	zapcore.PanicLevel:  "E",
+	zapcore.FatalLevel:  "F",
+}
+
+// severityChar returns the glog severity letter of l
+func severityChar(l zapcore.Level) string {
+	if c, ok := severityChars[l]; ok {
+		return c
+	}
+	return "I"
+}
+
+// sevCore adds the glog severity letter to each entry
+type sevCore struct {
+	zapcore.Core
+}
+
+// newSevCore returns core itself unless enabled
+func newSevCore(core zapcore.Core, enabled bool) zapcore.Core {
+	if !enabled {
+		return core
+	}
+	return &sevCore{core}
+}
+
+// With implements zapcore.Core
+func (s *sevCore) With(fields []zapcore.Field) zapcore.Core {
+	return &sevCore{s.Core.With(fields)}
+}
+
+// Check implements zapcore.Core
+func (s *sevCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if s.Enabled(ent.Level) {
+		return ce.AddCore(ent, s)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (s *sevCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := make([]zapcore.Field, len(fields), len(fields)+1)
+	copy(all, fields)
+	return s.Core.Write(ent, append(all, zap.String(SeverityCharKey, severityChar(ent.Level))))
+}
@@ -0,0 +1,60 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"testing"
+)
+
+func TestSeverityChar(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	k.config.severityChar.set(true)
+	k.config.sampling.set(samplingRules{})
+	rebuild(t, k)
+	k.SetLevel(1)
+	defer swapLogger(k)()
+	SetExitFunc(func(int) {})
+	defer SetExitFunc(nil)
+
+	Infof("info")
+	V(1).Infof("verbose")
+	k.WithFields("a", 1).Warningf("warning")
+	Errorf("error")
+	Fatalf("fatal")
+	Flush()
+
+	expect := map[string]string{"info": "I", "verbose": "I", "warning": "W", "error": "E", "fatal": "F"}
+	for _, e := range readLines(t, path) {
+		msg, _ := e["msg"].(string)
+		if c, ok := expect[msg]; ok {
+			if e[SeverityCharKey] != c {
+				t.Errorf("expect %s for %s, get %v", c, msg, e[SeverityCharKey])
+			}
+			delete(expect, msg)
+		}
+	}
+	if len(expect) > 0 {
+		t.Errorf("missing entries %v", expect)
+	}
+}
+
+func TestSeverityCharDisabled(t *testing.T) {
+	k, _ := newTestLogger()
+	core := k.sugar.Desugar().Core()
+	if newSevCore(core, false) != core {
+		t.Error("core should not be wrapped")
+	}
+}
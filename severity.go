@@ -0,0 +1,148 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// severities maps the names of log_level to the lowest zap level enabled
+// V() entries are DEBUG, so "info" enables DEBUG as well
+var severities = map[string]zapcore.Level{
+	"info":    zapcore.DebugLevel,
+	"warning": zapcore.WarnLevel,
+	"warn":    zapcore.WarnLevel,
+	"error":   zapcore.ErrorLevel,
+}
+
+// severity implements pflag.Value for log_level
+type severity struct {
+	level zap.AtomicLevel
+}
+
+// parseSeverity accepts info, warning and error
+func parseSeverity(s string) (zapcore.Level, error) {
+	l, ok := severities[strings.ToLower(strings.TrimSpace(s))]
+	if !ok {
+		return 0, fmt.Errorf("invalid log_level %q: expect one of info, warning and error", s)
+	}
+	return l, nil
+}
+
+// String implements pflag.Value
+func (s *severity) String() string {
+	return severityName(s.level.Level())
+}
+
+// severityName returns the name of log_level enabling l
+func severityName(l zapcore.Level) string {
+	switch {
+	case l >= zapcore.ErrorLevel:
+		return "error"
+	case l >= zapcore.WarnLevel:
+		return "warning"
+	}
+	return "info"
+}
+
+// Set implements pflag.Value
+func (s *severity) Set(v string) error {
+	l, err := parseSeverity(v)
+	if err != nil {
+		return err
+	}
+	s.level.SetLevel(l)
+	return nil
+}
+
+// Type implements pflag.Value
+func (s *severity) Type() string {
+	return "severity"
+}
+
+// SetMinSeverity suppresses entries below severity, which is one of info,
+// warning and error. V() entries are suppressed unless it's info
+func SetMinSeverity(severity string) error {
+	if err := klogger.config.severity.Set(severity); err != nil {
+		return err
+	}
+	klogger.logConfigChanges()
+	return nil
+}
+
+// WithMinSeverity returns a logger suppressing entries below level, e.g. a
+// logger of a noisy library at zapcore.WarnLevel. V() entries, which are
+// DEBUG, are suppressed unless level is DEBUG
+func WithMinSeverity(level zapcore.Level) *Klogger {
+	return klogger.WithMinSeverity(level)
+}
+
+// WithMinSeverity returns a logger suppressing entries below level, e.g. a
+// logger of a noisy library at zapcore.WarnLevel. V() entries, which are
+// DEBUG, are suppressed unless level is DEBUG. It can only raise the
+// severity, log_level and the severity of k still apply
+func (k *Klogger) WithMinSeverity(level zapcore.Level) *Klogger {
+	enabler := zap.LevelEnablerFunc(func(l zapcore.Level) bool {
+		return l >= level && k.severityEnabled(l)
+	})
+	child := k.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &increaseLevelCore{Core: core, level: enabler}
+	}))
+	child.minSeverity = enabler
+	return child
+}
+
+// increaseLevelCore is zap.IncreaseLevel, whose core of zap 1.14 loses the
+// level on With
+type increaseLevelCore struct {
+	zapcore.Core
+	level zapcore.LevelEnabler
+}
+
+// Enabled implements zapcore.Core
+func (c *increaseLevelCore) Enabled(l zapcore.Level) bool {
+	return c.level.Enabled(l)
+}
+
+// With implements zapcore.Core
+func (c *increaseLevelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &increaseLevelCore{Core: c.Core.With(fields), level: c.level}
+}
+
+// Check implements zapcore.Core
+func (c *increaseLevelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// severityEnabled reports whether entries at l pass log_level and
+// WithMinSeverity of k
+func (k *Klogger) severityEnabled(l zapcore.Level) bool {
+	if k.minSeverity != nil {
+		return k.minSeverity.Enabled(l)
+	}
+	return k.config.severity.level.Enabled(l)
+}
+
+// vEnabled reports whether V(level) of k is enabled
+func (k *Klogger) vEnabled(level Level) bool {
+	return level <= k.level() && k.severityEnabled(zapcore.DebugLevel)
+}
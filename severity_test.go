@@ -0,0 +1,130 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bytes"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// newSeverityLogger returns a test logger enabling levels by log_level
+func newSeverityLogger() (*Klogger, *bytes.Buffer) {
+	k, buf := newTestLogger()
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.TimeKey = ""
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(encoderConfig), zapcore.AddSync(buf), k.config.severity.level)
+	k.sugar = zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1)).Sugar()
+	return k, buf
+}
+
+func TestMinSeverity(t *testing.T) {
+	k, buf := newSeverityLogger()
+	defer swapLogger(k)()
+	SetLevel(2)
+
+	if err := SetMinSeverity("error"); err != nil {
+		t.Fatal(err)
+	}
+	Infof("info")
+	Warningf("warning")
+	V(1).Infof("verbose")
+	Errorf("error")
+	if V(1).Enabled() || Check(1) != nil {
+		t.Error("V() should be disabled with Info")
+	}
+
+	if err := SetMinSeverity("Warning"); err != nil {
+		t.Fatal(err)
+	}
+	Warningf("warning again")
+	V(1).Infof("verbose again")
+
+	if err := SetMinSeverity("info"); err != nil {
+		t.Fatal(err)
+	}
+	V(1).Infof("verbose at last")
+
+	var msgs []interface{}
+	for _, e := range decodeLines(t, buf) {
+		msgs = append(msgs, e["msg"])
+	}
+	expect := []interface{}{"error", "warning again", "verbose at last"}
+	if len(msgs) != len(expect) {
+		t.Fatalf("expect %v, get %v", expect, msgs)
+	}
+	for i := range expect {
+		if msgs[i] != expect[i] {
+			t.Errorf("expect %v, get %v", expect, msgs)
+		}
+	}
+	if err := SetMinSeverity("fatal"); err == nil {
+		t.Error("expect error for unknown severity")
+	}
+}
+
+func TestWithMinSeverity(t *testing.T) {
+	k, buf := newSeverityLogger()
+	defer swapLogger(k)()
+	SetLevel(2)
+
+	quiet := WithMinSeverity(zapcore.WarnLevel)
+	derived := quiet.WithFields("lib", "noisy")
+	quiet.Infof("quiet info")
+	derived.Infof("derived info")
+	quiet.V(1).Infof("quiet verbose")
+	if quiet.V(1).Enabled() || derived.V(1).Enabled() {
+		t.Error("V() should be disabled below warning")
+	}
+	Infof("parent info")
+	V(1).Infof("parent verbose")
+	derived.Warningf("derived warning")
+
+	// lowering it again, or below log_level, keeps the higher one
+	quiet.WithMinSeverity(zapcore.DebugLevel).Infof("lowered info")
+	if err := SetMinSeverity("error"); err != nil {
+		t.Fatal(err)
+	}
+	WithMinSeverity(zapcore.InfoLevel).Warningf("warning below log_level")
+	quiet.Errorf("quiet error")
+
+	var msgs []interface{}
+	for _, e := range decodeLines(t, buf) {
+		msgs = append(msgs, e["msg"])
+	}
+	expect := []interface{}{"parent info", "parent verbose", "derived warning", "quiet error"}
+	if len(msgs) != len(expect) {
+		t.Fatalf("expect %v, get %v", expect, msgs)
+	}
+	for i := range expect {
+		if msgs[i] != expect[i] {
+			t.Errorf("expect %v, get %v", expect, msgs)
+		}
+	}
+}
+
+func TestSeverityFlag(t *testing.T) {
+	s := severity{level: zap.NewAtomicLevel()}
+	for _, name := range []string{"info", "warning", "error"} {
+		if err := s.Set(name); err != nil {
+			t.Fatal(err)
+		}
+		if s.String() != name {
+			t.Errorf("expect %s, get %s", name, s.String())
+		}
+	}
+}
@@ -0,0 +1,86 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+)
+
+// SignalKey holds the name of the signal in the "shutting down" entry
+const SignalKey = "signal"
+
+// EnableSignalFlush installs a handler of SIGTERM and SIGINT, which logs a
+// "shutting down" entry and flushes all the outputs, within
+// ExitCleanupTimeout. Then it calls shutdown, or raises the signal again
+// with the handler removed if shutdown is nil
+// The handler runs once, call the returned func to remove it earlier
+// Applications handling signals themselves should call FlushOnSignal instead
+func EnableSignalFlush(shutdown func(os.Signal)) (disable func()) {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGTERM, os.Interrupt)
+	done := make(chan struct{})
+	go func() {
+		select {
+		case sig := <-ch:
+			signal.Stop(ch)
+			ctx, cancel := context.WithTimeout(context.Background(), ExitCleanupTimeout)
+			FlushOnSignal(ctx, sig)
+			cancel()
+			if shutdown != nil {
+				shutdown(sig)
+				return
+			}
+			raise(sig)
+		case <-done:
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			signal.Stop(ch)
+			close(done)
+		})
+	}
+}
+
+// FlushOnSignal logs a "shutting down" entry with sig unless it is nil, and
+// flushes all the outputs before ctx is done
+func FlushOnSignal(ctx context.Context, sig os.Signal) error {
+	if sig != nil {
+		klogger.internal().sugar.Infow("shutting down", SignalKey, sig.String())
+	}
+	klogger.LogOnceSummary()
+	return klogger.flushContext(ctx)
+}
+
+// raise sends sig to the process again, the default action terminates it
+// Where signals can't be sent, the process exits by the exit func
+func raise(sig os.Signal) {
+	p, err := os.FindProcess(os.Getpid())
+	if err == nil {
+		err = p.Signal(sig)
+	}
+	if err != nil {
+		exitMu.Lock()
+		exit := exitFunc
+		exitMu.Unlock()
+		exit(1)
+	}
+}
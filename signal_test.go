@@ -0,0 +1,93 @@
+//go:build !windows
+// +build !windows
+
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestEnableSignalFlush(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer swapLogger(k)()
+
+	got := make(chan os.Signal, 1)
+	disable := EnableSignalFlush(func(sig os.Signal) { got <- sig })
+	defer disable()
+
+	Infof("before")
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case sig := <-got:
+		if sig != syscall.SIGTERM {
+			t.Errorf("expect SIGTERM, get %v", sig)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown is not called")
+	}
+
+	entries := readLines(t, path)
+	e := entries[len(entries)-1]
+	if e["msg"] != "shutting down" || e[SignalKey] != "terminated" {
+		t.Errorf("unexpected entry %v", e)
+	}
+}
+
+func TestDisableSignalFlush(t *testing.T) {
+	// keep SIGINT from killing the test once the handler is removed
+	ignored := make(chan struct{})
+	defer EnableSignalFlush(func(os.Signal) { close(ignored) })()
+
+	called := make(chan struct{}, 1)
+	disable := EnableSignalFlush(func(os.Signal) { called <- struct{}{} })
+	disable()
+	disable() // no panic
+
+	syscall.Kill(os.Getpid(), syscall.SIGINT)
+	select {
+	case <-ignored:
+	case <-time.After(5 * time.Second):
+		t.Fatal("SIGINT is not handled")
+	}
+	select {
+	case <-called:
+		t.Error("removed handler is called")
+	default:
+	}
+}
+
+func TestFlushOnSignal(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer swapLogger(k)()
+
+	if err := FlushOnSignal(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range readLines(t, path) {
+		if e["msg"] == "shutting down" {
+			t.Errorf("nil signal should not be logged: %v", e)
+		}
+	}
+}
@@ -0,0 +1,308 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/multierr"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// managedSink is an opened output which falls back to stderr once closed
+type managedSink struct {
+	mu     sync.RWMutex
+	ws     zapcore.WriteSyncer
+	close  func()
+	std    bool
+	closed bool
+}
+
+// Write implements zapcore.WriteSyncer
+func (s *managedSink) Write(p []byte) (int, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return os.Stderr.Write(p)
+	}
+	return s.ws.Write(p)
+}
+
+// Sync implements zapcore.WriteSyncer
+func (s *managedSink) Sync() error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.closed {
+		return nil
+	}
+	err := s.ws.Sync()
+	if s.std {
+		// syncing a terminal or a pipe always fails
+		return nil
+	}
+	return err
+}
+
+// Close releases the underlying resource
+func (s *managedSink) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.close()
+		s.closed = true
+	}
+}
+
+// sinks tracks opened outputs and background goroutines of a logger
+type sinks struct {
+	mu      sync.Mutex
+	managed []*managedSink
+	stop    chan struct{}
+	wg      sync.WaitGroup
+
+	// where entries go when an output fails
+	fallback zapcore.WriteSyncer
+	// the fallback is an output as well, see fallbackIsOutput
+	fallbackIsOutput bool
+	// where the files report failed rotations
+	errorOutput zapcore.WriteSyncer
+	stats       *stats
+}
+
+// open opens each path and combines them into a locked WriteSyncer
+func (s *sinks) open(paths ...string) (zapcore.WriteSyncer, error) {
+	writers := make([]zapcore.WriteSyncer, 0, len(paths))
+	for _, path := range paths {
+		ws, close, err := zap.Open(path)
+		if err != nil {
+			for _, w := range writers {
+				w.(*managedSink).Close()
+			}
+			return nil, err
+		}
+		writers = append(writers, s.managedSink(path, ws, close))
+	}
+
+	s.mu.Lock()
+	for _, w := range writers {
+		s.managed = append(s.managed, w.(*managedSink))
+	}
+	s.mu.Unlock()
+	return zap.CombineWriteSyncers(writers...), nil
+}
+
+// managedSink wraps ws of path, which falls back to the fallback unless
+// it's stdout or stderr
+func (s *sinks) managedSink(path string, ws zapcore.WriteSyncer, close func()) *managedSink {
+	sink := &managedSink{
+		ws:    ws,
+		close: close,
+		std:   path == "stdout" || path == "stderr",
+	}
+	if !sink.std && s.stats != nil {
+		sink.ws = s.withFallback(path, ws)
+	}
+	return sink
+}
+
+// adopt manages ws of path, which is opened by other than zap.Open, e.g.
+// the journal
+func (s *sinks) adopt(path string, ws zapcore.WriteSyncer, close func()) zapcore.WriteSyncer {
+	sink := s.managedSink(path, ws, close)
+	s.mu.Lock()
+	s.managed = append(s.managed, sink)
+	s.mu.Unlock()
+	return sink
+}
+
+// attachFile manages a rotated file, and maintains its backups in background
+func (s *sinks) attachFile(file *rotatingFile) zapcore.WriteSyncer {
+	if s.errorOutput != nil {
+		file.errorOutput = s.errorOutput
+	}
+	sink := &managedSink{
+		ws:    file,
+		close: func() { file.Close() },
+	}
+	if s.stats != nil {
+		sink.ws = s.withFallback(file.path, file)
+	}
+
+	s.mu.Lock()
+	s.managed = append(s.managed, sink)
+	s.mu.Unlock()
+	s.run(file.maintain)
+	return sink
+}
+
+// withFallback wraps ws of path in a fallbackSink
+func (s *sinks) withFallback(path string, ws zapcore.WriteSyncer) zapcore.WriteSyncer {
+	sink := newFallbackSink(path, ws, s.fallback, s.stats)
+	sink.isOutput = s.fallbackIsOutput
+	return sink
+}
+
+// run starts fn in a goroutine which is told to stop by close
+func (s *sinks) run(fn func(stop <-chan struct{})) {
+	s.mu.Lock()
+	if s.stop == nil {
+		s.stop = make(chan struct{})
+	}
+	stop := s.stop
+	s.wg.Add(1)
+	s.mu.Unlock()
+
+	go func() {
+		defer s.wg.Done()
+		fn(stop)
+	}()
+}
+
+// close stops background goroutines, then syncs and closes every sink
+// before ctx is done
+func (s *sinks) close(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	managed := s.managed
+	s.managed = nil
+	s.mu.Unlock()
+
+	return closeSinks(ctx, managed, s.wg.Wait)
+}
+
+// sync syncs every sink, aggregating the errors. It returns false if there's
+// no sink
+func (s *sinks) sync() (bool, error) {
+	s.mu.Lock()
+	managed := append([]*managedSink(nil), s.managed...)
+	s.mu.Unlock()
+	if len(managed) == 0 {
+		return false, nil
+	}
+	var err error
+	for _, sink := range managed {
+		err = multierr.Append(err, sink.Sync())
+	}
+	return true, err
+}
+
+// detach forgets the opened sinks and returns them, background goroutines
+// are kept running
+func (s *sinks) detach() []*managedSink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	managed := s.managed
+	s.managed = nil
+	return managed
+}
+
+// count returns how many sinks are opened
+func (s *sinks) count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.managed)
+}
+
+// detachFrom forgets the sinks opened after the first n, and returns them
+func (s *sinks) detachFrom(n int) []*managedSink {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n >= len(s.managed) {
+		return nil
+	}
+	managed := append([]*managedSink(nil), s.managed[n:]...)
+	s.managed = s.managed[:n]
+	return managed
+}
+
+// attach tracks the sinks returned by detach again
+func (s *sinks) attach(managed []*managedSink) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.managed = append(managed, s.managed...)
+}
+
+// closeSinks syncs and closes each sink after wait returns, syncing is
+// given up when ctx is done
+func closeSinks(ctx context.Context, managed []*managedSink, wait func()) error {
+	done := make(chan error, 1)
+	go func() {
+		wait()
+		var err error
+		for _, sink := range managed {
+			err = multierr.Append(err, sink.Sync())
+		}
+		done <- err
+	}()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	for _, sink := range managed {
+		sink.Close()
+	}
+	return err
+}
+
+// closedCore is swapped in by Close, which writes to stderr directly, so
+// that late entries never reach the closed outputs
+type closedCore struct {
+	zapcore.Core
+	n *uint64
+}
+
+// newClosedCore returns a closedCore encoding entries as JSON, c.mu is held
+func (c *Config) newClosedCore() zapcore.Core {
+	ec := c.zapConfig.EncoderConfig
+	if ec.MessageKey == "" {
+		ec = c.newZapConfig().EncoderConfig
+	}
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(ec), zapcore.Lock(os.Stderr), c.zapConfig.Level)
+	return &closedCore{Core: core, n: &c.stats.afterClose}
+}
+
+// With implements zapcore.Core
+func (c *closedCore) With(fields []zapcore.Field) zapcore.Core {
+	return &closedCore{Core: c.Core.With(fields), n: c.n}
+}
+
+// Check implements zapcore.Core
+func (c *closedCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if c.Enabled(ent.Level) {
+		return ce.AddCore(ent, c)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (c *closedCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	atomic.AddUint64(c.n, 1)
+	return c.Core.Write(ent, fields)
+}
+
+// Sync implements zapcore.Core, syncing stderr always fails on terminals
+func (c *closedCore) Sync() error {
+	return nil
+}
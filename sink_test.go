@@ -0,0 +1,239 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newFileLogger builds a logger writing into a temp file
+func newFileLogger(t *testing.T) (*Klogger, string) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "klog.log")
+
+	c := newConfig()
+	c.zapConfig = c.newZapConfig()
+	c.zapConfig.OutputPaths = []string{path}
+	zlogger, err := c.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Klogger{sugar: zlogger.Sugar(), config: c}, path
+}
+
+// rebuild builds k again after its config is changed, closing the sinks of
+// the previous build like reconfigure
+func rebuild(t *testing.T, k *Klogger) {
+	old := k.config.sinks.detach()
+	zlogger, err := k.config.build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.sugar = zlogger.Sugar()
+	if err := closeSinks(context.Background(), old, func() {}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// removeDir removes the temp dir of a file logger
+func removeDir(path string) {
+	os.RemoveAll(filepath.Dir(path))
+}
+
+func TestClose(t *testing.T) {
+	goroutines := runtime.NumGoroutine()
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+
+	stopped := make(chan struct{})
+	k.config.sinks.run(func(stop <-chan struct{}) {
+		<-stop
+		close(stopped)
+	})
+
+	child := k.WithFields("A", 1)
+	k.Info("final")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := k.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	select {
+	case <-stopped:
+	default:
+		t.Errorf("background goroutine should be stopped")
+	}
+
+	// no panic after close
+	k.Info("after-close")
+	child.Info("after-close")
+	if err := k.Close(ctx); err != nil {
+		t.Errorf("closing twice: %v", err)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"msg":"final"`) || strings.Contains(string(data), "after-close") {
+		t.Errorf("unexpected file content: %s", data)
+	}
+	if n := runtime.NumGoroutine(); n > goroutines {
+		t.Errorf("goroutines leaked: %d before, %d after", goroutines, n)
+	}
+}
+
+func TestCloseDeadline(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+
+	release := make(chan struct{})
+	k.config.sinks.run(func(stop <-chan struct{}) {
+		// ignores stop
+		<-release
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := k.Close(ctx); err != context.DeadlineExceeded {
+		t.Errorf("expect deadline exceeded, get %v", err)
+	}
+	close(release)
+	k.config.sinks.wg.Wait()
+}
+
+func TestLogWhileClosing(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	stderr := os.Stderr
+	defer func() { os.Stderr = stderr }()
+	f, err := os.Create(filepath.Join(dir, "stderr.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	os.Stderr = f
+
+	k, err := New(WithOutputPaths(filepath.Join(dir, "out.log")), WithLogFile(filepath.Join(dir, "file.log"), 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			l := k.WithFields("goroutine", i)
+			for n := 0; ; n++ {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+				l.Infof("entry %d", n)
+				k.Warningw("warning", "n", n)
+				k.V(0).InfoS("verbose", "n", n)
+			}
+		}(i)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := k.Close(ctx); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	close(stop)
+	wg.Wait()
+
+	if atomic.LoadUint64(&k.config.stats.afterClose) == 0 {
+		t.Error("expect entries written to stderr after close")
+	}
+	data, err := ioutil.ReadFile(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"msg":"entry `) {
+		t.Errorf("expect entries in stderr, got %.200s", data)
+	}
+	k.Info("after")
+	if err := k.Close(ctx); err != nil {
+		t.Errorf("closing twice: %v", err)
+	}
+}
+
+// openFiles returns how many fds of the process are files in dir, -1 if
+// unknown
+func openFiles(dir string) int {
+	fds, err := ioutil.ReadDir("/proc/self/fd")
+	if err != nil {
+		return -1
+	}
+	n := 0
+	for _, fd := range fds {
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); err == nil && strings.HasPrefix(target, dir) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestBuildFailureClosesSinks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "klog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c := newConfig()
+	c.outputPaths.set([]string{filepath.Join(dir, "out.log")})
+	c.fallbackPath.set(filepath.Join(dir, "fallback.log"))
+	c.logFile.set(filepath.Join(dir, "app.log"))
+	c.auditPaths.set([]string{filepath.Join(dir, "audit.log")})
+	c.routes = []RouteConfig{{Outputs: []string{"nosuchscheme://x"}}}
+	c.zapConfig = c.newZapConfig()
+	if _, err := c.build(); err == nil {
+		t.Fatal("expect error of the route")
+	}
+	if n := c.sinks.count(); n != 0 {
+		t.Errorf("expect no sinks left, get %d", n)
+	}
+	if c.sinks.fallback != nil {
+		t.Error("expect the fallback restored")
+	}
+	if n := openFiles(dir); n > 0 {
+		t.Errorf("expect the files closed, get %d open", n)
+	}
+	k := &Klogger{config: c}
+	if files := k.ExtraFiles(); files != nil {
+		t.Errorf("expect no files of a failed build, get %v", files)
+	}
+}
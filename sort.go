@@ -0,0 +1,79 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sort"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// sortCore writes the fields of an entry in lexical order of their keys,
+// after the reserved keys written by the encoder. Fields after a namespace
+// are sorted within the namespace
+// zap encodes the fields of With once, while sortCore keeps them and encodes
+// them on each entry, which costs about as much as passing them per entry
+type sortCore struct {
+	zapcore.Core
+	context []zapcore.Field
+}
+
+// newSortCore returns core itself unless enabled
+func newSortCore(core zapcore.Core, enabled bool) zapcore.Core {
+	if !enabled {
+		return core
+	}
+	return &sortCore{Core: core}
+}
+
+// With implements zapcore.Core
+func (s *sortCore) With(fields []zapcore.Field) zapcore.Core {
+	context := make([]zapcore.Field, 0, len(s.context)+len(fields))
+	context = append(context, s.context...)
+	return &sortCore{Core: s.Core, context: append(context, fields...)}
+}
+
+// Check implements zapcore.Core
+func (s *sortCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if s.Enabled(ent.Level) {
+		return ce.AddCore(ent, s)
+	}
+	return ce
+}
+
+// Write implements zapcore.Core
+func (s *sortCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	all := make([]zapcore.Field, 0, len(s.context)+len(fields))
+	all = append(all, s.context...)
+	all = append(all, fields...)
+	sortFields(all)
+	return s.Core.Write(ent, all)
+}
+
+// sortFields sorts fields by key between namespaces, duplicate keys are
+// kept in order
+func sortFields(fields []zapcore.Field) {
+	start := 0
+	for i := 0; i <= len(fields); i++ {
+		if i < len(fields) && fields[i].Type != zapcore.NamespaceType {
+			continue
+		}
+		segment := fields[start:i]
+		sort.SliceStable(segment, func(a, b int) bool {
+			return segment[a].Key < segment[b].Key
+		})
+		start = i + 1
+	}
+}
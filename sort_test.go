@@ -0,0 +1,81 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestWithMapSorted(t *testing.T) {
+	m := make(map[string]int)
+	for i := 0; i < 20; i++ {
+		m["k"+strconv.Itoa(i)] = i
+	}
+	k, buf := newTestLogger()
+	for i := 0; i < 10; i++ {
+		k.With(m).Infof("map")
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	for _, line := range lines[1:] {
+		if line != lines[0] {
+			t.Fatalf("expect identical lines, get\n%s\n%s", lines[0], line)
+		}
+	}
+	if !strings.Contains(lines[0], `"k0":0,"k1":1,"k10":10,"k11":11`) {
+		t.Errorf("expect sorted keys, get %s", lines[0])
+	}
+}
+
+func TestSortFields(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	k.config.sortFields.set(true)
+	k.config.seqField.set(true)
+	k.config.sampling.set(samplingRules{})
+	rebuild(t, k)
+
+	k.WithFields("c", 3, "a", 1).InfoS("sorted", "b", 2)
+	k.WithFields("z", 1).InfoS("namespace", zap.Namespace("ns"), "y", 2, "x", 3)
+	k.sugar.Sync()
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("unexpected lines %q", lines)
+	}
+	if !strings.Contains(lines[0], `"msg":"sorted","a":1,"b":2,"c":3,"seq":1}`) {
+		t.Errorf("expect sorted fields, get %s", lines[0])
+	}
+	if !strings.Contains(lines[1], `"msg":"namespace","z":1,"ns":{"seq":2,"x":3,"y":2}}`) {
+		t.Errorf("expect sorted fields in the namespace, get %s", lines[1])
+	}
+}
+
+func TestSortFieldsStable(t *testing.T) {
+	fields := []zapcore.Field{zap.Int("b", 1), zap.Int("a", 1), zap.Int("b", 2)}
+	sortFields(fields)
+	if fields[0].Key != "a" || fields[1].Integer != 1 || fields[2].Integer != 2 {
+		t.Errorf("unexpected order %v", fields)
+	}
+}
@@ -0,0 +1,39 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+
+	"go.uber.org/zap/buffer"
+)
+
+// msgPool holds the buffers formatting the messages of *ln entries
+var msgPool = buffer.NewPool()
+
+// sprintln formats args like fmt.Sprintln without the trailing newline, i.e.
+// separated by spaces, with a single allocation for the message
+func sprintln(args []interface{}) string {
+	if len(args) == 1 {
+		if s, ok := args[0].(string); ok {
+			return s
+		}
+	}
+	buf := msgPool.Get()
+	defer buf.Free()
+	fmt.Fprintln(buf, args...)
+	b := buf.Bytes()
+	return string(b[:len(b)-1])
+}
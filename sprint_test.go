@@ -0,0 +1,91 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestSprintln(t *testing.T) {
+	err := errors.New("failed")
+	for _, args := range [][]interface{}{
+		{},
+		{"a"},
+		{"a", "b"},
+		{1, 2},
+		{"a", 1, err},
+		{nil},
+		{"multi\nline"},
+	} {
+		expect := strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+		if s := sprintln(args); s != expect {
+			t.Errorf("expect %q for %v, get %q", expect, args, s)
+		}
+	}
+}
+
+func TestLnEquivalence(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	SetExitFunc(func(int) {})
+	defer SetExitFunc(nil)
+	k.SetLevel(1)
+
+	args := []interface{}{"a", 1, errors.New("b")}
+	Infoln(args...)
+	k.Infoln(args...)
+	V(1).Infoln(args...)
+	Warningln(args...)
+	k.Warningln(args...)
+	Errorln(args...)
+	k.Errorln(args...)
+	Exitln(args...)
+	k.Exitln(args...)
+	Fatalln(args...)
+	k.Fatalln(args...)
+	catchPanic(func() { Panicln(args...) })
+	catchPanic(func() { k.Panicln(args...) })
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 13 {
+		t.Fatalf("expect 13 entries, get %d", len(entries))
+	}
+	for _, e := range entries {
+		if e["msg"] != "a 1 b" {
+			t.Errorf("expect the message separated by spaces, get %q", e["msg"])
+		}
+		if caller, _ := e["caller"].(string); !strings.Contains(caller, "/sprint_test.go:") {
+			t.Errorf("expect the caller in this file, get %q", caller)
+		}
+	}
+}
+
+func BenchmarkInfoln(b *testing.B) {
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(ioutil.Discard), zapcore.DebugLevel)
+	k := &Klogger{sugar: zap.New(core).Sugar(), config: newConfig()}
+	err := errors.New("failed")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		k.Infoln("request", i, err)
+	}
+}
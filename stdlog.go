@@ -0,0 +1,113 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"log"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Print logs at INFO like Info, for libraries accepting a Print logger
+//go:noinline
+func Print(args ...interface{}) {
+	klogger.sugar.Info(args...)
+}
+
+// Print logs at INFO like Info, for libraries accepting a Print logger
+//go:noinline
+func (k *Klogger) Print(args ...interface{}) {
+	k.sugar.Info(args...)
+}
+
+// Printf logs at INFO like Infof
+//go:noinline
+func Printf(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		klogger.wrapf(zapcore.InfoLevel, format, args)
+		return
+	}
+	klogger.sugar.Infof(format, args...)
+}
+
+// Printf logs at INFO like Infof
+//go:noinline
+func (k *Klogger) Printf(format string, args ...interface{}) {
+	if hasWrapVerb(format) {
+		k.wrapf(zapcore.InfoLevel, format, args)
+		return
+	}
+	k.sugar.Infof(format, args...)
+}
+
+// Println logs at INFO like Infoln
+//go:noinline
+func Println(args ...interface{}) {
+	klogger.sugar.Desugar().Info(sprintln(args))
+}
+
+// Println logs at INFO like Infoln
+//go:noinline
+func (k *Klogger) Println(args ...interface{}) {
+	k.sugar.Desugar().Info(sprintln(args))
+}
+
+// stdLogSkip is the number of frames between the caller of a *log.Logger and
+// stdWriter.Write, which are log.(*Logger).Printf and the like, and Output
+const stdLogSkip = 2
+
+// stdWriter writes each line of a *log.Logger as an entry
+type stdWriter struct {
+	k      *Klogger
+	level  Level
+	logger *zap.Logger
+}
+
+// Write implements io.Writer
+func (w *stdWriter) Write(p []byte) (int, error) {
+	lvl, fields := zapcore.InfoLevel, []zap.Field(nil)
+	if w.level > 0 {
+		v := w.k.V(w.level)
+		if !v.Enabled() {
+			return len(p), nil
+		}
+		lvl, fields = v.entry(nil)
+	}
+	if ce := w.logger.Check(lvl, strings.TrimSuffix(string(p), "\n")); ce != nil {
+		ce.Write(fields...)
+	}
+	return len(p), nil
+}
+
+// NewStdLogger returns a *log.Logger writing to the global logger, at INFO
+// if level is 0 and like V(level) otherwise, see Klogger.NewStdLogger
+func NewStdLogger(level Level) *log.Logger {
+	return klogger.NewStdLogger(level)
+}
+
+// NewStdLogger returns a *log.Logger writing to k, at INFO if level is 0 and
+// like V(level) otherwise, for libraries accepting one. Its flags are 0, so
+// that the time isn't logged twice, and the caller is the one of the
+// *log.Logger
+func (k *Klogger) NewStdLogger(level Level) *log.Logger {
+	w := &stdWriter{
+		k:      k,
+		level:  level,
+		logger: k.sugar.Desugar().WithOptions(zap.AddCallerSkip(stdLogSkip)),
+	}
+	return log.New(w, "", 0)
+}
@@ -0,0 +1,98 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"log"
+	"strings"
+	"testing"
+)
+
+// printer is the logger interface of retry libraries like retryablehttp
+type printer interface {
+	Printf(format string, args ...interface{})
+}
+
+// retryStub logs like a retry library
+func retryStub(logger printer, attempts int) {
+	for i := 1; i <= attempts; i++ {
+		logger.Printf("[DEBUG] retrying GET %s (attempt %d)", "/health", i)
+	}
+}
+
+// stdStub logs like a library accepting a *log.Logger
+func stdStub(logger *log.Logger) {
+	logger.Printf("connection lost: %s", "EOF")
+	logger.Println("reconnected")
+}
+
+func TestPrint(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	retryStub(k, 2)
+	Print("a", "b")
+	k.Println("c", 1)
+
+	entries := decodeLines(t, buf)
+	expect := []string{
+		"[DEBUG] retrying GET /health (attempt 1)",
+		"[DEBUG] retrying GET /health (attempt 2)",
+		"ab",
+		"c 1",
+	}
+	if len(entries) != len(expect) {
+		t.Fatalf("expect %d entries, get %v", len(expect), entries)
+	}
+	for i, msg := range expect {
+		if entries[i]["msg"] != msg || entries[i]["level"] != "info" {
+			t.Errorf("expect %q at info, get %v", msg, entries[i])
+		}
+	}
+	if caller, _ := entries[0]["caller"].(string); !strings.Contains(caller, "/stdlog_test.go:") {
+		t.Errorf("expect the caller in the stub, get %q", caller)
+	}
+}
+
+func TestNewStdLogger(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	k.config.vField.set(true)
+
+	stdStub(NewStdLogger(0))
+	stdStub(k.NewStdLogger(2))
+	k.SetLevel(2)
+	stdStub(k.NewStdLogger(2))
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 4 {
+		t.Fatalf("expect 4 entries, get %v", entries)
+	}
+	for i, e := range entries {
+		msg := "connection lost: EOF"
+		if i%2 == 1 {
+			msg = "reconnected"
+		}
+		if e["msg"] != msg {
+			t.Errorf("entry %d: expect %q without a timestamp, get %q", i, msg, e["msg"])
+		}
+		if caller, _ := e["caller"].(string); !strings.Contains(caller, "/stdlog_test.go:") {
+			t.Errorf("entry %d: expect the caller of the std logger, get %q", i, caller)
+		}
+	}
+	if entries[0]["level"] != "info" || entries[2]["level"] != "debug" || entries[2]["v"] != float64(2) {
+		t.Errorf("unexpected levels %v", entries)
+	}
+}
@@ -0,0 +1,304 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// FilterRule matches the entries to suppress, e.g. the access logs of health
+// checks. All the conditions set must match. Entries above ERROR are never
+// suppressed
+type FilterRule struct {
+	// Name identifies the rule in SuppressedEntries, default to rule-<index>
+	Name string `json:"name,omitempty"`
+	// Level matches entries of exactly this level, e.g. info
+	Level string `json:"level,omitempty"`
+	// Message is a regexp matching the message
+	Message string `json:"message,omitempty"`
+	// Fields match the fields of the entry by their values in string form,
+	// e.g. {"path": "/healthz"}
+	Fields map[string]string `json:"fields,omitempty"`
+	// DemoteTo logs the entries at this level, e.g. debug, instead of
+	// dropping them
+	DemoteTo string `json:"demote_to,omitempty"`
+}
+
+// filterRule is a compiled FilterRule
+type filterRule struct {
+	// suppressed entries, first to be aligned for atomic operations
+	n        uint64
+	name     string
+	hasLevel bool
+	level    zapcore.Level
+	message  *regexp.Regexp
+	fields   map[string]string
+	demote   bool
+	demoteTo zapcore.Level
+}
+
+// filterRules are the rules set by SetSuppressRules, the first matching one
+// applies
+type filterRules struct {
+	rules []*filterRule
+	// the file loaded by log_suppress_rules
+	path string
+}
+
+// parseFilterLevel parses a level of FilterRule, warning is accepted as well
+func parseFilterLevel(s string) (zapcore.Level, error) {
+	var l zapcore.Level
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warning" {
+		s = "warn"
+	}
+	err := l.UnmarshalText([]byte(s))
+	return l, err
+}
+
+// compileRules validates and compiles rules
+func compileRules(rules []FilterRule) ([]*filterRule, error) {
+	compiled := make([]*filterRule, 0, len(rules))
+	for i, rule := range rules {
+		r := &filterRule{name: rule.Name, fields: rule.Fields}
+		if r.name == "" {
+			r.name = "rule-" + strconv.Itoa(i)
+		}
+		var err error
+		if rule.Level != "" {
+			r.hasLevel = true
+			if r.level, err = parseFilterLevel(rule.Level); err != nil {
+				return nil, fmt.Errorf("invalid level of suppress rule %s: %v", r.name, err)
+			}
+		}
+		if rule.Message != "" {
+			if r.message, err = regexp.Compile(rule.Message); err != nil {
+				return nil, fmt.Errorf("invalid message of suppress rule %s: %v", r.name, err)
+			}
+		}
+		if rule.DemoteTo != "" {
+			r.demote = true
+			if r.demoteTo, err = parseFilterLevel(rule.DemoteTo); err != nil {
+				return nil, fmt.Errorf("invalid demote_to of suppress rule %s: %v", r.name, err)
+			}
+		}
+		compiled = append(compiled, r)
+	}
+	return compiled, nil
+}
+
+// SetSuppressRules replaces the rules suppressing entries, which apply at
+// once, nil removes them. The counters of SuppressedEntries start over
+func SetSuppressRules(rules []FilterRule) error {
+	return klogger.config.setSuppressRules(rules, "")
+}
+
+// LoadSuppressRules replaces the rules suppressing entries by the JSON array
+// of FilterRule in the file at path, see log_suppress_rules
+func LoadSuppressRules(path string) error {
+	return klogger.config.loadSuppressRules(path)
+}
+
+// SuppressedEntries returns how many entries each rule suppressed, by name
+func SuppressedEntries() map[string]uint64 {
+	return klogger.config.suppressedEntries()
+}
+
+// setSuppressRules compiles and stores rules
+func (c *Config) setSuppressRules(rules []FilterRule, path string) error {
+	compiled, err := compileRules(rules)
+	if err != nil {
+		return err
+	}
+	c.suppress.Store(&filterRules{rules: compiled, path: path})
+	return nil
+}
+
+// loadSuppressRules reads the rules from the file at path
+func (c *Config) loadSuppressRules(path string) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var rules []FilterRule
+	if err := json.Unmarshal(b, &rules); err != nil {
+		return fmt.Errorf("invalid suppress rules in %s: %v", path, err)
+	}
+	return c.setSuppressRules(rules, path)
+}
+
+// suppressRules returns the current rules, nil if there's none
+func (c *Config) suppressRules() *filterRules {
+	rules, _ := c.suppress.Load().(*filterRules)
+	if rules == nil || len(rules.rules) == 0 {
+		return nil
+	}
+	return rules
+}
+
+// suppressedEntries returns the counters of the current rules
+func (c *Config) suppressedEntries() map[string]uint64 {
+	rules := c.suppressRules()
+	if rules == nil {
+		return map[string]uint64{}
+	}
+	m := make(map[string]uint64, len(rules.rules))
+	for _, r := range rules.rules {
+		m[r.name] += atomic.LoadUint64(&r.n)
+	}
+	return m
+}
+
+// suppressFile is the pflag.Value of log_suppress_rules
+type suppressFile struct {
+	c *Config
+}
+
+// String implements pflag.Value
+func (f suppressFile) String() string {
+	if f.c == nil {
+		return ""
+	}
+	if rules, _ := f.c.suppress.Load().(*filterRules); rules != nil {
+		return rules.path
+	}
+	return ""
+}
+
+// Set implements pflag.Value
+func (f suppressFile) Set(path string) error {
+	if path == "" {
+		return f.c.setSuppressRules(nil, "")
+	}
+	return f.c.loadSuppressRules(path)
+}
+
+// Type implements pflag.Value
+func (f suppressFile) Type() string {
+	return "path"
+}
+
+// matchEntry reports whether the level and the message match
+func (r *filterRule) matchEntry(ent zapcore.Entry) bool {
+	if r.hasLevel && ent.Level != r.level {
+		return false
+	}
+	return r.message == nil || r.message.MatchString(ent.Message)
+}
+
+// matchFields reports whether the fields match, the fields of the entry are
+// given after the ones added by With
+func (r *filterRule) matchFields(with, fields []zapcore.Field) bool {
+	for key, want := range r.fields {
+		f, ok := lastField(key, fields)
+		if !ok {
+			f, ok = lastField(key, with)
+		}
+		if !ok || fieldString(f) != want {
+			return false
+		}
+	}
+	return true
+}
+
+// lastField returns the last field of key, which wins when encoded
+func lastField(key string, fields []zapcore.Field) (zapcore.Field, bool) {
+	for i := len(fields) - 1; i >= 0; i-- {
+		if fields[i].Key == key {
+			return fields[i], true
+		}
+	}
+	return zapcore.Field{}, false
+}
+
+// fieldString returns the value of f in string form
+func fieldString(f zapcore.Field) string {
+	enc := zapcore.NewMapObjectEncoder()
+	f.AddTo(enc)
+	return fmt.Sprint(enc.Fields[f.Key])
+}
+
+// suppressCore drops or demotes the entries matching the rules of the config
+// A rule matching fields is applied on writing, when the fields are known,
+// so the wrapped core is checked by itself, like deferredCore does
+type suppressCore struct {
+	zapcore.Core
+	config *Config
+	// added by With, for the rules matching fields
+	with []zapcore.Field
+}
+
+// suppressEntry is an entry waiting for its fields to be matched
+type suppressEntry struct {
+	*suppressCore
+	rules *filterRules
+}
+
+// With implements zapcore.Core
+func (c *suppressCore) With(fields []zapcore.Field) zapcore.Core {
+	with := make([]zapcore.Field, 0, len(c.with)+len(fields))
+	with = append(with, c.with...)
+	return &suppressCore{Core: c.Core.With(fields), config: c.config, with: append(with, fields...)}
+}
+
+// Check implements zapcore.Core
+func (c *suppressCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	rules := c.config.suppressRules()
+	if rules == nil || ent.Level > zapcore.ErrorLevel || !c.Enabled(ent.Level) {
+		return c.Core.Check(ent, ce)
+	}
+	for _, r := range rules.rules {
+		if !r.matchEntry(ent) {
+			continue
+		}
+		if len(r.fields) > 0 {
+			return ce.AddCore(ent, suppressEntry{suppressCore: c, rules: rules})
+		}
+		atomic.AddUint64(&r.n, 1)
+		if !r.demote {
+			return ce
+		}
+		ent.Level = r.demoteTo
+		break
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// Write implements zapcore.Core
+func (e suppressEntry) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	for _, r := range e.rules.rules {
+		if !r.matchEntry(ent) || !r.matchFields(e.with, fields) {
+			continue
+		}
+		atomic.AddUint64(&r.n, 1)
+		if !r.demote {
+			return nil
+		}
+		ent.Level = r.demoteTo
+		break
+	}
+	if ce := e.Core.Check(ent, nil); ce != nil {
+		ce.Write(fields...)
+	}
+	return nil
+}
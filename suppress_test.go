@@ -0,0 +1,133 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/pflag"
+)
+
+func TestSuppressDrop(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	err := k.config.setSuppressRules([]FilterRule{
+		{Name: "healthz", Level: "info", Fields: map[string]string{"path": "/healthz", "code": "200"}},
+		{Message: "^noise"},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k.WithFields("path", "/healthz").InfoS("access", "code", 200)
+	k.InfoS("access", "path", "/healthz", "code", 200)
+	k.InfoS("access", "path", "/healthz", "code", 500)
+	k.InfoS("access", "path", "/api", "code", 200)
+	k.Warningw("access", "path", "/healthz", "code", 200)
+	k.Infof("noise %d", 1)
+	k.Error("noise")
+	SetExitFunc(func(int) {})
+	defer SetExitFunc(nil)
+	k.Fatalw("noise")
+
+	entries := readLines(t, path)
+	if len(entries) != 4 {
+		t.Fatalf("expect 4 entries, get %v", entries)
+	}
+	if entries[0]["code"] != float64(500) || entries[1]["path"] != "/api" || entries[2]["level"] != "warn" || entries[3]["level"] != "fatal" {
+		t.Errorf("unexpected entries %v", entries)
+	}
+	if n := k.config.suppressedEntries(); n["healthz"] != 2 || n["rule-1"] != 2 {
+		t.Errorf("expect the counters of the rules, get %v", n)
+	}
+}
+
+func TestSuppressDemote(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	err := k.config.setSuppressRules([]FilterRule{
+		{Message: "^poll", DemoteTo: "debug"},
+		{Level: "warning", Fields: map[string]string{"retry": "true"}, DemoteTo: "info"},
+	}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	k.Info("polling")
+	k.Warningw("timeout", "retry", true)
+	k.Warningw("timeout", "retry", false)
+
+	entries := readLines(t, path)
+	if len(entries) != 3 {
+		t.Fatalf("expect 3 entries, get %v", entries)
+	}
+	for i, level := range []string{"debug", "info", "warn"} {
+		if entries[i]["level"] != level {
+			t.Errorf("entry %d: expect %s, get %v", i, level, entries[i])
+		}
+	}
+}
+
+func TestReloadSuppressRules(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer swapLogger(k)()
+	dir := filepath.Dir(path)
+	first, second := filepath.Join(dir, "first.json"), filepath.Join(dir, "second.json")
+	if err := ioutil.WriteFile(first, []byte(`[{"name":"healthz","fields":{"path":"/healthz"}}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(second, []byte(`[{"name":"ready","fields":{"path":"/ready"}}]`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	InitFlags(fs)
+	if err := fs.Parse([]string{"--log_suppress_rules=" + first}); err != nil {
+		t.Fatal(err)
+	}
+	if v := fs.Lookup("log_suppress_rules").Value.String(); v != first {
+		t.Errorf("expect the path as the flag value, get %s", v)
+	}
+	InfoS("access", "path", "/healthz")
+	InfoS("access", "path", "/ready")
+
+	if err := LoadSuppressRules(second); err != nil {
+		t.Fatal(err)
+	}
+	InfoS("access", "path", "/healthz")
+	InfoS("access", "path", "/ready")
+	if n := SuppressedEntries(); len(n) != 1 || n["ready"] != 1 {
+		t.Errorf("expect the counters to start over, get %v", n)
+	}
+
+	if err := SetSuppressRules(nil); err != nil {
+		t.Fatal(err)
+	}
+	InfoS("access", "path", "/ready")
+	if err := SetSuppressRules([]FilterRule{{Message: "("}}); err == nil {
+		t.Error("expect an error of the invalid regexp")
+	}
+
+	var paths []interface{}
+	for _, e := range readLines(t, path) {
+		paths = append(paths, e["path"])
+	}
+	if len(paths) != 3 || paths[0] != "/ready" || paths[1] != "/healthz" || paths[2] != "/ready" {
+		t.Errorf("unexpected entries of %v", paths)
+	}
+}
@@ -0,0 +1,241 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// errorStatsTopN is the number of messages in ErrorStats.Top
+	errorStatsTopN = 5
+	// maxBucketMessages bounds the distinct messages counted per second
+	maxBucketMessages = 100
+)
+
+// thresholdInterval is how often the error threshold is checked besides
+// when an error is logged
+var thresholdInterval = time.Second
+
+// MessageCount is a message with the number of times it was logged
+type MessageCount struct {
+	Message string
+	Count   int
+}
+
+// ErrorStats is passed to the callback of SetErrorThreshold
+type ErrorStats struct {
+	// ERROR and above logged within Window
+	Count  int
+	Window time.Duration
+	// true on breaching the threshold, false on recovering
+	Breached bool
+	// the most frequent messages, at most 5
+	Top []MessageCount
+}
+
+// errorBucket counts the errors of a second
+type errorBucket struct {
+	sec  int64
+	n    int
+	msgs map[string]int
+}
+
+// errorThreshold counts the errors in a ring of per second buckets, which
+// is checked by watch
+type errorThreshold struct {
+	count  int
+	window time.Duration
+	fn     func(ErrorStats)
+	now    func() time.Time
+	wake   chan struct{}
+	stop   chan struct{}
+
+	mu      sync.Mutex
+	buckets []errorBucket
+	// only accessed by watch
+	breached bool
+}
+
+// SetErrorThreshold calls fn once the number of ERROR and above entries
+// logged within window reaches count, see Klogger.SetErrorThreshold
+func SetErrorThreshold(count int, window time.Duration, fn func(stats ErrorStats)) {
+	klogger.SetErrorThreshold(count, window, fn)
+}
+
+// SetErrorThreshold calls fn once the number of ERROR and above entries
+// logged by the loggers sharing the config of k within window reaches
+// count, e.g. to fail a readiness probe. It's called again with Breached
+// false once the number drops to half of count, and so on. The window is
+// counted in seconds by the clock of SetClock. fn is called from a
+// background goroutine, never while logging, and its panic is recovered
+// and logged. It replaces the previous threshold, a non-positive count or
+// nil fn removes it
+func (k *Klogger) SetErrorThreshold(count int, window time.Duration, fn func(stats ErrorStats)) {
+	c := k.config
+	var t *errorThreshold
+	if count > 0 && fn != nil {
+		n := int(window / time.Second)
+		if n < 1 {
+			n = 1
+		}
+		t = &errorThreshold{
+			count:   count,
+			window:  window,
+			fn:      fn,
+			now:     c.now,
+			wake:    make(chan struct{}, 1),
+			stop:    make(chan struct{}),
+			buckets: make([]errorBucket, n),
+		}
+	}
+	c.mu.Lock()
+	old := c.errorThreshold()
+	c.threshold.Store(thresholdHolder{t})
+	c.mu.Unlock()
+	if old != nil {
+		close(old.stop)
+	}
+	if t != nil {
+		c.sinks.run(func(stop <-chan struct{}) {
+			t.watch(k, stop)
+		})
+	}
+}
+
+// thresholdHolder is stored in atomic.Value, which rejects nil
+type thresholdHolder struct {
+	t *errorThreshold
+}
+
+// errorThreshold returns the threshold set by SetErrorThreshold
+func (c *Config) errorThreshold() *errorThreshold {
+	h, _ := c.threshold.Load().(thresholdHolder)
+	return h.t
+}
+
+// record counts an error, and wakes watch up
+func (t *errorThreshold) record(now time.Time, msg string) {
+	sec := now.Unix()
+	t.mu.Lock()
+	b := &t.buckets[sec%int64(len(t.buckets))]
+	if b.sec != sec || b.msgs == nil {
+		*b = errorBucket{sec: sec, msgs: make(map[string]int)}
+	}
+	b.n++
+	if _, ok := b.msgs[msg]; ok || len(b.msgs) < maxBucketMessages {
+		b.msgs[msg]++
+	}
+	t.mu.Unlock()
+
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// stats sums up the buckets within the window before now
+func (t *errorThreshold) stats(now time.Time) ErrorStats {
+	sec := now.Unix()
+	s := ErrorStats{Window: t.window}
+	counts := make(map[string]int)
+	t.mu.Lock()
+	for _, b := range t.buckets {
+		if b.sec > sec || b.sec <= sec-int64(len(t.buckets)) {
+			continue
+		}
+		s.Count += b.n
+		for msg, n := range b.msgs {
+			counts[msg] += n
+		}
+	}
+	t.mu.Unlock()
+
+	for msg, n := range counts {
+		s.Top = append(s.Top, MessageCount{Message: msg, Count: n})
+	}
+	sort.Slice(s.Top, func(i, j int) bool {
+		if s.Top[i].Count != s.Top[j].Count {
+			return s.Top[i].Count > s.Top[j].Count
+		}
+		return s.Top[i].Message < s.Top[j].Message
+	})
+	if len(s.Top) > errorStatsTopN {
+		s.Top = s.Top[:errorStatsTopN]
+	}
+	return s
+}
+
+// watch checks the threshold on errors and periodically, so that recovering
+// is noticed without errors, until stop or the threshold is replaced
+func (t *errorThreshold) watch(k *Klogger, stop <-chan struct{}) {
+	ticker := time.NewTicker(thresholdInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-t.wake:
+		case <-ticker.C:
+		case <-t.stop:
+			return
+		case <-stop:
+			return
+		}
+		s := t.stats(t.now())
+		switch {
+		case !t.breached && s.Count >= t.count:
+			t.breached, s.Breached = true, true
+		case t.breached && s.Count <= t.count/2:
+			t.breached = false
+		default:
+			continue
+		}
+		t.call(k, s)
+	}
+}
+
+// call calls fn and logs its panic
+func (t *errorThreshold) call(k *Klogger, s ErrorStats) {
+	defer func() {
+		if r := recover(); r != nil {
+			k.internal().Warningf("error threshold callback panicked: %v", r)
+		}
+	}()
+	t.fn(s)
+}
+
+// thresholdCore counts the errors for SetErrorThreshold
+type thresholdCore struct {
+	zapcore.Core
+	config *Config
+}
+
+// With implements zapcore.Core
+func (c *thresholdCore) With(fields []zapcore.Field) zapcore.Core {
+	return &thresholdCore{Core: c.Core.With(fields), config: c.config}
+}
+
+// Check implements zapcore.Core
+func (c *thresholdCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if ent.Level >= zapcore.ErrorLevel {
+		if t := c.config.errorThreshold(); t != nil && c.Enabled(ent.Level) {
+			t.record(ent.Time, ent.Message)
+		}
+	}
+	return c.Core.Check(ent, ce)
+}
@@ -0,0 +1,119 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xial-thu/klog/klogtest"
+)
+
+func TestErrorThreshold(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer k.Close(context.Background())
+	defer func(d time.Duration) { thresholdInterval = d }(thresholdInterval)
+	thresholdInterval = 5 * time.Millisecond
+	clock := klogtest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	k.config.clock.Store(clockHolder{clock})
+
+	calls := make(chan ErrorStats, 10)
+	k.SetErrorThreshold(3, 10*time.Second, func(s ErrorStats) {
+		calls <- s
+	})
+	expectCall := func(breached bool) ErrorStats {
+		t.Helper()
+		select {
+		case s := <-calls:
+			if s.Breached != breached {
+				t.Fatalf("expect breached %v, got %+v", breached, s)
+			}
+			return s
+		case <-time.After(time.Second):
+			t.Fatalf("expect a call with breached %v", breached)
+		}
+		return ErrorStats{}
+	}
+	expectNoCall := func() {
+		t.Helper()
+		select {
+		case s := <-calls:
+			t.Fatalf("unexpected call %+v", s)
+		case <-time.After(30 * time.Millisecond):
+		}
+	}
+
+	k.Error("db down")
+	k.Warning("not counted")
+	clock.Add(5 * time.Second)
+	k.Error("db down")
+	expectNoCall()
+
+	k.Error("cache miss")
+	s := expectCall(true)
+	if s.Count != 3 || s.Window != 10*time.Second {
+		t.Errorf("unexpected stats %+v", s)
+	}
+	if len(s.Top) != 2 || s.Top[0] != (MessageCount{"db down", 2}) || s.Top[1] != (MessageCount{"cache miss", 1}) {
+		t.Errorf("unexpected top messages %+v", s.Top)
+	}
+	// called once per breach
+	k.Error("db down")
+	expectNoCall()
+
+	// the first error is out of the window, 3 are left, then none
+	clock.Add(5 * time.Second)
+	expectNoCall()
+	clock.Add(6 * time.Second)
+	if s = expectCall(false); s.Count != 0 {
+		t.Errorf("expect no error left, got %+v", s)
+	}
+
+	k.Error("again")
+	k.Error("again")
+	expectNoCall()
+	k.Error("again")
+	if s = expectCall(true); s.Count != 3 || s.Top[0] != (MessageCount{"again", 3}) {
+		t.Errorf("expect breached again with 3 errors, got %+v", s)
+	}
+
+	k.SetErrorThreshold(0, 0, nil)
+	if k.config.errorThreshold() != nil {
+		t.Error("expect the threshold removed")
+	}
+	clock.Add(time.Minute)
+	expectNoCall()
+}
+
+func TestErrorThresholdPanic(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer k.Close(context.Background())
+
+	called := make(chan struct{})
+	k.SetErrorThreshold(1, time.Second, func(ErrorStats) {
+		defer close(called)
+		panic("boom")
+	})
+	defer k.SetErrorThreshold(0, 0, nil)
+	k.Error("failed")
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("expect the callback called")
+	}
+}
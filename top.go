@@ -0,0 +1,261 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// TopPath is where RegisterDebugHandlers serves TopHandler
+	TopPath = "/debug/klog/top"
+	// maxTrackedMessages bounds the callers counted per window, entries of
+	// the others are only counted as Untracked
+	maxTrackedMessages = 1000
+	// defaultTopN is the number of messages served by TopHandler
+	defaultTopN = 20
+)
+
+// MessageStat is how many times a caller logged at a level
+type MessageStat struct {
+	Level  zapcore.Level `json:"level"`
+	Caller string        `json:"caller,omitempty"`
+	// the first message logged by the caller
+	Message string `json:"msg"`
+	Count   uint64 `json:"count"`
+}
+
+// messageKey identifies a caller and a level, or a message if the caller
+// is not logged. The caller is the file and line rather than the PC, which
+// differs for each copy of an inlined func
+type messageKey struct {
+	file  string
+	line  int
+	level zapcore.Level
+	msg   string
+}
+
+// MessageTracker counts the entries of each caller and level, see
+// TrackMessages
+type MessageTracker struct {
+	window time.Duration
+
+	mu      sync.Mutex
+	started time.Time
+	// the counts of the current window and the previous one
+	current, previous map[messageKey]*MessageStat
+	untracked         uint64
+}
+
+// TrackMessages starts counting the entries of each caller and level, and
+// returns the tracker, see Klogger.TrackMessages
+func TrackMessages(window time.Duration) *MessageTracker {
+	return klogger.TrackMessages(window)
+}
+
+// TrackMessages starts counting the entries written by the loggers sharing
+// the config of k, keyed by their caller and level, e.g. to find the most
+// frequent messages of the last hour. Counts are kept for the current
+// window and the previous one, at most 1000 callers each. It replaces the
+// previous tracker, a non-positive window stops tracking and returns nil
+func (k *Klogger) TrackMessages(window time.Duration) *MessageTracker {
+	var t *MessageTracker
+	if window > 0 {
+		t = &MessageTracker{
+			window:  window,
+			started: k.config.now(),
+			current: make(map[messageKey]*MessageStat),
+		}
+	}
+	k.config.tracker.Store(trackerHolder{t})
+	return t
+}
+
+// trackerHolder is stored in atomic.Value, which rejects nil
+type trackerHolder struct {
+	t *MessageTracker
+}
+
+// messageTracker returns the tracker of TrackMessages
+func (c *Config) messageTracker() *MessageTracker {
+	h, _ := c.tracker.Load().(trackerHolder)
+	return h.t
+}
+
+// record counts an entry
+func (t *MessageTracker) record(ent zapcore.Entry) {
+	key := messageKey{file: ent.Caller.File, line: ent.Caller.Line, level: ent.Level}
+	if !ent.Caller.Defined {
+		key.msg = ent.Message
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if ent.Time.Sub(t.started) >= t.window {
+		t.rotate(ent.Time)
+	}
+	if s, ok := t.current[key]; ok {
+		s.Count++
+		return
+	}
+	if len(t.current) >= maxTrackedMessages {
+		t.untracked++
+		return
+	}
+	s := &MessageStat{Level: ent.Level, Message: ent.Message, Count: 1}
+	if ent.Caller.Defined {
+		s.Caller = ent.Caller.TrimmedPath()
+	}
+	t.current[key] = s
+}
+
+// rotate starts a new window at now, t.mu is held
+func (t *MessageTracker) rotate(now time.Time) {
+	t.previous = t.current
+	if now.Sub(t.started) >= 2*t.window {
+		// nothing was logged in the last window
+		t.previous = nil
+	}
+	t.current = make(map[messageKey]*MessageStat, len(t.previous))
+	t.started = now
+	t.untracked = 0
+}
+
+// Report returns the n callers logging the most in the current window and
+// the previous one, the most frequent first. n <= 0 returns all of them
+func (t *MessageTracker) Report(n int) []MessageStat {
+	t.mu.Lock()
+	counts := make(map[messageKey]MessageStat, len(t.current)+len(t.previous))
+	for _, m := range []map[messageKey]*MessageStat{t.previous, t.current} {
+		for key, s := range m {
+			if c, ok := counts[key]; ok {
+				c.Count += s.Count
+				counts[key] = c
+				continue
+			}
+			counts[key] = *s
+		}
+	}
+	t.mu.Unlock()
+
+	stats := make([]MessageStat, 0, len(counts))
+	for _, s := range counts {
+		stats = append(stats, s)
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		a, b := stats[i], stats[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		if a.Caller != b.Caller {
+			return a.Caller < b.Caller
+		}
+		return a.Message < b.Message
+	})
+	if n > 0 && len(stats) > n {
+		stats = stats[:n]
+	}
+	return stats
+}
+
+// Untracked returns how many entries of the current window were not counted
+// since 1000 callers were already tracked
+func (t *MessageTracker) Untracked() uint64 {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.untracked
+}
+
+// TopHandler serves the Report of TrackMessages as JSON, the number of
+// callers is set by the "n" query parameter, default to 20. It responds 404
+// if messages are not tracked
+func TopHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "only GET is supported", http.StatusMethodNotAllowed)
+			return
+		}
+		t := klogger.config.messageTracker()
+		if t == nil {
+			http.Error(w, "messages are not tracked, see TrackMessages", http.StatusNotFound)
+			return
+		}
+		n := defaultTopN
+		if s := r.URL.Query().Get("n"); s != "" {
+			var err error
+			if n, err = strconv.Atoi(s); err != nil {
+				http.Error(w, "invalid n: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(t.Report(n))
+	})
+}
+
+// trackerCore counts the entries written for TrackMessages
+type trackerCore struct {
+	zapcore.Core
+	config *Config
+}
+
+// With implements zapcore.Core
+func (c *trackerCore) With(fields []zapcore.Field) zapcore.Core {
+	return &trackerCore{Core: c.Core.With(fields), config: c.config}
+}
+
+// Check implements zapcore.Core, the caller is known when the entry is
+// written, so the tracker is added as a core of the checked entry
+func (c *trackerCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	ce = c.Core.Check(ent, ce)
+	if ce == nil {
+		return nil
+	}
+	if t := c.config.messageTracker(); t != nil {
+		ce = ce.AddCore(ent, trackerWriter{t})
+	}
+	return ce
+}
+
+// trackerWriter is the core counting the entries of a MessageTracker
+type trackerWriter struct {
+	t *MessageTracker
+}
+
+// Enabled implements zapcore.Core
+func (w trackerWriter) Enabled(zapcore.Level) bool { return true }
+
+// With implements zapcore.Core
+func (w trackerWriter) With([]zapcore.Field) zapcore.Core { return w }
+
+// Check implements zapcore.Core
+func (w trackerWriter) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return ce.AddCore(ent, w)
+}
+
+// Write implements zapcore.Core
+func (w trackerWriter) Write(ent zapcore.Entry, _ []zapcore.Field) error {
+	w.t.record(ent)
+	return nil
+}
+
+// Sync implements zapcore.Core
+func (w trackerWriter) Sync() error { return nil }
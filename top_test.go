@@ -0,0 +1,153 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xial-thu/klog/klogtest"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTrackMessages(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer k.Close(context.Background())
+	clock := klogtest.NewFakeClock(time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC))
+	k.config.clock.Store(clockHolder{clock})
+
+	tracker := k.TrackMessages(time.Hour)
+	slow := func() { k.Warning("slow") }
+	for i := 0; i < 100; i++ {
+		k.Infof("request %d", i)
+		if i%3 == 0 {
+			slow()
+		}
+		if i%20 == 0 {
+			k.Infof("request %d", i)
+		}
+	}
+	k.V(1).Info("disabled")
+
+	top := tracker.Report(3)
+	if len(top) != 3 {
+		t.Fatalf("expect 3 callers, got %+v", top)
+	}
+	expect := []struct {
+		level zapcore.Level
+		msg   string
+		count uint64
+	}{
+		{zapcore.InfoLevel, "request 0", 100},
+		{zapcore.WarnLevel, "slow", 34},
+		{zapcore.InfoLevel, "request 0", 5},
+	}
+	for i, e := range expect {
+		s := top[i]
+		if s.Level != e.level || s.Message != e.msg || s.Count != e.count || !strings.Contains(s.Caller, "top_test.go:") {
+			t.Errorf("expect %+v at %d, got %+v", e, i, s)
+		}
+	}
+	if top[0].Caller == top[2].Caller {
+		t.Error("expect the callers told apart")
+	}
+
+	// the previous window is kept, then dropped
+	clock.Add(time.Hour)
+	slow()
+	if top := tracker.Report(0); len(top) != 3 || top[1].Count != 35 {
+		t.Errorf("expect the previous window counted, got %+v", top)
+	}
+	clock.Add(time.Hour)
+	slow()
+	if top := tracker.Report(0); len(top) != 1 || top[0].Count != 2 {
+		t.Errorf("expect the last 2 windows counted, got %+v", top)
+	}
+	clock.Add(3 * time.Hour)
+	slow()
+	if top := tracker.Report(0); len(top) != 1 || top[0].Count != 1 {
+		t.Errorf("expect idle windows dropped, got %+v", top)
+	}
+
+	if k.TrackMessages(0) != nil || k.config.messageTracker() != nil {
+		t.Error("expect tracking stopped")
+	}
+	k.Info("not tracked")
+	if top := tracker.Report(0); top[0].Count != 1 {
+		t.Errorf("expect the stopped tracker unchanged, got %+v", top)
+	}
+}
+
+func TestMessageTrackerBound(t *testing.T) {
+	tracker := &MessageTracker{window: time.Hour, current: make(map[messageKey]*MessageStat)}
+	now := time.Now()
+	tracker.started = now
+	for i := 0; i < maxTrackedMessages+10; i++ {
+		tracker.record(zapcore.Entry{Time: now, Message: "msg " + strconv.Itoa(i)})
+	}
+	tracker.record(zapcore.Entry{Time: now, Message: "msg 0"})
+	if n := len(tracker.Report(0)); n != maxTrackedMessages {
+		t.Errorf("expect %d callers tracked, got %d", maxTrackedMessages, n)
+	}
+	if n := tracker.Untracked(); n != 10 {
+		t.Errorf("expect 10 untracked, got %d", n)
+	}
+	if top := tracker.Report(1); top[0].Message != "msg 0" || top[0].Count != 2 {
+		t.Errorf("expect the tracked ones still counted, got %+v", top)
+	}
+}
+
+func TestTopHandler(t *testing.T) {
+	k, path := newFileLogger(t)
+	defer removeDir(path)
+	defer k.Close(context.Background())
+	defer swapLogger(k)()
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		TopHandler().ServeHTTP(w, httptest.NewRequest("GET", target, nil))
+		return w
+	}
+	if w := serve(TopPath); w.Code != http.StatusNotFound {
+		t.Errorf("expect 404 without tracking, got %d", w.Code)
+	}
+
+	TrackMessages(time.Hour)
+	defer TrackMessages(0)
+	a := func() { Info("a") }
+	for i := 0; i < 3; i++ {
+		a()
+		Info("b")
+	}
+	a()
+	if w := serve(TopPath + "?n=x"); w.Code != http.StatusBadRequest {
+		t.Errorf("expect 400 for an invalid n, got %d", w.Code)
+	}
+	w := serve(TopPath + "?n=1")
+	var stats []map[string]interface{}
+	if err := json.Unmarshal(w.Body.Bytes(), &stats); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats) != 1 || stats[0]["msg"] != "a" || stats[0]["count"] != float64(4) || stats[0]["level"] != "info" {
+		t.Errorf("unexpected report %v", stats)
+	}
+}
@@ -0,0 +1,199 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+const (
+	// TraceIDKey holds the trace ID set by WithNewTraceID and TraceMiddleware
+	TraceIDKey = "trace_id"
+	// maxTraceIDLen bounds the incoming trace IDs, longer ones are replaced
+	maxTraceIDLen = 128
+)
+
+var (
+	// traceIDHeader is the request header of incoming trace IDs
+	traceIDHeader = "X-Trace-Id"
+	// randReaders buffer crypto/rand, so that an ID rarely costs a syscall
+	randReaders = sync.Pool{New: func() interface{} {
+		return bufio.NewReaderSize(rand.Reader, 1024)
+	}}
+)
+
+// traceIDKey is the key of the trace ID stored in a context
+type traceIDKey struct{}
+
+// SetTraceIDHeader sets the request header read by TraceMiddleware, default
+// to X-Trace-Id. Call it before serving
+func SetTraceIDHeader(name string) {
+	traceIDHeader = http.CanonicalHeaderKey(name)
+}
+
+// newTraceID returns 16 random bytes in hex
+func newTraceID() string {
+	var b [16]byte
+	r := randReaders.Get().(*bufio.Reader)
+	_, err := io.ReadFull(r, b[:])
+	randReaders.Put(r)
+	if err != nil {
+		// crypto/rand doesn't fail on supported platforms
+		panic("klog: failed reading random bytes: " + err.Error())
+	}
+	return hex.EncodeToString(b[:])
+}
+
+// WithNewTraceID generates a trace ID, and returns a copy of ctx carrying it
+// along with the logger of ctx, see FromContext, which logs it as "trace_id"
+func WithNewTraceID(ctx context.Context) (context.Context, *Klogger) {
+	return WithTraceID(ctx, newTraceID())
+}
+
+// WithTraceID is WithNewTraceID with the given ID
+func WithTraceID(ctx context.Context, id string) (context.Context, *Klogger) {
+	k := FromContext(ctx).WithZapFields(zap.String(TraceIDKey, id))
+	ctx = context.WithValue(ctx, traceIDKey{}, id)
+	return NewContext(ctx, k), k
+}
+
+// TraceIDFromContext returns the trace ID carried by ctx, or ""
+func TraceIDFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(traceIDKey{}).(string)
+	return id
+}
+
+// MiddlewareOption configures NewTraceMiddleware
+type MiddlewareOption func(*middlewareConfig)
+
+// middlewareConfig is set by the MiddlewareOptions
+type middlewareConfig struct {
+	// flush the request buffer at this status or above, 0 to not buffer
+	bufferStatus int
+	// set by VerbosityOverride
+	overrideHeader string
+	tokenHeader    string
+	validToken     func(token string) bool
+	// set by RecoverPanics and IncidentIDHeader
+	recoverPanics  bool
+	repanic        bool
+	incidentHeader string
+}
+
+// BufferVerbose makes the logger of each request a NewRequestBuffer one, whose
+// V() entries are flushed at INFO if the response status is at least
+// minStatus, or the handler panics, and discarded otherwise
+func BufferVerbose(minStatus int) MiddlewareOption {
+	return func(c *middlewareConfig) {
+		c.bufferStatus = minStatus
+	}
+}
+
+// TraceMiddleware sets a trace ID on the context of each request, taken from
+// the header set by SetTraceIDHeader, or generated if it's absent. Handlers
+// get the logger with it by FromContext(r.Context())
+func TraceMiddleware(next http.Handler) http.Handler {
+	return NewTraceMiddleware()(next)
+}
+
+// NewTraceMiddleware returns TraceMiddleware configured by opts
+func NewTraceMiddleware(opts ...MiddlewareOption) func(http.Handler) http.Handler {
+	c := middlewareConfig{incidentHeader: IncidentIDHeaderName}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := strings.TrimSpace(r.Header.Get(traceIDHeader))
+			if id == "" || len(id) > maxTraceIDLen {
+				id = newTraceID()
+			}
+			ctx, k := WithTraceID(r.Context(), id)
+			var sw *statusWriter
+			if c.recoverPanics || c.bufferStatus != 0 {
+				sw = &statusWriter{ResponseWriter: w}
+				w = sw
+			}
+			if c.recoverPanics {
+				defer c.recoverPanic(k, sw, r)
+			}
+			if c.overrideHeader != "" {
+				var ok bool
+				ctx, ok = OverrideVerbosity(ctx, r.Header.Get(c.overrideHeader), r.Header.Get(c.tokenHeader), c.validToken)
+				if ok {
+					next.ServeHTTP(w, r.WithContext(ctx))
+					return
+				}
+			}
+			if c.bufferStatus == 0 {
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+			buffered := NewRequestBuffer(k)
+			done := false
+			defer func() {
+				if !done || sw.status >= c.bufferStatus {
+					buffered.FlushBuffer(zapcore.InfoLevel)
+				} else {
+					buffered.DiscardBuffer()
+				}
+			}()
+			next.ServeHTTP(w, r.WithContext(NewContext(ctx, buffered)))
+			done = true
+		})
+	}
+}
+
+// statusWriter records the status of a response
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader implements http.ResponseWriter
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush implements http.Flusher if the underlying writer does
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
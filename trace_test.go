@@ -0,0 +1,99 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+// traceIDPattern matches the generated trace IDs
+var traceIDPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+func TestWithNewTraceID(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	ctx, logger := WithNewTraceID(context.Background())
+	id := TraceIDFromContext(ctx)
+	if !traceIDPattern.MatchString(id) {
+		t.Fatalf("unexpected trace id %q", id)
+	}
+	logger.Infof("direct")
+	FromContext(ctx).Infof("from context")
+	FromContext(context.WithValue(ctx, struct{}{}, 1)).Infof("nested")
+	// the global logger picks it up if ctx carries no logger
+	FromContext(context.WithValue(context.Background(), traceIDKey{}, id)).Infof("id only")
+	FromContext(context.Background()).Infof("none")
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 5 {
+		t.Fatalf("expect 5 entries, get %v", entries)
+	}
+	for _, e := range entries[:4] {
+		if e[TraceIDKey] != id {
+			t.Errorf("expect trace id %s, get %v", id, e)
+		}
+	}
+	if _, ok := entries[4][TraceIDKey]; ok {
+		t.Errorf("unexpected trace id in %v", entries[4])
+	}
+
+	other, _ := WithNewTraceID(context.Background())
+	if TraceIDFromContext(other) == id {
+		t.Error("expect a new trace id")
+	}
+}
+
+func TestTraceMiddleware(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	defer SetTraceIDHeader(traceIDHeader)
+	SetTraceIDHeader("x-request-id")
+
+	var ids []string
+	handler := TraceMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ids = append(ids, TraceIDFromContext(r.Context()))
+		FromContext(r.Context()).Infof("handled")
+	}))
+	for _, id := range []string{"incoming-1", ""} {
+		r := httptest.NewRequest("GET", "/", nil)
+		if id != "" {
+			r.Header.Set("X-Request-Id", id)
+		}
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if len(ids) != 2 || ids[0] != "incoming-1" || !traceIDPattern.MatchString(ids[1]) {
+		t.Fatalf("unexpected trace ids %q", ids)
+	}
+	for i, e := range decodeLines(t, buf) {
+		if e[TraceIDKey] != ids[i] {
+			t.Errorf("expect trace id %s, get %v", ids[i], e)
+		}
+	}
+}
+
+func BenchmarkNewTraceID(b *testing.B) {
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			newTraceID()
+		}
+	})
+}
@@ -0,0 +1,90 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"encoding/hex"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// Field is a strongly typed field, the same as zap.Field, so that callers
+// don't have to import zap
+type Field = zap.Field
+
+// String returns a string field
+func String(key string, val string) Field {
+	return zap.String(key, val)
+}
+
+// Int returns an int field
+func Int(key string, val int) Field {
+	return zap.Int(key, val)
+}
+
+// Bool returns a bool field
+func Bool(key string, val bool) Field {
+	return zap.Bool(key, val)
+}
+
+// Err returns err as field "error", like ErrorS does
+func Err(err error) Field {
+	return zap.Error(err)
+}
+
+// Time returns a time field, encoded like the time of entries
+func Time(key string, val time.Time) Field {
+	return zap.Time(key, val)
+}
+
+// Hex returns b encoded in hex, e.g. for checksums
+func Hex(key string, b []byte) Field {
+	return zap.String(key, hex.EncodeToString(b))
+}
+
+// Base64 returns b encoded in standard base64
+func Base64(key string, b []byte) Field {
+	return zap.Binary(key, b)
+}
+
+// Any returns a field of val encoded like the values of WithFields
+func Any(key string, val interface{}) Field {
+	return anyField(key, val)
+}
+
+// WithZapFields adds typed fields to a logger, which skips the type detection
+// of WithFields. Fields are passed to zap as they are
+func WithZapFields(fields ...Field) *Klogger {
+	return klogger.WithZapFields(fields...)
+}
+
+// WithZapFields adds typed fields to a logger, which skips the type detection
+// of WithFields. Fields are passed to zap as they are
+func (k *Klogger) WithZapFields(fields ...Field) *Klogger {
+	return k.deriveWith(withFields(k.sugar, fields), fields)
+}
+
+// Infos logs a message with typed fields, like InfoS without boxing values
+//go:noinline
+func Infos(msg string, fields ...Field) {
+	klogger.sugar.Desugar().Info(msg, fields...)
+}
+
+// Infos logs a message with typed fields, like InfoS without boxing values
+//go:noinline
+func (k *Klogger) Infos(msg string, fields ...Field) {
+	k.sugar.Desugar().Info(msg, fields...)
+}
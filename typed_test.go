@@ -0,0 +1,117 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestTypedFields(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	now := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	WithZapFields(String("s", "a"), Int("i", 1)).Infos("typed",
+		Bool("b", true),
+		Err(errors.New("failed")),
+		Time("t", now),
+		Any("any", []int{1}),
+	)
+	k.Infos("method", Int("i", 2))
+
+	entries := decodeLines(t, buf)
+	if len(entries) != 2 {
+		t.Fatalf("expect 2 entries, get %d", len(entries))
+	}
+	expect := map[string]interface{}{
+		"s":     "a",
+		"i":     float64(1),
+		"b":     true,
+		"error": "failed",
+		"t":     float64(now.UnixNano()) / float64(time.Second),
+		"any":   []interface{}{float64(1)},
+	}
+	for key, val := range expect {
+		if !reflect.DeepEqual(entries[0][key], val) {
+			t.Errorf("expect %s to be %v, get %v", key, val, entries[0][key])
+		}
+	}
+	for _, e := range entries {
+		if caller, _ := e["caller"].(string); !strings.Contains(caller, "/typed_test.go:") {
+			t.Errorf("expect the caller in this file, get %q", caller)
+		}
+	}
+	if entries[1]["i"] != float64(2) {
+		t.Errorf("unexpected entry %v", entries[1])
+	}
+}
+
+func BenchmarkTypedFields(b *testing.B) {
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()), zapcore.AddSync(ioutil.Discard), zapcore.DebugLevel)
+	k := &Klogger{sugar: zap.New(core).Sugar(), config: newConfig()}
+
+	b.Run("WithFields", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			k.WithFields("count", i, "name", "a", "ok", true).InfoS("event")
+		}
+	})
+	b.Run("WithZapFields", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			k.WithZapFields(Int("count", i), String("name", "a"), Bool("ok", true)).Infos("event")
+		}
+	})
+	b.Run("InfoS", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			k.InfoS("event", "count", i, "name", "a", "ok", true)
+		}
+	})
+	b.Run("Infos", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			k.Infos("event", Int("count", i), String("name", "a"), Bool("ok", true))
+		}
+	})
+}
+
+func TestBinaryFields(t *testing.T) {
+	k, buf := newTestLogger()
+	k.Infos("binary",
+		Hex("hex", []byte{0xde, 0xad, 0xbe, 0xef}),
+		Base64("base64", []byte("hi")),
+		Hex("nilHex", nil),
+		Base64("nilBase64", nil),
+	)
+	entries := decodeLines(t, buf)
+	if len(entries) != 1 {
+		t.Fatalf("expect 1 entry, get %d", len(entries))
+	}
+	expect := map[string]interface{}{"hex": "deadbeef", "base64": "aGk=", "nilHex": "", "nilBase64": ""}
+	for key, val := range expect {
+		if entries[0][key] != val {
+			t.Errorf("expect %s to be %q, get %v", key, val, entries[0][key])
+		}
+	}
+}
@@ -0,0 +1,77 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// byteUnits are the IEC units used by Bytes
+var byteUnits = []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB", "EiB"}
+
+// durationValue encodes a duration as seconds and a readable string
+type durationValue time.Duration
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (d durationValue) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddFloat64("seconds", time.Duration(d).Seconds())
+	enc.AddString("human", time.Duration(d).String())
+	return nil
+}
+
+// Duration returns a field like {"seconds":1.5,"human":"1.5s"}
+func Duration(key string, d time.Duration) zap.Field {
+	return zap.Object(key, durationValue(d))
+}
+
+// bytesValue encodes a size as bytes and a readable string
+type bytesValue int64
+
+// MarshalLogObject implements zapcore.ObjectMarshaler
+func (n bytesValue) MarshalLogObject(enc zapcore.ObjectEncoder) error {
+	enc.AddInt64("bytes", int64(n))
+	enc.AddString("human", humanBytes(int64(n)))
+	return nil
+}
+
+// Bytes returns a field like {"bytes":1572864,"human":"1.5 MiB"}
+func Bytes(key string, n int64) zap.Field {
+	return zap.Object(key, bytesValue(n))
+}
+
+// humanBytes formats n in the largest IEC unit not greater than it
+func humanBytes(n int64) string {
+	abs := n
+	if abs < 0 {
+		abs = -abs
+	}
+	if abs < 1024 {
+		return fmt.Sprintf("%d B", n)
+	}
+	f, i := float64(n), 0
+	for ; i < len(byteUnits)-1 && (f >= 1024 || f <= -1024); i++ {
+		f /= 1024
+	}
+	return fmt.Sprintf("%.1f %s", f, byteUnits[i])
+}
+
+// SetTimeLayout sets the layout of time.Time values filled by With
+func SetTimeLayout(layout string) {
+	klogger.config.timeLayout.set(layout)
+}
@@ -0,0 +1,84 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDurationAndBytes(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	Infow("done", Duration("took", 1500*time.Millisecond), Bytes("size", 3<<19))
+	WithFields(Bytes("small", 512), Bytes("huge", 5<<40)).Info("sizes")
+
+	entries := decodeLines(t, buf)
+	expects := []map[string]interface{}{
+		{
+			"took": map[string]interface{}{"seconds": 1.5, "human": "1.5s"},
+			"size": map[string]interface{}{"bytes": float64(3 << 19), "human": "1.5 MiB"},
+		},
+		{
+			"small": map[string]interface{}{"bytes": float64(512), "human": "512 B"},
+			"huge":  map[string]interface{}{"bytes": float64(5 << 40), "human": "5.0 TiB"},
+		},
+	}
+	for i, expect := range expects {
+		for key, val := range expect {
+			if !reflect.DeepEqual(entries[i][key], val) {
+				t.Errorf("expect %s %v, get %v", key, val, entries[i][key])
+			}
+		}
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	for n, expect := range map[int64]string{
+		0:        "0 B",
+		1023:     "1023 B",
+		1024:     "1.0 KiB",
+		-2048:    "-2.0 KiB",
+		10 << 30: "10.0 GiB",
+	} {
+		if s := humanBytes(n); s != expect {
+			t.Errorf("expect %s for %d, get %s", expect, n, s)
+		}
+	}
+}
+
+func TestWithReadableTime(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+
+	at := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	type S struct {
+		Took time.Duration
+		At   time.Time
+	}
+	With(S{Took: 90 * time.Second, At: at}).Info("struct")
+	SetTimeLayout("2006-01-02")
+	With(map[string]interface{}{"at": at}).Info("map")
+
+	entries := decodeLines(t, buf)
+	if entries[0]["Took"] != "1m30s" || entries[0]["At"] != "2020-01-02T03:04:05Z" {
+		t.Errorf("unexpected entry %v", entries[0])
+	}
+	if entries[1]["at"] != "2020-01-02" {
+		t.Errorf("unexpected entry %v", entries[1])
+	}
+}
@@ -0,0 +1,168 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"fmt"
+	"strings"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// SetWrapErrorFields sets whether the errors formatted by %w in Infof,
+// Errorf and so on are logged as "error", or "errors" if there are more,
+// besides the message. Default to false
+func SetWrapErrorFields(enabled bool) {
+	klogger.config.wrapFields.set(enabled)
+}
+
+// hasWrapVerb reports whether format may have %w, which is rare, so that
+// the shims take the slow path only then
+func hasWrapVerb(format string) bool {
+	return strings.Contains(format, "%w")
+}
+
+// rewriteWrapVerbs returns format with each %w replaced by %v, along with
+// the args they format. Only fmt.Errorf accepts %w, others print
+// "%!w(...)" for it
+func rewriteWrapVerbs(format string, args []interface{}) (string, []interface{}) {
+	var b []byte
+	var wrapped []interface{}
+	arg := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		i++
+		for i < len(format) && strings.IndexByte("+-# 0", format[i]) >= 0 {
+			i++
+		}
+		i, arg = argIndex(format, i, arg)
+		if i < len(format) && format[i] == '*' {
+			i, arg = i+1, arg+1
+		} else {
+			i = skipDigits(format, i)
+		}
+		if i < len(format) && format[i] == '.' {
+			i, arg = argIndex(format, i+1, arg)
+			if i < len(format) && format[i] == '*' {
+				i, arg = i+1, arg+1
+			} else {
+				i = skipDigits(format, i)
+			}
+		}
+		i, arg = argIndex(format, i, arg)
+		if i >= len(format) {
+			break
+		}
+		switch format[i] {
+		case '%':
+			continue
+		case 'w':
+			if b == nil {
+				b = []byte(format)
+			}
+			b[i] = 'v'
+			if arg < len(args) {
+				wrapped = append(wrapped, args[arg])
+			}
+		}
+		arg++
+	}
+	if b == nil {
+		return format, nil
+	}
+	return string(b), wrapped
+}
+
+// argIndex parses an explicit argument index like [2] at i, and returns the
+// position after it and the index of the next arg
+func argIndex(format string, i, arg int) (int, int) {
+	if i >= len(format) || format[i] != '[' {
+		return i, arg
+	}
+	n := 0
+	for j := i + 1; j < len(format); j++ {
+		c := format[j]
+		if c == ']' {
+			if j == i+1 {
+				return j + 1, arg
+			}
+			return j + 1, n - 1
+		}
+		if c < '0' || c > '9' {
+			return i, arg
+		}
+		n = n*10 + int(c-'0')
+	}
+	return i, arg
+}
+
+// skipDigits returns the position of the first non-digit from i
+func skipDigits(format string, i int) int {
+	for i < len(format) && format[i] >= '0' && format[i] <= '9' {
+		i++
+	}
+	return i
+}
+
+// sprintf is fmt.Sprintf accepting %w as %v, which is reported as a misuse
+// The wrapped errors are returned as fields if SetWrapErrorFields is on
+func (k *Klogger) sprintf(format string, args []interface{}) (string, []zap.Field) {
+	if !hasWrapVerb(format) {
+		return fmt.Sprintf(format, args...), nil
+	}
+	fixed, wrapped := rewriteWrapVerbs(format, args)
+	if len(wrapped) == 0 && fixed == format {
+		return fmt.Sprintf(format, args...), nil
+	}
+	k.misuse("%w in a format of klog, use %v", zap.String("format", format))
+	msg := fmt.Sprintf(fixed, args...)
+	if !k.config.wrapFields.get() {
+		return msg, nil
+	}
+	var errs []error
+	for _, arg := range wrapped {
+		if err, ok := arg.(error); ok {
+			errs = append(errs, err)
+		}
+	}
+	switch len(errs) {
+	case 0:
+		return msg, nil
+	case 1:
+		return msg, []zap.Field{zap.Error(errs[0])}
+	}
+	return msg, []zap.Field{zap.Errors("errors", errs)}
+}
+
+// wrapf logs a format with %w verbs at lvl, reporting the caller of the shim
+// calling it
+func (k *Klogger) wrapf(lvl zapcore.Level, format string, args []interface{}) {
+	l := k.depthLogger(1)
+	if !l.Core().Enabled(lvl) {
+		return
+	}
+	msg, fields := k.sprintf(format, args)
+	if lvl == zapcore.ErrorLevel {
+		if f, ok := k.fingerprintField(format); ok {
+			fields = append(fields, f)
+		}
+	}
+	if ce := l.Check(lvl, msg); ce != nil {
+		ce.Write(fields...)
+	}
+}
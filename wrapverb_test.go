@@ -0,0 +1,115 @@
+/*
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package klog
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestRewriteWrapVerbs(t *testing.T) {
+	e1, e2 := errors.New("e1"), errors.New("e2")
+	cases := []struct {
+		format  string
+		args    []interface{}
+		fixed   string
+		wrapped []interface{}
+	}{
+		{"failed: %v", []interface{}{e1}, "failed: %v", nil},
+		{"failed: %w", []interface{}{e1}, "failed: %v", []interface{}{e1}},
+		{"%d: %w, then %+w", []interface{}{1, e1, e2}, "%d: %v, then %+v", []interface{}{e1, e2}},
+		{"100%% %w", []interface{}{e1}, "100%% %v", []interface{}{e1}},
+		{"%%w", nil, "%%w", nil},
+		{"%*d %-5.*f %w", []interface{}{3, 1, 2, 1.5, e1}, "%*d %-5.*f %v", []interface{}{e1}},
+		{"%[2]w %[1]s", []interface{}{"a", e2}, "%[2]v %[1]s", []interface{}{e2}},
+		{"%w %w", []interface{}{e1}, "%v %v", []interface{}{e1}},
+		{"trailing %", nil, "trailing %", nil},
+	}
+	for _, c := range cases {
+		fixed, wrapped := rewriteWrapVerbs(c.format, c.args)
+		if fixed != c.fixed || !reflect.DeepEqual(wrapped, c.wrapped) {
+			t.Errorf("%q: expect %q %v, got %q %v", c.format, c.fixed, c.wrapped, fixed, wrapped)
+		}
+	}
+}
+
+func TestWrapVerbInShims(t *testing.T) {
+	k, buf := newTestLogger()
+	defer swapLogger(k)()
+	k.SetLevel(1)
+	// formats in variables, since vet rejects %w in constant ones
+	single, multiple := "failed: %w", "%s: %w, %w"
+	e1, e2 := errors.New("e1"), errors.New("e2")
+
+	Errorf(single, e1)
+	k.Warningf(multiple, "op", e1, e2)
+	k.V(1).Infof(single, e1)
+	Printf(single, e1)
+	SetWrapErrorFields(true)
+	defer SetWrapErrorFields(false)
+	k.Errorf(single, e1)
+	Infof(multiple, "op", e1, e2)
+	k.Infof(single, "not an error")
+
+	lines := decodeLines(t, buf)
+	if len(lines) != 7 {
+		t.Fatalf("expect 7 entries, got %v", lines)
+	}
+	msgs := []string{"failed: e1", "op: e1, e2", "failed: e1", "failed: e1", "failed: e1", "op: e1, e2", "failed: not an error"}
+	for i, line := range lines {
+		if line["msg"] != msgs[i] {
+			t.Errorf("expect %q, got %v", msgs[i], line["msg"])
+		}
+		if caller, _ := line["caller"].(string); !strings.Contains(caller, "wrapverb_test.go:") {
+			t.Errorf("expect the caller in the test, got %v", line)
+		}
+		if i < 4 && (line["error"] != nil || line["errors"] != nil) {
+			t.Errorf("expect no error field without SetWrapErrorFields, got %v", line)
+		}
+	}
+	if lines[4]["error"] != "e1" {
+		t.Errorf("expect the error extracted, got %v", lines[4])
+	}
+	if errs, _ := lines[5]["errors"].([]interface{}); len(errs) != 2 {
+		t.Errorf("expect both errors extracted, got %v", lines[5])
+	}
+	if lines[6]["error"] != nil {
+		t.Errorf("expect no error field of a non-error, got %v", lines[6])
+	}
+}
+
+func TestWrapVerbMisuse(t *testing.T) {
+	format := "failed: %w"
+	k, _ := newModeLogger(false)
+	if r := catchPanic(func() { k.Errorf(format, errors.New("x")) }); r != nil {
+		t.Errorf("expect %%w tolerated in production, got %v", r)
+	}
+	k, buf := newModeLogger(true)
+	if r := catchPanic(func() { k.Errorf(format, errors.New("x")) }); r == nil {
+		t.Error("expect %w to panic in development")
+	}
+	if lines := decodeLines(t, buf); len(lines) == 0 || lines[0]["level"] != "dpanic" || lines[0]["format"] != format {
+		t.Errorf("expect a dpanic with the format, got %v", lines)
+	}
+}
+
+func BenchmarkInfofNoWrap(b *testing.B) {
+	k := NewNop()
+	for i := 0; i < b.N; i++ {
+		k.Infof("state of %s: %d", "a", i)
+	}
+}